@@ -0,0 +1,124 @@
+package main
+
+// HTTP access logging. Recent requests are kept in memory for /api/logs,
+// and optionally appended to a file as JSON lines.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxAccessEntries is how many requests are kept in memory.
+const maxAccessEntries = 500
+
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	LatencyMS float64   `json:"latency_ms"`
+	Remote    string    `json:"remote"`
+}
+
+// accessLog records HTTP requests. A nil *accessLog records nothing.
+type accessLog struct {
+	mu      sync.Mutex
+	entries []accessEntry // oldest first
+	f       *os.File      // may be nil
+}
+
+// newAccessLog returns an accessLog that also appends to filename, if it is set.
+func newAccessLog(filename string) (*accessLog, error) {
+	al := &accessLog{}
+	if filename != "" {
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening access log: %w", err)
+		}
+		al.f = f
+	}
+	return al, nil
+}
+
+func (al *accessLog) record(e accessEntry) {
+	if al == nil {
+		return
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if len(al.entries) == maxAccessEntries {
+		copy(al.entries, al.entries[1:])
+		al.entries = al.entries[:len(al.entries)-1]
+	}
+	al.entries = append(al.entries, e)
+
+	if al.f != nil {
+		raw, _ := json.Marshal(e)
+		if _, err := al.f.Write(append(raw, '\n')); err != nil {
+			// Don't log every failure, since logging happens on every request.
+			log.Printf("Writing access log: %v; no longer writing to %s", err, al.f.Name())
+			al.f.Close()
+			al.f = nil
+		}
+	}
+}
+
+// Entries returns the recent requests, oldest first.
+func (al *accessLog) Entries() []accessEntry {
+	if al == nil {
+		return nil
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return append([]accessEntry(nil), al.entries...)
+}
+
+// wrap returns a handler that records the requests served by h.
+func (al *accessLog) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		al.record(accessEntry{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Status:    sw.status,
+			Bytes:     sw.n,
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			Remote:    r.RemoteAddr,
+		})
+	})
+}
+
+// statusWriter is an http.ResponseWriter that remembers the status and size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	n      int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(p)
+	sw.n += n
+	return n, err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "access.log")
+	al, err := newAccessLog(filename)
+	if err != nil {
+		t.Fatalf("newAccessLog: %v", err)
+	}
+	s := &server{access: al}
+	h := al.wrap(s)
+
+	req := httptest.NewRequest("POST", "/set-next-photo?x=1", strings.NewReader("photo=cat.jpg"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/logs", nil))
+	var resp struct {
+		Access []accessEntry `json:"access"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Decoding /api/logs: %v", err)
+	}
+	if len(resp.Access) != 2 {
+		t.Fatalf("/api/logs has %d entries, want 2", len(resp.Access))
+	}
+	got := resp.Access[0]
+	if got.Method != "POST" || got.Path != "/set-next-photo?x=1" || got.Status != http.StatusSeeOther || got.Remote != "192.0.2.1:1234" {
+		t.Errorf("First entry = %+v, want a POST to /set-next-photo?x=1 from 192.0.2.1:1234 giving 303", got)
+	}
+	if got := resp.Access[1]; got.Status != http.StatusNotFound || got.Bytes == 0 {
+		t.Errorf("Second entry = %+v, want a 404 with a body", got)
+	}
+
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Reading access log: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(raw)), "\n"); len(lines) != 3 {
+		t.Errorf("Access log file has %d lines, want 3:\n%s", len(lines), raw)
+	}
+}
+
+func TestAccessLogBounded(t *testing.T) {
+	al, _ := newAccessLog("")
+	for i := 0; i < maxAccessEntries+10; i++ {
+		al.record(accessEntry{Status: i})
+	}
+	es := al.Entries()
+	if len(es) != maxAccessEntries || es[0].Status != 10 {
+		t.Errorf("After overflowing, got %d entries starting with %d, want %d starting with 10", len(es), es[0].Status, maxAccessEntries)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+// Syncing an iCloud shared album into the photos dir, so that anyone who can add
+// photos to the album (such as grandparents) can feed the display.
+// This uses the same unauthenticated API as the album's public web page.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AlbumConfig struct {
+	// URL is the public URL of an iCloud shared album,
+	// such as https://www.icloud.com/sharedalbum/#B0aBcDeFgHiJkL.
+	URL string `yaml:"url"`
+
+	// Period is how often to sync the album. It defaults to an hour.
+	Period time.Duration `yaml:"period"`
+
+	// MaxPhotos, if positive, is the most photos to keep from the album, newest first.
+	MaxPhotos int `yaml:"max_photos"`
+
+	// MaxBytes, if positive, is the largest photo to download. Smaller versions
+	// of larger photos are used if there are any.
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+const defaultAlbumPeriod = time.Hour
+
+// albumSyncTimeout bounds each sync, so a stalled download doesn't hold up the next.
+const albumSyncTimeout = 10 * time.Minute
+
+// albumPrefix starts the names of photos synced from the album,
+// so that pruning leaves other photos alone.
+const albumPrefix = "album-"
+
+func (ac AlbumConfig) validate(photosDir string) error {
+	if photosDir == "" {
+		return fmt.Errorf("album needs photos_dir")
+	}
+	if _, err := albumToken(ac.URL); err != nil {
+		return err
+	}
+	if ac.Period < 0 || ac.MaxPhotos < 0 || ac.MaxBytes < 0 {
+		return fmt.Errorf("negative period, max_photos or max_bytes")
+	}
+	return nil
+}
+
+// albumToken returns the token of a shared album from its public URL.
+func albumToken(albumURL string) (string, error) {
+	u, err := url.Parse(albumURL)
+	if err != nil || u.Host != "www.icloud.com" || !strings.HasPrefix(u.Path, "/sharedalbum") {
+		return "", fmt.Errorf("url %q is not an iCloud shared album", albumURL)
+	}
+	token, _, _ := strings.Cut(u.Fragment, ";")
+	if len(token) < 3 {
+		return "", fmt.Errorf("url %q has no album token after #", albumURL)
+	}
+	for _, c := range token[:3] {
+		if !strings.ContainsRune(base62, c) {
+			return "", fmt.Errorf("url %q has a bad album token", albumURL)
+		}
+	}
+	return token, nil
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// albumHost returns the host that normally serves a shared album.
+// The server may redirect to another.
+func albumHost(token string) string {
+	var partition int
+	if token[0] == 'A' {
+		partition = strings.IndexByte(base62, token[1])
+	} else {
+		partition = strings.IndexByte(base62, token[1])*62 + strings.IndexByte(base62, token[2])
+	}
+	return fmt.Sprintf("p%02d-sharedstreams.icloud.com", partition)
+}
+
+// albumPhoto is a photo in a shared album, as listed by the webstream call.
+type albumPhoto struct {
+	GUID        string                     `json:"photoGuid"`
+	Created     string                     `json:"dateCreated"`
+	MediaType   string                     `json:"mediaAssetType"`
+	Derivatives map[string]albumDerivative `json:"derivatives"`
+}
+
+// albumDerivative is one size of a photo. The numbers are strings in the API.
+type albumDerivative struct {
+	Checksum string `json:"checksum"`
+	FileSize string `json:"fileSize"`
+	Width    string `json:"width"`
+	Height   string `json:"height"`
+}
+
+func (ad albumDerivative) size() (width, height int, bytes int64) {
+	width, _ = strconv.Atoi(ad.Width)
+	height, _ = strconv.Atoi(ad.Height)
+	bytes, _ = strconv.ParseInt(ad.FileSize, 10, 64)
+	return
+}
+
+// pickDerivative picks the version of a photo to download: the smallest that
+// covers the panel, or else the largest, of those no bigger than maxBytes (if positive).
+func pickDerivative(ap albumPhoto, panel image.Point, maxBytes int64) (albumDerivative, bool) {
+	var best albumDerivative
+	found, covers := false, false
+	for _, ad := range ap.Derivatives {
+		w, h, n := ad.size()
+		if ad.Checksum == "" || (maxBytes > 0 && n > maxBytes) {
+			continue
+		}
+		c := w >= panel.X && h >= panel.Y
+		bw, bh, _ := best.size()
+		switch {
+		case !found,
+			c && !covers,
+			c && covers && w*h < bw*bh,
+			!c && !covers && w*h > bw*bh:
+			best, found, covers = ad, true, c
+		}
+	}
+	return best, found
+}
+
+// albumSyncer syncs a shared album into a directory.
+type albumSyncer struct {
+	cfg    AlbumConfig
+	dir    string
+	panel  image.Point // size of the panel, to pick a big enough version of each photo
+	client *http.Client
+}
+
+func newAlbumSyncer(cfg AlbumConfig, dir string, panel image.Point) *albumSyncer {
+	if cfg.Period == 0 {
+		cfg.Period = defaultAlbumPeriod
+	}
+	return &albumSyncer{cfg: cfg, dir: dir, panel: panel, client: http.DefaultClient}
+}
+
+// Run syncs the album now and then periodically, until ctx is done.
+func (as *albumSyncer) Run(ctx context.Context) {
+	for {
+		sctx, cancel := context.WithTimeout(ctx, albumSyncTimeout)
+		err := as.Sync(sctx)
+		cancel()
+		if err != nil {
+			log.Printf("Syncing shared album: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(as.cfg.Period):
+		}
+	}
+}
+
+// Sync downloads photos new to the album, and removes those no longer in it.
+func (as *albumSyncer) Sync(ctx context.Context) error {
+	dir, err := expandHome(as.dir)
+	if err != nil {
+		return err
+	}
+	token, err := albumToken(as.cfg.URL)
+	if err != nil {
+		return err
+	}
+	host := albumHost(token)
+
+	var stream struct {
+		Photos []albumPhoto `json:"photos"`
+	}
+	host, err = as.call(ctx, host, token, "webstream", map[string]interface{}{"streamCtag": nil}, &stream)
+	if err != nil {
+		return err
+	}
+	if len(stream.Photos) == 0 {
+		// More likely a bad response than an album emptied on purpose,
+		// so don't delete every photo synced already.
+		return fmt.Errorf("album has no photos; keeping those already synced")
+	}
+
+	// Newest first, so any limit keeps the newest.
+	var photos []albumPhoto
+	for _, ap := range stream.Photos {
+		if ap.MediaType != "video" {
+			photos = append(photos, ap)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool { return photos[i].Created > photos[j].Created })
+	if as.cfg.MaxPhotos > 0 && len(photos) > as.cfg.MaxPhotos {
+		photos = photos[:as.cfg.MaxPhotos]
+	}
+
+	keep := make(map[string]bool)
+	want := make(map[string]string) // checksum => file name
+	var guids []string
+	for _, ap := range photos {
+		name := albumPrefix + ap.GUID + ".jpg"
+		keep[name] = true
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			continue
+		}
+		ad, ok := pickDerivative(ap, as.panel, as.cfg.MaxBytes)
+		if !ok {
+			log.Printf("Shared album photo %s is too large; skipping it", ap.GUID)
+			continue
+		}
+		want[ad.Checksum] = name
+		guids = append(guids, ap.GUID)
+	}
+
+	added := 0
+	if len(guids) > 0 {
+		var assets struct {
+			Items map[string]struct {
+				Location string `json:"url_location"`
+				Path     string `json:"url_path"`
+			} `json:"items"`
+		}
+		if _, err := as.call(ctx, host, token, "webasseturls", map[string]interface{}{"photoGuids": guids}, &assets); err != nil {
+			return err
+		}
+		for checksum, item := range assets.Items {
+			name, ok := want[checksum]
+			if !ok {
+				continue
+			}
+			if err := as.download(ctx, "https://"+item.Location+item.Path, filepath.Join(dir, name)); err != nil {
+				// Try the rest, and this one again next time.
+				log.Printf("Downloading shared album photo %s: %v", name, err)
+				continue
+			}
+			added++
+		}
+	}
+
+	removed := 0
+	existing, err := filepath.Glob(filepath.Join(dir, albumPrefix+"*.jpg"))
+	if err != nil {
+		return fmt.Errorf("globbing photos dir: %w", err)
+	}
+	for _, filename := range existing {
+		if keep[filepath.Base(filename)] {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			log.Printf("Removing photo no longer in shared album: %v", err)
+			continue
+		}
+		removed++
+	}
+	if added > 0 || removed > 0 {
+		log.Printf("Synced shared album: added %d photos, removed %d", added, removed)
+	}
+	return nil
+}
+
+// call makes an API call about the album, following any redirect to another host,
+// and returns the host that answered.
+func (as *albumSyncer) call(ctx context.Context, host, token, method string, args, resp interface{}) (string, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("encoding %s request: %w", method, err)
+	}
+	for redirects := 0; ; redirects++ {
+		u := "https://" + host + "/" + token + "/sharedstreams/" + method
+		req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(raw))
+		if err != nil {
+			return "", fmt.Errorf("internal error: constructing http request: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		hr, err := as.client.Do(req)
+		if err != nil {
+			// Drop the URL from the error, since the token is secret.
+			var ue *url.Error
+			if errors.As(err, &ue) {
+				err = ue.Err
+			}
+			return "", fmt.Errorf("%s: %w", method, err)
+		}
+		body, err := io.ReadAll(hr.Body)
+		hr.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading %s response: %w", method, err)
+		}
+		if hr.StatusCode == 330 && redirects < 2 {
+			// The album is served by another host.
+			var redir struct {
+				Host string `json:"X-Apple-MMe-Host"`
+			}
+			if err := json.Unmarshal(body, &redir); err != nil || redir.Host == "" {
+				return "", fmt.Errorf("%s: bad redirect", method)
+			}
+			host = redir.Host
+			continue
+		}
+		if hr.StatusCode != 200 {
+			return "", fmt.Errorf("%s: non-200 response: %s", method, hr.Status)
+		}
+		if err := json.Unmarshal(body, resp); err != nil {
+			return "", fmt.Errorf("parsing %s response: %w", method, err)
+		}
+		return host, nil
+	}
+}
+
+// download fetches a photo to filename, checking that it is a JPEG.
+func (as *albumSyncer) download(ctx context.Context, u, filename string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	resp, err := as.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("non-200 response: %s", resp.Status)
+	}
+	limit := as.cfg.MaxBytes
+	if limit <= 0 {
+		limit = 64 << 20
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(raw)) > limit {
+		return fmt.Errorf("larger than %d bytes", limit)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(raw)); err != nil || format != "jpeg" {
+		return fmt.Errorf("not a JPEG")
+	}
+	return writeFileAtomic(filename, raw)
+}
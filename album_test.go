@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAlbumToken(t *testing.T) {
+	tests := []struct {
+		url, token, host string
+	}{
+		{"https://www.icloud.com/sharedalbum/#B0aBcDeFgHiJkL", "B0aBcDeFgHiJkL", "p36-sharedstreams.icloud.com"},
+		{"https://www.icloud.com/sharedalbum/en-gb/#A1bCdE;xyz", "A1bCdE", "p01-sharedstreams.icloud.com"},
+		{"https://www.icloud.com/sharedalbum/", "", ""},
+		{"https://photos.google.com/share/abc", "", ""},
+	}
+	for _, test := range tests {
+		token, err := albumToken(test.url)
+		if test.token == "" {
+			if err == nil {
+				t.Errorf("albumToken(%q) = %q, want error", test.url, token)
+			}
+			continue
+		}
+		if err != nil || token != test.token {
+			t.Errorf("albumToken(%q) = %q, %v, want %q", test.url, token, err, test.token)
+			continue
+		}
+		if got := albumHost(token); got != test.host {
+			t.Errorf("albumHost(%q) = %q, want %q", token, got, test.host)
+		}
+	}
+}
+
+func TestPickDerivative(t *testing.T) {
+	ap := albumPhoto{Derivatives: map[string]albumDerivative{
+		"342":  {Checksum: "small", Width: "342", Height: "256", FileSize: "30000"},
+		"1024": {Checksum: "medium", Width: "1024", Height: "768", FileSize: "200000"},
+		"2048": {Checksum: "large", Width: "2048", Height: "1536", FileSize: "900000"},
+	}}
+	tests := []struct {
+		panel    image.Point
+		maxBytes int64
+		want     string
+	}{
+		{image.Pt(800, 480), 0, "medium"},
+		{image.Pt(1600, 1200), 0, "large"},
+		{image.Pt(4000, 3000), 0, "large"},
+		{image.Pt(1600, 1200), 500000, "medium"},
+		{image.Pt(800, 480), 100, ""},
+	}
+	for _, test := range tests {
+		ad, ok := pickDerivative(ap, test.panel, test.maxBytes)
+		if got := ad.Checksum; !ok && got != "" || ok && got != test.want || ok != (test.want != "") {
+			t.Errorf("pickDerivative(%v, %d) = %q, %t, want %q", test.panel, test.maxBytes, got, ok, test.want)
+		}
+	}
+}
+
+func TestAlbumSync(t *testing.T) {
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 4, 3)), nil)
+
+	photo := func(guid, created, typ string) albumPhoto {
+		return albumPhoto{GUID: guid, Created: created, MediaType: typ, Derivatives: map[string]albumDerivative{
+			"1024": {Checksum: "c-" + guid, Width: "1024", Height: "768", FileSize: "1000"},
+		}}
+	}
+	redirected := false
+	photos := []albumPhoto{
+		photo("g3", "2024-06-01T00:00:00Z", "image"),
+		photo("g1", "2024-06-12T00:00:00Z", "image"),
+		photo("v1", "2024-06-13T00:00:00Z", "video"),
+		photo("g2", "2024-06-10T00:00:00Z", "image"),
+	}
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/B0aBcDeFgHiJkL/sharedstreams/webstream", func(w http.ResponseWriter, r *http.Request) {
+		if !redirected {
+			redirected = true
+			w.WriteHeader(330)
+			w.Write([]byte(`{"X-Apple-MMe-Host": "p99-sharedstreams.icloud.com"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"photos": photos})
+	})
+	mux.HandleFunc("/B0aBcDeFgHiJkL/sharedstreams/webasseturls", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			PhotoGUIDs []string `json:"photoGuids"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		requested = append(requested, req.PhotoGUIDs...)
+		items := make(map[string]interface{})
+		for _, guid := range req.PhotoGUIDs {
+			items["c-"+guid] = map[string]string{"url_location": "cvws.icloud-content.com", "url_path": "/photo/" + guid}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	})
+	mux.HandleFunc("/photo/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jpg.Bytes())
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	dir := t.TempDir()
+	for _, name := range []string{"album-old.jpg", "album-g2.jpg", "mine.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("existing"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	as := newAlbumSyncer(AlbumConfig{URL: "https://www.icloud.com/sharedalbum/#B0aBcDeFgHiJkL", MaxPhotos: 2}, dir, image.Pt(800, 480))
+	as.client = &http.Client{Transport: redirectTransport{target}}
+	if err := as.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if want := []string{"g1"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("Requested asset URLs for %q, want %q", requested, want)
+	}
+	synced := func() []string {
+		ents, _ := os.ReadDir(dir)
+		var got []string
+		for _, ent := range ents {
+			got = append(got, ent.Name())
+		}
+		sort.Strings(got)
+		return got
+	}
+	want := []string{"album-g1.jpg", "album-g2.jpg", "mine.jpg"}
+	if got := synced(); !reflect.DeepEqual(got, want) {
+		t.Errorf("After sync, photos dir has %q, want %q", got, want)
+	}
+	if raw, _ := ioutil.ReadFile(filepath.Join(dir, "album-g1.jpg")); !bytes.Equal(raw, jpg.Bytes()) {
+		t.Errorf("Downloaded photo has the wrong content")
+	}
+
+	// An album that comes back empty doesn't remove what was synced.
+	photos = nil
+	if err := as.Sync(context.Background()); err == nil {
+		t.Errorf("Sync of an empty album succeeded, want an error")
+	}
+	if got := synced(); !reflect.DeepEqual(got, want) {
+		t.Errorf("After syncing an empty album, photos dir has %q, want %q", got, want)
+	}
+}
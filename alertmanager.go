@@ -5,25 +5,193 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Alertmanager integration
 
+// AlertmanagerConfig is one of several Alertmanagers to show alerts from.
+type AlertmanagerConfig struct {
+	Addr string `yaml:"addr"` // host:port
+	Name string `yaml:"name"` // shown with each of its alerts, such as "home" or "vps"
+}
+
+// alertmanagers returns all the configured Alertmanagers,
+// including the single unnamed one that the alertmanager field gives.
+func (cfg Config) alertmanagers() []AlertmanagerConfig {
+	var ams []AlertmanagerConfig
+	if cfg.Alertmanager != "" {
+		ams = append(ams, AlertmanagerConfig{Addr: cfg.Alertmanager})
+	}
+	return append(ams, cfg.Alertmanagers...)
+}
+
+func validateAlertmanagers(ams []AlertmanagerConfig) error {
+	names := make(map[string]bool)
+	for i, am := range ams {
+		if am.Addr == "" {
+			return fmt.Errorf("alertmanager %d has no addr", i+1)
+		}
+		if len(ams) > 1 && am.Name == "" {
+			return fmt.Errorf("alertmanager %s needs a name, to tell its alerts apart", am.Addr)
+		}
+		if names[am.Name] {
+			return fmt.Errorf("alertmanager name %q is used more than once", am.Name)
+		}
+		names[am.Name] = true
+	}
+	return nil
+}
+
+// AlertsConfig picks which alerts to show, and how.
+// The number shown is capped by the footer's max_alerts.
+type AlertsConfig struct {
+	// Matchers select the alerts to show. Each is a label matcher as in Prometheus,
+	// such as severity=critical, severity!=info or job=~"node|hass".
+	// An alert must match all of them.
+	Matchers []string `yaml:"matchers"`
+
+	// SkipSuppressed hides alerts that are silenced or inhibited.
+	SkipSuppressed bool `yaml:"skip_suppressed"`
+
+	// RedSeverities, if set, are the values of the severity label whose alerts
+	// are shown in red, and ahead of the rest, which are shown in black.
+	// By default every alert is shown in red.
+	RedSeverities []string `yaml:"red_severities"`
+}
+
+func (ac AlertsConfig) validate() error {
+	for _, m := range ac.Matchers {
+		if _, err := parseAlertMatcher(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alertMatcher is a parsed label matcher.
+type alertMatcher struct {
+	label, op, value string
+	re               *regexp.Regexp // for =~ and !~
+}
+
+func parseAlertMatcher(s string) (alertMatcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return alertMatcher{}, fmt.Errorf("bad label matcher %q", s)
+	}
+	am := alertMatcher{label: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			am.op, rest = op, rest[len(op):]
+			break
+		}
+	}
+	if am.op == "" {
+		return alertMatcher{}, fmt.Errorf("bad label matcher %q", s)
+	}
+	am.value = strings.TrimSpace(rest)
+	if uq, err := strconv.Unquote(am.value); err == nil {
+		am.value = uq
+	}
+	if am.op == "=~" || am.op == "!~" {
+		re, err := regexp.Compile("^(?:" + am.value + ")$")
+		if err != nil {
+			return alertMatcher{}, fmt.Errorf("bad regexp in label matcher %q: %w", s, err)
+		}
+		am.re = re
+	}
+	return am, nil
+}
+
+// Matches reports whether the labels match. A missing label has the empty value.
+func (am alertMatcher) Matches(labels map[string]string) bool {
+	v := labels[am.label]
+	switch am.op {
+	case "=":
+		return v == am.value
+	case "!=":
+		return v != am.value
+	case "=~":
+		return am.re.MatchString(v)
+	case "!~":
+		return !am.re.MatchString(v)
+	}
+	return false
+}
+
 type Alert struct {
 	Fingerprint string // The uniqueness key for the alert.
+	Origin      string // The name of the Alertmanager it came from, if there are several.
 
 	Summary     string
 	Description string
+
+	Muted bool // whether to show it in black, as its severity isn't one of red_severities
 }
 
 // Same reports whether the alert is the same as some other alert.
 // This works off the alert fingerprint instead of its annotations.
-func (a Alert) Same(other Alert) bool { return a.Fingerprint == other.Fingerprint }
+func (a Alert) Same(other Alert) bool {
+	return a.Fingerprint == other.Fingerprint && a.Origin == other.Origin
+}
+
+// alertmanagerStatus is how fetching alerts from an Alertmanager last went.
+type alertmanagerStatus struct {
+	Name, Addr string
+	Err        string    // empty if it worked
+	Alerts     int       // how many alerts it had
+	LastOK     time.Time // when it last worked; zero if it hasn't
+}
+
+// fetchAlerts fetches the alerts from each Alertmanager, merging them.
+// A failing Alertmanager doesn't stop the alerts from others being shown.
+// It reports whether they all worked.
+func (r *refresher) fetchAlerts(ctx context.Context, dd *displayData, ams []AlertmanagerConfig) (ok bool) {
+	ok = true
+	statuses := make([]alertmanagerStatus, len(ams))
+	r.mu.Lock()
+	copy(statuses, r.amStatus)
+	r.mu.Unlock()
+	for i, am := range ams {
+		st := &statuses[i]
+		st.Name, st.Addr = am.Name, am.Addr
+		as, err := FetchAlerts(ctx, am.Addr, r.cfg.Alerts)
+		if err != nil {
+			log.Printf("Fetching alerts from Alertmanager %s: %v", am.Addr, err)
+			st.Err = err.Error()
+			ok = false
+			continue
+		}
+		for i := range as {
+			as[i].Origin = am.Name
+		}
+		dd.alerts = append(dd.alerts, as...)
+		st.Err, st.Alerts, st.LastOK = "", len(as), time.Now()
+	}
+	sortAlerts(dd.alerts)
+	r.mu.Lock()
+	r.amStatus = statuses
+	r.mu.Unlock()
+	return ok
+}
+
+// AlertmanagerStatus returns how fetching alerts from each Alertmanager last went.
+func (r *refresher) AlertmanagerStatus() []alertmanagerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]alertmanagerStatus(nil), r.amStatus...)
+}
 
-func FetchAlerts(ctx context.Context, amAddr string) ([]Alert, error) {
+// FetchAlerts fetches the alerts from an Alertmanager that ac says to show.
+func FetchAlerts(ctx context.Context, amAddr string, ac AlertsConfig) ([]Alert, error) {
 	u := "http://" + amAddr + "/api/v2/alerts" // This gets all active alerts, even silenced/inhibited ones.
 
 	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
@@ -48,36 +216,87 @@ func FetchAlerts(ctx context.Context, amAddr string) ([]Alert, error) {
 		return nil, fmt.Errorf("decoding JSON: %w", err)
 	}
 
+	var matchers []alertMatcher
+	for _, m := range ac.Matchers {
+		am, err := parseAlertMatcher(m)
+		if err != nil {
+			return nil, err // already validated, so shouldn't happen
+		}
+		matchers = append(matchers, am)
+	}
+	red := make(map[string]bool)
+	for _, sev := range ac.RedSeverities {
+		red[sev] = true
+	}
+
 	var alerts []Alert
+Alerts:
 	for _, ga := range gas {
+		if ac.SkipSuppressed && ga.Silenced() {
+			continue
+		}
+		for _, am := range matchers {
+			if !am.Matches(ga.Labels) {
+				continue Alerts
+			}
+		}
 		alerts = append(alerts, Alert{
 			Fingerprint: ga.Fingerprint,
 			Summary:     cleanString(ga.Annotations["summary"]),
 			Description: cleanString(ga.Annotations["description"]),
+			Muted:       len(red) > 0 && !red[ga.Labels["severity"]],
 		})
 	}
 
-	// Sort the alerts to try to get some vaguely canonical ordering.
-	// Alertmanager itself sorts by the fingerprint, which isn't useful for us.
-	sort.Slice(alerts, func(i, j int) bool {
+	sortAlerts(alerts)
+	return alerts, nil
+}
+
+// sortAlerts sorts alerts to try to get some vaguely canonical ordering.
+// Alertmanager itself sorts by the fingerprint, which isn't useful for us.
+func sortAlerts(alerts []Alert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
 		ai, aj := alerts[i], alerts[j]
+		if ai.Muted != aj.Muted {
+			// Red alerts first, so they are shown if not all fit.
+			return !ai.Muted
+		}
+		if ai.Origin != aj.Origin {
+			return ai.Origin < aj.Origin
+		}
 		if ai.Summary != aj.Summary {
 			return ai.Summary < aj.Summary
 		}
 		return ai.Description < aj.Description
 	})
-
-	return alerts, nil
 }
 
-func cleanString(s string) string {
-	s = strings.TrimSpace(s)
+// alertLine is a single rendered line of alerts.
+type alertLine struct {
+	Origin      string
+	Summary     string
+	Description string
+	Count       int  // number of alerts that this line represents
+	Muted       bool // whether to show it in black
+}
 
-	// Our chosen font doesn't support a lot of glyphs.
-	s = strings.Replace(s, "℃", "°C", -1)
-	s = strings.Replace(s, "CO₂", "CO2", -1)
+// collapseAlerts merges alerts that would render identically.
+// The alerts should be sorted, as sortAlerts does.
+func collapseAlerts(alerts []Alert) []alertLine {
+	var lines []alertLine
+	for _, a := range alerts {
+		if n := len(lines); n > 0 && lines[n-1].Origin == a.Origin && lines[n-1].Summary == a.Summary && lines[n-1].Description == a.Description && lines[n-1].Muted == a.Muted {
+			lines[n-1].Count++
+			continue
+		}
+		lines = append(lines, alertLine{Origin: a.Origin, Summary: a.Summary, Description: a.Description, Count: 1, Muted: a.Muted})
+	}
+	return lines
+}
 
-	return s
+func cleanString(s string) string {
+	// Glyphs that the fonts lack are substituted when drawing; see glyphsubst.go.
+	return strings.TrimSpace(s)
 }
 
 // This is a subset of github.com/prometheus/alertmanager/api/v2/models.GettableAlerts,
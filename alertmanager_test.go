@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollapseAlerts(t *testing.T) {
+	alerts := []Alert{
+		{Fingerprint: "1", Summary: "Disk full", Description: "/data"},
+		{Fingerprint: "2", Summary: "Disk full", Description: "/data"},
+		{Fingerprint: "3", Summary: "Disk full", Description: "/home"},
+		{Fingerprint: "4", Summary: "Too hot", Description: "Kitchen"},
+		{Fingerprint: "5", Summary: "Too hot", Description: "Kitchen"},
+		{Fingerprint: "6", Summary: "Too hot", Description: "Kitchen"},
+	}
+	got := collapseAlerts(alerts)
+	want := []alertLine{
+		{"", "Disk full", "/data", 2, false},
+		{"", "Disk full", "/home", 1, false},
+		{"", "Too hot", "Kitchen", 3, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collapseAlerts = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollapseAlertsFromSeveral(t *testing.T) {
+	alerts := []Alert{
+		{Fingerprint: "1", Origin: "vps", Summary: "Disk full", Description: "/data"},
+		{Fingerprint: "1", Origin: "home", Summary: "Disk full", Description: "/data"},
+	}
+	sortAlerts(alerts)
+	got := collapseAlerts(alerts)
+	want := []alertLine{
+		{"home", "Disk full", "/data", 1, false},
+		{"vps", "Disk full", "/data", 1, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collapseAlerts = %+v, want %+v", got, want)
+	}
+	if alerts[0].Same(alerts[1]) {
+		t.Errorf("Alerts with the same fingerprint from different Alertmanagers are the Same")
+	}
+}
+
+func TestValidateAlertmanagers(t *testing.T) {
+	for _, test := range []struct {
+		ams []AlertmanagerConfig
+		ok  bool
+	}{
+		{nil, true},
+		{[]AlertmanagerConfig{{Addr: "localhost:9093"}}, true},
+		{[]AlertmanagerConfig{{Addr: "localhost:9093", Name: "home"}, {Addr: "vps:9093", Name: "vps"}}, true},
+		{[]AlertmanagerConfig{{Addr: "localhost:9093"}, {Addr: "vps:9093", Name: "vps"}}, false},
+		{[]AlertmanagerConfig{{Addr: "localhost:9093", Name: "a"}, {Addr: "vps:9093", Name: "a"}}, false},
+		{[]AlertmanagerConfig{{Name: "home"}}, false},
+	} {
+		err := validateAlertmanagers(test.ams)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validateAlertmanagers(%+v) = %v, want ok=%t", test.ams, err, test.ok)
+		}
+	}
+}
+
+func TestFetchAlertsFromSeveral(t *testing.T) {
+	home := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"fingerprint": "f1", "annotations": {"summary": "Too hot", "description": "Kitchen"}}]`))
+	}))
+	defer home.Close()
+	vps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", 500)
+	}))
+	defer vps.Close()
+
+	ams := []AlertmanagerConfig{
+		{Addr: strings.TrimPrefix(vps.URL, "http://"), Name: "vps"},
+		{Addr: strings.TrimPrefix(home.URL, "http://"), Name: "home"},
+	}
+	r := &refresher{}
+	var dd displayData
+	if r.fetchAlerts(context.Background(), &dd, ams) {
+		t.Errorf("fetchAlerts reported success with a failing Alertmanager")
+	}
+	want := []Alert{{Fingerprint: "f1", Origin: "home", Summary: "Too hot", Description: "Kitchen"}}
+	if !reflect.DeepEqual(dd.alerts, want) {
+		t.Errorf("Alerts = %+v, want %+v", dd.alerts, want)
+	}
+	st := r.AlertmanagerStatus()
+	if len(st) != 2 || st[0].Err == "" || st[1].Err != "" || st[1].Alerts != 1 || st[1].LastOK.IsZero() {
+		t.Errorf("AlertmanagerStatus = %+v, want vps failing and home OK with one alert", st)
+	}
+}
+
+func TestFetchAlertsFiltered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"fingerprint": "1", "annotations": {"summary": "Disk full"}, "labels": {"severity": "warning", "job": "node"}, "status": {"state": "active"}},
+			{"fingerprint": "2", "annotations": {"summary": "Down"}, "labels": {"severity": "critical", "job": "node"}, "status": {"state": "active"}},
+			{"fingerprint": "3", "annotations": {"summary": "Silenced"}, "labels": {"severity": "critical", "job": "node"}, "status": {"state": "suppressed"}},
+			{"fingerprint": "4", "annotations": {"summary": "Chatty"}, "labels": {"severity": "info", "job": "node"}, "status": {"state": "active"}},
+			{"fingerprint": "5", "annotations": {"summary": "Other job"}, "labels": {"severity": "critical", "job": "hass"}, "status": {"state": "active"}}
+		]`))
+	}))
+	defer srv.Close()
+
+	ac := AlertsConfig{
+		Matchers:       []string{"severity!=info", `job=~"node|prom"`},
+		SkipSuppressed: true,
+		RedSeverities:  []string{"critical"},
+	}
+	if err := ac.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	got, err := FetchAlerts(context.Background(), strings.TrimPrefix(srv.URL, "http://"), ac)
+	if err != nil {
+		t.Fatalf("FetchAlerts: %v", err)
+	}
+	want := []Alert{
+		{Fingerprint: "2", Summary: "Down"},
+		{Fingerprint: "1", Summary: "Disk full", Muted: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchAlerts = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseAlertMatcher(t *testing.T) {
+	labels := map[string]string{"severity": "critical"}
+	for _, test := range []struct {
+		m     string
+		match bool
+	}{
+		{"severity=critical", true},
+		{`severity="critical"`, true},
+		{"severity!=critical", false},
+		{"severity=~crit.*", true},
+		{"severity!~crit", true},
+		{"job=", true},
+	} {
+		am, err := parseAlertMatcher(test.m)
+		if err != nil {
+			t.Errorf("parseAlertMatcher(%q): %v", test.m, err)
+			continue
+		}
+		if got := am.Matches(labels); got != test.match {
+			t.Errorf("%q matching %v = %t, want %t", test.m, labels, got, test.match)
+		}
+	}
+	for _, bad := range []string{"severity", "=critical", "job=~(", "severity~critical"} {
+		if _, err := parseAlertMatcher(bad); err == nil {
+			t.Errorf("parseAlertMatcher(%q) didn't fail", bad)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+// Panel burn-in and alignment diagnostics.
+//
+// This cycles through a fixed set of patterns, holding each for a while so it can be
+// inspected. There's no way to read back what the panel is actually showing, so
+// ghosting has to be judged by eye: the high-contrast patterns are followed by a
+// full white flush, and any residue of them is ghosting.
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"time"
+)
+
+type burnTestStep struct {
+	name string
+	draw func(dst draw.Image)
+}
+
+func burnTestSteps(r renderer) []burnTestStep {
+	white := func(dst draw.Image) {} // the panel is cleared to white before each step
+	fill := func(c color.Color) func(draw.Image) {
+		return func(dst draw.Image) {
+			draw.Draw(dst, dst.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+	grid := func(shift int) func(draw.Image) {
+		return func(dst draw.Image) { drawAlignmentGrid(r, dst, shift) }
+	}
+	checks := func(size int, c color.Color) func(draw.Image) {
+		return func(dst draw.Image) { drawCheckerboard(dst, size, c) }
+	}
+	return []burnTestStep{
+		{"white flush (baseline)", white},
+		{"alignment grid", grid(0)},
+		{"alignment grid, shifted 1px", grid(1)},
+		{"alignment grid, shifted 2px", grid(2)},
+		{"alignment grid, shifted 3px", grid(3)},
+		{"fine black checkerboard", checks(4, color.Black)},
+		{"coarse black checkerboard", checks(40, color.Black)},
+		{"coarse red checkerboard", checks(40, colorRed)},
+		{"white flush (inspect for checkerboard ghosting)", white},
+		{"solid black", fill(color.Black)},
+		{"solid red", fill(colorRed)},
+		{"white flush (inspect for solid ghosting)", white},
+	}
+}
+
+// runBurnTest runs each burn test step on the paper, holding each for the given duration.
+func runBurnTest(ctx context.Context, r renderer, p panelDriver, hold time.Duration) error {
+	if t := p.LastWhiteFlush(); t.IsZero() {
+		log.Printf("Burn test: no full white flush since startup")
+	} else {
+		log.Printf("Burn test: last full white flush was %v ago", time.Since(t).Truncate(time.Second))
+	}
+
+	steps := burnTestSteps(r)
+	for i, step := range steps {
+		log.Printf("Burn test step %d/%d: %s", i+1, len(steps), step.name)
+		if err := p.Init(); err != nil {
+			return fmt.Errorf("initialising panel: %w", err)
+		}
+		step.draw(p)
+		if err := p.DisplayRefresh(); err != nil {
+			return err
+		}
+		p.Sleep()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hold):
+		}
+	}
+	log.Printf("Burn test complete")
+	return nil
+}
+
+// drawAlignmentGrid draws a grid of lines every 10px, with heavier lines every 50px
+// and red lines every 100px, all offset by shift pixels. The red lines are labelled
+// with their coordinates.
+func drawAlignmentGrid(r renderer, dst draw.Image, shift int) {
+	b := dst.Bounds()
+	colFor := func(v int) (color.Color, bool) {
+		switch {
+		case v%100 == 0:
+			return colorRed, true
+		case v%50 == 0:
+			return color.Black, true
+		case v%10 == 0:
+			return color.Black, false
+		}
+		return nil, false
+	}
+	for x := b.Min.X; x < b.Max.X; x++ {
+		c, heavy := colFor(x - b.Min.X - shift)
+		if c == nil {
+			continue
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if heavy || y%2 == 0 {
+				dst.Set(x, y, c)
+			}
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		c, heavy := colFor(y - b.Min.Y - shift)
+		if c == nil {
+			continue
+		}
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if heavy || x%2 == 0 {
+				dst.Set(x, y, c)
+			}
+		}
+	}
+
+	// Label the intersections of the red lines.
+	for y := b.Min.Y + shift + 100; y < b.Max.Y; y += 100 {
+		for x := b.Min.X + shift; x < b.Max.X-50; x += 100 {
+			r.writeText(dst, image.Pt(x+2, y-2), bottomLeft, color.Black, r.tiny, fmt.Sprintf("%d,%d", x, y))
+		}
+	}
+}
+
+// drawCheckerboard draws a checkerboard of the given square size and colour.
+func drawCheckerboard(dst draw.Image, size int, c color.Color) {
+	b := dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if ((x-b.Min.X)/size+(y-b.Min.Y)/size)%2 == 0 {
+				dst.Set(x, y, c)
+			}
+		}
+	}
+}
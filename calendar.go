@@ -0,0 +1,658 @@
+package main
+
+// Calendar integration, showing today's events from ICS (iCalendar) feeds,
+// such as a Google Calendar's secret address in iCal format or a Nextcloud subscription link.
+//
+// Only the parts of RFC 5545 that such feeds commonly use are understood.
+// Recurring events may repeat daily, weekly (on particular days), monthly (on the same
+// day of the month) or yearly, with an interval, an end, exceptions, and changed instances.
+// Events with other recurrence rules are shown on their first day only.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+type CalendarConfig struct {
+	URL    string `yaml:"url"`    // of the ICS feed; webcal:// works too
+	Name   string `yaml:"name"`   // for logs, since the URL may be secret; defaults to the URL's host
+	Colour string `yaml:"colour"` // for event titles: "black" (the default) or "red"
+
+	// Interval, if positive, is how often to fetch it. By default it is fetched at every refresh.
+	// It must be less than 6h, after which the events of a calendar that fails to be fetched are dropped.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// calendarMaxAge is how long to keep showing a calendar's events when fetching it fails.
+const calendarMaxAge = 6 * time.Hour
+
+func (cc CalendarConfig) validate() error {
+	u, err := url.Parse(cc.URL)
+	if err != nil {
+		// Don't include the URL, which may be secret.
+		return fmt.Errorf("bad url")
+	}
+	switch u.Scheme {
+	case "http", "https", "webcal":
+	default:
+		return fmt.Errorf("url must be http, https or webcal, not %q", u.Scheme)
+	}
+	switch cc.Colour {
+	case "", "black", "red":
+	default:
+		return fmt.Errorf("unknown colour %q (want black or red)", cc.Colour)
+	}
+	if cc.Interval < 0 || cc.Interval >= calendarMaxAge {
+		return fmt.Errorf("interval must be between 0 and %v", calendarMaxAge)
+	}
+	return nil
+}
+
+func (cc CalendarConfig) name() string {
+	if cc.Name != "" {
+		return cc.Name
+	}
+	if u, err := url.Parse(cc.URL); err == nil {
+		return u.Host
+	}
+	return "calendar"
+}
+
+// calendarEvent is an event to show today.
+type calendarEvent struct {
+	Time   time.Time // zero for all-day events, and those that started before today
+	Title  string
+	Colour string // of its calendar: "black" or "red"
+}
+
+func (ce calendarEvent) Same(o calendarEvent) bool {
+	return ce.Time.Equal(o.Time) && ce.Title == o.Title && ce.Colour == o.Colour
+}
+
+// sortEvents sorts all-day events first, then the rest by time.
+func sortEvents(events []calendarEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		ei, ej := events[i], events[j]
+		if !ei.Time.Equal(ej.Time) {
+			return ei.Time.Before(ej.Time)
+		}
+		return ei.Title < ej.Title
+	})
+}
+
+// fetchCalendar fetches the events in an ICS feed.
+func fetchCalendar(ctx context.Context, cc CalendarConfig) ([]icsEvent, error) {
+	u := cc.URL
+	if rest, ok := strings.CutPrefix(u, "webcal://"); ok {
+		u = "https://" + rest
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Drop the URL from the error, since it may be secret.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, fmt.Errorf("HTTP GET: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("non-200 response: %s", resp.Status)
+	}
+	return parseICS(resp.Body)
+}
+
+// icsEvent is a VEVENT from an ICS feed.
+type icsEvent struct {
+	UID        string
+	Summary    string
+	Start, End time.Time
+	AllDay     bool
+
+	RRule        *rrule      // nil if the event doesn't recur
+	ExDates      []time.Time // instances of a recurring event that are cancelled
+	RecurrenceID time.Time   // for a changed instance, the start of the instance it replaces
+}
+
+// parseICS parses the events in an ICS feed, skipping any that are cancelled or can't be understood.
+func parseICS(r io.Reader) ([]icsEvent, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || strings.TrimPrefix(lines[0], "\ufeff") != "BEGIN:VCALENDAR" {
+		return nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	var (
+		events    []icsEvent
+		ev        *icsEvent
+		nested    int // depth of components within the event, such as alarms
+		cancelled bool
+		hasEnd    bool
+		dur       time.Duration
+		bad       error // the first problem with the event
+	)
+	for _, line := range lines {
+		name, params, value, ok := splitICSLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && value == "VEVENT" && ev == nil:
+			ev = &icsEvent{}
+			nested, cancelled, hasEnd, dur, bad = 0, false, false, 0, nil
+			continue
+		case ev == nil:
+			continue
+		case name == "BEGIN":
+			nested++
+			continue
+		case name == "END" && nested > 0:
+			nested--
+			continue
+		case nested > 0:
+			continue
+		case name == "END":
+			if ev.Start.IsZero() && bad == nil {
+				bad = fmt.Errorf("no DTSTART")
+			}
+			if bad != nil {
+				log.Printf("Skipping calendar event %q: %v", ev.Summary, bad)
+			} else if !cancelled {
+				if !hasEnd {
+					ev.End = ev.Start.Add(dur)
+					if ev.AllDay && dur == 0 {
+						ev.End = ev.Start.AddDate(0, 0, 1)
+					}
+				}
+				events = append(events, *ev)
+			}
+			ev = nil
+			continue
+		}
+
+		var err error
+		switch name {
+		case "UID":
+			ev.UID = value
+		case "SUMMARY":
+			ev.Summary = cleanString(unescapeICSText(value))
+		case "STATUS":
+			cancelled = value == "CANCELLED"
+		case "DTSTART":
+			ev.Start, ev.AllDay, err = parseICSTime(params, value)
+		case "DTEND":
+			ev.End, _, err = parseICSTime(params, value)
+			hasEnd = true
+		case "DURATION":
+			dur, err = parseICSDuration(value)
+		case "RRULE":
+			ev.RRule, err = parseRRule(value)
+			if err != nil {
+				log.Printf("Showing recurring calendar event %q once: %v", ev.Summary, err)
+				ev.RRule, err = nil, nil
+			}
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				var t time.Time
+				if t, _, err = parseICSTime(params, v); err != nil {
+					break
+				}
+				ev.ExDates = append(ev.ExDates, t)
+			}
+		case "RECURRENCE-ID":
+			ev.RecurrenceID, _, err = parseICSTime(params, value)
+		}
+		if err != nil && bad == nil {
+			bad = fmt.Errorf("bad %s: %w", name, err)
+		}
+	}
+	return events, nil
+}
+
+// unfoldICS reads the lines of an ICS feed, joining those that were folded.
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading ICS: %w", err)
+	}
+	return lines, nil
+}
+
+// splitICSLine splits a content line such as
+//
+//	DTSTART;TZID=Europe/London:20240603T090000
+//
+// into its name, parameters and value.
+func splitICSLine(line string) (name string, params map[string]string, value string, ok bool) {
+	// The value starts after the first colon that isn't in a quoted parameter value.
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	fields := strings.Split(line[:colon], ";")
+	params = make(map[string]string)
+	for _, p := range fields[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(fields[0]), params, line[colon+1:], true
+}
+
+func unescapeICSText(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Dates are midnight local time.
+func parseICSTime(params map[string]string, value string) (t time.Time, allDay bool, err error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err = time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		// Some calendars use names Go doesn't know, such as Windows ones.
+		// Local time is the best guess then, since it's probably a local event.
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseICSDuration parses a DURATION value, such as PT1H30M or P1D.
+func parseICSDuration(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		s, sign = rest, -1
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	s, ok := strings.CutPrefix(s, "P")
+	if !ok || s == "" {
+		return 0, fmt.Errorf("bad duration %q", orig)
+	}
+	var d time.Duration
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("bad duration %q", orig)
+		}
+		n, _ := strconv.Atoi(s[:i])
+		var unit time.Duration
+		switch u := s[i]; {
+		case !inTime && u == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && u == 'D':
+			unit = 24 * time.Hour
+		case inTime && u == 'H':
+			unit = time.Hour
+		case inTime && u == 'M':
+			unit = time.Minute
+		case inTime && u == 'S':
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("bad duration %q", orig)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * d, nil
+}
+
+// rrule is the supported subset of a recurrence rule.
+type rrule struct {
+	Freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval int
+	Until    time.Time // zero for no end
+	Count    int       // 0 for no limit
+	ByDay    []time.Weekday
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(s string) (*rrule, error) {
+	rr := &rrule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			rr.Freq = v
+		case "INTERVAL":
+			rr.Interval, err = strconv.Atoi(v)
+			if err == nil && rr.Interval < 1 {
+				err = fmt.Errorf("bad INTERVAL %d", rr.Interval)
+			}
+		case "UNTIL":
+			rr.Until, _, err = parseICSTime(nil, v)
+		case "COUNT":
+			rr.Count, err = strconv.Atoi(v)
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				wd, ok := icsWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", day)
+				}
+				rr.ByDay = append(rr.ByDay, wd)
+			}
+		case "WKST":
+			// Only matters for weekly rules with an interval, and is nearly always MO, as assumed.
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad %s: %w", k, err)
+		}
+	}
+	switch rr.Freq {
+	case "DAILY", "WEEKLY":
+	case "MONTHLY", "YEARLY":
+		if len(rr.ByDay) > 0 {
+			return nil, fmt.Errorf("unsupported BYDAY for FREQ=%s", rr.Freq)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rr.Freq)
+	}
+	return rr, nil
+}
+
+// onDate reports whether the rule, for an event first starting at dtstart,
+// has an instance starting on the given date, ignoring UNTIL and COUNT.
+func (rr *rrule) onDate(dtstart time.Time, y int, m time.Month, d int) bool {
+	sy, sm, sd := dtstart.Date()
+	first := time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if date.Before(first) {
+		return false
+	}
+	hasDay := func(days []time.Weekday) bool {
+		for _, wd := range days {
+			if wd == date.Weekday() {
+				return true
+			}
+		}
+		return false
+	}
+	days := int(date.Sub(first).Hours() / 24)
+	switch rr.Freq {
+	case "DAILY":
+		return days%rr.Interval == 0 && (len(rr.ByDay) == 0 || hasDay(rr.ByDay))
+	case "WEEKLY":
+		// Weeks start on Monday.
+		monday := first.AddDate(0, 0, -int((first.Weekday()+6)%7))
+		weeks := int(date.Sub(monday).Hours()/24) / 7
+		byDay := rr.ByDay
+		if len(byDay) == 0 {
+			byDay = []time.Weekday{first.Weekday()}
+		}
+		return weeks%rr.Interval == 0 && hasDay(byDay)
+	case "MONTHLY":
+		months := (y-sy)*12 + int(m-sm)
+		return d == sd && months%rr.Interval == 0
+	case "YEARLY":
+		return m == sm && d == sd && (y-sy)%rr.Interval == 0
+	}
+	return false
+}
+
+// end returns when the instance of the event starting at start ends.
+func (ev icsEvent) end(start time.Time) time.Time {
+	if ev.AllDay {
+		// Whole days, which aren't always 24 hours long.
+		days := int((ev.End.Sub(ev.Start).Hours() + 12) / 24)
+		return start.AddDate(0, 0, days)
+	}
+	return start.Add(ev.End.Sub(ev.Start))
+}
+
+// instances returns the starts of the event's instances that overlap [from, to).
+func (ev icsEvent) instances(from, to time.Time) []time.Time {
+	overlaps := func(start time.Time) bool {
+		end := ev.end(start)
+		if !end.After(start) {
+			return !start.Before(from) && start.Before(to)
+		}
+		return start.Before(to) && end.After(from)
+	}
+	if ev.RRule == nil {
+		if overlaps(ev.Start) {
+			return []time.Time{ev.Start}
+		}
+		return nil
+	}
+
+	loc := ev.Start.Location()
+	hour, min, sec := ev.Start.Clock()
+	excluded := func(start time.Time) bool {
+		for _, ex := range ev.ExDates {
+			if ex.Equal(start) {
+				return true
+			}
+			if ev.AllDay && sameDate(ex, start) {
+				return true
+			}
+		}
+		return false
+	}
+	// count returns the number of instances up to and including the given date.
+	count := func(last time.Time) int {
+		n := 0
+		for d := ev.Start; !d.After(last) && n <= ev.RRule.Count; d = d.AddDate(0, 0, 1) {
+			if y, m, dd := d.Date(); ev.RRule.onDate(ev.Start, y, m, dd) {
+				n++
+			}
+		}
+		return n
+	}
+
+	var starts []time.Time
+	// An instance overlapping [from, to) starts no earlier than its length before from.
+	lookback := int(ev.End.Sub(ev.Start).Hours()/24) + 1
+	sy, sm, sd := from.In(loc).AddDate(0, 0, -lookback).Date()
+	for d := time.Date(sy, sm, sd, 0, 0, 0, 0, loc); d.Before(to); d = d.AddDate(0, 0, 1) {
+		y, m, dd := d.Date()
+		if !ev.RRule.onDate(ev.Start, y, m, dd) {
+			continue
+		}
+		start := time.Date(y, m, dd, hour, min, sec, 0, loc)
+		if !overlaps(start) || excluded(start) {
+			continue
+		}
+		if !ev.RRule.Until.IsZero() && start.After(ev.RRule.Until) {
+			continue
+		}
+		if ev.RRule.Count > 0 && count(start) > ev.RRule.Count {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// eventsOn returns the events to show on the given day, which should be midnight local time.
+func eventsOn(events []icsEvent, day time.Time, colour string) []calendarEvent {
+	if colour == "" {
+		colour = "black"
+	}
+	// Changed instances of recurring events replace the originals.
+	type instance struct {
+		uid   string
+		start int64
+	}
+	changed := make(map[instance]bool)
+	for _, ev := range events {
+		if !ev.RecurrenceID.IsZero() {
+			changed[instance{ev.UID, ev.RecurrenceID.Unix()}] = true
+		}
+	}
+
+	var out []calendarEvent
+	for _, ev := range events {
+		for _, start := range ev.instances(day, day.AddDate(0, 0, 1)) {
+			if ev.RRule != nil && changed[instance{ev.UID, start.Unix()}] {
+				continue
+			}
+			ce := calendarEvent{Title: ev.Summary, Colour: colour}
+			if !ev.AllDay && !start.Before(day) {
+				ce.Time = start
+			}
+			out = append(out, ce)
+		}
+	}
+	return out
+}
+
+// calendarFeed is the last events fetched from a calendar.
+type calendarFeed struct {
+	events []icsEvent
+	at     time.Time // when they were fetched; zero if they never have been
+}
+
+// fetchEvents fetches the calendars that are due, and adds today's events from each to dd.
+// A calendar that fails to be fetched keeps showing its last events for up to calendarMaxAge.
+// It reports whether all the calendars could be fetched.
+func (r *refresher) fetchEvents(ctx context.Context, dd *displayData, now time.Time) (ok bool) {
+	ok = true
+	if len(r.calendars) != len(r.cfg.Calendars) {
+		r.calendars = make([]calendarFeed, len(r.cfg.Calendars))
+	}
+	for i, cc := range r.cfg.Calendars {
+		feed := &r.calendars[i]
+		if feed.at.IsZero() || cc.Interval <= 0 || now.Sub(feed.at) >= cc.Interval {
+			evs, err := fetchCalendar(ctx, cc)
+			if err != nil {
+				log.Printf("Fetching calendar %s: %v", cc.name(), err)
+				ok = false
+			} else {
+				feed.events, feed.at = evs, now
+			}
+		}
+		if feed.at.IsZero() || now.Sub(feed.at) >= calendarMaxAge {
+			continue
+		}
+		dd.events = append(dd.events, eventsOn(feed.events, dd.today, cc.Colour)...)
+	}
+	sortEvents(dd.events)
+	return ok
+}
+
+// planCalendar plans a strip of today's events, as many as fit across the panel.
+func (r renderer) planCalendar(f *frame, room image.Rectangle) (int, func(top int)) {
+	events := f.data.events
+	if len(events) == 0 {
+		return 0, nil
+	}
+	timeStyle := f.timeStyle
+	face := f.projectFace
+	const gap = 16 // pixels between events
+	avail := f.dst.Bounds().Dx() - 20
+
+	// Work out the text of each event, and how many fit.
+	type piece struct {
+		when, title string
+		col         color.Color
+	}
+	pieces := make([]piece, len(events))
+	for i, ev := range events {
+		p := piece{title: truncateText(face, r.substitute(ev.Title), avail/3), col: color.Color(color.Black)}
+		if !ev.Time.IsZero() {
+			p.when = r.formatTime(ev.Time, f.data.now, timeStyle) + " "
+		}
+		if ev.Colour == "red" {
+			p.col = f.accentCol
+		}
+		pieces[i] = p
+	}
+	more := func(n int) string { return fmt.Sprintf("+%d more", n) }
+	shown, width := 0, 0
+	for i, p := range pieces {
+		w := font.MeasureString(face, p.when+p.title).Ceil()
+		if i > 0 {
+			w += gap
+		}
+		need := width + w
+		if i < len(pieces)-1 {
+			// Leave room to say how many more there are.
+			need += gap + font.MeasureString(face, more(len(pieces)-i-1)).Ceil()
+		}
+		if need > avail {
+			break
+		}
+		shown, width = i+1, width+w
+	}
+
+	height := face.Metrics().Height.Ceil() + 4
+	return height, func(top int) {
+		baseline := image.Pt(10, top+height-2-face.Metrics().Descent.Ceil())
+		for _, p := range pieces[:shown] {
+			if p.when != "" {
+				baseline.X = r.writeText(f.dst, baseline, bottomLeft, color.Black, face, p.when).X
+			}
+			baseline.X = r.writeText(f.dst, baseline, bottomLeft, p.col, face, p.title).X + gap
+		}
+		if shown < len(pieces) {
+			r.writeText(f.dst, baseline, bottomLeft, f.accentCol, face, more(len(pieces)-shown))
+		}
+	}
+}
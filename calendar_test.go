@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:dentist\r\n" +
+	"DTSTART;TZID=Australia/Sydney:20240603T093000\r\n" +
+	"DTEND;TZID=Australia/Sydney:20240603T103000\r\n" +
+	"SUMMARY:Dentist\\, then\r\n" +
+	"  shopping\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"SUMMARY:Alarm\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday\r\n" +
+	"DTSTART;VALUE=DATE:20240603\r\n" +
+	"SUMMARY:King's Birthday\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:swim\r\n" +
+	"DTSTART;TZID=Australia/Sydney:20240506T160000\r\n" +
+	"DURATION:PT45M\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE\r\n" +
+	"EXDATE;TZID=Australia/Sydney:20240610T160000\r\n" +
+	"SUMMARY:Swimming\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:swim\r\n" +
+	"RECURRENCE-ID;TZID=Australia/Sydney:20240605T160000\r\n" +
+	"DTSTART;TZID=Australia/Sydney:20240605T170000\r\n" +
+	"DURATION:PT45M\r\n" +
+	"SUMMARY:Swimming (late)\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled\r\n" +
+	"DTSTART;TZID=Australia/Sydney:20240603T120000\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"SUMMARY:Lunch\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	events, err := parseICS(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatalf("parseICS: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("parseICS returned %d events, want 4: %+v", len(events), events)
+	}
+	dentist := events[0]
+	if want := "Dentist, then shopping"; dentist.Summary != want {
+		t.Errorf("Summary = %q, want %q", dentist.Summary, want)
+	}
+	if got, want := dentist.End.Sub(dentist.Start), time.Hour; got != want {
+		t.Errorf("Dentist lasts %v, want %v", got, want)
+	}
+	if loc := dentist.Start.Location().String(); loc != "Australia/Sydney" {
+		t.Errorf("Dentist is in %s, want Australia/Sydney", loc)
+	}
+	if holiday := events[1]; !holiday.AllDay || holiday.End.Sub(holiday.Start) != 24*time.Hour {
+		t.Errorf("Holiday = %+v, want a whole day", holiday)
+	}
+
+	if _, err := parseICS(strings.NewReader("<html>Sign in</html>")); err == nil {
+		t.Errorf("parseICS of HTML succeeded")
+	}
+}
+
+func TestEventsOn(t *testing.T) {
+	syd, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	// Dates, such as for all-day events, are in local time.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = syd
+	events, err := parseICS(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatalf("parseICS: %v", err)
+	}
+	titles := func(day time.Time) string {
+		var ts []string
+		evs := eventsOn(events, day, "")
+		sortEvents(evs)
+		for _, ev := range evs {
+			s := ev.Title
+			if !ev.Time.IsZero() {
+				s = ev.Time.In(syd).Format("15:04 ") + s
+			}
+			ts = append(ts, s)
+		}
+		return strings.Join(ts, "; ")
+	}
+	for _, test := range []struct {
+		day  string
+		want string
+	}{
+		{"2024-06-03", "King's Birthday; 09:30 Dentist, then shopping; 16:00 Swimming"},
+		{"2024-06-04", ""},
+		{"2024-06-05", "17:00 Swimming (late)"}, // changed instance
+		{"2024-06-10", ""},                      // excluded
+		{"2024-06-12", "16:00 Swimming"},
+		{"2024-05-01", ""}, // before it started
+	} {
+		day, _ := time.ParseInLocation("2006-01-02", test.day, time.Local)
+		if got := titles(day); got != test.want {
+			t.Errorf("Events on %s = %q, want %q", test.day, got, test.want)
+		}
+	}
+}
+
+func TestRRule(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 8, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		rule string
+		on   []string
+		off  []string
+	}{
+		{"FREQ=DAILY;INTERVAL=2", []string{"2024-01-31", "2024-02-02"}, []string{"2024-02-01", "2024-01-29"}},
+		{"FREQ=DAILY;COUNT=3", []string{"2024-02-02"}, []string{"2024-02-03"}},
+		{"FREQ=DAILY;UNTIL=20240202T000000Z", []string{"2024-02-01"}, []string{"2024-02-02"}},
+		{"FREQ=WEEKLY;INTERVAL=2", []string{"2024-02-14"}, []string{"2024-02-07"}},
+		{"FREQ=MONTHLY", []string{"2024-03-31"}, []string{"2024-02-29", "2024-04-30"}},
+		{"FREQ=YEARLY", []string{"2025-01-31"}, []string{"2024-12-31"}},
+		{"FREQ=WEEKLY;BYDAY=SA,SU;WKST=MO", []string{"2024-02-03", "2024-02-04"}, []string{"2024-02-05"}},
+	} {
+		rr, err := parseRRule(test.rule)
+		if err != nil {
+			t.Errorf("parseRRule(%q): %v", test.rule, err)
+			continue
+		}
+		ev := icsEvent{Summary: "x", Start: start, End: start.Add(time.Hour), RRule: rr}
+		check := func(days []string, want bool) {
+			for _, d := range days {
+				day, _ := time.Parse("2006-01-02", d)
+				if got := len(ev.instances(day, day.AddDate(0, 0, 1))) > 0; got != want {
+					t.Errorf("%s: occurs on %s = %t, want %t", test.rule, d, got, want)
+				}
+			}
+		}
+		check(test.on, true)
+		check(test.off, false)
+	}
+
+	for _, bad := range []string{"FREQ=MONTHLY;BYDAY=2TU", "FREQ=HOURLY", "FREQ=DAILY;BYSETPOS=1", "FREQ=DAILY;INTERVAL=0"} {
+		if _, err := parseRRule(bad); err == nil {
+			t.Errorf("parseRRule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseICSDuration(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"-PT15M", -15 * time.Minute},
+		{"P1DT12H", 36 * time.Hour},
+	} {
+		got, err := parseICSDuration(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("parseICSDuration(%q) = %v, %v, want %v", test.in, got, err, test.want)
+		}
+	}
+	for _, bad := range []string{"", "P", "1H", "PT1D", "P1H"} {
+		if _, err := parseICSDuration(bad); err == nil {
+			t.Errorf("parseICSDuration(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCalendarConfig(t *testing.T) {
+	for _, test := range []struct {
+		cc CalendarConfig
+		ok bool
+	}{
+		{CalendarConfig{URL: "https://calendar.google.com/calendar/ical/x/private-y/basic.ics"}, true},
+		{CalendarConfig{URL: "webcal://cloud.example.com/remote.php/dav/public-calendars/z?export", Colour: "red"}, true},
+		{CalendarConfig{URL: "calendar.ics"}, false},
+		{CalendarConfig{URL: "https://example.com/a.ics", Colour: "blue"}, false},
+		{CalendarConfig{URL: "https://example.com/a.ics", Interval: 30 * time.Minute}, true},
+		{CalendarConfig{URL: "https://example.com/a.ics", Interval: -time.Minute}, false},
+		{CalendarConfig{URL: "https://example.com/a.ics", Interval: calendarMaxAge}, false},
+	} {
+		err := test.cc.validate()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validate(%+v) = %v, want ok=%t", test.cc, err, test.ok)
+		}
+	}
+	if got := (CalendarConfig{URL: "https://example.com/secret/basic.ics"}).name(); got != "example.com" {
+		t.Errorf("name() = %q, want the URL's host", got)
+	}
+}
+
+func TestFetchEvents(t *testing.T) {
+	fails := false
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if fails {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, testICS)
+	}))
+	defer srv.Close()
+
+	r := &refresher{cfg: Config{Calendars: []CalendarConfig{{URL: srv.URL, Interval: time.Hour}}}}
+	now := time.Date(2024, time.June, 3, 9, 0, 0, 0, time.Local)
+	titles := func(at time.Time) (titles []string, ok bool) {
+		dd := displayData{today: time.Date(2024, time.June, 3, 0, 0, 0, 0, time.Local)}
+		ok = r.fetchEvents(context.Background(), &dd, at)
+		for _, ev := range dd.events {
+			titles = append(titles, ev.Title)
+		}
+		return titles, ok
+	}
+
+	first, ok := titles(now)
+	if !ok || !slices.Contains(first, "King's Birthday") {
+		t.Fatalf("First fetch gave %q, %t; want King's Birthday and success", first, ok)
+	}
+	if got, _ := titles(now.Add(time.Minute)); fetches != 1 || !reflect.DeepEqual(got, first) {
+		t.Errorf("Within the interval, fetched %d times and gave %q; want 1 and %q", fetches, got, first)
+	}
+
+	// Failures keep showing the last events, but not forever.
+	fails = true
+	if got, ok := titles(now.Add(2 * time.Hour)); ok || !reflect.DeepEqual(got, first) {
+		t.Errorf("While failing, gave %q, %t; want %q and failure", got, ok, first)
+	}
+	if got, _ := titles(now.Add(calendarMaxAge)); len(got) != 0 {
+		t.Errorf("After failing for %v, gave %q, want nothing", calendarMaxAge, got)
+	}
+}
+
+func TestCalendarStrip(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	rend, err := newRenderer(Config{
+		Font:     fontFile,
+		Messages: []message{{Options: []string{"Testing"}}},
+		Regions:  []RegionConfig{{Widget: "calendar"}},
+	}, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	render := func(events []calendarEvent) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 800, 480))
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+		rend.Render(img, displayData{events: events})
+		return img
+	}
+	if img := render(nil); !isBlank(img) {
+		t.Errorf("Calendar strip drawn with no events")
+	}
+	img := render([]calendarEvent{
+		{Title: "Bin night", Colour: "red"},
+		{Time: time.Date(2024, time.June, 3, 9, 30, 0, 0, time.Local), Title: "Dentist", Colour: "black"},
+	})
+	if isBlank(img) {
+		t.Errorf("Calendar strip not drawn")
+	}
+	for y := img.Bounds().Dy() / 4; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r != 0xFFFF {
+				t.Fatalf("Calendar strip drawn at (%d, %d), too far down", x, y)
+			}
+		}
+	}
+}
+
+func isBlank(img *image.RGBA) bool {
+	for _, p := range img.Pix {
+		if p != 0xFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+// Tiny charts, small enough to sit in a line of text.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// chartBar is one bar of a bar chart.
+type chartBar struct {
+	Value int
+	Col   color.Color
+}
+
+// drawBars draws a bar chart filling box, with the bars evenly spaced across it and a gap
+// of a pixel or so between them. Bars are scaled so the largest value reaches the top.
+// A bar with no value is drawn as a pixel high, so each bar's place can be seen.
+func drawBars(dst draw.Image, box image.Rectangle, bars []chartBar) {
+	if len(bars) == 0 || box.Empty() {
+		return
+	}
+	most := 0
+	for _, b := range bars {
+		most = max(most, b.Value)
+	}
+	step := box.Dx() / len(bars)
+	gap := max(step/4, 1)
+	if step <= gap {
+		return
+	}
+	for i, b := range bars {
+		h := 1
+		if most > 0 && b.Value > 0 {
+			h = max(b.Value*box.Dy()/most, 1)
+		}
+		x := box.Min.X + i*step
+		bar := image.Rect(x, box.Max.Y-h, x+step-gap, box.Max.Y)
+		draw.Draw(dst, bar, &image.Uniform{b.Col}, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+// Calling a Home Assistant service, such as a chime or a spoken notification,
+// when a new highest priority task appears for today.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"text/template"
+	"time"
+)
+
+// HASSChimeConfig is a Home Assistant service to call once for each task that newly appears
+// for today with the highest priority (P1 in the Todoist app).
+type HASSChimeConfig struct {
+	Service string `yaml:"service"` // domain.service, e.g. "notify.kitchen_speaker"
+
+	// Data is a text/template for the service data, as for HASSEventConfig.Data.
+	// It defaults to an object with a message naming the task.
+	Data string `yaml:"data"`
+}
+
+const (
+	taskNewP1 = "new_p1" // the transition for taskEvent.When
+
+	defaultChimeData = `{"message": {{json (printf "New task: %s" .Content)}}}`
+
+	// Chimes are remembered for this long, which is long enough
+	// that tasks due today aren't chimed twice.
+	chimeMemory = 48 * time.Hour
+)
+
+// parseChime prepares the configured chime, which may be nil if none is configured.
+func parseChime(cfg HASSChimeConfig) (*taskEventer, error) {
+	if cfg.Service == "" {
+		return nil, nil
+	}
+	if _, _, ok := splitService(cfg.Service); !ok {
+		return nil, fmt.Errorf("service %q is not of the form domain.service", cfg.Service)
+	}
+	data := cfg.Data
+	if data == "" {
+		data = defaultChimeData
+	}
+	tmpl, err := template.New(cfg.Service).Funcs(template.FuncMap{"json": jsonString}).Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing data template for %q: %w", cfg.Service, err)
+	}
+	return &taskEventer{when: taskNewP1, typ: cfg.Service, data: tmpl}, nil
+}
+
+// newP1Tasks returns the open tasks in shared projects due today with the highest priority,
+// keyed by ID and due date, so each occurrence of a recurring task is distinct.
+func newP1Tasks(td todoistData, now time.Time) map[string]taskEvent {
+	m := make(map[string]taskEvent)
+	ny, nm, nd := now.Date()
+	for _, item := range td.Items {
+		if item.Priority != 4 || item.Due == nil {
+			continue
+		}
+		if !td.Projects[item.ProjectID].Shared {
+			// Private tasks aren't for announcing in the kitchen.
+			continue
+		}
+		t, _, err := parseDue(item.Due)
+		if err != nil {
+			continue
+		}
+		if ty, tm, tdd := t.Date(); ty != ny || tm != nm || tdd != nd {
+			continue
+		}
+		ot := openTask{Content: item.Content, Project: td.Projects[item.ProjectID].Name, Priority: item.Priority, Due: item.Due.Date}
+		if item.Responsible != nil {
+			ot.Assignee = td.Collaborators[*item.Responsible].FullName
+		}
+		m[item.ID+" "+item.Due.Date] = taskEvent{When: taskNewP1, ID: item.ID, openTask: ot}
+	}
+	return m
+}
+
+// chimeNewP1 calls the chime service for each highest priority task that is newly due today.
+// The chimed tasks are persisted, so a restart doesn't repeat them.
+// It reports whether talking to Home Assistant worked.
+func (r *refresher) chimeNewP1(ctx context.Context, td todoistData, now time.Time) (ok bool) {
+	due := newP1Tasks(td, now)
+
+	var chimed map[string]time.Time
+	r.state.View(func(st *State) {
+		if st.ChimedTasks != nil {
+			chimed = make(map[string]time.Time)
+			for key, t := range st.ChimedTasks {
+				if now.Sub(t) < chimeMemory {
+					chimed[key] = t
+				}
+			}
+		}
+	})
+	if chimed == nil {
+		// First run, so don't chime for what was already there.
+		chimed = make(map[string]time.Time)
+		for key := range due {
+			chimed[key] = now
+		}
+		r.saveChimes(chimed)
+		return true
+	}
+
+	ok = true
+	n := 0
+	for key, ev := range due {
+		if _, done := chimed[key]; done {
+			continue
+		}
+		if n >= maxTaskEvents {
+			// Probably a glitch, such as a mass reschedule; don't chime for the rest.
+			chimed[key] = now
+			continue
+		}
+		data, err := r.chime.eventData(ev)
+		if err != nil {
+			// Retrying won't help.
+			log.Printf("Preparing chime for task %s: %v", ev.ID, err)
+			chimed[key] = now
+			continue
+		}
+		n++
+		if err := r.hass.CallService(ctx, r.chime.typ, data); err != nil {
+			log.Printf("Calling %s for task %s: %v", r.chime.typ, ev.ID, err)
+			ok = false
+			continue // try again next time
+		}
+		chimed[key] = now
+	}
+	r.saveChimes(chimed)
+	return ok
+}
+
+func (r *refresher) saveChimes(chimed map[string]time.Time) {
+	same := false
+	r.state.View(func(st *State) { same = reflect.DeepEqual(st.ChimedTasks, chimed) })
+	if same {
+		return
+	}
+	if err := r.state.Update(func(st *State) { st.ChimedTasks = chimed }); err != nil {
+		log.Printf("Saving chimed tasks: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestChimeNewP1(t *testing.T) {
+	var messages []string
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/services/notify/kitchen" {
+			t.Errorf("Request to unexpected path %s", r.URL.Path)
+		}
+		if failing {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		var data map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("Decoding service data: %v", err)
+		}
+		messages = append(messages, data["message"])
+	}))
+	defer srv.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	newRef := func() *refresher {
+		state, err := loadState(stateFile)
+		if err != nil {
+			t.Fatalf("loadState: %v", err)
+		}
+		hcfg := HASSConfig{URL: srv.URL, Chime: HASSChimeConfig{Service: "notify.kitchen"}}
+		chime, err := parseChime(hcfg.Chime)
+		if err != nil {
+			t.Fatalf("parseChime: %v", err)
+		}
+		return &refresher{hass: NewHASS(hcfg), state: state, chime: chime}
+	}
+
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	td := todoistData{
+		Projects: map[string]todoist.Project{
+			"p":    {ID: "p", Name: "House", Shared: true},
+			"priv": {ID: "priv", Name: "Personal"},
+		},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p", Content: "old", Priority: 4, Due: &todoist.Due{Date: "2024-06-12"}},
+		},
+	}
+	check := func(desc string, want ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(messages, want) {
+			t.Errorf("%s: chimed %q, want %q", desc, messages, want)
+		}
+		messages = nil
+	}
+
+	r := newRef()
+	r.chimeNewP1(context.Background(), td, now)
+	check("First run")
+
+	td.Items["2"] = todoist.Item{ID: "2", ProjectID: "p", Content: "urgent", Priority: 4, Due: &todoist.Due{Date: "2024-06-12T17:00:00"}}
+	td.Items["3"] = todoist.Item{ID: "3", ProjectID: "p", Content: "meh", Priority: 3, Due: &todoist.Due{Date: "2024-06-12"}}
+	td.Items["4"] = todoist.Item{ID: "4", ProjectID: "p", Content: "later", Priority: 4, Due: &todoist.Due{Date: "2024-06-13"}}
+	td.Items["5"] = todoist.Item{ID: "5", ProjectID: "priv", Content: "private", Priority: 4, Due: &todoist.Due{Date: "2024-06-12"}}
+	failing = true
+	if r.chimeNewP1(context.Background(), td, now) {
+		t.Errorf("chimeNewP1 reported success while Home Assistant was failing")
+	}
+	failing = false
+	r.chimeNewP1(context.Background(), td, now)
+	check("New P1 task", "New task: urgent") // not the private task
+
+	// Restarting doesn't chime again.
+	r = newRef()
+	r.chimeNewP1(context.Background(), td, now)
+	check("After restart")
+
+	// The next day, task 4 is due.
+	r.chimeNewP1(context.Background(), td, now.AddDate(0, 0, 1))
+	check("Next day", "New task: later")
+}
@@ -0,0 +1,54 @@
+package main
+
+// A tiny bar chart of how many tasks were completed on each of the last week's days,
+// giving a sense of the household's momentum.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+const completionsWindowDays = 7
+
+// pruneCompletions drops days that are outside the window.
+func pruneCompletions(days map[string]int, now time.Time) {
+	oldest := now.AddDate(0, 0, -(completionsWindowDays - 1)).Format("2006-01-02")
+	for day := range days {
+		if day < oldest {
+			delete(days, day)
+		}
+	}
+}
+
+// completionsByDay returns how many tasks were completed on each day of the window, ending today.
+func completionsByDay(days map[string]int, now time.Time) []int {
+	counts := make([]int, completionsWindowDays)
+	for i := range counts {
+		counts[i] = days[now.AddDate(0, 0, i-(completionsWindowDays-1)).Format("2006-01-02")]
+	}
+	return counts
+}
+
+// planCompletions plans the completions chart, with today's bar in the accent colour.
+// The returned function draws it with its bottom right corner at the given point,
+// over anything already there.
+func (r renderer) planCompletions(f *frame, height int) func(bottomRight image.Point) {
+	counts := f.data.completions
+	if len(counts) == 0 {
+		return nil
+	}
+	bars := make([]chartBar, len(counts))
+	for i, n := range counts {
+		bars[i] = chartBar{Value: n, Col: color.Black}
+	}
+	bars[len(bars)-1].Col = f.accentCol
+	const barPitch = 6 // pixels, including the gap
+	width := len(bars) * barPitch
+	return func(br image.Point) {
+		box := image.Rect(br.X-width, br.Y-height, br.X, br.Y)
+		draw.Draw(f.dst, box.Inset(-2), image.White, image.Point{}, draw.Src)
+		drawBars(f.dst, box, bars)
+	}
+}
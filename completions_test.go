@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestCompletionsByDay(t *testing.T) {
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	days := map[string]int{
+		"2024-06-12": 4,
+		"2024-06-10": 2,
+		"2024-06-06": 1,
+		"2024-06-05": 7, // outside the window
+	}
+	if got, want := completionsByDay(days, now), []int{1, 0, 0, 0, 2, 0, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("completionsByDay = %v, want %v", got, want)
+	}
+	pruneCompletions(days, now)
+	if len(days) != 3 {
+		t.Errorf("After pruning, %d days remain, want 3", len(days))
+	}
+}
+
+func TestTrackTasksCompletions(t *testing.T) {
+	state, _ := loadState("")
+	r := &refresher{state: state, cfg: Config{Footer: FooterConfig{Completions: true}}}
+	td := todoistData{
+		Projects: map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1"},
+			"2": {ID: "2", ProjectID: "p1"},
+			"3": {ID: "3", ProjectID: "p1"},
+		},
+	}
+	now := time.Now()
+	r.trackTasks(context.Background(), td, now) // baseline only
+	delete(td.Items, "1")
+	delete(td.Items, "2")
+	r.trackTasks(context.Background(), td, now)
+	r.trackTasks(context.Background(), td, now) // nothing new
+
+	var got int
+	state.View(func(st *State) { got = st.Completions[now.Format("2006-01-02")] })
+	if got != 2 {
+		t.Errorf("Completions today = %d, want 2", got)
+	}
+}
+
+func TestDrawBars(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	drawBars(img, img.Bounds(), []chartBar{
+		{Value: 0, Col: color.Black},
+		{Value: 2, Col: color.Black},
+		{Value: 4, Col: red},
+		{Value: 1, Col: color.Black},
+	})
+	// Each bar is 10 pixels apart, with a gap after it.
+	height := func(x int) int {
+		h := 0
+		for y := 0; y < 10; y++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+				h++
+			}
+		}
+		return h
+	}
+	for i, want := range []int{1, 5, 10, 2} {
+		if got := height(i * 10); got != want {
+			t.Errorf("Bar %d is %d high, want %d", i, got, want)
+		}
+		if got := height(i*10 + 9); got != 0 {
+			t.Errorf("Gap after bar %d is filled", i)
+		}
+	}
+	if got := img.At(20, 0); got != red {
+		t.Errorf("Top of the tallest bar is %v, want red", got)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 )
 
@@ -18,3 +20,28 @@ func TestConfigParses(t *testing.T) {
 		}
 	}
 }
+
+func TestStateDir(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	raw := "state_dir: /var/lib/kitchenthing\ntodoist_cache: /tmp/todoist.json\n"
+	if err := ioutil.WriteFile(filename, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(filename)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if want := "/var/lib/kitchenthing/state.json"; cfg.StateFile != want {
+		t.Errorf("state_file = %q, want %q", cfg.StateFile, want)
+	}
+	if want := "/tmp/todoist.json"; cfg.TodoistCache != want {
+		t.Errorf("todoist_cache = %q, want %q (as set)", cfg.TodoistCache, want)
+	}
+	if want := "/var/lib/kitchenthing/homekit"; cfg.HomeKit.StateDir != want {
+		t.Errorf("homekit.state_dir = %q, want %q", cfg.HomeKit.StateDir, want)
+	}
+	if want := "/var/lib/kitchenthing/tailscale"; cfg.Tailscale.StateDir != want {
+		t.Errorf("tailscale.state_dir = %q, want %q", cfg.Tailscale.StateDir, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+// Countdowns for tasks due soon.
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	countdownWindow = time.Hour       // how far ahead countdowns are shown
+	countdownStep   = 5 * time.Minute // countdown resolution, to limit panel refreshes
+)
+
+// countdown returns the text to show for a task due at t, such as "in 25m",
+// or the empty string if t isn't soon enough for a countdown.
+// Countdowns round up, so they never claim there's more time than there is.
+func countdown(t, now time.Time) string {
+	d := t.Sub(now)
+	if t.IsZero() || d <= 0 || d > countdownWindow {
+		return ""
+	}
+	return fmt.Sprintf("in %dm", countdownMinutes(d))
+}
+
+// countdownMinutes returns the minutes to show in a countdown for a task due in d.
+func countdownMinutes(d time.Duration) int {
+	steps := (d + countdownStep - 1) / countdownStep
+	return int(steps * countdownStep / time.Minute)
+}
+
+// nextCountdownChange returns how long after now the countdown for a task due at t will next change,
+// or zero if it won't.
+func nextCountdownChange(t, now time.Time) time.Duration {
+	d := t.Sub(now)
+	if t.IsZero() || d <= 0 {
+		return 0
+	}
+	if d > countdownWindow {
+		return d - countdownWindow
+	}
+	// The countdown changes when the remaining time drops to the next step down.
+	steps := (d + countdownStep - 1) / countdownStep
+	return d - (steps-1)*countdownStep
+}
+
+// countdownTick returns how long to wait for the next countdown change among the tasks,
+// or zero if there are no countdowns to update.
+func countdownTick(tasks []renderableTask, now time.Time) time.Duration {
+	var next time.Duration
+	for _, task := range tasks {
+		if d := nextCountdownChange(task.Time, now); d > 0 && (next == 0 || d < next) {
+			next = d
+		}
+	}
+	return next
+}
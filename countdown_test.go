@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountdown(t *testing.T) {
+	now := time.Date(2024, time.June, 12, 15, 0, 0, 0, time.Local)
+	tests := []struct {
+		due  time.Duration // after now
+		want string
+		next time.Duration
+	}{
+		{-time.Minute, "", 0},
+		{30 * time.Second, "in 5m", 30 * time.Second},
+		{23 * time.Minute, "in 25m", 3 * time.Minute},
+		{25 * time.Minute, "in 25m", 5 * time.Minute},
+		{time.Hour, "in 60m", 5 * time.Minute},
+		{90 * time.Minute, "", 30 * time.Minute},
+	}
+	for _, test := range tests {
+		due := now.Add(test.due)
+		if got := countdown(due, now); got != test.want {
+			t.Errorf("countdown(now+%v) = %q, want %q", test.due, got, test.want)
+		}
+		if got := nextCountdownChange(due, now); got != test.next {
+			t.Errorf("nextCountdownChange(now+%v) = %v, want %v", test.due, got, test.next)
+		}
+		// The countdown should actually have changed by then.
+		if test.next > 0 {
+			if a, b := countdown(due, now.Add(test.next-time.Second)), countdown(due, now.Add(test.next)); a == b {
+				t.Errorf("countdown(now+%v) didn't change after %v: still %q", test.due, test.next, a)
+			}
+		}
+	}
+
+	if got := countdown(time.Time{}, now); got != "" {
+		t.Errorf("countdown(zero time) = %q, want empty", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+// The most recently refreshed display data, set by the main loop and read by the
+// HTTP server, MQTT handlers and HomeKit. Readers and the writer each get their own
+// copy, so none of them can see changes another makes.
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// displayStore guards the latest displayData.
+type displayStore struct {
+	mu sync.Mutex
+	dd displayData
+}
+
+// Set records dd as the latest data. Changing dd afterwards doesn't change what is stored.
+func (ds *displayStore) Set(dd displayData) {
+	dd = dd.clone()
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.dd = dd
+}
+
+// Get returns a copy of the latest data, which the caller may change.
+func (ds *displayStore) Get() displayData {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.dd.clone()
+}
+
+// clone returns a deep copy of dd. The override image is shared, since it is never modified.
+func (dd displayData) clone() displayData {
+	dd.tasks = cloneTasks(dd.tasks)
+	dd.alerts = slices.Clone(dd.alerts)
+	dd.events = slices.Clone(dd.events)
+	if dd.forecast != nil {
+		f := *dd.forecast
+		dd.forecast = &f
+	}
+	dd.weather = weather{Rain: cloneFloat(dd.weather.Rain), Temp: cloneFloat(dd.weather.Temp)}
+	dd.completions = slices.Clone(dd.completions)
+	dd.hassFooter = slices.Clone(dd.hassFooter)
+	dd.hassHeader = slices.Clone(dd.hassHeader)
+	dd.hassSidebar = slices.Clone(dd.hassSidebar)
+	dd.health = slices.Clone(dd.health)
+	if dd.fairness != nil {
+		rep := *dd.fairness
+		rep.People = maps.Clone(rep.People)
+		dd.fairness = &rep
+	}
+	return dd
+}
+
+func cloneTasks(tasks []renderableTask) []renderableTask {
+	tasks = slices.Clone(tasks)
+	for i := range tasks {
+		tasks[i].Hints = slices.Clone(tasks[i].Hints)
+		tasks[i].Subtasks = cloneTasks(tasks[i].Subtasks)
+	}
+	return tasks
+}
+
+func cloneFloat(p *float64) *float64 {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDisplayStoreCopies(t *testing.T) {
+	rain := 40.0
+	dd := displayData{
+		tasks: []renderableTask{
+			{Title: "Take out bins", Hints: []string{"☂"}, Subtasks: []renderableTask{{Title: "Rinse recycling"}}},
+		},
+		weather:  weather{Rain: &rain},
+		forecast: &forecast{Temp: 18},
+		fairness: &fairnessReport{People: map[string]personFairness{"David": {Completed: 3}}},
+	}
+	var ds displayStore
+	ds.Set(dd)
+
+	// Changing what was set doesn't change what is stored.
+	dd.tasks[0].Title = "Changed"
+	rain = 90
+
+	got := ds.Get()
+	if got.tasks[0].Title != "Take out bins" || *got.weather.Rain != 40 {
+		t.Errorf("Store changed with the data set: %+v", got)
+	}
+
+	// Nor does changing what was got.
+	got.tasks[0].Hints[0] = "☀"
+	got.tasks[0].Subtasks[0].Title = "Changed"
+	got.forecast.Temp = 30
+	got.fairness.People["David"] = personFairness{Completed: 10}
+
+	again := ds.Get()
+	if again.tasks[0].Hints[0] != "☂" || again.tasks[0].Subtasks[0].Title != "Rinse recycling" {
+		t.Errorf("Store changed with the tasks got: %+v", again.tasks)
+	}
+	if again.forecast.Temp != 18 || again.fairness.People["David"].Completed != 3 {
+		t.Errorf("Store changed with the forecast or fairness report got: %+v, %+v", again.forecast, again.fairness)
+	}
+}
+
+// TestDisplayStoreConcurrent is most useful with -race.
+func TestDisplayStoreConcurrent(t *testing.T) {
+	var ds displayStore
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			dd := displayData{tasks: []renderableTask{{Title: fmt.Sprint(i)}}}
+			ds.Set(dd)
+			dd.tasks[0].Title = "changed after Set"
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			dd := ds.Get()
+			for j := range dd.tasks {
+				dd.tasks[j].Title += " changed after Get"
+			}
+		}
+	}()
+	wg.Wait()
+}
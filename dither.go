@@ -0,0 +1,186 @@
+package main
+
+// Dithering photos to black and white by thresholding against a pattern, as an alternative
+// to diffusing errors into the panel's colours. This gives a steadier simulation of grayscale,
+// without the photo picking up stray red.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Ways of dithering images (see RegionConfig.Dither).
+const (
+	ditherColour    = "colour"     // error diffusion into the panel's colours
+	ditherOrdered   = "ordered"    // grayscale, with a Bayer matrix
+	ditherBlueNoise = "blue-noise" // grayscale, with a blue noise pattern
+)
+
+// thresholdPattern is a square tile of distinct ranks, from 0 to len(ranks)-1.
+// Each pixel is black if its gray level is below the threshold for its rank.
+type thresholdPattern struct {
+	size  int
+	ranks []int
+}
+
+// black reports whether a pixel at (x, y) with the given gray level should be black.
+func (tp thresholdPattern) black(x, y int, level uint8) bool {
+	rank := tp.ranks[(y%tp.size)*tp.size+x%tp.size]
+	// Thresholds are centred in each of the len(ranks) steps across 0-255.
+	return int(level)*2*len(tp.ranks) < (2*rank+1)*256
+}
+
+// drawGray draws src into dst, which must start at (0, 0), in black and white,
+// with src scaled down by scale. It first samples src into a grayscale image of dst's size,
+// so the pattern sees the photo's full tonal range.
+func drawGray(dst draw.Image, src image.Image, scale float64, dither string) {
+	gray := image.NewGray(dst.Bounds())
+	for y := 0; y < gray.Rect.Max.Y; y++ {
+		for x := 0; x < gray.Rect.Max.X; x++ {
+			srcX := src.Bounds().Min.X + int(scale*float64(x))
+			srcY := src.Bounds().Min.Y + int(scale*float64(y))
+			gray.Set(x, y, src.At(srcX, srcY))
+		}
+	}
+	tp := bayerPattern
+	if dither == ditherBlueNoise {
+		tp = blueNoisePattern()
+	}
+	for y := 0; y < gray.Rect.Max.Y; y++ {
+		for x := 0; x < gray.Rect.Max.X; x++ {
+			if tp.black(x, y, gray.GrayAt(x, y).Y) {
+				dst.Set(x, y, color.Black)
+			} else {
+				dst.Set(x, y, color.White)
+			}
+		}
+	}
+}
+
+// bayerPattern is the 8x8 Bayer matrix.
+var bayerPattern = func() thresholdPattern {
+	tp := thresholdPattern{size: 1, ranks: []int{0}}
+	for tp.size < 8 {
+		// Each doubling puts the previous matrix, scaled by 4, in each quadrant in turn.
+		n := tp.size
+		next := thresholdPattern{size: 2 * n, ranks: make([]int, 4*n*n)}
+		for q, off := range []int{0, 2, 3, 1} {
+			qx, qy := (q%2)*n, (q/2)*n
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					next.ranks[(qy+y)*next.size+qx+x] = 4*tp.ranks[y*n+x] + off
+				}
+			}
+		}
+		tp = next
+	}
+	return tp
+}()
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoise     thresholdPattern
+)
+
+// blueNoisePattern returns a 32x32 blue noise pattern, made on first use.
+func blueNoisePattern() thresholdPattern {
+	blueNoiseOnce.Do(func() { blueNoise = voidAndCluster(32, 1.5) })
+	return blueNoise
+}
+
+// voidAndCluster makes a blue noise pattern of the given size with Ulichney's
+// void-and-cluster method, using a Gaussian filter with the given sigma to find
+// the tightest clusters and largest voids. The pattern wraps around at its edges.
+func voidAndCluster(size int, sigma float64) thresholdPattern {
+	n := size * size
+	kernel := make([]float64, n)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			wx, wy := min(dx, size-dx), min(dy, size-dy)
+			kernel[dy*size+dx] = math.Exp(-float64(wx*wx+wy*wy) / (2 * sigma * sigma))
+		}
+	}
+	// energy[i] is the sum of the kernel centred on each set pixel, at pixel i.
+	type pattern struct {
+		set    []bool
+		energy []float64
+	}
+	toggle := func(p *pattern, i int) {
+		p.set[i] = !p.set[i]
+		sign := 1.0
+		if !p.set[i] {
+			sign = -1
+		}
+		ix, iy := i%size, i/size
+		for j := range p.energy {
+			dx, dy := (j%size-ix+size)%size, (j/size-iy+size)%size
+			p.energy[j] += sign * kernel[dy*size+dx]
+		}
+	}
+	// extreme finds the set pixel with the most energy, or the unset one with the least.
+	extreme := func(p *pattern, set bool) int {
+		best := -1
+		for i, s := range p.set {
+			if s != set {
+				continue
+			}
+			if best < 0 || (set && p.energy[i] > p.energy[best]) || (!set && p.energy[i] < p.energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// Start with a tenth of the pixels set at random, then move pixels from clusters
+	// into voids until that doesn't change anything.
+	initial := &pattern{set: make([]bool, n), energy: make([]float64, n)}
+	rnd := rand.New(rand.NewSource(1))
+	ones := 0
+	for _, i := range rnd.Perm(n)[:n/10] {
+		toggle(initial, i)
+		ones++
+	}
+	for iter := 0; iter < n; iter++ { // it normally settles much sooner
+		cluster := extreme(initial, true)
+		toggle(initial, cluster)
+		void := extreme(initial, false)
+		toggle(initial, void)
+		if void == cluster {
+			break
+		}
+	}
+
+	ranks := make([]int, n)
+	// The initial pixels are ranked by removing the tightest cluster each time.
+	p := &pattern{set: append([]bool(nil), initial.set...), energy: append([]float64(nil), initial.energy...)}
+	for rank := ones - 1; rank >= 0; rank-- {
+		i := extreme(p, true)
+		ranks[i] = rank
+		toggle(p, i)
+	}
+	// Up to half are ranked by filling the largest void each time.
+	rank := ones
+	for ; rank < n/2; rank++ {
+		i := extreme(initial, false)
+		ranks[i] = rank
+		toggle(initial, i)
+	}
+	// Then the unset pixels are the minority, so the rest are ranked by removing
+	// the tightest cluster of those each time.
+	inv := &pattern{set: make([]bool, n), energy: make([]float64, n)}
+	for i, s := range initial.set {
+		if !s {
+			toggle(inv, i)
+		}
+	}
+	for ; rank < n; rank++ {
+		i := extreme(inv, true)
+		ranks[i] = rank
+		toggle(inv, i)
+	}
+	return thresholdPattern{size: size, ranks: ranks}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+	"testing"
+)
+
+func checkRanks(t *testing.T, name string, tp thresholdPattern) {
+	t.Helper()
+	ranks := append([]int(nil), tp.ranks...)
+	sort.Ints(ranks)
+	for i, r := range ranks {
+		if r != i {
+			t.Errorf("%s pattern's ranks are not 0 to %d: %v", name, len(ranks)-1, ranks)
+			return
+		}
+	}
+}
+
+func TestBayerPattern(t *testing.T) {
+	checkRanks(t, "Bayer", bayerPattern)
+	if bayerPattern.size != 8 {
+		t.Errorf("Bayer pattern is %dx%[1]d, want 8x8", bayerPattern.size)
+	}
+	// The first row of the standard 8x8 Bayer matrix.
+	want := []int{0, 32, 8, 40, 2, 34, 10, 42}
+	for x, w := range want {
+		if got := bayerPattern.ranks[x]; got != w {
+			t.Errorf("Bayer pattern at (%d, 0) = %d, want %d", x, got, w)
+		}
+	}
+}
+
+func TestBlueNoisePattern(t *testing.T) {
+	tp := blueNoisePattern()
+	checkRanks(t, "Blue noise", tp)
+
+	// Black pixels in light gray, and white pixels in dark gray, should be spread out.
+	// At a tenth of the pixels, none should touch another, even at the pattern's wrapped edges.
+	for _, level := range []uint8{230, 25} {
+		minority := level > 128
+		for y := 0; y < tp.size; y++ {
+			for x := 0; x < tp.size; x++ {
+				if tp.black(x, y, level) != minority {
+					continue
+				}
+				if tp.black(x+1, y, level) == minority || tp.black(x, y+1, level) == minority {
+					t.Fatalf("Minority pixels at gray level %d touch at (%d, %d)", level, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestDrawImageGray(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 128, 128))
+	for i := range src.Pix {
+		src.Pix[i] = 128
+	}
+	for _, dither := range []string{ditherOrdered, ditherBlueNoise} {
+		dst := image.NewPaletted(image.Rect(0, 0, 64, 64), staticPalette)
+		drawImage(dst, src, dither)
+		black := 0
+		for _, p := range dst.Pix {
+			switch staticPalette[p] {
+			case color.Black:
+				black++
+			case colorRed:
+				t.Fatalf("%s dithering drew red", dither)
+			}
+		}
+		if black < 64*64*45/100 || black > 64*64*55/100 {
+			t.Errorf("%s dithering of mid gray made %d of %d pixels black, want about half", dither, black, 64*64)
+		}
+	}
+}
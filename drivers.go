@@ -0,0 +1,60 @@
+package main
+
+// Drivers for the models of panel that kitchenthing can run on.
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+	"time"
+)
+
+// panelDriver drives a model of panel.
+type panelDriver interface {
+	display
+	Clear()
+
+	Start() error
+	Stop()
+
+	LastWhiteFlush() time.Time
+	Plane(name string) *image.Paletted // as most recently sent to the panel; nil if there's no such plane
+}
+
+const defaultDisplay = "waveshare_7in5b_v2"
+
+// panelDrivers maps each model of panel, as named in the config, to its driver.
+// Each driver is built from a paper, since the supported models share a controller.
+var panelDrivers = map[string]func(p paper) panelDriver{
+	"waveshare_7in5b_v2": func(p paper) panelDriver { return p },          // 7.5" (B) V2, black/white/red
+	"waveshare_7in5_v2":  func(p paper) panelDriver { return bwPaper{p} }, // 7.5" V2, black/white
+}
+
+// validateDisplay checks the display named in the config, and its panel tuning.
+func validateDisplay(name string, tuning PanelTuning) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := panelDrivers[name]; !ok {
+		var names []string
+		for n := range panelDrivers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown display %q; known displays are %s", name, strings.Join(names, ", "))
+	}
+	if name != defaultDisplay && tuning.LUT.fromRegister() {
+		// The LUT tables are for the KWR mode of the (B) panel.
+		return fmt.Errorf("panel_tuning.lut can't load LUTs from registers for display %q", name)
+	}
+	return nil
+}
+
+// newPanelDriver returns the driver for the display named in the config, wrapping p.
+func newPanelDriver(name string, p paper) panelDriver {
+	if name == "" {
+		name = defaultDisplay
+	}
+	return panelDrivers[name](p)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestValidateDisplay(t *testing.T) {
+	register := PanelTuning{LUT: LUTConfig{Source: "register", Tables: map[string][]int{"vcom": {0, 1, 1, 1, 1, 1}}}}
+	for _, test := range []struct {
+		name   string
+		tuning PanelTuning
+		ok     bool
+	}{
+		{"", PanelTuning{}, true},
+		{"waveshare_7in5b_v2", PanelTuning{}, true},
+		{"waveshare_7in5_v2", PanelTuning{}, true},
+		{"waveshare_7in5b_v2", register, true},
+		{"waveshare_7in5_v2", register, false},
+		{"inkyphat", PanelTuning{}, false},
+	} {
+		err := validateDisplay(test.name, test.tuning)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validateDisplay(%q, %+v) = %v, want ok=%t", test.name, test.tuning, err, test.ok)
+		}
+	}
+}
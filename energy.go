@@ -0,0 +1,48 @@
+package main
+
+// Nudges to run power-hungry tasks while energy is cheap.
+
+import (
+	"context"
+	"fmt"
+)
+
+type EnergyConfig struct {
+	// Entity is a Home Assistant sensor that indicates how cheap energy is,
+	// such as the electricity price or solar production.
+	Entity string `yaml:"entity"`
+
+	// Energy is cheap when the entity's state is below Below (e.g. price),
+	// or above Above (e.g. solar power). Set one of these.
+	Below *float64 `yaml:"below"`
+	Above *float64 `yaml:"above"`
+
+	// Event is the Home Assistant event type fired when a nudge starts.
+	// It defaults to "kitchenthing_power_hungry_nudge".
+	Event string `yaml:"event"`
+}
+
+const defaultEnergyEvent = "kitchenthing_power_hungry_nudge"
+
+// energyIsCheap reports whether the configured entity says energy is cheap.
+func energyIsCheap(ctx context.Context, hass *HASS, cfg EnergyConfig) (bool, error) {
+	v, err := hass.NumericState(ctx, cfg.Entity)
+	if err != nil {
+		return false, err
+	}
+	if cfg.Below != nil && v < *cfg.Below {
+		return true, nil
+	}
+	if cfg.Above != nil && v > *cfg.Above {
+		return true, nil
+	}
+	return false, nil
+}
+
+// nudgeMessage is the banner text for n pending power-hungry tasks.
+func nudgeMessage(n int) string {
+	if n == 1 {
+		return "Energy is cheap now: run the power-hungry task!"
+	}
+	return fmt.Sprintf("Energy is cheap now: run the %d power-hungry tasks!", n)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnergyIsCheap(t *testing.T) {
+	var state string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"state": %q}`, state)
+	}))
+	defer srv.Close()
+	hass := NewHASS(HASSConfig{URL: srv.URL})
+
+	below, above := 0.10, 2000.0
+	tests := []struct {
+		cfg   EnergyConfig
+		state string
+		want  bool
+	}{
+		{EnergyConfig{Below: &below}, "0.05", true},
+		{EnergyConfig{Below: &below}, "0.25", false},
+		{EnergyConfig{Above: &above}, "3500", true},
+		{EnergyConfig{Above: &above}, "150", false},
+		{EnergyConfig{Below: &below, Above: &above}, "0.5", false},
+	}
+	for _, test := range tests {
+		state = test.state
+		test.cfg.Entity = "sensor.thing"
+		got, err := energyIsCheap(context.Background(), hass, test.cfg)
+		if err != nil {
+			t.Errorf("energyIsCheap with state %q: %v", test.state, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("energyIsCheap with state %q = %t, want %t", test.state, got, test.want)
+		}
+	}
+
+	state = "unavailable"
+	if _, err := energyIsCheap(context.Background(), hass, EnergyConfig{Entity: "sensor.thing", Below: &below}); err == nil {
+		t.Errorf("energyIsCheap with unavailable state didn't fail")
+	}
+}
+
+func TestCheckEnergyCountsSubtasks(t *testing.T) {
+	var pending int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var body map[string]int
+			json.NewDecoder(r.Body).Decode(&body)
+			pending = body["pending"]
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		fmt.Fprint(w, `{"state": "0.05"}`)
+	}))
+	defer srv.Close()
+
+	below := 0.10
+	r := &refresher{
+		cfg:  Config{Energy: EnergyConfig{Entity: "sensor.price", Below: &below}},
+		hass: NewHASS(HASSConfig{URL: srv.URL}),
+	}
+	dd := displayData{tasks: []renderableTask{
+		{Title: "Laundry", Subtasks: []renderableTask{{Title: "Run the dryer", PowerHungry: true}}},
+	}}
+	if !r.checkEnergy(context.Background(), &dd) {
+		t.Errorf("checkEnergy reported failure")
+	}
+	if want := nudgeMessage(1); dd.nudge != want {
+		t.Errorf("Nudge = %q, want %q", dd.nudge, want)
+	}
+	if pending != 1 {
+		t.Errorf("Nudge event had %d pending, want 1", pending)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+// A rolling report on how fairly tasks are shared out,
+// comparing how many tasks each person completes with how many they are assigned.
+
+import (
+	"time"
+)
+
+type FairnessConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Threshold is how far apart the highest and lowest completion ratios
+	// can be before the split is lopsided. It defaults to 0.5.
+	Threshold float64 `yaml:"threshold"`
+
+	// MinAssigned is how many tasks someone must have been assigned
+	// within the window to be included. It defaults to 3.
+	MinAssigned int `yaml:"min_assigned"`
+}
+
+const fairnessWindowDays = 7
+
+// fairnessCount is one person's tally for one day.
+type fairnessCount struct {
+	Assigned  int `json:"assigned,omitempty"`
+	Completed int `json:"completed,omitempty"`
+}
+
+// tallyFairness records an assignment or completion for the task's assignee.
+// days is keyed by day (YYYY-MM-DD), then by person.
+func tallyFairness(days map[string]map[string]fairnessCount, ev taskEvent, now time.Time) {
+	day := now.Format("2006-01-02")
+	if days[day] == nil {
+		days[day] = make(map[string]fairnessCount)
+	}
+	fc := days[day][ev.Assignee]
+	switch ev.When {
+	case taskAssigned:
+		fc.Assigned++
+	case taskCompleted:
+		fc.Completed++
+	}
+	days[day][ev.Assignee] = fc
+}
+
+// pruneFairness drops days that are outside the window.
+func pruneFairness(days map[string]map[string]fairnessCount, now time.Time) {
+	oldest := now.AddDate(0, 0, -(fairnessWindowDays - 1)).Format("2006-01-02")
+	for day := range days {
+		if day < oldest {
+			delete(days, day)
+		}
+	}
+}
+
+// personFairness is one person's totals over the window.
+type personFairness struct {
+	Assigned  int     `json:"assigned"`
+	Completed int     `json:"completed"`
+	Ratio     float64 `json:"ratio"` // completed ÷ assigned
+}
+
+type fairnessReport struct {
+	People   map[string]personFairness `json:"people"` // only those assigned enough tasks
+	Lopsided bool                      `json:"lopsided"`
+}
+
+func (rep fairnessReport) Equal(o fairnessReport) bool {
+	if rep.Lopsided != o.Lopsided || len(rep.People) != len(o.People) {
+		return false
+	}
+	for person, pf := range rep.People {
+		if opf, ok := o.People[person]; !ok || opf != pf {
+			return false
+		}
+	}
+	return true
+}
+
+// newFairnessReport totals the days within the window.
+func newFairnessReport(cfg FairnessConfig, days map[string]map[string]fairnessCount, now time.Time) fairnessReport {
+	threshold, minAssigned := cfg.Threshold, cfg.MinAssigned
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	if minAssigned == 0 {
+		minAssigned = 3
+	}
+
+	oldest := now.AddDate(0, 0, -(fairnessWindowDays - 1)).Format("2006-01-02")
+	totals := make(map[string]personFairness)
+	for day, people := range days {
+		if day < oldest {
+			continue
+		}
+		for person, fc := range people {
+			pf := totals[person]
+			pf.Assigned += fc.Assigned
+			pf.Completed += fc.Completed
+			totals[person] = pf
+		}
+	}
+
+	rep := fairnessReport{People: make(map[string]personFairness)}
+	lo, hi := 0.0, 0.0
+	for person, pf := range totals {
+		if pf.Assigned < minAssigned {
+			continue
+		}
+		pf.Ratio = float64(pf.Completed) / float64(pf.Assigned)
+		if len(rep.People) == 0 || pf.Ratio < lo {
+			lo = pf.Ratio
+		}
+		if len(rep.People) == 0 || pf.Ratio > hi {
+			hi = pf.Ratio
+		}
+		rep.People[person] = pf
+	}
+	rep.Lopsided = len(rep.People) >= 2 && hi-lo > threshold
+	return rep
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestFairnessReport(t *testing.T) {
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	days := make(map[string]map[string]fairnessCount)
+	tally := func(daysAgo int, person, when string, n int) {
+		for i := 0; i < n; i++ {
+			tallyFairness(days, taskEvent{When: when, openTask: openTask{Assignee: person}}, now.AddDate(0, 0, -daysAgo))
+		}
+	}
+	tally(0, "Alex", taskAssigned, 2)
+	tally(6, "Alex", taskAssigned, 2)
+	tally(1, "Alex", taskCompleted, 4)
+	tally(2, "Sam", taskAssigned, 4)
+	tally(2, "Sam", taskCompleted, 3)
+	tally(3, "Kim", taskAssigned, 2) // too few to count
+	tally(7, "Sam", taskAssigned, 5) // outside the window
+
+	rep := newFairnessReport(FairnessConfig{}, days, now)
+	want := map[string]personFairness{
+		"Alex": {Assigned: 4, Completed: 4, Ratio: 1},
+		"Sam":  {Assigned: 4, Completed: 3, Ratio: 0.75},
+	}
+	if !rep.Equal(fairnessReport{People: want}) {
+		t.Errorf("newFairnessReport = %+v, want people %+v and not lopsided", rep, want)
+	}
+	if rep := newFairnessReport(FairnessConfig{Threshold: 0.2}, days, now); !rep.Lopsided {
+		t.Errorf("With a threshold of 0.2, the report isn't lopsided")
+	}
+
+	pruneFairness(days, now)
+	if len(days) != 5 {
+		t.Errorf("After pruning, %d days remain, want 5", len(days))
+	}
+}
+
+func TestTrackTasksFairness(t *testing.T) {
+	state, _ := loadState("")
+	r := &refresher{state: state, cfg: Config{Fairness: FairnessConfig{Enabled: true}}}
+
+	alex, sam := "u1", "u2"
+	td := todoistData{
+		Projects: map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Collaborators: map[string]todoist.Collaborator{
+			"u1": {ID: "u1", FullName: "Alex"},
+			"u2": {ID: "u2", FullName: "Sam"},
+		},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Responsible: &alex},
+		},
+	}
+	now := time.Now()
+	track := func() {
+		t.Helper()
+		if !r.trackTasks(context.Background(), td, now) {
+			t.Errorf("trackTasks failed")
+		}
+	}
+	track() // baseline only
+
+	for i := 2; i <= 4; i++ {
+		id := fmt.Sprint(i)
+		td.Items[id] = todoist.Item{ID: id, ProjectID: "p1", Responsible: &sam}
+	}
+	track()
+	// Reassigning counts as an assignment to the new person.
+	td.Items["1"] = todoist.Item{ID: "1", ProjectID: "p1", Responsible: &sam}
+	track()
+	delete(td.Items, "1")
+	delete(td.Items, "2")
+	track()
+	track() // nothing new
+
+	var got map[string]fairnessCount
+	state.View(func(st *State) { got = st.Fairness[now.Format("2006-01-02")] })
+	want := map[string]fairnessCount{"Sam": {Assigned: 4, Completed: 2}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Tallies = %v, want %v", got, want)
+	}
+}
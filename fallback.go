@@ -0,0 +1,229 @@
+package main
+
+// Font fallback, for glyphs (such as emoji) that the main font lacks.
+// Glyphs that no font has are drawn as a replacement character, and noted for /api/glyphs.
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fallbackFace is a font.Face that draws each glyph using the first face that has it.
+// Like other faces, it is not safe for concurrent use.
+type fallbackFace struct {
+	faces []font.Face
+	fonts []*opentype.Font // parallel to faces
+	buf   sfnt.Buffer
+
+	missing *missingGlyphs // may be nil
+}
+
+// missingGlyphs records the runes that no font could draw.
+// It is shared by all the renderer's faces, and is safe for concurrent use.
+type missingGlyphs struct {
+	replacement rune // drawn instead of a missing rune
+
+	mu   sync.Mutex
+	seen map[rune]*missingGlyph
+}
+
+type missingGlyph struct {
+	Rune      string    `json:"rune"`
+	Code      string    `json:"code"` // such as U+1F6D2
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func newMissingGlyphs(replacement rune) *missingGlyphs {
+	return &missingGlyphs{
+		replacement: replacement,
+		seen:        make(map[rune]*missingGlyph),
+	}
+}
+
+// note records that r is missing, logging it the first time.
+func (mg *missingGlyphs) note(r rune) {
+	now := time.Now()
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	if g, ok := mg.seen[r]; ok {
+		g.LastSeen = now
+		return
+	}
+	code := fmt.Sprintf("U+%04X", r)
+	log.Printf("No font has a glyph for %q (%s); drawing %q instead", r, code, mg.replacement)
+	mg.seen[r] = &missingGlyph{
+		Rune:      string(r),
+		Code:      code,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+}
+
+// Glyphs returns the missing runes seen so far, in order.
+func (mg *missingGlyphs) Glyphs() []missingGlyph {
+	if mg == nil {
+		return nil
+	}
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	var gs []missingGlyph
+	for _, g := range mg.seen {
+		gs = append(gs, *g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].Code < gs[j].Code })
+	return gs
+}
+
+// pick returns the face to use for r, or nil if none of them have it.
+func (ff *fallbackFace) pick(r rune) font.Face {
+	for i, f := range ff.fonts {
+		if x, err := f.GlyphIndex(&ff.buf, r); err == nil && x != 0 {
+			return ff.faces[i]
+		}
+	}
+	return nil
+}
+
+// invisibleRune reports whether r is only a modifier that can be dropped
+// when no font supports it, such as an emoji variation selector.
+func invisibleRune(r rune) bool {
+	return r == '\u200d' || r == '\ufe0e' || r == '\ufe0f' // ZWJ and variation selectors
+}
+
+// face returns the face to use for r, and the rune to draw with it
+// in place of r. The third result is false if r should be skipped entirely.
+func (ff *fallbackFace) face(r rune) (font.Face, rune, bool) {
+	if f := ff.pick(r); f != nil {
+		return f, r, true
+	}
+	if invisibleRune(r) {
+		return nil, 0, false
+	}
+	if ff.missing != nil {
+		ff.missing.note(r)
+		if f := ff.pick(ff.missing.replacement); f != nil {
+			return f, ff.missing.replacement, true
+		}
+	}
+	// Nothing has it, so let the main font draw its missing glyph box.
+	return ff.faces[0], r, true
+}
+
+func (ff *fallbackFace) Close() error {
+	for _, f := range ff.faces {
+		f.Close()
+	}
+	return nil
+}
+
+func (ff *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	f, r, ok := ff.face(r)
+	if !ok {
+		return
+	}
+	return f.Glyph(dot, r)
+}
+
+func (ff *fallbackFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	f, r, ok := ff.face(r)
+	if !ok {
+		return
+	}
+	return f.GlyphBounds(r)
+}
+
+func (ff *fallbackFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	f, r, ok := ff.face(r)
+	if !ok {
+		return
+	}
+	return f.GlyphAdvance(r)
+}
+
+func (ff *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	// Only kern between glyphs from the same font.
+	f0, f1 := ff.pick(r0), ff.pick(r1)
+	if f0 == nil || f0 != f1 {
+		return 0
+	}
+	return f0.Kern(r0, r1)
+}
+
+func (ff *fallbackFace) Metrics() font.Metrics { return ff.faces[0].Metrics() }
+
+// addFallbackFonts wraps each of the renderer's faces so that glyphs
+// missing from its font are drawn using the given fonts, in order,
+// or else as r.missing's replacement.
+func (r *renderer) addFallbackFonts(filenames []string, dpi float64) error {
+	var fonts []*opentype.Font
+	for _, filename := range filenames {
+		fdata, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("loading fallback font file: %w", err)
+		}
+		f, err := opentype.Parse(fdata)
+		if err != nil {
+			return fmt.Errorf("parsing fallback font %s: %w", filename, err)
+		}
+		fonts = append(fonts, f)
+	}
+
+	wrap := func(face font.Face, mainFont *opentype.Font, size float64) (font.Face, error) {
+		ff := &fallbackFace{
+			faces:   []font.Face{face},
+			fonts:   []*opentype.Font{mainFont},
+			missing: r.missing,
+		}
+		for _, f := range fonts {
+			fb, err := opentype.NewFace(f, &opentype.FaceOptions{
+				Size: size, // points
+				DPI:  dpi,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("making fallback font face: %w", err)
+			}
+			ff.faces = append(ff.faces, fb)
+			ff.fonts = append(ff.fonts, f)
+		}
+		return ff, nil
+	}
+
+	bold := make(map[font.Face]font.Face)
+	for _, fp := range []struct {
+		face *font.Face
+		size float64
+	}{
+		{&r.tiny, 10},
+		{&r.small, 12},
+		{&r.normal, 16},
+		{&r.large, 20},
+		{&r.xlarge, 36},
+	} {
+		orig := *fp.face
+		wrapped, err := wrap(orig, r.font, fp.size)
+		if err != nil {
+			return err
+		}
+		*fp.face = wrapped
+		if bf, ok := r.bold[orig]; ok {
+			if bold[wrapped], err = wrap(bf, r.boldFont, fp.size); err != nil {
+				return err
+			}
+		}
+	}
+	if r.bold != nil {
+		r.bold = bold
+	}
+	return nil
+}
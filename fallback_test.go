@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+func TestFallbackFace(t *testing.T) {
+	var faces []font.Face
+	var fonts []*opentype.Font
+	for _, ttf := range [][]byte{gobold.TTF, goregular.TTF} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			t.Fatalf("Parsing font: %v", err)
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 12, DPI: 72})
+		if err != nil {
+			t.Fatalf("Making face: %v", err)
+		}
+		fonts = append(fonts, f)
+		faces = append(faces, face)
+	}
+	ff := &fallbackFace{faces: faces, fonts: fonts}
+
+	if got := ff.pick('a'); got != faces[0] {
+		t.Errorf("pick('a') didn't use the main face")
+	}
+	if got := ff.pick('🛒'); got != nil {
+		t.Errorf("pick('🛒') found a face, but neither font has it")
+	}
+
+	// Variation selectors take no space if no font has them.
+	plain := font.MeasureString(ff, "★ star")
+	if got := font.MeasureString(ff, "★️ star"); got != plain {
+		t.Errorf("Variation selector changed width from %v to %v", plain, got)
+	}
+}
+
+func TestMissingGlyphReplacement(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parsing font: %v", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 12, DPI: 72})
+	if err != nil {
+		t.Fatalf("Making face: %v", err)
+	}
+	mg := newMissingGlyphs('?')
+	ff := &fallbackFace{faces: []font.Face{face}, fonts: []*opentype.Font{f}, missing: mg}
+
+	if got, want := font.MeasureString(ff, "a🛒b"), font.MeasureString(ff, "a?b"); got != want {
+		t.Errorf("Missing glyph measures %v, want %v as for its replacement", got, want)
+	}
+	font.MeasureString(ff, "🛒 and 🥕")
+	gs := mg.Glyphs()
+	if len(gs) != 2 {
+		t.Fatalf("Glyphs() = %+v, want two", gs)
+	}
+	if gs[0].Rune != "🛒" || gs[1].Rune != "🥕" {
+		t.Errorf("Glyphs() = %+v, want 🛒 then 🥕", gs)
+	}
+	if gs[0].LastSeen.Before(gs[0].FirstSeen) {
+		t.Errorf("LastSeen %v is before FirstSeen %v", gs[0].LastSeen, gs[0].FirstSeen)
+	}
+}
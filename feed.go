@@ -0,0 +1,115 @@
+package main
+
+// An Atom feed of the tasks completed in shared projects over the last week,
+// so that family without Todoist accounts can follow along in a feed reader.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// completedFeedWindow is how long completed tasks stay in the feed.
+const completedFeedWindow = 7 * 24 * time.Hour
+
+// completedTask is a task that was completed, as recorded for the feed.
+type completedTask struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+	openTask
+}
+
+// pruneCompletedTasks drops tasks completed before the window.
+func pruneCompletedTasks(tasks []completedTask, now time.Time) []completedTask {
+	var kept []completedTask
+	for _, ct := range tasks {
+		if now.Sub(ct.At) < completedFeedWindow {
+			kept = append(kept, ct)
+		}
+	}
+	return kept
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author"`
+	Summary string      `xml:"summary"`
+}
+
+// completedFeed makes the feed of tasks completed within the window, most recent first.
+// self is the feed's own URL, which is also its ID.
+func completedFeed(tasks []completedTask, self string, now time.Time) ([]byte, error) {
+	tasks = pruneCompletedTasks(tasks, now)
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].At.After(tasks[j].At) })
+
+	feed := atomFeed{
+		Title:  "Completed tasks",
+		ID:     self,
+		Link:   atomLink{Rel: "self", Href: self},
+		Author: atomAuthor{Name: "kitchenthing"},
+		// With nothing completed, the feed is unchanged since the window began.
+		Updated: now.Add(-completedFeedWindow).Format(time.RFC3339),
+	}
+	if len(tasks) > 0 {
+		feed.Updated = tasks[0].At.Format(time.RFC3339)
+	}
+	for _, ct := range tasks {
+		entry := atomEntry{
+			Title: ct.Content,
+			// Tasks can be completed again (e.g. recurring ones), so the time is part of the ID.
+			ID:      fmt.Sprintf("%s#%s-%d", self, ct.ID, ct.At.Unix()),
+			Updated: ct.At.Format(time.RFC3339),
+			Summary: "Completed in " + ct.Project,
+		}
+		if ct.Assignee != "" {
+			entry.Author = &atomAuthor{Name: ct.Assignee}
+			entry.Summary += " by " + ct.Assignee
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	raw, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), raw...), nil
+}
+
+func (s *server) serveCompletedFeed(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.CompletedFeed {
+		http.NotFound(w, r)
+		return
+	}
+	var tasks []completedTask
+	s.state.View(func(st *State) { tasks = append(tasks, st.CompletedTasks...) })
+
+	raw, err := completedFeed(tasks, "http://"+r.Host+"/completed.atom", time.Now())
+	if err != nil {
+		http.Error(w, "Internal error encoding feed: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	writeBody(w, r, raw)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestCompletedFeed(t *testing.T) {
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.UTC)
+	tasks := []completedTask{
+		{ID: "1", At: now.Add(-2 * time.Hour), openTask: openTask{Content: "Take out bins", Project: "House", Assignee: "David"}},
+		{ID: "2", At: now.Add(-8 * 24 * time.Hour), openTask: openTask{Content: "Too old", Project: "House"}},
+		{ID: "3", At: now.Add(-time.Hour), openTask: openTask{Content: "Feed the cat", Project: "Pets"}},
+	}
+	raw, err := completedFeed(tasks, "http://kitchen/completed.atom", now)
+	if err != nil {
+		t.Fatalf("completedFeed: %v", err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(raw, &feed); err != nil {
+		t.Fatalf("Feed doesn't parse: %v\n%s", err, raw)
+	}
+	if feed.Updated != "2024-06-12T08:00:00Z" {
+		t.Errorf("Feed updated %q, want the latest completion", feed.Updated)
+	}
+	var got []string
+	for _, e := range feed.Entries {
+		got = append(got, e.Title+": "+e.Summary)
+	}
+	want := []string{"Feed the cat: Completed in Pets", "Take out bins: Completed in House by David"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Feed entries = %q, want %q", got, want)
+	}
+	if e := feed.Entries[1]; e.Author == nil || e.Author.Name != "David" {
+		t.Errorf("Entry for an assigned task has author %+v, want David", e.Author)
+	}
+}
+
+func TestTrackTasksCompletedFeed(t *testing.T) {
+	state, _ := loadState("")
+	r := &refresher{state: state, cfg: Config{CompletedFeed: true}}
+	td := todoistData{
+		Projects: map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "Take out bins"},
+			"2": {ID: "2", ProjectID: "p1", Content: "Clean gutters"},
+		},
+	}
+	now := time.Now()
+	r.trackTasks(context.Background(), td, now) // baseline only
+	delete(td.Items, "1")
+	r.trackTasks(context.Background(), td, now)
+	r.trackTasks(context.Background(), td, now) // nothing new
+
+	var got []completedTask
+	state.View(func(st *State) { got = st.CompletedTasks })
+	if len(got) != 1 || got[0].ID != "1" || got[0].Content != "Take out bins" {
+		t.Errorf("Completed tasks = %+v, want just Take out bins", got)
+	}
+
+	s := &server{state: state, cfg: r.cfg}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/completed.atom", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Errorf("GET /completed.atom: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	s.cfg.CompletedFeed = false
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/completed.atom", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /completed.atom when not configured: %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+// Footer layout.
+
+import (
+	"fmt"
+)
+
+// FooterConfig controls what is shown at the bottom of the display.
+type FooterConfig struct {
+	// Order lists the footer sections from top to bottom.
+	// The sections are "notes", "hass" and "alerts", which is the default order.
+	Order []string `yaml:"order"`
+
+	// MaxAlerts, if positive, is the most alert lines to show.
+	// Any more are summarised as "+k more".
+	MaxAlerts int `yaml:"max_alerts"`
+
+	// MaxHeightPercent, if positive, limits the footer to that
+	// share of the display height, so the task list keeps its space.
+	MaxHeightPercent int `yaml:"max_height_percent"`
+
+	// Completions shows a tiny bar chart of how many tasks in shared projects
+	// were completed on each of the last week's days, at the right of the footer.
+	Completions bool `yaml:"completions"`
+}
+
+var footerSections = []string{"notes", "hass", "alerts"}
+
+func (fc FooterConfig) validate() error {
+	seen := make(map[string]bool)
+	for _, sec := range fc.Order {
+		if sec != "notes" && sec != "hass" && sec != "alerts" {
+			return fmt.Errorf("unknown footer section %q", sec)
+		}
+		if seen[sec] {
+			return fmt.Errorf("footer section %q listed twice", sec)
+		}
+		seen[sec] = true
+	}
+	if fc.MaxHeightPercent < 0 || fc.MaxHeightPercent > 100 {
+		return fmt.Errorf("footer max_height_percent %d out of range", fc.MaxHeightPercent)
+	}
+	return nil
+}
+
+// footerLine is a single line of the footer.
+// Exactly one field is set.
+type footerLine struct {
+	alert *alertLine
+	more  int    // number of alerts not shown
+	note  string // a line of the household notes
+	text  string // plain text, such as a Home Assistant state
+}
+
+// layoutFooter picks the footer lines to show, from top to bottom,
+// given room for at most maxLines. Alerts give way before anything else,
+// then Home Assistant states.
+func layoutFooter(fc FooterConfig, notes, hass []string, alerts []alertLine, maxLines int) []footerLine {
+	if maxLines <= 0 {
+		return nil
+	}
+	order := fc.Order
+	if len(order) == 0 {
+		order = footerSections
+	}
+	// Sections that aren't shown don't take any room.
+	listed := make(map[string]bool)
+	for _, sec := range order {
+		listed[sec] = true
+	}
+	if !listed["notes"] {
+		notes = nil
+	}
+	if !listed["hass"] {
+		hass = nil
+	}
+	if len(notes) > maxLines {
+		notes = notes[:maxLines]
+	}
+	if len(hass) > maxLines-len(notes) {
+		hass = hass[:maxLines-len(notes)]
+	}
+	limit := maxLines - len(notes) - len(hass)
+	if fc.MaxAlerts > 0 && fc.MaxAlerts < limit {
+		limit = fc.MaxAlerts
+	}
+
+	var alertSec []footerLine
+	if len(alerts) <= limit {
+		for i := range alerts {
+			alertSec = append(alertSec, footerLine{alert: &alerts[i]})
+		}
+	} else if limit > 0 {
+		// Use the last line to summarise what doesn't fit.
+		shown := alerts[:limit-1]
+		for i := range shown {
+			alertSec = append(alertSec, footerLine{alert: &shown[i]})
+		}
+		more := 0
+		for _, a := range alerts[len(shown):] {
+			more += a.Count
+		}
+		alertSec = append(alertSec, footerLine{more: more})
+	}
+
+	var lines []footerLine
+	for _, sec := range order {
+		switch sec {
+		case "notes":
+			for _, txt := range notes {
+				lines = append(lines, footerLine{note: txt})
+			}
+		case "hass":
+			for _, txt := range hass {
+				lines = append(lines, footerLine{text: txt})
+			}
+		case "alerts":
+			lines = append(lines, alertSec...)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLayoutFooter(t *testing.T) {
+	alerts := []alertLine{
+		{Summary: "A", Count: 1},
+		{Summary: "B", Count: 2},
+		{Summary: "C", Count: 1},
+		{Summary: "D", Count: 1},
+	}
+	notes := []string{"Out of milk"}
+	hass := []string{"Outside: 12 °C"}
+
+	describe := func(lines []footerLine) []string {
+		var out []string
+		for _, l := range lines {
+			switch {
+			case l.alert != nil:
+				out = append(out, l.alert.Summary)
+			case l.more > 0:
+				out = append(out, fmt.Sprintf("+%d", l.more))
+			case l.note != "":
+				out = append(out, "note: "+l.note)
+			default:
+				out = append(out, l.text)
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		desc     string
+		fc       FooterConfig
+		maxLines int
+		want     []string
+	}{
+		{"everything fits", FooterConfig{}, 10, []string{"note: Out of milk", "Outside: 12 °C", "A", "B", "C", "D"}},
+		{"alerts first", FooterConfig{Order: []string{"alerts", "hass"}}, 10, []string{"A", "B", "C", "D", "Outside: 12 °C"}},
+		{"max alerts", FooterConfig{MaxAlerts: 2}, 10, []string{"note: Out of milk", "Outside: 12 °C", "A", "+4"}},
+		{"no room", FooterConfig{}, 4, []string{"note: Out of milk", "Outside: 12 °C", "A", "+4"}},
+		{"only hass", FooterConfig{Order: []string{"hass", "alerts"}}, 1, []string{"Outside: 12 °C"}},
+		{"only notes", FooterConfig{}, 1, []string{"note: Out of milk"}},
+		{"nothing", FooterConfig{}, 0, nil},
+	}
+	for _, test := range tests {
+		got := describe(layoutFooter(test.fc, notes, hass, alerts, test.maxLines))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+// The weather forecast shown next to the date: the current conditions and temperature,
+// and today's low, high and chance of precipitation. It comes from Open-Meteo
+// (https://open-meteo.com), which needs no account, or a Home Assistant weather entity.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+type ForecastConfig struct {
+	// Provider is "open-meteo" or "hass". If it is unset, no forecast is shown.
+	Provider string `yaml:"provider"`
+
+	// For open-meteo, where to forecast, in degrees.
+	Latitude   float64 `yaml:"latitude"`
+	Longitude  float64 `yaml:"longitude"`
+	Fahrenheit bool    `yaml:"fahrenheit"` // show temperatures in Fahrenheit instead of Celsius
+
+	// For hass, a weather entity, such as "weather.home". Temperatures are in its units.
+	Entity string `yaml:"entity"`
+}
+
+func (fc ForecastConfig) validate(hass HASSConfig) error {
+	switch fc.Provider {
+	case "":
+	case "open-meteo":
+		if fc.Latitude == 0 && fc.Longitude == 0 {
+			return fmt.Errorf("open-meteo needs a latitude and longitude")
+		}
+		if math.Abs(fc.Latitude) > 90 || math.Abs(fc.Longitude) > 180 {
+			return fmt.Errorf("latitude or longitude out of range")
+		}
+	case "hass":
+		if hass.URL == "" {
+			return fmt.Errorf("hass provider needs Home Assistant to be configured")
+		}
+		if domain, _, _ := strings.Cut(fc.Entity, "."); domain != "weather" {
+			return fmt.Errorf("hass provider needs a weather entity, not %q", fc.Entity)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q (want open-meteo or hass)", fc.Provider)
+	}
+	return nil
+}
+
+// forecast is the weather to show. Temperatures are rounded, since that's how they are shown.
+type forecast struct {
+	Condition string // a key of weatherIcons, or empty if there's no icon for it
+	Temp      int    // now
+
+	HasDaily  bool // whether the rest is known
+	Low, High int
+	Rain      int // chance of precipitation, in percent
+}
+
+// forecastMaxAge is how long to keep showing a forecast when fetching a new one fails.
+const forecastMaxAge = time.Hour
+
+// fetchForecast updates the forecast to show, keeping the previous one for a while if that fails.
+// It reports whether fetching worked.
+func (r *refresher) fetchForecast(ctx context.Context, dd *displayData, now time.Time) (ok bool) {
+	fc, err := fetchForecast(ctx, r.hass, r.cfg.Weather.Forecast)
+	if err != nil {
+		log.Printf("Fetching weather forecast from %s: %v", r.cfg.Weather.Forecast.Provider, err)
+		if r.forecast != nil && now.Sub(r.forecastAt) < forecastMaxAge {
+			dd.forecast = r.forecast
+		}
+		return false
+	}
+	r.forecast, r.forecastAt = &fc, now
+	dd.forecast = &fc
+	return true
+}
+
+func fetchForecast(ctx context.Context, hass *HASS, cfg ForecastConfig) (forecast, error) {
+	if cfg.Provider == "hass" {
+		return fetchHASSForecast(ctx, hass, cfg.Entity)
+	}
+	return fetchOpenMeteo(ctx, cfg)
+}
+
+// openMeteoURL is the Open-Meteo forecast API. Tests change it.
+var openMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+func fetchOpenMeteo(ctx context.Context, cfg ForecastConfig) (forecast, error) {
+	q := url.Values{
+		"latitude":      {strconv.FormatFloat(cfg.Latitude, 'f', -1, 64)},
+		"longitude":     {strconv.FormatFloat(cfg.Longitude, 'f', -1, 64)},
+		"current":       {"temperature_2m,weather_code"},
+		"daily":         {"temperature_2m_min,temperature_2m_max,precipitation_probability_max"},
+		"timezone":      {"auto"},
+		"forecast_days": {"1"},
+	}
+	if cfg.Fahrenheit {
+		q.Set("temperature_unit", "fahrenheit")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", openMeteoURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return forecast{}, fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return forecast{}, fmt.Errorf("HTTP GET: %w", err)
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return forecast{}, fmt.Errorf("reading HTTP response body: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return forecast{}, fmt.Errorf("non-200 response: %s", resp.Status)
+	}
+	var om struct {
+		Current struct {
+			Temp float64 `json:"temperature_2m"`
+			Code int     `json:"weather_code"`
+		} `json:"current"`
+		Daily struct {
+			Min  []float64 `json:"temperature_2m_min"`
+			Max  []float64 `json:"temperature_2m_max"`
+			Rain []*int    `json:"precipitation_probability_max"`
+		} `json:"daily"`
+	}
+	if err := json.Unmarshal(raw, &om); err != nil {
+		return forecast{}, fmt.Errorf("decoding JSON: %w", err)
+	}
+	fc := forecast{
+		Condition: wmoCondition(om.Current.Code),
+		Temp:      round(om.Current.Temp),
+	}
+	if d := om.Daily; len(d.Min) > 0 && len(d.Max) > 0 && len(d.Rain) > 0 && d.Rain[0] != nil {
+		fc.HasDaily = true
+		fc.Low, fc.High, fc.Rain = round(d.Min[0]), round(d.Max[0]), *d.Rain[0]
+	}
+	return fc, nil
+}
+
+// wmoCondition returns the condition for a WMO weather interpretation code, as Open-Meteo uses.
+func wmoCondition(code int) string {
+	switch {
+	case code == 0:
+		return "clear"
+	case code == 1 || code == 2:
+		return "partlycloudy"
+	case code == 3:
+		return "cloudy"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 67, code >= 80 && code <= 82:
+		return "rain"
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return "snow"
+	case code >= 95 && code <= 99:
+		return "storm"
+	}
+	return ""
+}
+
+// hassConditions maps the conditions of Home Assistant weather entities to ours.
+// https://developers.home-assistant.io/docs/core/entity/weather/#recommended-values-for-state-and-condition
+var hassConditions = map[string]string{
+	"clear-night":     "clear",
+	"sunny":           "clear",
+	"partlycloudy":    "partlycloudy",
+	"cloudy":          "cloudy",
+	"windy-variant":   "cloudy",
+	"fog":             "fog",
+	"rainy":           "rain",
+	"pouring":         "rain",
+	"snowy":           "snow",
+	"snowy-rainy":     "snow",
+	"hail":            "snow",
+	"lightning":       "storm",
+	"lightning-rainy": "storm",
+}
+
+func fetchHASSForecast(ctx context.Context, hass *HASS, entity string) (forecast, error) {
+	var ent struct {
+		State      string `json:"state"`
+		Attributes struct {
+			Temperature *float64 `json:"temperature"`
+		} `json:"attributes"`
+	}
+	if err := hass.get(ctx, "/api/states/"+url.PathEscape(entity), &ent); err != nil {
+		return forecast{}, fmt.Errorf("getting state of %s: %w", entity, err)
+	}
+	if ent.Attributes.Temperature == nil {
+		// Probably "unavailable".
+		return forecast{}, fmt.Errorf("%s has no temperature; its state is %q", entity, ent.State)
+	}
+	fc := forecast{
+		Condition: hassConditions[ent.State],
+		Temp:      round(*ent.Attributes.Temperature),
+	}
+
+	var resp map[string]struct {
+		Forecast []struct {
+			Temp    *float64 `json:"temperature"`
+			TempLow *float64 `json:"templow"`
+			Rain    *float64 `json:"precipitation_probability"`
+		} `json:"forecast"`
+	}
+	data := map[string]string{"entity_id": entity, "type": "daily"}
+	if err := hass.CallServiceWithResponse(ctx, "weather.get_forecasts", data, &resp); err != nil {
+		return forecast{}, fmt.Errorf("getting forecast for %s: %w", entity, err)
+	}
+	// The first daily forecast is today's.
+	if days := resp[entity].Forecast; len(days) > 0 && days[0].Temp != nil && days[0].TempLow != nil && days[0].Rain != nil {
+		fc.HasDaily = true
+		fc.Low, fc.High, fc.Rain = round(*days[0].TempLow), round(*days[0].Temp), round(*days[0].Rain)
+	}
+	return fc, nil
+}
+
+func round(x float64) int { return int(math.Round(x)) }
+
+// planWeather plans the forecast block beside the date: the condition's icon, then the
+// current temperature over today's range and chance of precipitation, marked by a drop.
+// The height is how far the block reaches above the baseline of its last line, and
+// the returned function draws it with the right end of that baseline at the given point.
+func (r renderer) planWeather(f *frame) (width, height int, draw func(baseline image.Point)) {
+	fc := f.data.forecast
+	if fc == nil {
+		return 0, 0, nil
+	}
+	const gap = 4 // pixels between the icon and the text
+	big, small := r.normal, r.small
+
+	now := fmt.Sprintf("%d°", fc.Temp)
+	textWidth := font.MeasureString(big, now).Ceil()
+	height = big.Metrics().Ascent.Ceil()
+	var today, rain string
+	drop := small.Metrics().Ascent.Ceil() // size of the drop icon
+	if fc.HasDaily {
+		today, rain = fmt.Sprintf("%d–%d° ", fc.Low, fc.High), fmt.Sprintf("%d%%", fc.Rain)
+		textWidth = max(textWidth, font.MeasureString(small, today).Ceil()+drop+font.MeasureString(small, rain).Ceil())
+		height += small.Metrics().Height.Ceil()
+	}
+	icon, hasIcon := weatherIcons[fc.Condition]
+	width = textWidth
+	if hasIcon {
+		width += height + gap
+	}
+
+	return width, height, func(bl image.Point) {
+		bl.X -= textWidth
+		if today != "" {
+			tr := r.writeText(f.dst, bl, bottomLeft, color.Black, small, today)
+			drawGlyph(f.dst, image.Rect(tr.X, bl.Y-drop, tr.X+drop, bl.Y), color.Black, rainDropIcon)
+			r.writeText(f.dst, image.Pt(tr.X+drop, bl.Y), bottomLeft, color.Black, small, rain)
+			bl.Y -= small.Metrics().Height.Ceil()
+		}
+		r.writeText(f.dst, bl, bottomLeft, color.Black, big, now)
+		if hasIcon {
+			col := color.Color(color.Black)
+			if fc.Condition == "clear" {
+				col = f.accentCol
+			}
+			box := image.Rect(bl.X-gap-height, bl.Y-big.Metrics().Ascent.Ceil(), bl.X-gap, bl.Y-big.Metrics().Ascent.Ceil()+height)
+			drawGlyph(f.dst, box, col, icon)
+		}
+	}
+}
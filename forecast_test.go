@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchOpenMeteo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("latitude"); got != "-33.87" {
+			t.Errorf("latitude = %q, want -33.87", got)
+		}
+		if got := r.FormValue("temperature_unit"); got != "" {
+			t.Errorf("temperature_unit = %q, want the default", got)
+		}
+		fmt.Fprint(w, `{
+			"current": {"time": "2024-06-03T09:00", "temperature_2m": 17.6, "weather_code": 61},
+			"daily": {
+				"time": ["2024-06-03"],
+				"temperature_2m_min": [11.5],
+				"temperature_2m_max": [19.4],
+				"precipitation_probability_max": [80]
+			}
+		}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { openMeteoURL = u }(openMeteoURL)
+	openMeteoURL = srv.URL
+
+	cfg := ForecastConfig{Provider: "open-meteo", Latitude: -33.87, Longitude: 151.21}
+	got, err := fetchForecast(context.Background(), nil, cfg)
+	if err != nil {
+		t.Fatalf("fetchForecast: %v", err)
+	}
+	want := forecast{Condition: "rain", Temp: 18, HasDaily: true, Low: 12, High: 19, Rain: 80}
+	if got != want {
+		t.Errorf("fetchForecast = %+v, want %+v", got, want)
+	}
+}
+
+func TestFetchHASSForecast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/states/weather.home":
+			fmt.Fprint(w, `{"state": "partlycloudy", "attributes": {"temperature": 21.2, "temperature_unit": "°C"}}`)
+		case "/api/services/weather/get_forecasts":
+			if _, ok := r.URL.Query()["return_response"]; !ok {
+				t.Errorf("weather.get_forecasts called without return_response")
+			}
+			var data map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data["type"] != "daily" {
+				t.Errorf("weather.get_forecasts called with %v (%v), want a daily forecast", data, err)
+			}
+			fmt.Fprint(w, `{"changed_states": [], "service_response": {"weather.home": {"forecast": [
+				{"datetime": "2024-06-03T00:00:00+10:00", "condition": "rainy", "temperature": 23, "templow": 14, "precipitation_probability": 35},
+				{"datetime": "2024-06-04T00:00:00+10:00", "condition": "sunny", "temperature": 25, "templow": 15, "precipitation_probability": 0}
+			]}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	hass := NewHASS(HASSConfig{URL: srv.URL})
+
+	got, err := fetchForecast(context.Background(), hass, ForecastConfig{Provider: "hass", Entity: "weather.home"})
+	if err != nil {
+		t.Fatalf("fetchForecast: %v", err)
+	}
+	want := forecast{Condition: "partlycloudy", Temp: 21, HasDaily: true, Low: 14, High: 23, Rain: 35}
+	if got != want {
+		t.Errorf("fetchForecast = %+v, want %+v", got, want)
+	}
+
+	if _, err := fetchForecast(context.Background(), hass, ForecastConfig{Provider: "hass", Entity: "weather.missing"}); err == nil {
+		t.Errorf("fetchForecast of a missing entity succeeded")
+	}
+}
+
+func TestForecastConfig(t *testing.T) {
+	hass := HASSConfig{URL: "http://homeassistant.local:8123"}
+	for _, test := range []struct {
+		fc   ForecastConfig
+		hass HASSConfig
+		ok   bool
+	}{
+		{ForecastConfig{}, HASSConfig{}, true},
+		{ForecastConfig{Provider: "open-meteo", Latitude: 52.37, Longitude: 4.9}, HASSConfig{}, true},
+		{ForecastConfig{Provider: "open-meteo"}, HASSConfig{}, false},
+		{ForecastConfig{Provider: "open-meteo", Latitude: 95, Longitude: 4.9}, HASSConfig{}, false},
+		{ForecastConfig{Provider: "hass", Entity: "weather.home"}, hass, true},
+		{ForecastConfig{Provider: "hass", Entity: "weather.home"}, HASSConfig{}, false},
+		{ForecastConfig{Provider: "hass", Entity: "sensor.temperature"}, hass, false},
+		{ForecastConfig{Provider: "bom"}, HASSConfig{}, false},
+	} {
+		err := test.fc.validate(test.hass)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validate(%+v) = %v, want ok=%t", test.fc, err, test.ok)
+		}
+	}
+}
+
+func TestWeatherIcons(t *testing.T) {
+	for code := 0; code < 100; code++ {
+		if c := wmoCondition(code); c != "" && weatherIcons[c] == nil {
+			t.Errorf("WMO code %d has condition %q, which has no icon", code, c)
+		}
+	}
+	for state, c := range hassConditions {
+		if weatherIcons[c] == nil {
+			t.Errorf("Home Assistant condition %q maps to %q, which has no icon", state, c)
+		}
+	}
+	icons := map[string]glyphBitmap{"drop": rainDropIcon}
+	for c, icon := range weatherIcons {
+		icons[c] = icon
+	}
+	for name, icon := range icons {
+		for i, row := range icon {
+			if len(row) != len(icon[0]) {
+				t.Errorf("Row %d of the %s icon is %d wide, want %d", i, name, len(row), len(icon[0]))
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+// Pipelining panel refreshes. A full refresh of the panel blocks for many seconds,
+// so frames are rendered offscreen and the panel is refreshed in the background,
+// letting the next frame be fetched and rendered in the meantime.
+//
+// Frames are compared pixel for pixel with the one before, so the panel isn't refreshed
+// for a frame that looks the same, even if the data behind it changed.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+
+	rpio "github.com/stianeikeland/go-rpio/v4"
+)
+
+// frameBuffers is a pair of offscreen frames: the front one was last sent to the panel,
+// and the back one is for rendering the next frame into.
+type frameBuffers struct {
+	front, back *image.Paletted
+}
+
+func newFrameBuffers(bounds image.Rectangle) *frameBuffers {
+	return &frameBuffers{
+		front: image.NewPaletted(bounds, staticPalette),
+		back:  image.NewPaletted(bounds, staticPalette),
+	}
+}
+
+// Back returns the back frame, cleared to white.
+func (fb *frameBuffers) Back() *image.Paletted {
+	draw.Draw(fb.back, fb.back.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	return fb.back
+}
+
+// Flip swaps the frames, making the back frame the front one.
+func (fb *frameBuffers) Flip() {
+	fb.front, fb.back = fb.back, fb.front
+}
+
+// frameDiff returns the bounding box of the pixels that differ between a and b,
+// which must have the same bounds and palette. It is empty if they are the same.
+func frameDiff(a, b *image.Paletted) image.Rectangle {
+	var diff image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ra := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rb := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(ra, rb) {
+			continue
+		}
+		first, last := 0, len(ra)-1
+		for ra[first] == rb[first] {
+			first++
+		}
+		for ra[last] == rb[last] {
+			last--
+		}
+		diff = diff.Union(image.Rect(bounds.Min.X+first, y, bounds.Min.X+last+1, y+1))
+	}
+	return diff
+}
+
+// regionRefresher is a display that can refresh just the region of the panel that changed.
+// None of the supported panels can yet; see paper.DisplayPartialRefresh.
+type regionRefresher interface {
+	DisplayRegionRefresh(changed image.Rectangle) error
+}
+
+// panelPipeline refreshes a display in the background, one frame at a time.
+type panelPipeline struct {
+	p      display
+	frames *frameBuffers
+
+	shown bool // whether the front frame has been sent to the panel
+
+	busy chan struct{} // non-nil while a refresh is running; closed when it finishes
+
+	led busyLED // if non-nil, driven high while a refresh is running
+
+	// refreshed, if non-nil, is called from the refresh goroutine with the frame's checksum
+	// once the panel has finished refreshing successfully.
+	refreshed func(checksum string)
+}
+
+// busyLED is an output pin, such as an rpio.Pin, that drives an external LED.
+// Seeing it stay lit tells a stuck panel apart from a stuck daemon.
+type busyLED interface {
+	High()
+	Low()
+}
+
+// gpioBusyLED sets up the pin with the given BCM number to drive a busy LED, starting off.
+// GPIO access must already be set up, which starting the panel does.
+func gpioBusyLED(gpio int) busyLED {
+	pin := rpio.Pin(gpio)
+	pin.Output()
+	pin.Low()
+	return pin
+}
+
+func newPanelPipeline(p display) *panelPipeline {
+	return &panelPipeline{
+		p:      p,
+		frames: newFrameBuffers(p.Bounds()),
+	}
+}
+
+// Back returns the frame to render the next frame into.
+// It is safe to use while a refresh is running.
+func (pp *panelPipeline) Back() draw.Image { return pp.frames.Back() }
+
+// Repaint makes the next Show refresh the whole panel, even if the frame looks the same.
+func (pp *panelPipeline) Repaint() { pp.shown = false }
+
+// Show sends the back frame to the panel, waiting for any running refresh to finish first,
+// and starts refreshing the panel. It returns once the panel is refreshing.
+// If the back frame looks the same as the front one, it does nothing, since a refresh
+// is slow and wears the panel. It reports whether it refreshed the panel.
+func (pp *panelPipeline) Show() bool {
+	changed := pp.frames.back.Bounds()
+	if pp.shown {
+		changed = frameDiff(pp.frames.back, pp.frames.front)
+		if changed.Empty() {
+			log.Printf("Frame looks the same as the last one; not refreshing the panel")
+			return false
+		}
+	}
+	pp.Wait()
+	pp.frames.Flip()
+	pp.shown = true
+
+	if pp.led != nil {
+		pp.led.High()
+	}
+	if err := pp.p.Init(); err != nil {
+		log.Printf("Initialising panel: %v", err)
+	}
+	draw.Draw(pp.p, pp.p.Bounds(), pp.frames.front, pp.frames.front.Bounds().Min, draw.Src)
+
+	sum := pp.Checksum()
+	busy := make(chan struct{})
+	pp.busy = busy
+	go func() {
+		defer close(busy)
+		var err error
+		if rr, ok := pp.p.(regionRefresher); ok && changed != pp.p.Bounds() {
+			err = rr.DisplayRegionRefresh(changed)
+		} else {
+			err = pp.p.DisplayRefresh()
+		}
+		if err != nil {
+			log.Printf("Panel: %v", err)
+		} else if pp.refreshed != nil {
+			pp.refreshed(sum)
+		}
+		pp.p.Sleep()
+		if pp.led != nil {
+			pp.led.Low()
+		}
+	}()
+	return true
+}
+
+// Checksum returns a short hash of the frame last sent to the panel,
+// so that mirrors of the panel can tell when they need to fetch it again.
+func (pp *panelPipeline) Checksum() string {
+	sum := sha256.Sum256(pp.frames.front.Pix)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Wait waits for any running refresh to finish.
+func (pp *panelPipeline) Wait() {
+	if pp.busy != nil {
+		<-pp.busy
+		pp.busy = nil
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// blockingPaper is a fakePaper whose refreshes block until released.
+type blockingPaper struct {
+	*fakePaper
+	release chan bool
+}
+
+func (bp *blockingPaper) DisplayRefresh() error {
+	<-bp.release
+	return bp.fakePaper.DisplayRefresh()
+}
+
+// failingPaper is a fakePaper whose refreshes fail.
+type failingPaper struct {
+	*fakePaper
+}
+
+func (failingPaper) DisplayRefresh() error { return errors.New("panel stuck busy") }
+
+func TestPanelPipeline(t *testing.T) {
+	bp := &blockingPaper{fakePaper: newFakePaper(), release: make(chan bool)}
+	pipe := newPanelPipeline(bp)
+
+	back := pipe.Back()
+	back.Set(1, 1, color.Black)
+	pipe.Show() // must not block on the refresh
+	if got := bp.At(1, 1); got != color.Black {
+		t.Errorf("panel pixel after Show = %v, want black", got)
+	}
+
+	// The next frame can be rendered while the panel is refreshing.
+	back = pipe.Back()
+	if got := back.At(1, 1); got != color.White {
+		t.Errorf("back frame pixel = %v, want white", got)
+	}
+	back.Set(2, 2, colorRed)
+	if got := bp.At(2, 2); got == colorRed {
+		t.Errorf("rendering the back frame changed the panel while it was refreshing")
+	}
+
+	done := make(chan bool)
+	go func() {
+		pipe.Show()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Show didn't wait for the running refresh")
+	case bp.release <- true:
+	}
+	<-done
+	if got := bp.At(2, 2); got != colorRed {
+		t.Errorf("panel pixel after second Show = %v, want red", got)
+	}
+	if got := bp.At(1, 1); got != color.White {
+		t.Errorf("panel pixel from first frame = %v, want white", got)
+	}
+
+	bp.release <- true
+	pipe.Wait()
+	if bp.refreshes != 2 {
+		t.Errorf("panel refreshed %d times, want 2", bp.refreshes)
+	}
+}
+
+func TestFrameDiff(t *testing.T) {
+	a := image.NewPaletted(image.Rect(0, 0, 40, 20), staticPalette)
+	b := image.NewPaletted(a.Bounds(), staticPalette)
+	if d := frameDiff(a, b); !d.Empty() {
+		t.Errorf("frameDiff of the same frames = %v, want empty", d)
+	}
+	b.Set(3, 4, color.Black)
+	b.Set(30, 12, colorRed)
+	if got, want := frameDiff(a, b), image.Rect(3, 4, 31, 13); got != want {
+		t.Errorf("frameDiff = %v, want %v", got, want)
+	}
+}
+
+// regionPaper is a fakePaper that can refresh just the region that changed.
+type regionPaper struct {
+	*fakePaper
+	regions []image.Rectangle
+}
+
+func (rp *regionPaper) DisplayRegionRefresh(changed image.Rectangle) error {
+	rp.regions = append(rp.regions, changed)
+	return nil
+}
+
+func TestPanelPipelineSkipsSameFrame(t *testing.T) {
+	rp := &regionPaper{fakePaper: newFakePaper()}
+	pipe := newPanelPipeline(rp)
+	show := func(x, y int) bool {
+		back := pipe.Back()
+		back.Set(x, y, color.Black)
+		refreshed := pipe.Show()
+		pipe.Wait()
+		return refreshed
+	}
+
+	// The first frame refreshes the whole panel, even though it's blank.
+	if !show(-1, -1) {
+		t.Errorf("First frame didn't refresh the panel")
+	}
+	if rp.refreshes != 1 || len(rp.regions) != 0 {
+		t.Errorf("First frame made %d full and %d region refreshes, want 1 full", rp.refreshes, len(rp.regions))
+	}
+	if show(-1, -1) {
+		t.Errorf("Same frame refreshed the panel")
+	}
+	if !show(10, 20) {
+		t.Errorf("Changed frame didn't refresh the panel")
+	}
+	if want := []image.Rectangle{image.Rect(10, 20, 11, 21)}; rp.refreshes != 1 || len(rp.regions) != 1 || rp.regions[0] != want[0] {
+		t.Errorf("Changed frame refreshed regions %v (and %d full refreshes), want %v", rp.regions, rp.refreshes, want)
+	}
+	if got := rp.At(10, 20); got != color.Black {
+		t.Errorf("Panel pixel after refresh = %v, want black", got)
+	}
+}
+
+// fakeLED records the states of a busy LED.
+type fakeLED struct {
+	states []bool
+}
+
+func (fl *fakeLED) High() { fl.states = append(fl.states, true) }
+func (fl *fakeLED) Low()  { fl.states = append(fl.states, false) }
+
+func TestPanelPipelineBusyLED(t *testing.T) {
+	bp := &blockingPaper{fakePaper: newFakePaper(), release: make(chan bool)}
+	led := new(fakeLED)
+	pipe := newPanelPipeline(bp)
+	pipe.led = led
+
+	pipe.Back().Set(1, 1, color.Black)
+	pipe.Show()
+	if len(led.states) != 1 || !led.states[0] {
+		t.Fatalf("LED states while refreshing = %v, want [true]", led.states)
+	}
+	bp.release <- true
+	pipe.Wait()
+	if want := []bool{true, false}; len(led.states) != 2 || led.states[1] {
+		t.Errorf("LED states after refreshing = %v, want %v", led.states, want)
+	}
+
+	// A frame that looks the same doesn't light it.
+	pipe.Back().Set(1, 1, color.Black)
+	pipe.Show()
+	if len(led.states) != 2 {
+		t.Errorf("LED states after skipped refresh = %v, want no change", led.states)
+	}
+}
+
+func TestPanelPipelineChecksum(t *testing.T) {
+	pipe := newPanelPipeline(newFakePaper())
+	show := func(x, y int) string {
+		pipe.Back().Set(x, y, color.Black)
+		pipe.Show()
+		pipe.Wait()
+		return pipe.Checksum()
+	}
+	first := show(1, 1)
+	if got := show(1, 1); got != first {
+		t.Errorf("Checksum of the same frame changed from %q to %q", first, got)
+	}
+	if got := show(2, 2); got == first || len(got) != 16 {
+		t.Errorf("Checksum of a changed frame = %q, want a different 16 hex digits from %q", got, first)
+	}
+}
+
+func TestPanelPipelineRefreshed(t *testing.T) {
+	bp := &blockingPaper{fakePaper: newFakePaper(), release: make(chan bool)}
+	pipe := newPanelPipeline(bp)
+	var got []string
+	pipe.refreshed = func(checksum string) { got = append(got, checksum) }
+
+	pipe.Back().Set(1, 1, color.Black)
+	pipe.Show()
+	if len(got) != 0 {
+		t.Errorf("Refreshed with %q before the panel finished refreshing", got)
+	}
+	bp.release <- true
+	pipe.Wait()
+	if want := pipe.Checksum(); len(got) != 1 || got[0] != want {
+		t.Errorf("After refreshing, refreshed with %q, want [%q]", got, want)
+	}
+
+	// A failed refresh doesn't change what is on the panel.
+	got = nil
+	pipe = newPanelPipeline(failingPaper{newFakePaper()})
+	pipe.refreshed = func(checksum string) { got = append(got, checksum) }
+	pipe.Back().Set(1, 1, color.Black)
+	pipe.Show()
+	pipe.Wait()
+	if len(got) != 0 {
+		t.Errorf("After a failed refresh, refreshed with %q, want nothing", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// Substitutions applied to all text before it is drawn, to patch around
+// characters that the configured fonts can't draw, such as "℃" → "°C".
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultGlyphSubstitutions are for characters that the usual fonts lack.
+// The config can change them, or disable one by substituting it with itself.
+var defaultGlyphSubstitutions = map[string]string{
+	"℃":   "°C",
+	"CO₂": "CO2",
+}
+
+// newGlyphSubstituter returns a replacer for the default substitutions, overridden by those in cfg.
+// Longer strings are substituted in preference to shorter ones that they contain.
+// Substitutes may not contain anything else that would be substituted,
+// so that substituting is the same however many times it is done.
+func newGlyphSubstituter(cfg map[string]string) (*strings.Replacer, error) {
+	subs := make(map[string]string)
+	for from, to := range defaultGlyphSubstitutions {
+		subs[from] = to
+	}
+	for from, to := range cfg {
+		if from == "" {
+			return nil, fmt.Errorf("can't substitute an empty string")
+		}
+		subs[from] = to
+	}
+	var froms []string
+	for from, to := range subs {
+		if from == to {
+			delete(subs, from)
+			continue
+		}
+		froms = append(froms, from)
+	}
+	sort.Slice(froms, func(i, j int) bool {
+		if len(froms[i]) != len(froms[j]) {
+			return len(froms[i]) > len(froms[j])
+		}
+		return froms[i] < froms[j]
+	})
+	var oldnew []string
+	for _, from := range froms {
+		for _, other := range froms {
+			if strings.Contains(subs[from], other) {
+				return nil, fmt.Errorf("substitute %q for %q contains %q, which is substituted too", subs[from], from, other)
+			}
+		}
+		oldnew = append(oldnew, from, subs[from])
+	}
+	return strings.NewReplacer(oldnew...), nil
+}
+
+// substitute applies the glyph substitutions to s.
+func (r renderer) substitute(s string) string {
+	if r.subst == nil {
+		return s
+	}
+	return r.subst.Replace(s)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestGlyphSubstituter(t *testing.T) {
+	tests := []struct {
+		cfg     map[string]string
+		in, out string
+	}{
+		{nil, "garden 12℃, CO₂ 450ppm", "garden 12°C, CO2 450ppm"},
+		{map[string]string{"℃": "℃"}, "garden 12℃", "garden 12℃"}, // disabled
+		{map[string]string{"℃": "C"}, "garden 12℃", "garden 12C"},
+		{map[string]string{"→": "->", "⇒": "=>"}, "a → b ⇒ c", "a -> b => c"},
+		// The longer match wins.
+		{map[string]string{"₂": "2", "H₂O": "water"}, "H₂O and CO₂ and N₂", "water and CO2 and N2"},
+	}
+	for _, test := range tests {
+		rep, err := newGlyphSubstituter(test.cfg)
+		if err != nil {
+			t.Errorf("newGlyphSubstituter(%q): %v", test.cfg, err)
+			continue
+		}
+		if got := rep.Replace(test.in); got != test.out {
+			t.Errorf("With %q, substituting %q gave %q, want %q", test.cfg, test.in, got, test.out)
+		}
+	}
+
+	for _, bad := range []map[string]string{
+		{"": "x"},
+		{"°": "deg"}, // the default ℃ → °C would then change again
+		{"a": "b", "b": "c"},
+	} {
+		if _, err := newGlyphSubstituter(bad); err == nil {
+			t.Errorf("newGlyphSubstituter(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWriteTextSubstitutes(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	rend, err := newRenderer(Config{
+		Font:               fontFile,
+		Messages:           []message{{Options: []string{"Testing"}}},
+		GlyphSubstitutions: map[string]string{"♥": "<3"},
+	}, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	draw := func(text string) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 40))
+		rend.writeText(img, image.Pt(2, 30), bottomLeft, color.Black, rend.normal, text)
+		return img
+	}
+	if got, want := draw("12℃ ♥"), draw("12°C <3"); !reflect.DeepEqual(got.Pix, want.Pix) {
+		t.Errorf("Text isn't drawn with its substitutions")
+	}
+	if rend.missing.Glyphs() != nil {
+		t.Errorf("Substituted characters were noted as missing: %+v", rend.missing.Glyphs())
+	}
+}
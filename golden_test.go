@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var updateGolden = flag.Bool("update", false, "whether to rewrite the golden images in testdata/golden instead of comparing against them")
+
+// goldenTolerance is the fraction of pixels that may differ from a golden image,
+// to allow for small differences in font rasterisation.
+const goldenTolerance = 0.001
+
+// goldenFixture is a display to render, with any changes to the default config.
+type goldenFixture struct {
+	data displayData
+	cfg  func(*Config)
+}
+
+// goldenFixtures are the displays to render, by name.
+// The date and time are fixed so that the renders don't change from day to day.
+func goldenFixtures() map[string]goldenFixture {
+	now := time.Date(2024, time.June, 12, 9, 30, 0, 0, time.Local)
+	today := time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local)
+	at := func(h, m int) time.Time { return time.Date(2024, time.June, 12, h, m, 0, 0, time.Local) }
+	tasks := []renderableTask{
+		{Priority: 4, Title: "Take out bins", HasDesc: true, Assignee: "David", Project: "House", Done: 2, Total: 3, InProgress: true},
+		{Priority: 3, Time: at(17, 30), Title: "Run the dishwasher", Project: "House", PowerHungry: true},
+		{Priority: 1, Title: "Clean gutters", Overdue: true, Project: "House"},
+	}
+	health := []integrationHealth{{"T", true}, {"A", false}}
+
+	var alerts []Alert
+	for i := 1; i <= 8; i++ {
+		alerts = append(alerts, Alert{
+			Fingerprint: fmt.Sprint(i),
+			Summary:     fmt.Sprintf("Disk %d is nearly full", i),
+			Description: "Less than 5% free space remains",
+		})
+	}
+
+	var many []renderableTask
+	for i := 1; i <= 20; i++ {
+		many = append(many, renderableTask{Priority: 1 + i%4, Title: fmt.Sprintf("Chore number %d", i), Project: "House"})
+	}
+
+	return map[string]goldenFixture{
+		"overdue": {data: displayData{
+			today: today, now: now, health: health,
+			tasks: append(tasks, renderableTask{Priority: 2, Time: at(8, 0), Title: "Feed the cat", Overdue: true, Assignee: "Alex", Project: "Pets"}),
+		}},
+		"many_alerts": {data: displayData{
+			today: today, now: now, health: health,
+			tasks:  tasks,
+			alerts: alerts,
+		}},
+		"long_titles": {data: displayData{
+			today: today, now: now, health: health,
+			tasks: []renderableTask{
+				{Priority: 4, Title: "Find the receipt for the washing machine and ring the shop about the warranty before it runs out", Project: "Household Administration"},
+				{Priority: 1, Title: strings.Repeat("very ", 30) + "long", Assignee: "Bartholomew", Project: "House"},
+			},
+		}},
+		"december": {data: displayData{
+			today: time.Date(2024, time.December, 10, 0, 0, 0, 0, time.Local),
+			now:   time.Date(2024, time.December, 10, 9, 30, 0, 0, time.Local),
+			tasks: tasks,
+		}},
+		"empty": {data: displayData{
+			today: today, now: now, health: health,
+		}},
+		"two_columns": {
+			data: displayData{today: today, now: now, health: health, tasks: many},
+			cfg:  func(cfg *Config) { cfg.Columns = columnsAuto },
+		},
+		"hass_items": {data: displayData{
+			today: today, now: now, health: health,
+			tasks:       tasks,
+			hassHeader:  []string{"Inside: 21.5 °C"},
+			hassSidebar: []string{"EV: 80%", "Washer: Idle"},
+			hassFooter:  []string{"Outside: 12.5 °C"},
+		}},
+	}
+}
+
+func TestGoldenRenders(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	zero := 0
+
+	for name, fix := range goldenFixtures() {
+		cfg := Config{
+			Font: fontFile,
+			Messages: []message{
+				{Eq: &zero, Options: []string{"All done!"}},
+				{Options: []string{"Things to do"}},
+			},
+		}
+		if fix.cfg != nil {
+			fix.cfg(&cfg)
+		}
+		rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+		if err != nil {
+			t.Fatalf("%s: newRenderer: %v", name, err)
+		}
+		img := image.NewPaletted(image.Rect(0, 0, 800, 480), staticPalette)
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+		rend.Render(img, fix.data)
+
+		filename := filepath.Join("testdata", "golden", name+".png")
+		if *updateGolden {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				t.Fatalf("Encoding %s: %v", name, err)
+			}
+			if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+				t.Fatalf("Writing golden image: %v", err)
+			}
+			continue
+		}
+
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Errorf("%s: %v (run with -update to create it)", name, err)
+			continue
+		}
+		golden, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("Decoding %s: %v", filename, err)
+			continue
+		}
+		diff, n := diffImages(img, golden)
+		// Beside the golden image, so it is still there after the test; .gitignore skips it.
+		out := filepath.Join("testdata", "golden", name+".diff.png")
+		if total := img.Bounds().Dx() * img.Bounds().Dy(); float64(n) > goldenTolerance*float64(total) {
+			var buf bytes.Buffer
+			png.Encode(&buf, diff)
+			if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+				t.Errorf("Writing differences: %v", err)
+			}
+			t.Errorf("%s: %d of %d pixels differ from %s; differences are in %s (run with -update if this is intended)", name, n, total, filename, out)
+		} else {
+			os.Remove(out) // from an earlier failure
+		}
+	}
+}
+
+// diffImages returns an image showing the pixels of a that differ from b in red,
+// over a faded copy of a, and how many there are. Pixels outside either image differ.
+func diffImages(a, b image.Image) (*image.RGBA, int) {
+	bounds := a.Bounds().Union(b.Bounds())
+	diff := image.NewRGBA(bounds)
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := image.Pt(x, y)
+			ca, cb := color.RGBAModel.Convert(a.At(x, y)), color.RGBAModel.Convert(b.At(x, y))
+			if p.In(a.Bounds()) && p.In(b.Bounds()) && ca == cb {
+				g := color.GrayModel.Convert(ca).(color.Gray)
+				diff.Set(x, y, color.Gray{Y: 192 + g.Y/4})
+				continue
+			}
+			diff.Set(x, y, colorRed)
+			n++
+		}
+	}
+	return diff, n
+}
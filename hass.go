@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Home Assistant integration.
+// https://developers.home-assistant.io/docs/api/rest/
+
+type HASSConfig struct {
+	URL   string `yaml:"url"`   // e.g. "http://homeassistant.local:8123"
+	Token string `yaml:"token"` // long-lived access token
+
+	// Footer lists entities (e.g. "sensor.outside_temperature")
+	// whose states are shown in the display footer.
+	Footer []string `yaml:"footer"`
+
+	// Items are more entity states and templates to show; see hassitems.go.
+	Items []HASSItem `yaml:"items"`
+
+	// CompletionEvents enables firing a todoist_task_completed event
+	// whenever a task in a shared project is completed.
+	CompletionEvents bool `yaml:"completion_events"`
+	// Events are further events to fire on task transitions.
+	Events []HASSEventConfig `yaml:"events"`
+
+	// Chime is a service to call when a new P1 task appears for today.
+	Chime HASSChimeConfig `yaml:"chime"`
+}
+
+type HASS struct {
+	base  string
+	token string
+}
+
+// NewHASS returns a HASS client, or nil if Home Assistant is not configured.
+func NewHASS(cfg HASSConfig) *HASS {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &HASS{
+		base:  strings.TrimSuffix(cfg.URL, "/"),
+		token: cfg.Token,
+	}
+}
+
+// hassEntity is the state of an entity, with the attributes we care about.
+type hassEntity struct {
+	State      string `json:"state"`
+	Attributes struct {
+		FriendlyName string `json:"friendly_name"`
+		Unit         string `json:"unit_of_measurement"`
+	} `json:"attributes"`
+}
+
+// String formats the entity for display, such as "Outside: 12.5 °C".
+func (e hassEntity) String() string {
+	s := e.State
+	if e.Attributes.Unit != "" {
+		s += " " + e.Attributes.Unit
+	}
+	if e.Attributes.FriendlyName != "" {
+		s = e.Attributes.FriendlyName + ": " + s
+	}
+	return s
+}
+
+// Entity returns the current state of the given entity.
+func (h *HASS) Entity(ctx context.Context, entityID string) (hassEntity, error) {
+	var ent hassEntity
+	err := h.get(ctx, "/api/states/"+url.PathEscape(entityID), &ent)
+	return ent, err
+}
+
+// State returns the current state of the given entity.
+func (h *HASS) State(ctx context.Context, entityID string) (string, error) {
+	ent, err := h.Entity(ctx, entityID)
+	if err != nil {
+		return "", err
+	}
+	return ent.State, nil
+}
+
+// NumericState returns the state of an entity that should be a number, such as a sensor's.
+func (h *HASS) NumericState(ctx context.Context, entityID string) (float64, error) {
+	state, err := h.State(ctx, entityID)
+	if err != nil {
+		return 0, fmt.Errorf("getting state of %s: %w", entityID, err)
+	}
+	v, err := strconv.ParseFloat(state, 64)
+	if err != nil {
+		// Probably "unavailable" or "unknown".
+		return 0, fmt.Errorf("state of %s is %q, not a number", entityID, state)
+	}
+	return v, nil
+}
+
+// RenderTemplate renders a template, such as "{{ states('sensor.ev_battery') }}%".
+func (h *HASS) RenderTemplate(ctx context.Context, template string) (string, error) {
+	var s string
+	err := h.post(ctx, "/api/template", map[string]string{"template": template}, &s)
+	return s, err
+}
+
+// FireEvent fires an event of the given type, with optional event data.
+func (h *HASS) FireEvent(ctx context.Context, eventType string, data interface{}) error {
+	return h.post(ctx, "/api/events/"+url.PathEscape(eventType), data, nil)
+}
+
+// CallService calls a service, named as "domain.service", with optional service data.
+func (h *HASS) CallService(ctx context.Context, service string, data interface{}) error {
+	domain, name, ok := splitService(service)
+	if !ok {
+		return fmt.Errorf("bad service name %q", service)
+	}
+	return h.post(ctx, "/api/services/"+url.PathEscape(domain)+"/"+url.PathEscape(name), data, nil)
+}
+
+// CallServiceWithResponse calls a service that returns a response, such as "weather.get_forecasts",
+// decoding the response into dst.
+func (h *HASS) CallServiceWithResponse(ctx context.Context, service string, data, dst interface{}) error {
+	domain, name, ok := splitService(service)
+	if !ok {
+		return fmt.Errorf("bad service name %q", service)
+	}
+	var resp struct {
+		ServiceResponse json.RawMessage `json:"service_response"`
+	}
+	if err := h.post(ctx, "/api/services/"+url.PathEscape(domain)+"/"+url.PathEscape(name)+"?return_response", data, &resp); err != nil {
+		return err
+	}
+	if len(resp.ServiceResponse) == 0 {
+		return fmt.Errorf("no response from %s", service)
+	}
+	if err := json.Unmarshal(resp.ServiceResponse, dst); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", service, err)
+	}
+	return nil
+}
+
+// splitService splits a service name such as "notify.kitchen" into its domain and service.
+func splitService(service string) (domain, name string, ok bool) {
+	domain, name, ok = strings.Cut(service, ".")
+	return domain, name, ok && domain != "" && name != ""
+}
+
+// post POSTs body as JSON, decoding the response into dst if it isn't nil.
+func (h *HASS) post(ctx context.Context, path string, body, dst interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding JSON: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.base+path, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP POST: %w", err)
+	}
+	if dst == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return fmt.Errorf("non-2xx response: %s", resp.Status)
+		}
+		return nil
+	}
+	raw, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading HTTP response body: %w", err)
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return fmt.Errorf("non-2xx response: %s", resp.Status)
+	}
+	if s, ok := dst.(*string); ok {
+		// The response is plain text, as from rendering a template.
+		*s = string(raw)
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("decoding JSON: %w", err)
+	}
+	return nil
+}
+
+func (h *HASS) get(ctx context.Context, path string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.base+path, nil)
+	if err != nil {
+		return fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP GET: %w", err)
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading HTTP response body: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("non-200 response: %s", resp.Status)
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("decoding JSON: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+// Home Assistant entity states and templates shown on the display, each fetched
+// as often as it needs to be and shown in the footer, header or a sidebar.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// HASSItem is an entity state or template from Home Assistant to show.
+type HASSItem struct {
+	// Name labels the value, as "Name: value". For an entity, it defaults to its friendly name.
+	Name string `yaml:"name"`
+
+	// Exactly one of Entity (such as "sensor.indoor_temperature")
+	// or Template (such as "EV {{ states('sensor.ev_battery') }}%") is set.
+	Entity   string `yaml:"entity"`
+	Template string `yaml:"template"`
+
+	// Interval, if positive, is how often to fetch it. By default it is fetched at every refresh.
+	Interval time.Duration `yaml:"interval"`
+
+	// Position is where to show it: "footer" (the default), "header" (after the subtitle)
+	// or "sidebar" (down the right of the task list).
+	Position string `yaml:"position"`
+}
+
+const (
+	hassFooterPos  = "footer"
+	hassHeaderPos  = "header"
+	hassSidebarPos = "sidebar"
+)
+
+func (hi HASSItem) validate() error {
+	if (hi.Entity == "") == (hi.Template == "") {
+		return fmt.Errorf("set exactly one of entity and template")
+	}
+	if hi.Interval < 0 {
+		return fmt.Errorf("negative interval")
+	}
+	switch hi.Position {
+	case "", hassFooterPos, hassHeaderPos, hassSidebarPos:
+	default:
+		return fmt.Errorf("unknown position %q", hi.Position)
+	}
+	return nil
+}
+
+// fetch gets the item's current value, formatted for display.
+func (hi HASSItem) fetch(ctx context.Context, hass *HASS) (string, error) {
+	if hi.Template != "" {
+		s, err := hass.RenderTemplate(ctx, hi.Template)
+		if err != nil {
+			return "", err
+		}
+		if hi.Name != "" {
+			s = hi.Name + ": " + s
+		}
+		return cleanString(s), nil
+	}
+	ent, err := hass.Entity(ctx, hi.Entity)
+	if err != nil {
+		return "", err
+	}
+	if hi.Name != "" {
+		ent.Attributes.FriendlyName = hi.Name
+	}
+	return cleanString(ent.String()), nil
+}
+
+// hassItemValue is the last value fetched for a HASSItem.
+type hassItemValue struct {
+	text string
+	at   time.Time // when it was fetched; zero if it never has been
+}
+
+// fetchHASSItems fetches the items that are due, and adds the latest value of each to dd.
+// An item that fails to be fetched keeps showing its last value.
+// It reports whether fetching them all worked.
+func (r *refresher) fetchHASSItems(ctx context.Context, dd *displayData, now time.Time) (ok bool) {
+	ok = true
+	if len(r.hassItems) != len(r.cfg.HASS.Items) {
+		r.hassItems = make([]hassItemValue, len(r.cfg.HASS.Items))
+	}
+	for i, hi := range r.cfg.HASS.Items {
+		v := &r.hassItems[i]
+		if v.at.IsZero() || hi.Interval <= 0 || now.Sub(v.at) >= hi.Interval {
+			text, err := hi.fetch(ctx, r.hass)
+			if err != nil {
+				what := hi.Entity
+				if what == "" {
+					what = "template " + hi.Name
+				}
+				log.Printf("Getting %s from Home Assistant: %v", what, err)
+				ok = false
+			} else {
+				v.text, v.at = text, now
+			}
+		}
+		if v.text == "" {
+			continue
+		}
+		switch hi.Position {
+		case "", hassFooterPos:
+			dd.hassFooter = append(dd.hassFooter, v.text)
+		case hassHeaderPos:
+			dd.hassHeader = append(dd.hassHeader, v.text)
+		case hassSidebarPos:
+			dd.hassSidebar = append(dd.hassSidebar, v.text)
+		}
+	}
+	return ok
+}
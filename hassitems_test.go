@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFetchHASSItems(t *testing.T) {
+	battery := 80
+	fails := false
+	fetches := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches[r.URL.Path]++
+		if fails {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/states/sensor.indoor_temperature":
+			fmt.Fprint(w, `{"state": "21.5", "attributes": {"friendly_name": "Indoor temperature", "unit_of_measurement": "°C"}}`)
+		case "/api/template":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["template"] != "{{ states('sensor.ev_battery') }}%" {
+				t.Errorf("Rendered template %q", body["template"])
+			}
+			fmt.Fprintf(w, "%d%%", battery)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{HASS: HASSConfig{
+		URL: srv.URL,
+		Items: []HASSItem{
+			{Entity: "sensor.indoor_temperature", Name: "Inside", Position: "header"},
+			{Template: "{{ states('sensor.ev_battery') }}%", Name: "EV", Interval: time.Hour, Position: "sidebar"},
+			{Entity: "sensor.indoor_temperature"},
+		},
+	}}
+	for i, hi := range cfg.HASS.Items {
+		if err := hi.validate(); err != nil {
+			t.Fatalf("Item %d: %v", i+1, err)
+		}
+	}
+	r := &refresher{cfg: cfg, hass: NewHASS(cfg.HASS)}
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.UTC)
+
+	var dd displayData
+	if !r.fetchHASSItems(context.Background(), &dd, now) {
+		t.Errorf("fetchHASSItems reported failure")
+	}
+	check := func(when string, header, sidebar, footer []string) {
+		t.Helper()
+		if !reflect.DeepEqual(dd.hassHeader, header) || !reflect.DeepEqual(dd.hassSidebar, sidebar) || !reflect.DeepEqual(dd.hassFooter, footer) {
+			t.Errorf("%s: header %q, sidebar %q, footer %q; want %q, %q, %q", when, dd.hassHeader, dd.hassSidebar, dd.hassFooter, header, sidebar, footer)
+		}
+	}
+	check("First fetch", []string{"Inside: 21.5 °C"}, []string{"EV: 80%"}, []string{"Indoor temperature: 21.5 °C"})
+
+	// The template isn't fetched again until its interval is up.
+	battery = 75
+	dd = displayData{}
+	r.fetchHASSItems(context.Background(), &dd, now.Add(time.Minute))
+	if n := fetches["/api/template"]; n != 1 {
+		t.Errorf("Template was rendered %d times within its interval, want 1", n)
+	}
+	check("Within interval", []string{"Inside: 21.5 °C"}, []string{"EV: 80%"}, []string{"Indoor temperature: 21.5 °C"})
+
+	// Failures keep showing the last values.
+	fails = true
+	dd = displayData{}
+	if r.fetchHASSItems(context.Background(), &dd, now.Add(2*time.Hour)) {
+		t.Errorf("fetchHASSItems reported success while Home Assistant fails")
+	}
+	check("While failing", []string{"Inside: 21.5 °C"}, []string{"EV: 80%"}, []string{"Indoor temperature: 21.5 °C"})
+
+	fails = false
+	dd = displayData{}
+	r.fetchHASSItems(context.Background(), &dd, now.Add(3*time.Hour))
+	check("After interval", []string{"Inside: 21.5 °C"}, []string{"EV: 75%"}, []string{"Indoor temperature: 21.5 °C"})
+}
+
+func TestHASSItemValidate(t *testing.T) {
+	for _, hi := range []HASSItem{
+		{},
+		{Entity: "sensor.x", Template: "{{ 1 }}"},
+		{Entity: "sensor.x", Position: "sideways"},
+		{Entity: "sensor.x", Interval: -time.Minute},
+	} {
+		if err := hi.validate(); err == nil {
+			t.Errorf("%+v validated", hi)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+// A queue of task events that Home Assistant couldn't be sent, such as while it restarts.
+// They are retried with backoff, and kept in the state file so a restart doesn't lose them.
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	// At most this many events wait to be retried; beyond that, the oldest are dropped.
+	maxPendingTaskEvents = 50
+
+	// Events that still haven't been sent after this long are dropped,
+	// since automations acting on them would be acting on stale news.
+	pendingTaskEventMaxAge = 24 * time.Hour
+
+	minTaskEventBackoff = time.Minute
+	maxTaskEventBackoff = time.Hour
+)
+
+// pendingTaskEvent is a task event waiting to be retried.
+type pendingTaskEvent struct {
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+	Queued   time.Time       `json:"queued"`
+	Attempts int             `json:"attempts"`
+	NextTry  time.Time       `json:"next_try"`
+}
+
+// taskEventBackoff is how long to wait before retrying after the given number of attempts.
+func taskEventBackoff(attempts int) time.Duration {
+	d := minTaskEventBackoff
+	for i := 1; i < attempts && d < maxTaskEventBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxTaskEventBackoff)
+}
+
+// queueTaskEvent adds a task event that failed to the queue.
+func queueTaskEvent(pending []pendingTaskEvent, typ string, data json.RawMessage, now time.Time) []pendingTaskEvent {
+	if len(pending) >= maxPendingTaskEvents {
+		drop := len(pending) - maxPendingTaskEvents + 1
+		log.Printf("Too many task events are waiting to be retried; dropping the oldest %d", drop)
+		pending = pending[drop:]
+	}
+	return append(pending, pendingTaskEvent{
+		Type:     typ,
+		Data:     data,
+		Queued:   now,
+		Attempts: 1,
+		NextTry:  now.Add(taskEventBackoff(1)),
+	})
+}
+
+// retryTaskEvents retries the queued events that are due, oldest first, firing at most
+// budget of them. It stops at the first failure, since the rest would most likely fail too.
+// It returns what is still queued, how many were fired, and whether talking to Home Assistant worked.
+func (r *refresher) retryTaskEvents(ctx context.Context, pending []pendingTaskEvent, budget int, now time.Time) (rest []pendingTaskEvent, n int, ok bool) {
+	ok = true
+	for i, pe := range pending {
+		if now.Sub(pe.Queued) >= pendingTaskEventMaxAge {
+			log.Printf("Dropping %s event queued at %s, after %d attempts", pe.Type, pe.Queued.Format(time.Stamp), pe.Attempts)
+			continue
+		}
+		if n >= budget || now.Before(pe.NextTry) {
+			rest = append(rest, pe)
+			continue
+		}
+		n++
+		if err := r.hass.FireEvent(ctx, pe.Type, pe.Data); err != nil {
+			log.Printf("Retrying %s event (attempt %d): %v", pe.Type, pe.Attempts+1, err)
+			pe.Attempts++
+			pe.NextTry = now.Add(taskEventBackoff(pe.Attempts))
+			rest = append(rest, pe)
+			ok = false
+			// Leave the rest until next time.
+			rest = append(rest, pending[i+1:]...)
+			break
+		}
+		log.Printf("Sent %s event queued at %s", pe.Type, pe.Queued.Format(time.Stamp))
+	}
+	return rest, n, ok
+}
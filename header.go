@@ -0,0 +1,45 @@
+package main
+
+// The date header in the top right corner.
+
+import (
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// defaultDateFormat is the layout (as for time.Format) of the date header.
+const defaultDateFormat = "Mon 2 Jan"
+
+// headerSizes are the point sizes tried for the date header, largest first.
+var headerSizes = []float64{36, 32, 28, 24, 20}
+
+// splitDayOfMonth splits a time.Format layout around its day of the month,
+// so that it can be drawn in a different colour. If there isn't one, day is empty.
+func splitDayOfMonth(layout string) (before, day, after string) {
+	for i := 0; i < len(layout); i++ {
+		rest := layout[i:]
+		switch {
+		case strings.HasPrefix(rest, "2006"):
+			i += 3
+		case strings.HasPrefix(rest, "002"): // day of the year
+			i += 2
+		case strings.HasPrefix(rest, "_2"), strings.HasPrefix(rest, "02"):
+			return layout[:i], rest[:2], rest[2:]
+		case rest[0] == '2':
+			return layout[:i], rest[:1], rest[1:]
+		}
+	}
+	return layout, "", ""
+}
+
+// fitFace returns the first of faces, which should be largest first,
+// that can draw text within width pixels, or the last if none can.
+func fitFace(faces []font.Face, text string, width int) font.Face {
+	for _, face := range faces {
+		if font.MeasureString(face, text).Ceil() <= width {
+			return face
+		}
+	}
+	return faces[len(faces)-1]
+}
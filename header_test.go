@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+func TestSplitDayOfMonth(t *testing.T) {
+	tests := []struct {
+		layout             string
+		before, day, after string
+	}{
+		{"Mon 2 Jan", "Mon ", "2", " Jan"},
+		{"Monday _2 January", "Monday ", "_2", " January"},
+		{"2006-01-02", "2006-01-", "02", ""},
+		{"Jan 2, 2006", "Jan ", "2", ", 2006"},
+		{"day 002 of 2006", "day 002 of 2006", "", ""},
+		{"Monday", "Monday", "", ""},
+	}
+	for _, test := range tests {
+		before, day, after := splitDayOfMonth(test.layout)
+		if before != test.before || day != test.day || after != test.after {
+			t.Errorf("splitDayOfMonth(%q) = %q, %q, %q, want %q, %q, %q", test.layout, before, day, after, test.before, test.day, test.after)
+		}
+	}
+}
+
+func TestFitFace(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parsing font: %v", err)
+	}
+	var faces []font.Face
+	for _, size := range headerSizes {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72})
+		if err != nil {
+			t.Fatalf("Making face: %v", err)
+		}
+		faces = append(faces, face)
+	}
+	const text = "Wednesday 24 September"
+	width := func(face font.Face) int { return font.MeasureString(face, text).Ceil() }
+
+	if got := fitFace(faces, text, 1000); got != faces[0] {
+		t.Errorf("With plenty of room, fitFace didn't pick the largest face")
+	}
+	if got := fitFace(faces, text, width(faces[2])); got != faces[2] {
+		t.Errorf("With room for exactly the third face, fitFace picked one %d wide", width(got))
+	}
+	if got := fitFace(faces, text, 10); got != faces[len(faces)-1] {
+		t.Errorf("With no room, fitFace didn't pick the smallest face")
+	}
+}
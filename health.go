@@ -0,0 +1,117 @@
+package main
+
+// A strip showing whether each integration is working,
+// so missing alerts can be told apart from an unreachable Alertmanager.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// integrationHealth is whether an integration last worked.
+type integrationHealth struct {
+	Letter string // "T" for Todoist, "A" for Alertmanager, and so on
+	OK     bool
+}
+
+// allFailed reports whether there were integrations and all of them failed,
+// which most likely means the network is down.
+func allFailed(health []integrationHealth) bool {
+	for _, h := range health {
+		if h.OK {
+			return false
+		}
+	}
+	return len(health) > 0
+}
+
+// trackConnectivity notes whether any integration worked in this refresh,
+// and if none did, sets when they last did.
+func (r *refresher) trackConnectivity(dd *displayData, now time.Time) {
+	if !allFailed(dd.health) {
+		if !r.offlineSince.IsZero() {
+			log.Printf("Back online after being offline since %s", r.offlineSince.Format(time.Stamp))
+		}
+		r.offlineSince = time.Time{}
+		r.lastOnline = now
+		return
+	}
+	if r.offlineSince.IsZero() {
+		r.offlineSince = r.lastOnline
+		if c, ok := r.ts.(*todoistCache); ok && r.offlineSince.IsZero() {
+			// Nothing has worked since starting, so use when the cached data was saved.
+			r.offlineSince, _ = c.Offline()
+		}
+		if r.offlineSince.IsZero() {
+			r.offlineSince = now
+		}
+		log.Printf("All integrations are failing; the network appears to be down")
+	}
+	dd.offlineSince = r.offlineSince
+}
+
+// offlineBadge returns the text of the badge showing when the network was last up.
+func offlineBadge(since, now time.Time) string {
+	return "offline since " + badgeTime(since, now)
+}
+
+// cachedBadge returns the text of the badge showing when tasks cached by a previous run were saved.
+func cachedBadge(at, now time.Time) string {
+	return "last updated " + badgeTime(at, now)
+}
+
+// badgeTime formats t for a badge, with the day if it isn't today.
+func badgeTime(t, now time.Time) string {
+	layout := time.Kitchen
+	if y, m, d := t.Date(); y != now.Year() || m != now.Month() || d != now.Day() {
+		layout = "Mon " + time.Kitchen
+	}
+	return t.Format(layout)
+}
+
+// writeHealth draws the health strip with its bottom right corner at origin,
+// which must be non-negative, with failed integrations in failCol.
+// It returns the top left corner.
+func (r renderer) writeHealth(dst draw.Image, origin image.Point, failCol color.Color, health []integrationHealth) image.Point {
+	okMark := r.glyphOr(r.tiny, "✓", "+")
+	failMark := r.glyphOr(r.tiny, "✗", "×")
+	// Draw from right to left.
+	for i := len(health) - 1; i >= 0; i-- {
+		h := health[i]
+		txt, col := " "+h.Letter+okMark, color.Color(color.Black)
+		if !h.OK {
+			txt, col = " "+h.Letter+failMark, failCol
+		}
+		tl := r.writeText(dst, origin, bottomRight, col, r.tiny, txt)
+		origin.X = tl.X
+	}
+	return origin
+}
+
+// glyphOr returns want if face can draw all of it, and alt otherwise.
+func (r renderer) glyphOr(face font.Face, want, alt string) string {
+	if ff, ok := face.(*fallbackFace); ok {
+		for _, c := range want {
+			if ff.pick(c) == nil {
+				return alt
+			}
+		}
+		return want
+	}
+	if r.font == nil {
+		return alt
+	}
+	var buf sfnt.Buffer
+	for _, c := range want {
+		if x, err := r.font.GlyphIndex(&buf, c); err != nil || x == 0 {
+			return alt
+		}
+	}
+	return want
+}
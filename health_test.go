@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackConnectivity(t *testing.T) {
+	t0 := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	r := &refresher{}
+	refresh := func(now time.Time, health ...integrationHealth) time.Time {
+		dd := displayData{health: health}
+		r.trackConnectivity(&dd, now)
+		return dd.offlineSince
+	}
+
+	if got := refresh(t0, integrationHealth{"T", false}); !got.Equal(t0) {
+		t.Errorf("Failing from the start gave offline since %v, want %v", got, t0)
+	}
+	if got := refresh(t0.Add(10*time.Minute), integrationHealth{"T", true}, integrationHealth{"H", false}); !got.IsZero() {
+		t.Errorf("With Todoist working, offline since %v, want online", got)
+	}
+	refresh(t0.Add(20*time.Minute), integrationHealth{"T", false}, integrationHealth{"H", false})
+	if got, want := refresh(t0.Add(30*time.Minute), integrationHealth{"T", false}, integrationHealth{"H", false}), t0.Add(10*time.Minute); !got.Equal(want) {
+		t.Errorf("With everything failing, offline since %v, want %v", got, want)
+	}
+	if got := refresh(t0.Add(40 * time.Minute)); !got.IsZero() {
+		t.Errorf("With no integrations, offline since %v, want online", got)
+	}
+}
+
+func TestOfflineBadge(t *testing.T) {
+	now := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	if got, want := offlineBadge(now.Add(-time.Hour), now), "offline since 8:00AM"; got != want {
+		t.Errorf("offlineBadge for earlier today = %q, want %q", got, want)
+	}
+	if got, want := offlineBadge(now.Add(-12*time.Hour), now), "offline since Tue 9:00PM"; got != want {
+		t.Errorf("offlineBadge for yesterday = %q, want %q", got, want)
+	}
+	if got, want := cachedBadge(now.Add(-12*time.Hour), now), "last updated Tue 9:00PM"; got != want {
+		t.Errorf("cachedBadge for yesterday = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+// A hit map of the frame on the panel: the rectangles where tapping or clicking
+// should do something, such as completing a task. It is served at /api/hitmap,
+// for a touch overlay or the web preview to map taps and clicks to actions.
+
+import (
+	"encoding/json"
+	"image"
+	"net/http"
+	"sync"
+)
+
+// hitZone is a rectangle of the frame and what touching it does.
+type hitZone struct {
+	Rect   image.Rectangle
+	Action string // "complete" or "next_page"
+	TaskID string // the Todoist ID of the task the action is on
+	Title  string // of the task, for debugging
+}
+
+const (
+	hitActionComplete = "complete"
+	hitActionNextPage = "next_page" // shows the next page of tasks
+)
+
+// taskHit is the hit zone for completing a task drawn in the row from top to bottom,
+// between the left edge of its column and right.
+func taskHit(task renderableTask, left, top, right, bottom int) hitZone {
+	return hitZone{
+		Rect:   image.Rect(left, top, right, bottom),
+		Action: hitActionComplete,
+		TaskID: task.id,
+		Title:  task.Title,
+	}
+}
+
+func (hz hitZone) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		X      int    `json:"x"`
+		Y      int    `json:"y"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+		Action string `json:"action"`
+		TaskID string `json:"task_id,omitempty"`
+		Title  string `json:"title,omitempty"`
+	}{hz.Rect.Min.X, hz.Rect.Min.Y, hz.Rect.Dx(), hz.Rect.Dy(), hz.Action, hz.TaskID, hz.Title})
+}
+
+// hitMap holds the hit zones of the frame most recently sent to the panel.
+// A nil hitMap ignores them.
+type hitMap struct {
+	mu    sync.Mutex
+	set   bool
+	size  image.Point
+	zones []hitZone
+}
+
+// Set records the hit zones of the frame just sent to the panel, of the given size.
+func (hm *hitMap) Set(size image.Point, zones []hitZone) {
+	if hm == nil {
+		return
+	}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.set, hm.size, hm.zones = true, size, zones
+}
+
+// Get returns the hit zones, and whether any frame has been sent to the panel.
+func (hm *hitMap) Get() (size image.Point, zones []hitZone, ok bool) {
+	if hm == nil {
+		return image.Point{}, nil, false
+	}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	return hm.size, hm.zones, hm.set
+}
+
+// Lookup returns the hit zone containing pt.
+func (hm *hitMap) Lookup(pt image.Point) (hitZone, bool) {
+	_, zones, _ := hm.Get()
+	for _, hz := range zones {
+		if pt.In(hz.Rect) {
+			return hz, true
+		}
+	}
+	return hitZone{}, false
+}
+
+// Has reports whether any hit zone has the given action.
+func (hm *hitMap) Has(action string) bool {
+	_, zones, _ := hm.Get()
+	for _, hz := range zones {
+		if hz.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) serveHitMap(w http.ResponseWriter, r *http.Request) {
+	size, zones, ok := s.hits.Get()
+	if !ok {
+		http.Error(w, "Nothing has been sent to the panel yet", http.StatusNotFound)
+		return
+	}
+	resp := struct {
+		Width  int       `json:"width"`
+		Height int       `json:"height"`
+		Zones  []hitZone `json:"zones"`
+	}{size.X, size.Y, zones}
+	if resp.Zones == nil {
+		resp.Zones = []hitZone{} // not null
+	}
+	raw, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal error encoding hit map: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeBody(w, r, raw)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestRenderHits(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Font:     fontFile,
+		Messages: []message{{Options: []string{"Testing"}}},
+	}
+	rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	data := displayData{
+		today: time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local),
+		now:   time.Date(2024, time.June, 12, 9, 30, 0, 0, time.Local),
+		tasks: []renderableTask{
+			{Priority: 4, Title: "Take out bins", Project: "House", id: "1", Subtasks: []renderableTask{
+				{Priority: 4, Title: "Rinse recycling", Project: "House", id: "2"},
+			}},
+			{Priority: 1, Title: "Clean gutters", Project: "House", id: "3"},
+		},
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 480))
+	_, hits := rend.RenderHits(dst, data)
+
+	var ids []string
+	for i, hz := range hits {
+		ids = append(ids, hz.TaskID)
+		if hz.Action != hitActionComplete || hz.Rect.Empty() || !hz.Rect.In(dst.Bounds()) {
+			t.Errorf("Hit zone %d = %+v, want a complete action within the frame", i, hz)
+		}
+		if i > 0 && hz.Rect.Overlaps(hits[i-1].Rect) {
+			t.Errorf("Hit zone %v overlaps the one above, %v", hz.Rect, hits[i-1].Rect)
+		}
+	}
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "2" || ids[2] != "3" {
+		t.Errorf("Hit zones are for tasks %q, want 1, 2, 3", ids)
+	}
+
+	// Override images have nothing to tap.
+	data.override = image.NewPaletted(dst.Bounds(), staticPalette)
+	if _, hits := rend.RenderHits(dst, data); len(hits) != 0 {
+		t.Errorf("Override image has %d hit zones, want none", len(hits))
+	}
+}
+
+func TestServeHitMap(t *testing.T) {
+	s := &server{hits: new(hitMap)}
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/hitmap", nil))
+		return rec
+	}
+	if rec := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("Before any frame, /api/hitmap gave %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	s.hits.Set(image.Pt(800, 480), []hitZone{{Rect: image.Rect(0, 10, 400, 40), Action: hitActionComplete, TaskID: "1", Title: "Take out bins"}})
+	rec := get()
+	var resp struct {
+		Width, Height int
+		Zones         []struct {
+			X, Y, Width, Height int
+			Action              string
+			TaskID              string `json:"task_id"`
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Decoding /api/hitmap: %v\n%s", err, rec.Body)
+	}
+	if resp.Width != 800 || resp.Height != 480 || len(resp.Zones) != 1 {
+		t.Fatalf("/api/hitmap = %+v, want one zone in 800x480", resp)
+	}
+	if z := resp.Zones[0]; z.X != 0 || z.Y != 10 || z.Width != 400 || z.Height != 30 || z.Action != "complete" || z.TaskID != "1" {
+		t.Errorf("Zone = %+v", z)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// A HomeKit bridge, for households that use HomeKit instead of Home Assistant.
+// It exposes the count of pending power-hungry tasks, and whether the display is stale.
+//
+// This needs github.com/brutella/hap (required in go.mod), so it is only built in
+// with the hap build tag:
+//
+//	go build -tags hap
+
+import (
+	"fmt"
+)
+
+type HomeKitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PIN is the eight digit setup code to enter when adding the bridge in the Home app.
+	PIN string `yaml:"pin"`
+
+	// StateDir is where pairings are kept. It defaults to "homekit" in the top-level
+	// state_dir if that is set, or else in the working directory.
+	StateDir string `yaml:"state_dir"`
+}
+
+func (hc HomeKitConfig) validate() error {
+	if !hc.Enabled {
+		return nil
+	}
+	if len(hc.PIN) != 8 {
+		return fmt.Errorf("pin must be eight digits")
+	}
+	for _, c := range hc.PIN {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("pin must be eight digits")
+		}
+	}
+	return nil
+}
+
+func (hc HomeKitConfig) stateDir() string {
+	if hc.StateDir == "" {
+		return "homekit"
+	}
+	return hc.StateDir
+}
+
+// homeKitStatus is what the HomeKit bridge exposes.
+type homeKitStatus struct {
+	PowerHungry int  // pending power-hungry tasks
+	Stale       bool // whether the display is showing old data
+}
+
+func newHomeKitStatus(data displayData) homeKitStatus {
+	return homeKitStatus{
+		PowerHungry: powerHungryPending(data.tasks),
+		Stale:       data.offline || !data.offlineSince.IsZero(),
+	}
+}
@@ -0,0 +1,66 @@
+//go:build hap
+
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// homeKit is a HomeKit bridge. A nil homeKit ignores updates.
+type homeKit struct {
+	// HomeKit has no sensor for a plain count, so the count is the level of a light sensor.
+	count *service.LightSensor
+	stale *service.ContactSensor
+}
+
+// startHomeKit starts serving the bridge until ctx is done.
+func startHomeKit(ctx context.Context, hc HomeKitConfig) (*homeKit, error) {
+	info := accessory.Info{
+		Name:         "kitchenthing",
+		Manufacturer: "dsymonds",
+		Model:        "kitchenthing",
+	}
+	bridge := accessory.NewBridge(info)
+
+	hk := &homeKit{
+		count: service.NewLightSensor(),
+		stale: service.NewContactSensor(),
+	}
+	countAcc := accessory.New(accessory.Info{Name: "Power-hungry tasks"}, accessory.TypeSensor)
+	countAcc.AddS(hk.count.S)
+	staleAcc := accessory.New(accessory.Info{Name: "Display stale"}, accessory.TypeSensor)
+	staleAcc.AddS(hk.stale.S)
+	hk.Update(homeKitStatus{})
+
+	srv, err := hap.NewServer(hap.NewFsStore(hc.stateDir()), bridge.A, countAcc, staleAcc)
+	if err != nil {
+		return nil, err
+	}
+	srv.Pin = hc.PIN
+	go func() {
+		log.Printf("Serving HomeKit bridge")
+		if err := srv.ListenAndServe(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("HomeKit: %v", err)
+		}
+	}()
+	return hk, nil
+}
+
+func (hk *homeKit) Update(st homeKitStatus) {
+	if hk == nil {
+		return
+	}
+	// The light level can't be zero.
+	hk.count.CurrentAmbientLightLevel.SetValue(max(float64(st.PowerHungry), 0.0001))
+	contact := characteristic.ContactSensorStateContactDetected
+	if st.Stale {
+		contact = characteristic.ContactSensorStateContactNotDetected
+	}
+	hk.stale.ContactSensorState.SetValue(contact)
+}
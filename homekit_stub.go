@@ -0,0 +1,16 @@
+//go:build !hap
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type homeKit struct{}
+
+func startHomeKit(ctx context.Context, hc HomeKitConfig) (*homeKit, error) {
+	return nil, fmt.Errorf("HomeKit needs a build with the hap tag")
+}
+
+func (hk *homeKit) Update(st homeKitStatus) {}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHomeKitConfig(t *testing.T) {
+	for _, test := range []struct {
+		hc HomeKitConfig
+		ok bool
+	}{
+		{HomeKitConfig{}, true},
+		{HomeKitConfig{Enabled: true, PIN: "12344321"}, true},
+		{HomeKitConfig{Enabled: true}, false},
+		{HomeKitConfig{Enabled: true, PIN: "1234-4321"}, false},
+		{HomeKitConfig{Enabled: true, PIN: "1234432x"}, false},
+	} {
+		err := test.hc.validate()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validate(%+v) = %v, want ok=%t", test.hc, err, test.ok)
+		}
+	}
+}
+
+func TestNewHomeKitStatus(t *testing.T) {
+	tasks := []renderableTask{
+		{Title: "dishwasher", PowerHungry: true},
+		{Title: "washing", PowerHungry: true, InProgress: true},
+		{Title: "dryer", PowerHungry: true},
+		{Title: "sweep", Subtasks: []renderableTask{
+			{Title: "run robot vacuum", PowerHungry: true},
+		}},
+	}
+	got := newHomeKitStatus(displayData{tasks: tasks})
+	if want := (homeKitStatus{PowerHungry: 3}); got != want {
+		t.Errorf("newHomeKitStatus = %+v, want %+v", got, want)
+	}
+	got = newHomeKitStatus(displayData{offlineSince: time.Now()})
+	if want := (homeKitStatus{Stale: true}); got != want {
+		t.Errorf("newHomeKitStatus while offline = %+v, want %+v", got, want)
+	}
+	got = newHomeKitStatus(displayData{offline: true})
+	if want := (homeKitStatus{Stale: true}); got != want {
+		t.Errorf("newHomeKitStatus with cached tasks = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// Response compression and cache headers, to go easy on slow links to the web UI.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Bodies smaller than this aren't worth compressing.
+const minGzipSize = 1 << 10
+
+// writeBody writes body, gzipped if the client accepts that and it's worth it.
+// The Content-Type header should already be set.
+func writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(body) < minGzipSize || !acceptsGzip(r) {
+		w.Write(body)
+		return
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(body)
+	if err := gw.Close(); err != nil {
+		// Not possible when writing to a bytes.Buffer, but just in case.
+		w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Write(buf.Bytes())
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if enc == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// contentETag returns a strong ETag for the given content.
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// notModified sets the ETag header, and reports whether the client already has
+// that version, in which case it writes a 304 response and nothing more should be written.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
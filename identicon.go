@@ -0,0 +1,62 @@
+package main
+
+// Identicons: small patterns derived from assignee names, drawn in a gutter beside the
+// task list so whose task it is can be seen at a glance without reading names.
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// identicon is an 8×8 pattern, one byte per row, with bit i set for a filled cell in column i.
+// It is mirrored left to right, which makes it more recognisable.
+type identicon [8]uint8
+
+// newIdenticon returns the identicon for a name. Names differing only in case get the same one,
+// matching how assignees are compared elsewhere.
+func newIdenticon(name string) identicon {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(name)))
+	sum := h.Sum64()
+
+	var ic identicon
+	for y := range ic {
+		half := uint8(sum>>(4*y)) & 0x0F // the left four columns
+		var row uint8
+		for x := 0; x < 4; x++ {
+			if half&(1<<x) != 0 {
+				row |= 1<<x | 1<<(7-x)
+			}
+		}
+		ic[y] = row
+	}
+	return ic
+}
+
+// Set reports whether the cell at column x and row y is filled.
+func (ic identicon) Set(x, y int) bool { return ic[y]&(1<<x) != 0 }
+
+// identiconSize returns the side length of an identicon drawn alongside text
+// with the given ascent: as large as fits, in whole pixels per cell.
+func identiconSize(ascent int) int {
+	return max(ascent/8, 1) * 8
+}
+
+// drawIdenticon draws ic in col with its bottom left corner at origin,
+// at the given size, which should be a multiple of 8.
+func drawIdenticon(dst draw.Image, origin image.Point, size int, col color.Color, ic identicon) {
+	cell := size / 8
+	src := &image.Uniform{col}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if !ic.Set(x, y) {
+				continue
+			}
+			tl := image.Pt(origin.X+x*cell, origin.Y-size+y*cell)
+			draw.Draw(dst, image.Rectangle{Min: tl, Max: tl.Add(image.Pt(cell, cell))}, src, image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestIdenticon(t *testing.T) {
+	a, b := newIdenticon("David"), newIdenticon("Alice")
+	if a == b {
+		t.Errorf("Different names have the same identicon %v", a)
+	}
+	if c := newIdenticon("DAVID"); c != a {
+		t.Errorf("Identicons differ by case: %v vs %v", a, c)
+	}
+	if a == (identicon{}) {
+		t.Errorf("Identicon is blank")
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 4; x++ {
+			if a.Set(x, y) != a.Set(7-x, y) {
+				t.Errorf("Identicon isn't mirrored at (%d, %d): %v", x, y, a)
+			}
+		}
+	}
+}
+
+func TestDrawIdenticon(t *testing.T) {
+	if got := identiconSize(19); got != 16 {
+		t.Errorf("identiconSize(19) = %d, want 16", got)
+	}
+	if got := identiconSize(3); got != 8 {
+		t.Errorf("identiconSize(3) = %d, want 8", got)
+	}
+
+	var ic identicon
+	ic[0] = 0x81 // top corners
+	img := image.NewPaletted(image.Rect(0, 0, 40, 40), staticPalette)
+	drawIdenticon(img, image.Pt(4, 36), 16, color.Black, ic)
+	for _, p := range []image.Point{{4, 20}, {5, 21}, {18, 20}, {19, 21}} {
+		if got := img.At(p.X, p.Y); got != color.Black {
+			t.Errorf("pixel %v = %v, want black", p, got)
+		}
+	}
+	for _, p := range []image.Point{{6, 20}, {4, 22}, {17, 20}, {20, 20}, {4, 36}} {
+		if got := img.At(p.X, p.Y); got == color.Black {
+			t.Errorf("pixel %v is black, want blank", p)
+		}
+	}
+}
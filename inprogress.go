@@ -0,0 +1,84 @@
+package main
+
+// Tasks that have kept the in-progress label for too long, which are probably done or
+// abandoned. They are either marked as stale, or have the label removed, so that
+// "in progress" keeps its meaning.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+type InProgressConfig struct {
+	// StaleAfter is how long a task can have the in-progress label before it is stale.
+	// It is measured from when kitchenthing first saw the label. If zero, tasks never go stale.
+	StaleAfter time.Duration `yaml:"stale_after"`
+
+	// Stale is what to do with stale tasks: "mark" (the default) draws a marker beside them,
+	// and "remove" removes the label, which only happens with -act_on_metadata,
+	// as for metadata labels.
+	Stale string `yaml:"stale"`
+}
+
+func (ic InProgressConfig) validate() error {
+	if ic.StaleAfter < 0 {
+		return fmt.Errorf("negative stale_after")
+	}
+	switch ic.Stale {
+	case "", "mark", "remove":
+	default:
+		return fmt.Errorf("unknown stale action %q (want mark or remove)", ic.Stale)
+	}
+	return nil
+}
+
+// trackInProgress records when each task was first seen with the in-progress label,
+// and returns the IDs of those that have had it for too long.
+// If configured to, it removes the label from them.
+func (r *refresher) trackInProgress(ctx context.Context, td todoistData, now time.Time) map[string]bool {
+	var prev map[string]time.Time
+	r.state.View(func(st *State) { prev = st.InProgressSince })
+
+	since := make(map[string]time.Time)
+	stale := make(map[string]bool)
+	for _, item := range td.Items {
+		if !hasLabel(item.Labels, "in-progress") {
+			continue
+		}
+		t, ok := prev[item.ID]
+		if !ok {
+			t = now
+		}
+		since[item.ID] = t
+		if now.Sub(t) < r.cfg.InProgress.StaleAfter {
+			continue
+		}
+		stale[item.ID] = true
+		if r.cfg.InProgress.Stale == "remove" {
+			if err := removeLabel(ctx, r.ts, item, "in-progress", *actOnMetadata); err != nil {
+				log.Printf("Removing stale in-progress label from item %s (%q): %v", item.ID, item.Content, err)
+			}
+		}
+	}
+
+	if len(since) == 0 {
+		since = nil
+	}
+	if !reflect.DeepEqual(prev, since) {
+		if err := r.state.Update(func(st *State) { st.InProgressSince = since }); err != nil {
+			log.Printf("Saving state: %v", err)
+		}
+	}
+	return stale
+}
+
+// markStaleProgress marks the tasks, and their subtasks, that are stale.
+func markStaleProgress(tasks []renderableTask, stale map[string]bool) {
+	for i := range tasks {
+		tasks[i].StaleProgress = stale[tasks[i].id]
+		markStaleProgress(tasks[i].Subtasks, stale)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestTrackInProgress(t *testing.T) {
+	defer func(act bool) { *actOnMetadata = act }(*actOnMetadata)
+	*actOnMetadata = true
+
+	ft := newFakeTodoist()
+	ft.data.Items = map[string]todoist.Item{
+		"1": {ID: "1", ProjectID: "p1", Content: "paint fence", Labels: []string{"in-progress"}},
+		"2": {ID: "2", ProjectID: "p1", Content: "wash up"},
+	}
+	state, _ := loadState("")
+	r := &refresher{ts: ft, state: state, cfg: Config{InProgress: InProgressConfig{StaleAfter: 48 * time.Hour}}}
+
+	start := time.Now()
+	if stale := r.trackInProgress(context.Background(), ft.Data(), start); len(stale) != 0 {
+		t.Errorf("Newly in-progress tasks are stale: %v", stale)
+	}
+	// Later, another task is started.
+	ft.data.Items["2"] = todoist.Item{ID: "2", ProjectID: "p1", Content: "wash up", Labels: []string{"in-progress", "power-hungry"}}
+	if stale := r.trackInProgress(context.Background(), ft.Data(), start.Add(47*time.Hour)); len(stale) != 0 {
+		t.Errorf("Tasks are stale too soon: %v", stale)
+	}
+	stale := r.trackInProgress(context.Background(), ft.Data(), start.Add(48*time.Hour))
+	if !stale["1"] || stale["2"] {
+		t.Errorf("After two days, stale tasks are %v, want only 1", stale)
+	}
+	if ft.mutations != 0 {
+		t.Errorf("Marking stale tasks made %d changes in Todoist", ft.mutations)
+	}
+
+	tasks := []renderableTask{{id: "2", InProgress: true, Subtasks: []renderableTask{{id: "1", InProgress: true}}}}
+	markStaleProgress(tasks, stale)
+	if tasks[0].StaleProgress || !tasks[0].Subtasks[0].StaleProgress {
+		t.Errorf("markStaleProgress marked %+v", tasks)
+	}
+
+	// Removing the label keeps any other labels.
+	r.cfg.InProgress.Stale = "remove"
+	r.trackInProgress(context.Background(), ft.Data(), start.Add(100*time.Hour))
+	if got := ft.data.Items["1"].Labels; len(got) != 0 {
+		t.Errorf("Stale task's labels are %q, want none", got)
+	}
+	if got := ft.data.Items["2"].Labels; len(got) != 1 || got[0] != "power-hungry" {
+		t.Errorf("Stale task's labels are %q, want only power-hungry", got)
+	}
+	r.trackInProgress(context.Background(), ft.Data(), start.Add(101*time.Hour))
+	state.View(func(st *State) {
+		if st.InProgressSince != nil {
+			t.Errorf("After removing the labels, InProgressSince = %v", st.InProgressSince)
+		}
+	})
+}
+
+func TestInProgressConfig(t *testing.T) {
+	for _, test := range []struct {
+		ic InProgressConfig
+		ok bool
+	}{
+		{InProgressConfig{}, true},
+		{InProgressConfig{StaleAfter: 72 * time.Hour, Stale: "remove"}, true},
+		{InProgressConfig{StaleAfter: -time.Hour}, false},
+		{InProgressConfig{StaleAfter: time.Hour, Stale: "delete"}, false},
+	} {
+		err := test.ic.validate()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validate(%+v) = %v, want ok=%t", test.ic, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+// Arrangement of the task list.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// listRow is a single row of the task list.
+type listRow struct {
+	divider bool   // a divider before demoted tasks
+	header  string // a project header
+	task    renderableTask
+	indent  bool // whether the task is under a header
+
+	level int // for subtasks, how deeply nested they are
+	more  int // for subtasks, a count of hidden ones instead of a task
+}
+
+// listRows arranges tasks, which should already be sorted, into rows according to the layout.
+func (r renderer) listRows(tasks []renderableTask) []listRow {
+	var rows []listRow
+	if r.layout == "projects" {
+		for _, g := range groupByProject(tasks) {
+			rows = append(rows, listRow{header: g.Project})
+			for _, task := range g.Tasks {
+				rows = append(rows, listRow{task: task, indent: true})
+				rows = appendSubtaskRows(rows, task, 1, true)
+			}
+		}
+		return rows
+	}
+	divided := false
+	for _, task := range tasks {
+		if task.Demoted && !divided {
+			rows = append(rows, listRow{divider: true})
+			divided = true
+		}
+		rows = append(rows, listRow{task: task})
+		rows = appendSubtaskRows(rows, task, 1, false)
+	}
+	return rows
+}
+
+// appendSubtaskRows appends rows for the subtasks of task, which are at the given level.
+func appendSubtaskRows(rows []listRow, task renderableTask, level int, indent bool) []listRow {
+	for _, st := range task.Subtasks {
+		rows = append(rows, listRow{task: st, indent: indent, level: level})
+		rows = appendSubtaskRows(rows, st, level+1, indent)
+	}
+	if task.MoreSubtasks > 0 {
+		rows = append(rows, listRow{indent: indent, level: level, more: task.MoreSubtasks})
+	}
+	return rows
+}
+
+type taskGroup struct {
+	Project string
+	Tasks   []renderableTask
+}
+
+// groupByProject groups tasks by project, preserving their order within each group.
+// Groups are ordered by their highest priority task, then by where they first appear.
+func groupByProject(tasks []renderableTask) []taskGroup {
+	var groups []taskGroup
+	index := make(map[string]int) // project => index in groups
+	top := make(map[string]int)   // project => highest priority
+	for _, task := range tasks {
+		i, ok := index[task.Project]
+		if !ok {
+			i = len(groups)
+			index[task.Project] = i
+			groups = append(groups, taskGroup{Project: task.Project})
+		}
+		groups[i].Tasks = append(groups[i].Tasks, task)
+		if task.Priority > top[task.Project] {
+			top[task.Project] = task.Priority
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return top[groups[i].Project] > top[groups[j].Project]
+	})
+	return groups
+}
+
+// Overflow policies, for when the tasks don't all fit.
+const (
+	overflowHideLowPriority = "hide_low_priority" // the default
+	overflowHideLatest      = "hide_latest"
+	overflowShrink          = "shrink" // use smaller text, then hide low priority tasks
+)
+
+// overflowVictims returns the indexes of tasks in the order they should be hidden
+// to make room: lowest priority first, or latest due first, with the other as a tie-break.
+func overflowVictims(tasks []renderableTask, policy string) []int {
+	byPriority := func(a, b renderableTask) int { return a.Priority - b.Priority }
+	byDue := func(a, b renderableTask) int {
+		// Overdue tasks are due earliest, and tasks without a time are due latest.
+		if a.Overdue != b.Overdue {
+			return boolCompare(b.Overdue, a.Overdue)
+		}
+		if a.Time.IsZero() || b.Time.IsZero() {
+			return boolCompare(a.Time.IsZero(), b.Time.IsZero())
+		}
+		return timeCompare(b.Time, a.Time)
+	}
+	first, second := byPriority, byDue
+	if policy == overflowHideLatest {
+		first, second = byDue, byPriority
+	}
+	victims := make([]int, len(tasks))
+	for i := range victims {
+		victims[i] = i
+	}
+	sort.SliceStable(victims, func(i, j int) bool {
+		a, b := tasks[victims[i]], tasks[victims[j]]
+		if c := first(a, b); c != 0 {
+			return c < 0
+		}
+		return second(a, b) < 0
+	})
+	return victims
+}
+
+// Numbers of columns of tasks.
+const (
+	columnsOne  = "one" // the default
+	columnsTwo  = "two"
+	columnsAuto = "auto" // two only if the tasks don't all fit in one
+)
+
+// splitColumns splits rows into the given number of columns (one or two) of about equal height.
+// Columns only break before a task or header, so subtasks stay beneath their parents,
+// and the left column is the taller if they can't be equal.
+func splitColumns(rows []listRow, height func(listRow) int, columns int) [][]listRow {
+	if columns < 2 {
+		return [][]listRow{rows}
+	}
+	total := rowsHeight(rows, height)
+	split, tallest := len(rows), total
+	above := 0
+	for i, row := range rows {
+		if i > 0 && row.level == 0 && !row.indent {
+			if h := max(above, total-above); h <= tallest {
+				split, tallest = i, h
+			}
+		}
+		above += height(row)
+	}
+	return [][]listRow{rows[:split], rows[split:]}
+}
+
+// smallerFace returns the next size of face smaller than face, or face if it is the smallest.
+func (r renderer) smallerFace(face font.Face) font.Face {
+	switch face {
+	case r.xlarge:
+		return r.large
+	case r.large:
+		return r.normal
+	case r.normal:
+		return r.small
+	case r.small:
+		return r.tiny
+	}
+	return face
+}
+
+// rowsHeight returns the total height of rows.
+func rowsHeight(rows []listRow, height func(listRow) int) int {
+	total := 0
+	for _, row := range rows {
+		total += height(row)
+	}
+	return total
+}
+
+// columnsHeight returns the height of the tallest of columns.
+func columnsHeight(columns [][]listRow, height func(listRow) int) int {
+	tallest := 0
+	for _, col := range columns {
+		tallest = max(tallest, rowsHeight(col, height))
+	}
+	return tallest
+}
+
+// fitTasks splits tasks into those to show and those to hide, hiding them in the order given
+// by victims until at most max are left (if max is positive) and their rows fit in room pixels
+// when split into the given number of columns.
+// If any are hidden, reserve pixels are left free after the rows that are shown.
+func (r renderer) fitTasks(tasks []renderableTask, victims []int, max int, height func(listRow) int, columns, room, reserve int) (shown, hidden []renderableTask) {
+	k := 0
+	if max > 0 && len(tasks) > max {
+		k = len(tasks) - max
+	}
+	for ; k <= len(tasks); k++ {
+		hide := make(map[int]bool)
+		for _, i := range victims[:k] {
+			hide[i] = true
+		}
+		shown, hidden = nil, nil
+		for i, task := range tasks {
+			if hide[i] {
+				hidden = append(hidden, task)
+			} else {
+				shown = append(shown, task)
+			}
+		}
+		total := columnsHeight(splitColumns(r.listRows(shown), height, columns), height)
+		if k == 0 && total <= room || k > 0 && total <= room-reserve {
+			break
+		}
+	}
+	return shown, hidden
+}
+
+// hiddenTasks summarises the tasks that didn't fit on the display.
+type hiddenTasks struct {
+	Count      int            `json:"count"`
+	ByPriority map[string]int `json:"by_priority"` // keyed by displayed priority, such as "P0"
+}
+
+// hiddenIn summarises the tasks in rows, not counting subtasks already hidden beneath their parents.
+func hiddenIn(rows []listRow) hiddenTasks {
+	h := hiddenTasks{ByPriority: make(map[string]int)}
+	for _, row := range rows {
+		if row.header != "" || row.divider || row.more > 0 {
+			continue
+		}
+		h.Count++
+		h.ByPriority[fmt.Sprintf("P%d", 4-row.task.Priority)]++
+	}
+	return h
+}
+
+// String formats the summary for display, such as "3 hidden (1×P1, 2×P3)".
+func (h hiddenTasks) String() string {
+	var parts []string
+	for p := 0; p <= 3; p++ {
+		if n := h.ByPriority[fmt.Sprintf("P%d", p)]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d×P%d", n, p))
+		}
+	}
+	return fmt.Sprintf("%d hidden (%s)", h.Count, strings.Join(parts, ", "))
+}
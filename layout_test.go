@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupByProject(t *testing.T) {
+	tasks := []renderableTask{
+		{Priority: 4, Title: "a", Project: "House"},
+		{Priority: 3, Title: "b", Project: "Errands"},
+		{Priority: 2, Title: "c", Project: "House"},
+		{Priority: 1, Title: "d", Project: "School"},
+		// A group with a high priority task is ordered early, even if the task was demoted.
+		{Priority: 4, Title: "e", Project: "Garden", Demoted: true},
+	}
+	var got []string
+	for _, g := range groupByProject(tasks) {
+		s := g.Project + ":"
+		for _, task := range g.Tasks {
+			s += task.Title
+		}
+		got = append(got, s)
+	}
+	want := []string{"House:ac", "Garden:e", "Errands:b", "School:d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupByProject = %q, want %q", got, want)
+	}
+}
+
+func TestListRowsSubtasks(t *testing.T) {
+	tasks := []renderableTask{
+		{Title: "a", Project: "House", MoreSubtasks: 1, Subtasks: []renderableTask{
+			{Title: "a1", Subtasks: []renderableTask{{Title: "a1x"}}},
+		}},
+		{Title: "b", Project: "House"},
+	}
+	for _, layout := range []string{"list", "projects"} {
+		var got []string
+		for _, row := range (renderer{layout: layout}).listRows(tasks) {
+			switch {
+			case row.header != "":
+				got = append(got, "#"+row.header)
+			case row.more > 0:
+				got = append(got, fmt.Sprintf("%d:+%d", row.level, row.more))
+			default:
+				got = append(got, fmt.Sprintf("%d:%s", row.level, row.task.Title))
+			}
+		}
+		want := []string{"0:a", "1:a1", "2:a1x", "1:+1", "0:b"}
+		if layout == "projects" {
+			want = append([]string{"#House"}, want...)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("listRows with %s layout = %q, want %q", layout, got, want)
+		}
+	}
+}
+
+func TestOverflowVictims(t *testing.T) {
+	t0 := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	tasks := []renderableTask{
+		{Priority: 4, Title: "a", Time: t0},
+		{Priority: 4, Title: "b"},
+		{Priority: 1, Title: "c", Time: t0.Add(time.Hour)},
+		{Priority: 1, Title: "d", Time: t0.Add(-time.Hour)},
+		{Priority: 2, Title: "e", Overdue: true},
+	}
+	for policy, want := range map[string]string{
+		overflowHideLowPriority: "cdeba",
+		overflowHideLatest:      "bcade",
+	} {
+		var got string
+		for _, i := range overflowVictims(tasks, policy) {
+			got += tasks[i].Title
+		}
+		if got != want {
+			t.Errorf("overflowVictims with %s = %q, want %q", policy, got, want)
+		}
+	}
+}
+
+func TestFitTasks(t *testing.T) {
+	tasks := []renderableTask{
+		{Priority: 4, Title: "a"},
+		{Priority: 2, Title: "b", Subtasks: []renderableTask{{Title: "b1"}}},
+		{Priority: 3, Title: "c"},
+	}
+	victims := overflowVictims(tasks, overflowHideLowPriority)
+	height := func(row listRow) int {
+		if row.level > 0 {
+			return 10
+		}
+		return 20
+	}
+	titles := func(tasks []renderableTask) string {
+		var s string
+		for _, task := range tasks {
+			s += task.Title
+		}
+		return s
+	}
+	tests := []struct {
+		max, columns, room int
+		shown, hiddenWant  string
+	}{
+		{0, 1, 70, "abc", ""},
+		{0, 1, 69, "ac", "b"}, // b and its subtask make way for the reserved line
+		{0, 1, 50, "ac", "b"},
+		{0, 1, 49, "a", "bc"},
+		{2, 1, 100, "ac", "b"},
+		{0, 1, 5, "", "abc"},
+		{0, 2, 50, "abc", ""}, // "ab" beside "c"
+		{0, 2, 49, "ac", "b"},
+	}
+	for _, test := range tests {
+		shown, hidden := (renderer{}).fitTasks(tasks, victims, test.max, height, test.columns, test.room, 10)
+		if got := titles(shown); got != test.shown {
+			t.Errorf("fitTasks(max=%d, columns=%d, room=%d) showed %q, want %q", test.max, test.columns, test.room, got, test.shown)
+		}
+		if got := titles(hidden); got != test.hiddenWant {
+			t.Errorf("fitTasks(max=%d, columns=%d, room=%d) hid %q, want %q", test.max, test.columns, test.room, got, test.hiddenWant)
+		}
+	}
+}
+
+func TestSplitColumns(t *testing.T) {
+	height := func(row listRow) int {
+		if row.level > 0 {
+			return 10
+		}
+		return 20
+	}
+	titles := func(rows []listRow) string {
+		var s string
+		for _, row := range rows {
+			s += row.header + row.task.Title
+		}
+		return s
+	}
+	task := func(title string, level int) listRow {
+		return listRow{task: renderableTask{Title: title}, level: level}
+	}
+	tests := []struct {
+		rows []listRow
+		want []string
+	}{
+		{[]listRow{task("a", 0), task("b", 0), task("c", 0), task("d", 0)}, []string{"ab", "cd"}},
+		{[]listRow{task("a", 0), task("b", 0), task("c", 0)}, []string{"ab", "c"}},
+		// Subtasks stay with their parents.
+		{[]listRow{task("a", 0), task("a1", 1), task("a2", 1), task("a3", 1), task("b", 0)}, []string{"aa1a2a3", "b"}},
+		// Tasks under project headers stay with them.
+		{[]listRow{{header: "H"}, {task: renderableTask{Title: "a"}, indent: true}, {header: "I"}, {task: renderableTask{Title: "b"}, indent: true}}, []string{"Ha", "Ib"}},
+		{[]listRow{task("a", 0)}, []string{"a", ""}},
+		{nil, []string{"", ""}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, col := range splitColumns(test.rows, height, 2) {
+			got = append(got, titles(col))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitColumns(%q) = %q, want %q", titles(test.rows), got, test.want)
+		}
+	}
+}
+
+func TestHiddenIn(t *testing.T) {
+	rows := []listRow{
+		{header: "House"},
+		{task: renderableTask{Title: "a", Priority: 3}},
+		{task: renderableTask{Title: "a1", Priority: 1}, level: 1},
+		{more: 2, level: 1},
+		{divider: true},
+		{task: renderableTask{Title: "b", Priority: 1}},
+		{task: renderableTask{Title: "c", Priority: 1}},
+	}
+	h := hiddenIn(rows)
+	if h.Count != 4 {
+		t.Errorf("hiddenIn counted %d tasks, want 4", h.Count)
+	}
+	if got, want := h.String(), "4 hidden (1×P1, 3×P3)"; got != want {
+		t.Errorf("hiddenIn(...).String() = %q, want %q", got, want)
+	}
+}
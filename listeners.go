@@ -0,0 +1,90 @@
+package main
+
+// Serving HTTP on several addresses, each with its own access policy.
+// This allows, for instance, full access over a VPN interface
+// but only read access on the local network.
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type ListenerConfig struct {
+	// Addr is a TCP address such as "localhost:8080" or "[fd7a::1]:8080",
+	// a Unix socket such as "unix:/run/kitchenthing.sock",
+	// or a port on the tailnet such as "tailscale:80" (see TailscaleConfig).
+	Addr string `yaml:"addr"`
+
+	// ReadOnly rejects requests that change things, which are all POST requests.
+	ReadOnly bool `yaml:"read_only"`
+
+	// Users, if set, requires HTTP basic auth using one of these usernames and passwords.
+	Users map[string]string `yaml:"users"`
+}
+
+// listenerConfigs returns the listeners to serve on. Configured listeners replace
+// the -http flag value, which may have several comma-separated addresses.
+func listenerConfigs(cfg Config, httpFlag string) []ListenerConfig {
+	if len(cfg.Listeners) > 0 {
+		return cfg.Listeners
+	}
+	var lcs []ListenerConfig
+	for _, addr := range strings.Split(httpFlag, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			lcs = append(lcs, ListenerConfig{Addr: addr})
+		}
+	}
+	return lcs
+}
+
+// listen starts listening on the configured address.
+func (lc ListenerConfig) listen(ts TailscaleConfig) (net.Listener, error) {
+	if port, ok := strings.CutPrefix(lc.Addr, "tailscale:"); ok {
+		return listenTailscale(ts, port)
+	}
+	path, ok := strings.CutPrefix(lc.Addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", lc.Addr)
+	}
+	// Remove any socket left over from a previous run.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		os.Remove(path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("checking for old socket: %w", err)
+	}
+	return net.Listen("unix", path)
+}
+
+// wrap returns a handler that applies the listener's access policy before h.
+func (lc ListenerConfig) wrap(h http.Handler) http.Handler {
+	if !lc.ReadOnly && len(lc.Users) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(lc.Users) > 0 && !lc.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kitchenthing", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if lc.ReadOnly && r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "This address is read-only", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (lc ListenerConfig) authorized(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, ok := lc.Users[user]
+	return ok && subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListenerConfigs(t *testing.T) {
+	var addrs []string
+	for _, lc := range listenerConfigs(Config{}, "localhost:8080, [::1]:8080,unix:/tmp/kt.sock") {
+		addrs = append(addrs, lc.Addr)
+	}
+	if want := []string{"localhost:8080", "[::1]:8080", "unix:/tmp/kt.sock"}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("listenerConfigs from the flag = %q, want %q", addrs, want)
+	}
+
+	cfg := Config{Listeners: []ListenerConfig{{Addr: "100.64.0.1:80"}}}
+	if got := listenerConfigs(cfg, "localhost:8080"); !reflect.DeepEqual(got, cfg.Listeners) {
+		t.Errorf("listenerConfigs with configured listeners = %+v, want %+v", got, cfg.Listeners)
+	}
+}
+
+func TestListenerPolicy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		lc         ListenerConfig
+		method     string
+		user, pass string
+		want       int
+	}{
+		{ListenerConfig{}, "POST", "", "", http.StatusOK},
+		{ListenerConfig{ReadOnly: true}, "GET", "", "", http.StatusOK},
+		{ListenerConfig{ReadOnly: true}, "POST", "", "", http.StatusForbidden},
+		{ListenerConfig{Users: map[string]string{"sam": "pw"}}, "GET", "", "", http.StatusUnauthorized},
+		{ListenerConfig{Users: map[string]string{"sam": "pw"}}, "GET", "sam", "wrong", http.StatusUnauthorized},
+		{ListenerConfig{Users: map[string]string{"sam": "pw"}}, "GET", "kim", "pw", http.StatusUnauthorized},
+		{ListenerConfig{Users: map[string]string{"sam": "pw"}}, "POST", "sam", "pw", http.StatusOK},
+		{ListenerConfig{ReadOnly: true, Users: map[string]string{"sam": "pw"}}, "POST", "sam", "pw", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.pass)
+		}
+		rec := httptest.NewRecorder()
+		test.lc.wrap(ok).ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%s as %q with %+v gave %d, want %d", test.method, test.user, test.lc, rec.Code, test.want)
+		}
+	}
+}
+
+func TestListenTailscaleUnsupported(t *testing.T) {
+	if tailscaleSupported {
+		t.Skip("built with tsnet")
+	}
+	if _, err := (ListenerConfig{Addr: "tailscale:80"}).listen(TailscaleConfig{}); err == nil {
+		t.Errorf("Listening on the tailnet without tsnet support succeeded")
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "kt.sock")
+	lc := ListenerConfig{Addr: "unix:" + sock}
+	for i := 0; i < 2; i++ { // the second time finds a stale socket
+		l, err := lc.listen(TailscaleConfig{})
+		if err != nil {
+			t.Fatalf("listen #%d: %v", i+1, err)
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		})}
+		go srv.Serve(l)
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+			},
+		}}
+		resp, err := client.Get("http://kitchenthing/")
+		if err != nil {
+			t.Fatalf("GET over Unix socket: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello" {
+			t.Errorf("GET over Unix socket gave %q, want %q", body, "hello")
+		}
+		// Close only the listener, leaving the socket file behind as a crash would.
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		srv.Close()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+// Waveform lookup tables (LUTs) for the e-Paper controller.
+//
+// By default the panel uses the LUTs programmed into its OTP memory,
+// following 4.2-2 in the spec. Loading LUTs into registers instead (4.2-1)
+// allows different waveforms, such as ones that refresh faster at the cost of ghosting.
+// No tables are built in, since waveforms need tuning for each panel and temperature;
+// they come from the config, such as from a panel vendor's reference code.
+// In particular there are no "quality" or "fast" presets yet: Waveshare's reference
+// code for the (B) panel only uses the OTP LUTs, so there is nothing to cite, and
+// a waveform that isn't DC balanced can permanently damage the panel.
+//
+// Each LUT is a sequence of 6-byte groups. The first byte selects the level for
+// each of four phases (two bits per phase, first phase in the high bits), the
+// next four are the frame counts of those phases, and the last is how many
+// times to repeat the group. For the pixel LUTs the levels are GND, VDH, VDL and VDHR;
+// for the VCOM LUT they are VCOM_DC, VDH+VCOM_DC, VDL+VCOM_DC and floating.
+
+import (
+	"fmt"
+	"sort"
+)
+
+type LUTConfig struct {
+	// Source is "otp" (the default) or "register".
+	Source string `yaml:"source"`
+
+	// Tables are register LUTs by name (vcom, red, white, black, border).
+	// Only the tables given are loaded.
+	Tables map[string][]int `yaml:"tables"`
+}
+
+// lutRegisters are the LUT commands used in KWR mode, by table name.
+var lutRegisters = map[string]byte{
+	"vcom":   0x20, // VCOM LUT (LUTC)
+	"red":    0x22, // Red LUT (LUTR)
+	"white":  0x23, // White LUT (LUTW)
+	"black":  0x24, // Black LUT (LUTK)
+	"border": 0x25, // Border LUT (LUTBD)
+}
+
+const (
+	lutGroupSize = 6
+	lutMaxGroups = 10
+)
+
+func (lc LUTConfig) validate() error {
+	switch lc.Source {
+	case "", "otp":
+		if len(lc.Tables) > 0 {
+			return fmt.Errorf("tables need source \"register\"")
+		}
+		return nil
+	case "register":
+	default:
+		return fmt.Errorf("unknown source %q", lc.Source)
+	}
+	if len(lc.Tables) == 0 {
+		return fmt.Errorf("register source needs tables")
+	}
+	for name, lut := range lc.Tables {
+		if _, ok := lutRegisters[name]; !ok {
+			return fmt.Errorf("unknown table %q", name)
+		}
+		if len(lut) == 0 || len(lut)%lutGroupSize != 0 || len(lut) > lutGroupSize*lutMaxGroups {
+			return fmt.Errorf("table %s has %d bytes, want a multiple of %d up to %d", name, len(lut), lutGroupSize, lutGroupSize*lutMaxGroups)
+		}
+		for _, b := range lut {
+			if b < 0 || b > 0xFF {
+				return fmt.Errorf("table %s value %d is not a byte", name, b)
+			}
+		}
+	}
+	return nil
+}
+
+// fromRegister reports whether LUTs should be loaded from registers.
+func (lc LUTConfig) fromRegister() bool { return lc.Source == "register" }
+
+type lutCommand struct {
+	cmd  byte
+	data []byte
+}
+
+// commands returns the LUT commands to send, in register order.
+func (lc LUTConfig) commands() []lutCommand {
+	if !lc.fromRegister() {
+		return nil
+	}
+	var cmds []lutCommand
+	for name, lut := range lc.Tables {
+		cmds = append(cmds, lutCommand{lutRegisters[name], intsToBytes(lut)})
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].cmd < cmds[j].cmd })
+	return cmds
+}
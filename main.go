@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
@@ -23,9 +24,13 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dsymonds/todoist"
 	"golang.org/x/image/font"
@@ -37,22 +42,125 @@ import (
 var (
 	configFile = flag.String("config_file", "config.yaml", "configuration `filename`")
 	debug      = flag.Bool("debug", false, "whether to log extra information")
-	httpFlag   = flag.String("http", "localhost:8080", "`address` on which to serve HTTP")
+	httpFlag   = flag.String("http", "localhost:8080", "comma-separated `addresses` on which to serve HTTP; unix:/path for a Unix socket")
 
 	actOnMetadata = flag.Bool("act_on_metadata", false, "whether to act on metadata in task labels")
 
 	testRender  = flag.String("test_render", "", "`filename` to render a PNG to")
 	testTodoist = flag.Bool("test_todoist", false, "whether to use fake Todoist data")
+
+	burnTest     = flag.Bool("burn_test", false, "whether to run the panel burn-in/alignment diagnostic instead of the normal display")
+	burnTestHold = flag.Duration("burn_test_hold", 30*time.Second, "how long to hold each burn test pattern")
+
+	paperTraceFile  = flag.String("paper_trace", "", "`filename` to record everything sent to the panel to")
+	replayTraceFile = flag.String("replay_trace", "", "`filename` of a paper trace to replay to the panel instead of running normally")
+	replayPNG       = flag.String("replay_png", "", "`filename` to write the last frame of -replay_trace to as a PNG, instead of using the panel")
+
+	printSchema = flag.Bool("print_schema", false, "whether to print a JSON Schema for the config file and exit")
 )
 
 type Config struct {
-	Font            string        `yaml:"font"`
+	Font     string `yaml:"font"`
+	BoldFont string `yaml:"bold_font"` // for **bold** in titles; optional
+
+	// FallbackFonts are used, in order, for glyphs missing from the main font,
+	// such as emoji. Colour emoji fonts are not supported; use something like Noto Emoji.
+	FallbackFonts []string `yaml:"fallback_fonts"`
+	// Locale is the language of relative times (see RegionConfig.TimeStyle),
+	// and sets whether times of day use a 12 or 24 hour clock.
+	// It may be "en" (the default), "de", "es", "fr" or "nl", optionally with a region such as "en-AU".
+	// It is also the language of the web UI for browsers that don't prefer one of those.
+	Locale string `yaml:"locale"`
+
+	// MissingGlyph is drawn in place of any character that no font has; it defaults to "?".
+	MissingGlyph string `yaml:"missing_glyph"`
+	// GlyphSubstitutions replace text, such as single characters, before it is drawn,
+	// for what the fonts can't draw well. They add to and override those in glyphsubst.go.
+	GlyphSubstitutions map[string]string `yaml:"glyph_substitutions"`
+
 	RefreshPeriod   time.Duration `yaml:"refresh_period"`
+	RefreshBudget   int           `yaml:"daily_refresh_budget"` // warn if the panel refreshes more often than this per day
 	TodoistAPIToken string        `yaml:"todoist_api_token"`
+	TodoistAPI      string        `yaml:"todoist_api"` // "v9", "v1" or "auto" (the default)
 	PhotosDir       string        `yaml:"photos_dir"`
+	StateFile       string        `yaml:"state_file"` // where to persist state; optional
+	AccessLog       string        `yaml:"access_log"` // where to append HTTP requests as JSON lines; optional
+
+	// RefreshPeriods override RefreshPeriod for parts of the day. The first that covers the time applies.
+	RefreshPeriods []RefreshPeriodRule `yaml:"refresh_periods"`
+
+	// TodoistCache is where to keep the last synced Todoist data,
+	// so the display can start up without a network; optional.
+	TodoistCache string `yaml:"todoist_cache"`
+
+	// StateDir, if set, is a directory for files kept across restarts. It is created
+	// if need be, and state_file and todoist_cache default to state.json and todoist.json in it.
+	// The HomeKit pairings, the tailnet node's identity and converted HEIC photos
+	// default to the homekit, tailscale and heic directories in it.
+	StateDir string `yaml:"state_dir"`
+
+	// Listeners are the addresses to serve HTTP on, with their access policies.
+	// If set, they replace the -http flag.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// Tailscale configures serving on a tailnet, for listeners with tailscale: addresses.
+	Tailscale TailscaleConfig `yaml:"tailscale"`
+
+	// MDNS advertises the web UI on the local network.
+	MDNS MDNSConfig `yaml:"mdns"`
+
+	// ScheduledPhotosDir holds photos uploaded via the web UI
+	// that replace the random photo for a range of dates.
+	ScheduledPhotosDir string `yaml:"scheduled_photos_dir"`
+
+	// PhotoOrder is how to pick photos: "random" (the default) favours photos
+	// not shown for a while, and "shuffle" cycles through every photo before
+	// repeating any, weighted by photos.yaml in the photos dir; see photoqueue.go.
+	PhotoOrder string `yaml:"photo_order"`
+
+	// PhotoMinHeight is the least height in pixels of free space to show a photo in.
+	// It defaults to 60; a negative value shows a photo in any space.
+	PhotoMinHeight int `yaml:"photo_min_height"`
+
+	// Album is an iCloud shared album to sync into photos_dir; see album.go.
+	Album AlbumConfig `yaml:"album"`
+
+	// Calendars are ICS feeds whose events for today are shown in a strip; see calendar.go.
+	Calendars []CalendarConfig `yaml:"calendars"`
+
+	Alertmanager string     `yaml:"alertmanager"`
+	Webhook      string     `yaml:"webhook"` // URL to POST to when the display changes; optional
+	MQTT         string     `yaml:"mqtt"`
+	HASS         HASSConfig `yaml:"hass"`
 
-	Alertmanager string `yaml:"alertmanager"`
-	MQTT         string `yaml:"mqtt"`
+	// Alertmanagers are more Alertmanagers to show alerts from, as well as or instead of
+	// Alertmanager, such as for separate Prometheus stacks. Their alerts are merged,
+	// each shown with the name of where it came from.
+	Alertmanagers []AlertmanagerConfig `yaml:"alertmanagers"`
+
+	// Alerts filters the alerts to show, and picks their colours.
+	Alerts AlertsConfig `yaml:"alerts"`
+
+	// MQTTPublish sets the QoS and retain flag for MQTT publishes.
+	MQTTPublish MQTTPublishConfig `yaml:"mqtt_publish"`
+
+	// HomeKit configures a HomeKit bridge, as an alternative to Home Assistant.
+	HomeKit HomeKitConfig `yaml:"homekit"`
+
+	Presence PresenceConfig `yaml:"presence"`
+	Energy   EnergyConfig   `yaml:"energy"`
+	Weather  WeatherConfig  `yaml:"weather"`
+	Footer   FooterConfig   `yaml:"footer"`
+
+	// PowerLoss configures how a UPS signals that mains power has been lost.
+	PowerLoss PowerLossConfig `yaml:"power_loss"`
+
+	// BusyGPIO, if positive, is the BCM number of an output pin
+	// (e.g. for an LED) that is driven high while the panel is refreshing.
+	BusyGPIO int `yaml:"busy_gpio"`
+
+	// Touch configures an optional touch overlay on the panel.
+	Touch TouchConfig `yaml:"touch"`
 
 	Orderings []struct {
 		Project string          `yaml:"project"`
@@ -61,6 +169,100 @@ type Config struct {
 
 	// Messages are applied in a first-match order.
 	Messages []message `yaml:"messages"`
+
+	// NextActionsLabel, if set, switches to showing tasks with this label
+	// (e.g. "next") regardless of their due dates, along with overdue tasks,
+	// instead of the tasks due today.
+	NextActionsLabel string `yaml:"next_actions_label"`
+
+	// Fairness enables a rolling report on how evenly assigned tasks get completed.
+	Fairness FairnessConfig `yaml:"fairness"`
+
+	// CompletedFeed, if set, records tasks completed in shared projects, and serves an Atom feed
+	// of those from the last week at /completed.atom, for following along without Todoist.
+	CompletedFeed bool `yaml:"completed_feed"`
+
+	// Metadata sets which metadata labels (such as m:dd) are acted on in which projects.
+	Metadata MetadataConfig `yaml:"metadata"`
+
+	// InProgress handles tasks that keep the in-progress label for too long.
+	InProgress InProgressConfig `yaml:"in_progress"`
+
+	// Subtasks controls showing due subtasks beneath their due parents.
+	Subtasks SubtaskConfig `yaml:"subtasks"`
+
+	// Order is "priority" (the default) to sort tasks by priority then time,
+	// or "todoist" to keep the order they are arranged in within the Todoist app.
+	Order string `yaml:"order"`
+
+	// TitleRewrites rewrite task titles, in order, before they are shown or compared.
+	TitleRewrites []TitleRewriteConfig `yaml:"title_rewrites"`
+
+	// DateFormat is the layout of the date header, as for time.Format.
+	// It defaults to "Mon 2 Jan". The date shrinks to fit beside the subtitle.
+	DateFormat string `yaml:"date_format"`
+
+	// MinPriority, if set, is the lowest priority of task to show on the panel,
+	// as displayed there (e.g. "P1" shows only P0 and P1 tasks).
+	// All tasks are still published via MQTT and the web UI.
+	MinPriority string `yaml:"min_priority"`
+
+	// MaxTasks, if positive, is the most tasks to show on the panel.
+	MaxTasks int `yaml:"max_tasks"`
+
+	// Overflow is what to do when there are more tasks than fit on the panel (or MaxTasks):
+	// "hide_low_priority" (the default) hides the lowest priority tasks,
+	// "hide_latest" hides the tasks due latest,
+	// and "shrink" uses progressively smaller text before hiding low priority tasks.
+	Overflow string `yaml:"overflow"`
+
+	// Columns is how many columns to show tasks in on the panel: "one" (the default), "two",
+	// or "auto" for two only when they don't all fit in one. Two columns use smaller text.
+	Columns string `yaml:"columns"`
+
+	// Layout is "list" (the default) for a single list of tasks,
+	// or "projects" for tasks grouped under project headers.
+	Layout string `yaml:"layout"`
+
+	// AssigneeIdenticons, if set, draws a small pattern derived from each task's assignee
+	// in a gutter to the left of the task list, so ownership can be seen at a glance.
+	AssigneeIdenticons bool `yaml:"assignee_identicons"`
+
+	// Regions arranges the display as a list of widgets, placed in order.
+	// If it is empty, the date is at the top, followed by the task list,
+	// with the footer at the bottom and a photo in any space left.
+	// See regions.go for details.
+	Regions []RegionConfig `yaml:"regions"`
+
+	// ProjectNames maps project names to shorter names to display.
+	ProjectNames map[string]string `yaml:"project_names"`
+	// MaxProjectWidth, if positive, is the maximum width in pixels of
+	// a displayed project name. Longer names are truncated.
+	MaxProjectWidth int `yaml:"max_project_width"`
+
+	// LabelColours draws the titles of tasks in red if they have a label that is red-ish
+	// in Todoist (red, berry red, orange, magenta or salmon), so emphasis can be set from the app.
+	LabelColours bool `yaml:"label_colours"`
+
+	// AccessibilityMode renders larger, more widely spaced text,
+	// reserves red for overdue tasks, and omits the photo.
+	// It may also be toggled at runtime via MQTT.
+	AccessibilityMode bool `yaml:"accessibility_mode"`
+
+	// Display is the model of panel: "waveshare_7in5b_v2" (the default),
+	// or "waveshare_7in5_v2" for the black and white one, which shows red as black.
+	Display string `yaml:"display"`
+
+	// Panel is the panel's geometry.
+	Panel PanelConfig `yaml:"panel"`
+
+	// PanelPowerSave shuts down SPI and releases the panel's pins between refreshes,
+	// instead of only putting the panel into deep sleep. It is meant for battery installations,
+	// but the idle current saved hasn't been measured; measure it before relying on it.
+	PanelPowerSave bool `yaml:"panel_power_save"`
+
+	// PanelTuning is for advanced adjustment of the e-Paper's voltages and waveforms.
+	PanelTuning PanelTuning `yaml:"panel_tuning"`
 }
 
 type message struct {
@@ -69,28 +271,141 @@ type message struct {
 	Eq *int `yaml:"eq"` // ==
 	Lt *int `yaml:"lt"` // <
 
+	// Conditions on today's weather, which must also hold if they are set.
+	// The weather comes from the weather sensors, or else the forecast.
+	RainAbove *float64 `yaml:"rain_above"` // percent
+	TempAbove *float64 `yaml:"temp_above"`
+	TempBelow *float64 `yaml:"temp_below"`
+
 	Options []string `yaml:"options"`
 }
 
-func (m message) Matches(n int) bool {
+// messageContext is what messages are matched against.
+type messageContext struct {
+	Tasks   int // including subtasks
+	Weather weather
+}
+
+func (m message) Matches(mc messageContext) bool {
+	if !weatherHolds(mc.Weather, m.RainAbove, m.TempAbove, m.TempBelow) {
+		return false
+	}
 	if m.Eq != nil {
-		return n == *m.Eq
+		return mc.Tasks == *m.Eq
 	}
 	if m.Lt != nil {
-		return n < *m.Lt
+		return mc.Tasks < *m.Lt
 	}
 	return true
 }
 
+// matchingMessage returns the index of the first of messages that matches the data,
+// or -1 if none does.
+func matchingMessage(messages []message, data displayData) int {
+	mc := messageContext{Tasks: countTasks(data.tasks, nil), Weather: data.messageWeather()}
+	for i, msg := range messages {
+		if msg.Matches(mc) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m message) usesWeather() bool {
+	return m.RainAbove != nil || m.TempAbove != nil || m.TempBelow != nil
+}
+
 func parseConfig(filename string) (Config, error) {
 	raw, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return Config{}, fmt.Errorf("reading config file %s: %v", filename, err)
 	}
+	// Check against the schema first, since its errors say where problems are more clearly.
+	var generic interface{}
+	if err := yaml.Unmarshal(raw, &generic); err != nil {
+		return Config{}, fmt.Errorf("parsing config from %s: %v", filename, err)
+	}
+	if probs := configSchema().check(generic, ""); len(probs) > 0 {
+		return Config{}, fmt.Errorf("bad config in %s:\n\t%s", filename, strings.Join(probs, "\n\t"))
+	}
 	var cfg Config
 	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
 		return Config{}, fmt.Errorf("parsing config from %s: %v", filename, err)
 	}
+	if err := cfg.Panel.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad panel in %s: %w", filename, err)
+	}
+	if err := cfg.PanelTuning.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad panel_tuning in %s: %w", filename, err)
+	}
+	if err := validateDisplay(cfg.Display, cfg.PanelTuning); err != nil {
+		return Config{}, fmt.Errorf("bad display in %s: %w", filename, err)
+	}
+	if err := validateAlertmanagers(cfg.alertmanagers()); err != nil {
+		return Config{}, fmt.Errorf("bad alertmanagers in %s: %w", filename, err)
+	}
+	if err := cfg.Alerts.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad alerts in %s: %w", filename, err)
+	}
+	for i := range cfg.RefreshPeriods {
+		if err := cfg.RefreshPeriods[i].parse(); err != nil {
+			return Config{}, fmt.Errorf("bad refresh period %d in %s: %w", i+1, filename, err)
+		}
+	}
+	if err := cfg.Touch.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad touch in %s: %w", filename, err)
+	}
+	for i, cc := range cfg.Calendars {
+		if err := cc.validate(); err != nil {
+			return Config{}, fmt.Errorf("bad calendar %d in %s: %w", i+1, filename, err)
+		}
+	}
+	if err := cfg.Metadata.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad metadata in %s: %w", filename, err)
+	}
+	if err := cfg.InProgress.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad in_progress in %s: %w", filename, err)
+	}
+	if err := cfg.Weather.Forecast.validate(cfg.HASS); err != nil {
+		return Config{}, fmt.Errorf("bad weather forecast in %s: %w", filename, err)
+	}
+	for i, m := range cfg.Messages {
+		if m.usesWeather() && !cfg.Weather.sensors() && cfg.Weather.Forecast.Provider == "" {
+			return Config{}, fmt.Errorf("bad message %d in %s: it has weather conditions, but there is no weather sensor or forecast", i+1, filename)
+		}
+	}
+	if err := cfg.HomeKit.validate(); err != nil {
+		return Config{}, fmt.Errorf("bad homekit in %s: %w", filename, err)
+	}
+	switch cfg.PhotoOrder {
+	case "", photoOrderRandom, photoOrderShuffle:
+	default:
+		return Config{}, fmt.Errorf("bad photo_order %q in %s", cfg.PhotoOrder, filename)
+	}
+	for i, hi := range cfg.HASS.Items {
+		if err := hi.validate(); err != nil {
+			return Config{}, fmt.Errorf("bad hass item %d in %s: %w", i+1, filename, err)
+		}
+	}
+	if cfg.Album.URL != "" {
+		if err := cfg.Album.validate(cfg.PhotosDir); err != nil {
+			return Config{}, fmt.Errorf("bad album in %s: %w", filename, err)
+		}
+	}
+	if cfg.StateDir != "" {
+		if cfg.StateFile == "" {
+			cfg.StateFile = filepath.Join(cfg.StateDir, "state.json")
+		}
+		if cfg.TodoistCache == "" {
+			cfg.TodoistCache = filepath.Join(cfg.StateDir, "todoist.json")
+		}
+		if cfg.HomeKit.StateDir == "" {
+			cfg.HomeKit.StateDir = filepath.Join(cfg.StateDir, "homekit")
+		}
+		if cfg.Tailscale.StateDir == "" {
+			cfg.Tailscale.StateDir = filepath.Join(cfg.StateDir, "tailscale")
+		}
+	}
 	return cfg, nil
 }
 
@@ -99,14 +414,48 @@ func main() {
 
 	rand.Seed(time.Now().UnixNano())
 
+	if *printSchema {
+		raw, err := json.MarshalIndent(configSchema(), "", "  ")
+		if err != nil {
+			log.Fatalf("Encoding schema: %v", err)
+		}
+		fmt.Printf("%s\n", raw)
+		return
+	}
+
+	if *replayTraceFile != "" {
+		if err := replayPaperTrace(*replayTraceFile, *replayPNG); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	cfg, err := parseConfig(*configFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.StateDir != "" {
+		if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+			log.Fatalf("Making state dir: %v", err)
+		}
+		heicCacheDir = filepath.Join(cfg.StateDir, "heic")
+	}
+	state, err := loadState(cfg.StateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	access, err := newAccessLog(cfg.AccessLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wake := newWaker()
 	s := &server{
 		startTime: time.Now(),
 		cfg:       cfg,
+		state:     state,
+		access:    access,
+		wake:      wake,
 	}
 	http.Handle("/", s)
 
@@ -114,14 +463,17 @@ func main() {
 	if err != nil {
 		log.Fatalf("newRenderer: %v", err)
 	}
-	ref, err := newRefresher(cfg)
+	s.glyphs = rend.missing
+	ref, err := newRefresher(cfg, state)
 	if err != nil {
 		log.Fatalf("newRefresher: %v", err)
 	}
+	s.ref = ref
 
 	if *testRender != "" {
-		ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-		img := image.NewPaletted(image.Rect(0, 0, 800, 480), staticPalette)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		img := image.NewPaletted(image.Rectangle{Max: cfg.Panel.size()}, staticPalette)
 		draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
 		rend.Render(img, ref.Refresh(ctx))
 		var buf bytes.Buffer
@@ -139,56 +491,154 @@ func main() {
 	log.Printf("kitchenthing starting...")
 	time.Sleep(500 * time.Millisecond)
 
-	p := newPaper()
+	hw := newPaper(cfg.Panel, cfg.PanelTuning)
+	hw.powerSave = cfg.PanelPowerSave
+	if *paperTraceFile != "" {
+		hw.trace, err = openPaperTrace(*paperTraceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Tracing panel operations to %s", *paperTraceFile)
+	}
+	p := newPanelDriver(cfg.Display, hw)
+	s.lastWhiteFlush = p.LastWhiteFlush
+	s.framePlane = p.Plane
+	s.hits = new(hitMap)
 
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Handle signals.
+	// Handle signals. SIGHUP refreshes now, and SIGUSR1 redraws too.
 	go func() {
 		sigc := make(chan os.Signal, 1)
-		signal.Notify(sigc, os.Interrupt) // TODO: others?
+		signal.Notify(sigc, os.Interrupt, syscall.SIGHUP, syscall.SIGUSR1)
 
-		sig := <-sigc
-		log.Printf("Caught signal %v; shutting down gracefully", sig)
-		cancel()
+		for sig := range sigc {
+			switch sig {
+			case syscall.SIGHUP:
+				wake.Wake("SIGHUP", false)
+				continue
+			case syscall.SIGUSR1:
+				wake.Wake("SIGUSR1", true)
+				continue
+			}
+			log.Printf("Caught signal %v; shutting down gracefully", sig)
+			cancel()
+			return
+		}
 	}()
 
-	// Start HTTP server.
-	httpServer := &http.Server{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		l, err := net.Listen("tcp", *httpFlag)
+	// Start HTTP servers.
+	mdnsPort := 0 // of the first listener reachable from the local network
+	for _, lc := range listenerConfigs(cfg, *httpFlag) {
+		httpServer := &http.Server{
+			Handler: access.wrap(lc.wrap(http.DefaultServeMux)),
+		}
+		addr := lc.Addr
+		l, err := lc.listen(cfg.Tailscale)
 		if err != nil {
-			log.Printf("net.Listen(_, %q): %v", *httpFlag, err)
+			log.Printf("Listening on %q: %v", addr, err)
 			cancel()
+			break
 		}
-
-		log.Printf("Serving HTTP on %s", l.Addr())
-		err = httpServer.Serve(l)
-		if err != http.ErrServerClosed {
-			log.Printf("http.Serve: %v", err)
-			cancel()
+		if ta, ok := l.Addr().(*net.TCPAddr); ok && mdnsPort == 0 && !ta.IP.IsLoopback() && !strings.HasPrefix(addr, "tailscale:") {
+			mdnsPort = ta.Port
 		}
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log.Printf("Serving HTTP on %s", l.Addr())
+			err := httpServer.Serve(l)
+			if err != http.ErrServerClosed {
+				log.Printf("http.Serve on %s: %v", addr, err)
+				cancel()
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+			httpServer.Shutdown(context.Background())
+		}()
+	}
+
+	if cfg.MDNS.Enabled && mdnsPort == 0 {
+		log.Printf("Not advertising via mDNS, since HTTP is only served on loopback addresses or Unix sockets")
+	} else if cfg.MDNS.Enabled {
+		md := newMDNSResponder(cfg.MDNS, mdnsPort)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := md.Serve(ctx); err != nil {
+				log.Printf("mDNS: %v", err)
+			}
+		}()
+	}
 
-		<-ctx.Done()
-		httpServer.Shutdown(context.Background())
-	}()
+	if cfg.Album.URL != "" {
+		as := newAlbumSyncer(cfg.Album, cfg.PhotosDir, cfg.Panel.size())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			as.Run(ctx)
+		}()
+	}
 
 	mqtt, err := NewMQTT(cfg)
 	if err != nil {
 		log.Fatalf("MQTT: %v", err)
 	}
+	s.mqtt = mqtt
+	var hk *homeKit // nil unless enabled
+	if cfg.HomeKit.Enabled {
+		hk, err = startHomeKit(ctx, cfg.HomeKit)
+		if err != nil {
+			log.Fatalf("HomeKit: %v", err)
+		}
+	}
+
+	var power *powerLoss
+	if cfg.PowerLoss.GPIO > 0 || cfg.PowerLoss.MQTTTopic != "" {
+		power = newPowerLoss()
+	}
+	if mqtt != nil && cfg.PowerLoss.MQTTTopic != "" {
+		mqtt.Handle(cfg.PowerLoss.MQTTTopic, power.handleMQTT(cfg.PowerLoss))
+	}
+	if mqtt != nil {
+		mqtt.HandleAccessibilityMode(func(on bool) {
+			log.Printf("Setting accessibility mode to %t via MQTT", on)
+			ref.SetAccessibilityMode(on)
+			wake.Wake("accessibility mode set via MQTT", false)
+		})
+		mqtt.HandleNotes(func(notes string) {
+			if err := s.setNotes(notes, "MQTT"); err != nil {
+				log.Printf("Saving notes: %v", err)
+			}
+		})
+	}
 
 	if err := p.Start(); err != nil {
 		log.Fatalf("Paper start: %v", err)
 	}
+	if power != nil && cfg.PowerLoss.GPIO > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			power.watchGPIO(ctx, cfg.PowerLoss)
+		}()
+	}
+	if cfg.Touch.Device != "" {
+		tc := &touchController{cfg: cfg.Touch, panel: p.Bounds().Size(), hits: s.hits, ref: ref, wake: wake}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tc.Run(ctx); err != nil {
+				log.Printf("Touch input failed: %v", err)
+			}
+		}()
+	}
 
 	// Wait a bit. If things are still okay, consider this a successful startup.
 	select {
@@ -203,7 +653,11 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := loop(ctx, cfg, rend, ref, p, mqtt); err != nil {
+		if *burnTest {
+			if err := runBurnTest(ctx, rend, p, *burnTestHold); err != nil {
+				log.Printf("Burn test failed: %v", err)
+			}
+		} else if err := loop(ctx, cfg, rend, ref, p, state, mqtt, hk, wake, power, s.hits, s.photoRendered); err != nil {
 			log.Printf("Loop failed: %v", err)
 		}
 		cancel()
@@ -214,16 +668,30 @@ exit:
 	<-ctx.Done()
 	wg.Wait()
 	p.Stop()
+	if err := hw.trace.Close(); err != nil {
+		log.Printf("Closing paper trace: %v", err)
+	}
 	log.Printf("kitchenthing done")
 }
 
 type server struct {
 	startTime time.Time
 	cfg       Config
-
-	mu        sync.Mutex
-	logBuf    bytes.Buffer
-	nextPhoto string
+	ref       *refresher
+	state     *stateStore
+	mqtt      *MQTT // may be nil
+	access    *accessLog
+	wake      *waker // may be nil
+	glyphs    *missingGlyphs
+
+	lastWhiteFlush func() time.Time                  // may be nil
+	framePlane     func(name string) *image.Paletted // may be nil
+	hits           *hitMap                           // may be nil
+
+	mu          sync.Mutex
+	logBuf      bytes.Buffer
+	nextPhoto   string
+	pickedPhoto string // base name of the photo picked for the last render, if any
 }
 
 func (s *server) Write(p []byte) (n int, err error) {
@@ -251,6 +719,17 @@ func (s *server) Write(p []byte) (n int, err error) {
 }
 
 func (s *server) pickPhoto() (string, error) {
+	s.setPickedPhoto("")
+	if s.cfg.ScheduledPhotosDir != "" {
+		sel, err := activeScheduledPhoto(s.cfg.ScheduledPhotosDir, time.Now())
+		if err != nil {
+			log.Printf("Looking for scheduled photo: %v", err)
+			// Fall back to a random photo.
+		} else if sel != "" {
+			return sel, nil
+		}
+	}
+
 	if s.cfg.PhotosDir == "" {
 		return "", nil
 	}
@@ -273,16 +752,124 @@ func (s *server) pickPhoto() (string, error) {
 		for _, opt := range opts {
 			if sel == opt {
 				log.Printf("Using previously selected photo %q", sel)
+				s.setPickedPhoto(sel)
 				return sel, nil
 			}
 		}
 		log.Printf("Error: previously selected photo %q does not exist; ignoring", sel)
 	}
 
-	return opts[rand.Intn(len(opts))], nil
+	// Don't pick hidden photos at random.
+	hidden := s.hiddenPhotos()
+	var visible []string
+	for _, opt := range opts {
+		if !hidden[filepath.Base(opt)] {
+			visible = append(visible, opt)
+		}
+	}
+	if len(visible) == 0 {
+		return "", fmt.Errorf("all %d photos are hidden", len(opts))
+	}
+
+	if s.cfg.PhotoOrder == photoOrderShuffle {
+		return s.pickShuffledPhoto(visible)
+	}
+
+	// Favour photos that haven't been shown for a while.
+	s.state.View(func(st *State) { visible = leastRecentlyShown(visible, st.PhotoStats) })
+	sel = visible[rand.Intn(len(visible))]
+	s.setPickedPhoto(sel)
+	return sel, nil
+}
+
+// pickShuffledPhoto picks the next photo of opts (full filenames) from the shuffle queue.
+func (s *server) pickShuffledPhoto(opts []string) (string, error) {
+	pm, err := loadPhotoManifest(s.cfg.PhotosDir)
+	if err != nil {
+		log.Printf("Loading photo manifest: %v", err)
+		// Carry on without weights.
+	}
+	byName := make(map[string]string)
+	var names []string
+	for _, opt := range opts {
+		name := filepath.Base(opt)
+		byName[name] = opt
+		names = append(names, name)
+	}
+	var name string
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	err = s.state.Update(func(st *State) { name = st.PhotoShuffle.Pick(names, pm, rng) })
+	if err != nil {
+		log.Printf("Saving photo shuffle: %v", err)
+	}
+	if name == "" {
+		return "", fmt.Errorf("all %d photos have a weight of 0", len(opts))
+	}
+	s.setPickedPhoto(byName[name])
+	return byName[name], nil
+}
+
+func (s *server) setPickedPhoto(filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pickedPhoto = ""
+	if filename != "" {
+		s.pickedPhoto = filepath.Base(filename)
+	}
+}
+
+// photoRendered is called after each render is sent to the panel, and records
+// the photo picked for it as shown if the panel refreshed. Renders that the panel
+// doesn't show, such as ones that look the same as what is on it, don't count.
+func (s *server) photoRendered(refreshed bool) {
+	s.mu.Lock()
+	name := s.pickedPhoto
+	s.pickedPhoto = ""
+	s.mu.Unlock()
+	if !refreshed || name == "" {
+		return
+	}
+	err := s.state.Update(func(st *State) { recordPhotoShown(st, name, time.Now()) })
+	if err != nil {
+		log.Printf("Saving photo stats: %v", err)
+	}
+}
+
+// hiddenPhotos returns the set of base names of hidden photos.
+func (s *server) hiddenPhotos() map[string]bool {
+	hidden := make(map[string]bool)
+	s.state.View(func(st *State) {
+		for _, name := range st.HiddenPhotos {
+			hidden[name] = true
+		}
+	})
+	return hidden
+}
+
+// findPhoto returns the full filename of the photo with the given base name.
+// It only finds photos that are in the photos dir.
+func (s *server) findPhoto(name string) (string, bool) {
+	if s.cfg.PhotosDir == "" {
+		return "", false
+	}
+	opts, err := photoOptions(s.cfg.PhotosDir)
+	if err != nil {
+		log.Printf("Looking for photo options: %v", err)
+		return "", false
+	}
+	for _, opt := range opts {
+		if filepath.Base(opt) == name {
+			return opt, true
+		}
+	}
+	return "", false
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/photo/") {
+		s.servePhoto(w, r)
+		return
+	}
 	switch r.URL.Path {
 	default:
 		http.NotFound(w, r)
@@ -290,46 +877,171 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.serveFront(w, r)
 	case "/set-next-photo":
 		s.serveSetNextPhoto(w, r)
+	case "/schedule-photo":
+		s.serveSchedulePhoto(w, r)
+	case "/show-image":
+		s.serveShowImage(w, r)
+	case "/notes":
+		s.serveNotes(w, r)
+	case "/photos":
+		s.servePhotos(w, r)
+	case "/metrics":
+		s.serveMetrics(w, r)
+	case "/completed.atom":
+		s.serveCompletedFeed(w, r)
+	case "/api/status":
+		s.serveStatus(w, r)
+	case "/api/tasks":
+		s.serveTasks(w, r)
+	case "/api/logs":
+		s.serveLogs(w, r)
+	case "/api/glyphs":
+		s.serveGlyphs(w, r)
+	case "/api/frame/bw.png":
+		s.serveFramePlane(w, r, "bw")
+	case "/api/frame/red.png":
+		s.serveFramePlane(w, r, "red")
+	case "/api/hitmap":
+		s.serveHitMap(w, r)
+	case "/refresh":
+		s.serveWake(w, r, false)
+	case "/redraw":
+		s.serveWake(w, r, true)
 	}
 }
 
+// frontTabs are the tabs of the front page, chosen with the tab query parameter.
+// The first is the default.
+var frontTabs = []string{"status", "preview", "photos", "tasks", "logs"}
+
 func (s *server) serveFront(w http.ResponseWriter, r *http.Request) {
-	data := struct {
-		Uptime time.Duration
-		Logs   string
-		Photos []string
-	}{
-		Uptime: time.Since(s.startTime).Truncate(time.Minute),
+	tab := r.URL.Query().Get("tab")
+	if tab == "" {
+		tab = frontTabs[0]
 	}
+	if !hasLabel(frontTabs, tab) {
+		http.NotFound(w, r)
+		return
+	}
+	tr := newWebTranslator(webLanguage(r.Header.Get("Accept-Language"), s.cfg.Locale))
+	type task struct {
+		Priority                       int // as displayed
+		Title, Time, Assignee, Project string
+		Overdue                        bool
+	}
+	data := struct {
+		Tab string
 
-	s.mu.Lock()
-	data.Logs = s.logBuf.String()
-	s.mu.Unlock()
+		Uptime         time.Duration
+		LastWhiteFlush string
+		MQTT           *MQTTStatus
+		Notes          string
+		MaxNotesLen    int
+		Alertmanagers  []alertmanagerStatus
+		Alerts         []Alert
 
-	if s.cfg.PhotosDir != "" {
-		var err error
-		data.Photos, err = photoOptions(s.cfg.PhotosDir)
-		if err != nil {
-			log.Printf("Looking for photo options: %v", err)
-			// Continue anyway.
+		HasFrame, HasRed bool
+
+		Photos      []string
+		CanSchedule bool
+		Scheduled   []scheduledPhoto
+
+		Tasks []task
+
+		Logs string
+	}{
+		Tab: tab,
+	}
+
+	// Only what the tab shows is gathered.
+	switch tab {
+	case "status":
+		data.Uptime = time.Since(s.startTime).Truncate(time.Minute)
+		if s.lastWhiteFlush != nil {
+			if t := s.lastWhiteFlush(); t.IsZero() {
+				data.LastWhiteFlush = tr.T("not since startup")
+			} else {
+				data.LastWhiteFlush = tr.T("%v ago", time.Since(t).Truncate(time.Minute))
+			}
+		}
+		if s.mqtt != nil {
+			ms := s.mqtt.Status()
+			data.MQTT = &ms
+		}
+		s.state.View(func(st *State) { data.Notes = st.Notes })
+		data.MaxNotesLen = maxNotesLen
+		if s.ref != nil {
+			data.Alertmanagers = s.ref.AlertmanagerStatus()
+			data.Alerts = s.ref.Latest().alerts
+		}
+	case "preview":
+		if s.framePlane != nil {
+			data.HasFrame = s.framePlane("bw") != nil
+			data.HasRed = s.framePlane("red") != nil
+		}
+	case "photos":
+		if s.cfg.PhotosDir != "" {
+			var err error
+			data.Photos, err = photoOptions(s.cfg.PhotosDir)
+			if err != nil {
+				log.Printf("Looking for photo options: %v", err)
+				// Continue anyway.
+			}
+		}
+		if s.cfg.ScheduledPhotosDir != "" {
+			data.CanSchedule = true
+			var err error
+			data.Scheduled, err = scheduledPhotos(s.cfg.ScheduledPhotosDir)
+			if err != nil {
+				log.Printf("Looking for scheduled photos: %v", err)
+				// Continue anyway.
+			}
 		}
+	case "tasks":
+		if s.ref != nil {
+			latest := s.ref.Latest()
+			for _, rt := range latest.tasks {
+				t := task{
+					Priority: 4 - rt.Priority,
+					Title:    rt.Title,
+					Assignee: rt.Assignee,
+					Project:  rt.Project,
+					Overdue:  rt.Overdue,
+				}
+				if !rt.Time.IsZero() {
+					t.Time = rt.Time.Format("15:04")
+				}
+				data.Tasks = append(data.Tasks, t)
+			}
+		}
+	case "logs":
+		s.mu.Lock()
+		data.Logs = s.logBuf.String()
+		s.mu.Unlock()
 	}
 
+	tmpl, err := frontHTMLTmpl.Clone()
+	if err != nil {
+		http.Error(w, "Internal error cloning template: "+err.Error(), 500)
+		return
+	}
 	var buf bytes.Buffer
-	if err := frontHTMLTmpl.Execute(&buf, data); err != nil {
+	if err := tmpl.Funcs(tr.funcs()).Execute(&buf, data); err != nil {
 		log.Printf("Executing template: %v", err)
 		http.Error(w, "Internal error executing template: "+err.Error(), 500)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	io.Copy(w, &buf)
+	w.Header().Add("Vary", "Accept-Language")
+	writeBody(w, r, buf.Bytes())
 }
 
 //go:embed front.html.tmpl
 var frontHTML string
 
-var frontHTMLTmpl = template.Must(template.New("front").Parse(frontHTML))
+// frontHTMLTmpl is cloned to set the language for each request.
+var frontHTMLTmpl = template.Must(template.New("front").Funcs(webTranslator{}.funcs()).Parse(frontHTML))
 
 func (s *server) serveSetNextPhoto(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -344,34 +1056,593 @@ func (s *server) serveSetNextPhoto(w http.ResponseWriter, r *http.Request) {
 	s.nextPhoto = sel
 	s.mu.Unlock()
 	log.Printf("Selected %q as the next photo to use", sel)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	s.wake.Wake("next photo selected", true)
+	http.Redirect(w, r, "/?tab=photos", http.StatusSeeOther)
 }
 
-func loop(ctx context.Context, cfg Config, rend renderer, ref *refresher, p paper, mqtt *MQTT) error {
+func (s *server) servePhoto(w http.ResponseWriter, r *http.Request) {
+	filename, ok := s.findPhoto(strings.TrimPrefix(r.URL.Path, "/photo/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// Browsers mostly can't show HEIC, so serve the JPEG it's converted to for the panel.
+	if isHEIC(filename) {
+		jpg, err := convertHEIC(filename)
+		if err != nil {
+			http.Error(w, "Internal error converting photo: "+err.Error(), 500)
+			return
+		}
+		filename = jpg
+	}
+	// A photo may be replaced under the same name, so clients must revalidate;
+	// http.ServeFile handles Last-Modified and conditional requests, so that's cheap.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, filename)
+}
+
+//go:embed photos.html.tmpl
+var photosHTML string
+
+var photosHTMLTmpl = template.Must(template.New("photos").Parse(photosHTML))
+
+func (s *server) servePhotos(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		s.servePhotoAction(w, r)
+		return
+	}
+
+	type photo struct {
+		Name   string
+		Hidden bool
+		Stat   photoStat
+	}
+	var data struct {
+		Photos   []photo
+		Coverage photoCoverage
+	}
+	if s.cfg.PhotosDir != "" {
+		opts, err := photoOptions(s.cfg.PhotosDir)
+		if err != nil {
+			log.Printf("Looking for photo options: %v", err)
+			// Continue anyway.
+		}
+		hidden := s.hiddenPhotos()
+		var stats map[string]photoStat
+		s.state.View(func(st *State) {
+			stats = make(map[string]photoStat, len(st.PhotoStats))
+			for name, ps := range st.PhotoStats {
+				stats[name] = ps
+			}
+		})
+		var names []string
+		for _, opt := range opts {
+			name := filepath.Base(opt)
+			names = append(names, name)
+			data.Photos = append(data.Photos, photo{Name: name, Hidden: hidden[name], Stat: stats[name]})
+		}
+		data.Coverage = newPhotoCoverage(names, stats, time.Now())
+	}
+
+	var buf bytes.Buffer
+	if err := photosHTMLTmpl.Execute(&buf, data); err != nil {
+		log.Printf("Executing template: %v", err)
+		http.Error(w, "Internal error executing template: "+err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writeBody(w, r, buf.Bytes())
+}
+
+func (s *server) servePhotoAction(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("photo")
+	filename, ok := s.findPhoto(name)
+	if !ok {
+		http.Error(w, "Unknown photo", http.StatusNotFound)
+		return
+	}
+
+	// In theory we should do an XSRF check here, but the threat model isn't worth the effort.
+
+	var err error
+	switch action := r.PostFormValue("action"); action {
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	case "hide", "unhide":
+		err = s.state.Update(func(st *State) {
+			st.HiddenPhotos = removeString(st.HiddenPhotos, name)
+			if action == "hide" {
+				st.HiddenPhotos = append(st.HiddenPhotos, name)
+			}
+		})
+		log.Printf("Photo %q: %s", name, action)
+	case "delete":
+		err = os.Remove(filename)
+		if err == nil {
+			log.Printf("Deleted photo %s", filename)
+			// Forget about it.
+			err = s.state.Update(func(st *State) {
+				st.HiddenPhotos = removeString(st.HiddenPhotos, name)
+				delete(st.PhotoStats, name)
+			})
+		}
+	}
+	if err != nil {
+		log.Printf("Photo action on %q: %v", name, err)
+		http.Error(w, "Internal error: "+err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/photos", http.StatusSeeOther)
+}
+
+// removeString returns list without any instances of x.
+func removeString(list []string, x string) []string {
+	var out []string
+	for _, s := range list {
+		if s != x {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (s *server) serveSchedulePhoto(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.ScheduledPhotosDir == "" {
+		http.Error(w, "No scheduled_photos_dir configured", http.StatusNotFound)
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Bad form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := time.ParseInLocation("2006-01-02", r.FormValue("from"), time.Local)
+	if err != nil {
+		http.Error(w, "Bad start date: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", r.FormValue("to"), time.Local)
+	if err != nil {
+		http.Error(w, "Bad end date: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, fh, err := r.FormFile("photo")
+	if err != nil {
+		http.Error(w, "Bad photo: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+
+	// In theory we should do an XSRF check here, but the threat model isn't worth the effort.
+
+	filename, err := saveScheduledPhoto(s.cfg.ScheduledPhotosDir, from, to, fh.Filename, f, s.cfg.Panel.size())
+	if err != nil {
+		log.Printf("Saving scheduled photo: %v", err)
+		http.Error(w, "Saving photo: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Scheduled %s for %s to %s", filename, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if (scheduledPhoto{From: from, To: to}).Active(time.Now()) {
+		s.wake.Wake("photo scheduled for today", true)
+	}
+	http.Redirect(w, r, "/?tab=photos", http.StatusSeeOther)
+}
+
+// maxShowImage is the longest that an uploaded image may be shown for.
+const maxShowImage = 24 * time.Hour
+
+func (s *server) serveShowImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Bad form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// In theory we should do an XSRF check here, but the threat model isn't worth the effort.
+
+	if r.FormValue("clear") != "" {
+		s.ref.ClearImage()
+		log.Printf("Cleared uploaded image")
+		s.wake.Wake("uploaded image cleared", false)
+		http.Redirect(w, r, "/?tab=preview", http.StatusSeeOther)
+		return
+	}
+
+	mins, err := strconv.Atoi(r.FormValue("minutes"))
+	if err != nil || mins <= 0 || time.Duration(mins)*time.Minute > maxShowImage {
+		http.Error(w, "Bad minutes value", http.StatusBadRequest)
+		return
+	}
+	f, fh, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "Bad image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		http.Error(w, "Decoding image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	until := time.Now().Add(time.Duration(mins) * time.Minute)
+	s.ref.ShowImage(ditherImage(src, s.cfg.Panel.size()), until)
+	log.Printf("Showing uploaded image %s until %s", fh.Filename, until.Format(time.Kitchen))
+	s.wake.Wake("image uploaded", false)
+	http.Redirect(w, r, "/?tab=preview", http.StatusSeeOther)
+}
+
+// serveWake serves /refresh, which refreshes and renders now, and /redraw (if repaint is set),
+// which draws the last data again without refreshing it, updating the whole panel.
+func (s *server) serveWake(w http.ResponseWriter, r *http.Request, repaint bool) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if repaint {
+		s.wake.Repaint("redraw requested over HTTP")
+	} else {
+		s.wake.Wake("refresh requested over HTTP", true)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveMetrics serves gauges in the Prometheus text exposition format.
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	data := s.ref.Latest()
+
+	var buf bytes.Buffer
+	for _, def := range hygieneMetricDefs {
+		name := "kitchenthing_todoist_" + def.name
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, def.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&buf, "%s %d\n", name, def.get(data.hygiene))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	io.Copy(w, &buf)
+}
+
+func (s *server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Uptime string      `json:"uptime"`
+		Panel  panelWear   `json:"panel"`
+		MQTT   *MQTTStatus `json:"mqtt,omitempty"`
+	}{
+		Uptime: time.Since(s.startTime).Truncate(time.Second).String(),
+		Panel:  currentWear(s.state, s.cfg.RefreshBudget, time.Now()),
+	}
+	if s.mqtt != nil {
+		ms := s.mqtt.Status()
+		status.MQTT = &ms
+	}
+
+	raw, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal error encoding status: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
+
+// serveLogs serves the recent HTTP requests, oldest first.
+func (s *server) serveLogs(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Access []accessEntry `json:"access"`
+	}{
+		Access: s.access.Entries(),
+	}
+	if resp.Access == nil {
+		resp.Access = []accessEntry{}
+	}
+	raw, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal error encoding logs: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, r, raw)
+}
+
+func (s *server) serveGlyphs(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Missing []missingGlyph `json:"missing"`
+	}{
+		Missing: s.glyphs.Glyphs(),
+	}
+	if resp.Missing == nil {
+		resp.Missing = []missingGlyph{}
+	}
+	raw, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal error encoding glyphs: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, r, raw)
+}
+
+// apiTask is the JSON form of a renderableTask.
+type apiTask struct {
+	Priority      int        `json:"priority"` // 4 is highest, as in the Todoist API
+	Time          *time.Time `json:"time,omitempty"`
+	Title         string     `json:"title"`
+	HasDesc       bool       `json:"has_description"`
+	Overdue       bool       `json:"overdue"`
+	Assignee      string     `json:"assignee,omitempty"`
+	Project       string     `json:"project"`
+	Done          int        `json:"subtasks_done,omitempty"`
+	Total         int        `json:"subtasks_total,omitempty"`
+	InProgress    bool       `json:"in_progress"`
+	StaleProgress bool       `json:"stale_progress,omitempty"`
+	PowerHungry   bool       `json:"power_hungry"`
+	Emphasis      bool       `json:"emphasis,omitempty"`
+	Demoted       bool       `json:"demoted"`
+	Hints         []string   `json:"hints,omitempty"`
+
+	Subtasks     []apiTask `json:"subtasks,omitempty"`
+	MoreSubtasks int       `json:"more_subtasks,omitempty"`
+}
+
+func newAPITask(task renderableTask) apiTask {
+	at := apiTask{
+		Priority:      task.Priority,
+		Title:         task.Title,
+		HasDesc:       task.HasDesc,
+		Overdue:       task.Overdue,
+		Assignee:      task.Assignee,
+		Project:       task.Project,
+		Done:          task.Done,
+		Total:         task.Total,
+		InProgress:    task.InProgress,
+		StaleProgress: task.StaleProgress,
+		PowerHungry:   task.PowerHungry,
+		Emphasis:      task.Emphasis,
+		Demoted:       task.Demoted,
+		Hints:         task.Hints,
+
+		MoreSubtasks: task.MoreSubtasks,
+	}
+	if !task.Time.IsZero() {
+		at.Time = &task.Time
+	}
+	for _, st := range task.Subtasks {
+		at.Subtasks = append(at.Subtasks, newAPITask(st))
+	}
+	return at
+}
+
+// serveTasks serves the tasks currently being displayed, in display order.
+// They may be filtered with the assignee, project and overdue query parameters.
+func (s *server) serveTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var overdue *bool
+	if v := q.Get("overdue"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Bad overdue value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		overdue = &b
+	}
+	assignee, project := q.Get("assignee"), q.Get("project")
+
+	data := s.ref.Latest()
+	resp := struct {
+		Today string    `json:"today"`
+		Tasks []apiTask `json:"tasks"`
+	}{
+		Today: data.today.Format("2006-01-02"),
+		Tasks: []apiTask{}, // not null
+	}
+	for _, task := range data.tasks {
+		if assignee != "" && !strings.EqualFold(task.Assignee, assignee) {
+			continue
+		}
+		if project != "" && !strings.EqualFold(task.Project, project) {
+			continue
+		}
+		if overdue != nil && task.Overdue != *overdue {
+			continue
+		}
+		resp.Tasks = append(resp.Tasks, newAPITask(task))
+	}
+
+	raw, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal error encoding tasks: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
+
+// serveFramePlane serves one raw plane of the frame most recently sent to the panel,
+// for telling driver problems apart from rendering problems.
+func (s *server) serveFramePlane(w http.ResponseWriter, r *http.Request, plane string) {
+	var img *image.Paletted
+	if s.framePlane != nil {
+		img = s.framePlane(plane)
+	}
+	if img == nil {
+		http.Error(w, "Nothing has been sent to the panel yet", http.StatusNotFound)
+		return
+	}
+	// The frame changes at any refresh, so clients must revalidate,
+	// but they can keep using what they have if the frame is the same.
+	w.Header().Set("Cache-Control", "no-cache")
+	if notModified(w, r, contentETag(img.Pix)) {
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, "Internal error encoding PNG: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// display is what the main loop needs from the panel.
+type display interface {
+	draw.Image
+
+	Init() error
+	DisplayRefresh() error
+	Sleep()
+}
+
+func loop(ctx context.Context, cfg Config, rend renderer, ref *refresher, p display, state *stateStore, mqtt *MQTT, hk *homeKit, wake *waker, power *powerLoss, hits *hitMap, photoRendered func(refreshed bool)) error {
 	var prev displayData
+	var prevHygiene *hygieneMetrics
+	var prevFairness *fairnessReport
+	refresh := true  // whether to fetch new data, rather than draw the last again
+	redraw := false  // whether to render even if the data is unchanged
+	repaint := false // whether to refresh the whole panel even if the frame is unchanged
+	pipe := newPanelPipeline(p)
+	if mqtt != nil {
+		// Only once the panel has refreshed does /api/frame show the new frame.
+		pipe.refreshed = func(checksum string) {
+			if err := mqtt.PublishFrame(checksum); err != nil {
+				log.Printf("MQTT publish: %v", err)
+			}
+		}
+	}
+	if cfg.BusyGPIO > 0 {
+		pipe.led = gpioBusyLED(cfg.BusyGPIO)
+	}
+	var webhook *webhookPoster
+	if cfg.Webhook != "" {
+		webhook = startWebhookPoster(ctx, cfg.Webhook)
+	}
+	defer pipe.Wait()
 	for {
-		data := ref.Refresh(ctx)
+		select {
+		case <-power.C():
+			return freezeForPowerLoss(ctx, rend, pipe, prev, power.At())
+		default:
+		}
 
-		if !data.Equal(prev) {
-			log.Printf("New data to be displayed; refreshing now")
+		data := prev
+		if refresh {
+			data = ref.Refresh(ctx)
+			if mqtt != nil {
+				data.health = append(data.health, integrationHealth{"M", mqtt.Status().Connected})
+			}
+		}
+		refresh = true
+
+		// Hygiene metrics aren't displayed, so they are published independently.
+		if mqtt != nil && (prevHygiene == nil || *prevHygiene != data.hygiene) {
+			if err := mqtt.PublishHygiene(data.hygiene); err != nil {
+				log.Printf("MQTT publish: %v", err)
+			} else {
+				h := data.hygiene
+				prevHygiene = &h
+			}
+		}
+		// Likewise for the fairness report.
+		if mqtt != nil && data.fairness != nil && (prevFairness == nil || !prevFairness.Equal(*data.fairness)) {
+			if err := mqtt.PublishFairness(*data.fairness); err != nil {
+				log.Printf("MQTT publish: %v", err)
+			} else {
+				prevFairness = data.fairness
+			}
+		}
+
+		if changed := !data.Equal(prev); changed || redraw {
+			if changed {
+				log.Printf("New data to be displayed; refreshing now")
+			} else {
+				log.Printf("Redrawing on request")
+			}
+			redraw = false
 
 			if mqtt != nil {
 				if err := mqtt.PublishUpdate(data.tasks); err != nil {
 					log.Printf("MQTT publish: %v", err)
 				}
+				if err := mqtt.PublishOverdueP1(data.tasks); err != nil {
+					log.Printf("MQTT publish: %v", err)
+				}
+				if err := mqtt.PublishAccessibilityMode(data.accessible); err != nil {
+					log.Printf("MQTT publish: %v", err)
+				}
+				if err := mqtt.PublishNotes(data.notes); err != nil {
+					log.Printf("MQTT publish: %v", err)
+				}
+				if len(cfg.alertmanagers()) > 0 {
+					if err := mqtt.PublishAlerts(data.alerts); err != nil {
+						log.Printf("MQTT publish: %v", err)
+					}
+				}
 			}
+			hk.Update(newHomeKitStatus(data))
+			webhook.Post(data)
 
-			p.Init()
-			rend.Render(p, data)
-			p.DisplayRefresh()
-			p.Sleep()
+			// Render offscreen, since the panel may still be refreshing with the previous frame.
+			hidden, zones := rend.RenderHits(pipe.Back(), data)
+			if hidden.Count > 0 {
+				log.Printf("Not enough room to display %s", hidden)
+			}
+			if mqtt != nil {
+				if err := mqtt.PublishHidden(hidden); err != nil {
+					log.Printf("MQTT publish: %v", err)
+				}
+			}
+			if repaint {
+				pipe.Repaint()
+				repaint = false
+			}
+			refreshed := pipe.Show()
+			// Even if the panel wasn't refreshed, what's on it looks the same.
+			hits.Set(p.Bounds().Size(), zones)
+			if photoRendered != nil {
+				photoRendered(refreshed)
+			}
 			prev = data
+
+			if refreshed {
+				wear := recordRefresh(state, cfg.RefreshBudget, time.Now())
+				if mqtt != nil {
+					if err := mqtt.PublishRefreshes(wear.Refreshes); err != nil {
+						log.Printf("MQTT publish: %v", err)
+					}
+				}
+			}
 		}
 
+		// Refresh at the period for this time of day, or early if a countdown needs updating.
+		wait := refreshWait(cfg.RefreshPeriod, cfg.RefreshPeriods, time.Now())
+		if d := countdownTick(data.tasks, time.Now()); d > 0 && d < wait {
+			wait = d
+		}
+
+		timer := time.NewTimer(wait)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
-		case <-time.After(cfg.RefreshPeriod):
+		case <-timer.C:
+		case <-power.C():
+			timer.Stop()
+			return freezeForPowerLoss(ctx, rend, pipe, prev, power.At())
+		case <-wake.C():
+			timer.Stop()
+			req := wake.Take()
+			if len(req.reasons) > 0 {
+				log.Printf("Woken early: %s", req)
+			}
+			refresh, redraw, repaint = req.refresh, req.redraw, req.repaint
 		}
 	}
 }
@@ -380,14 +1651,80 @@ type renderer struct {
 	font *opentype.Font
 
 	tiny, small, normal, large, xlarge font.Face
+	header                             []font.Face // for the date, largest first; header[0] is xlarge
+
+	// bold maps each face to its bold equivalent.
+	// If it is nil, bold text is emboldened by overdrawing.
+	bold     map[font.Face]font.Face
+	boldFont *opentype.Font
 
 	photoPicker func() (string, error)
 
 	messages []message
+
+	projectNames    map[string]string
+	maxProjectWidth int
+
+	footer FooterConfig
+
+	layout     string // "list" or "projects"
+	identicons bool   // whether to draw assignee identicons in a gutter
+
+	labelColours bool // whether to emphasise tasks with red-ish labels
+
+	regions []RegionConfig
+
+	photos         bool // whether any photos are configured
+	photoMinHeight int  // pixels
+
+	minPriority int    // as in the Todoist API; 0 shows all tasks
+	maxTasks    int    // 0 for no limit
+	overflow    string // what to do when tasks don't fit
+	columns     string // how many columns of tasks
+
+	dateFormat string      // for the date header, as for time.Format
+	phrases    timePhrases // for times of tasks and events
+
+	missing *missingGlyphs
+	subst   *strings.Replacer // applied to all text before it is drawn or measured
 }
 
 func newRenderer(cfg Config, photoPicker func() (string, error)) (renderer, error) {
-	const dpi = 125 // per paper hardware
+	dpi := cfg.Panel.dpi()
+
+	if err := cfg.Footer.validate(); err != nil {
+		return renderer{}, err
+	}
+	switch cfg.Layout {
+	case "", "list", "projects":
+	default:
+		return renderer{}, fmt.Errorf("unknown layout %q", cfg.Layout)
+	}
+	phrases, err := lookupLocale(cfg.Locale)
+	if err != nil {
+		return renderer{}, err
+	}
+	if err := validateRegions(cfg.Regions); err != nil {
+		return renderer{}, err
+	}
+	switch cfg.Overflow {
+	case "", overflowHideLowPriority, overflowHideLatest, overflowShrink:
+	default:
+		return renderer{}, fmt.Errorf("unknown overflow policy %q (want %s, %s or %s)", cfg.Overflow, overflowHideLowPriority, overflowHideLatest, overflowShrink)
+	}
+	switch cfg.Columns {
+	case "", columnsOne, columnsTwo, columnsAuto:
+	default:
+		return renderer{}, fmt.Errorf("unknown columns %q (want %s, %s or %s)", cfg.Columns, columnsOne, columnsTwo, columnsAuto)
+	}
+	var minPriority int
+	if cfg.MinPriority != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(cfg.MinPriority), "P"))
+		if err != nil || n < 0 || n > 3 {
+			return renderer{}, fmt.Errorf("bad min_priority %q (want P0 to P3)", cfg.MinPriority)
+		}
+		minPriority = 4 - n
+	}
 
 	fdata, err := ioutil.ReadFile(cfg.Font)
 	if err != nil {
@@ -426,13 +1763,13 @@ func newRenderer(cfg Config, photoPicker func() (string, error)) (renderer, erro
 		return renderer{}, fmt.Errorf("making tiny font face: %w", err)
 	}
 	xlarge, err := opentype.NewFace(font, &opentype.FaceOptions{
-		Size: 36, // points
+		Size: headerSizes[0], // points
 		DPI:  dpi,
 	})
 	if err != nil {
 		return renderer{}, fmt.Errorf("making tiny font face: %w", err)
 	}
-	return renderer{
+	r := renderer{
 		font: font,
 
 		tiny:   tiny,
@@ -441,26 +1778,179 @@ func newRenderer(cfg Config, photoPicker func() (string, error)) (renderer, erro
 		large:  large,
 		xlarge: xlarge,
 
+		dateFormat: cfg.DateFormat,
+		phrases:    phrases,
+
 		photoPicker: photoPicker,
 
-		messages: cfg.Messages,
-	}, nil
-}
+		messages: cfg.Messages,
+
+		projectNames:    cfg.ProjectNames,
+		maxProjectWidth: cfg.MaxProjectWidth,
+
+		footer: cfg.Footer,
+
+		layout:     cfg.Layout,
+		identicons: cfg.AssigneeIdenticons,
+		regions:    cfg.Regions,
+
+		labelColours: cfg.LabelColours,
+
+		photos:         cfg.PhotosDir != "" || cfg.ScheduledPhotosDir != "",
+		photoMinHeight: cfg.PhotoMinHeight,
+
+		minPriority: minPriority,
+		maxTasks:    cfg.MaxTasks,
+		overflow:    cfg.Overflow,
+		columns:     cfg.Columns,
+	}
+	if r.dateFormat == "" {
+		r.dateFormat = defaultDateFormat
+	}
+	if len(r.regions) == 0 {
+		r.regions = defaultRegions
+	}
+	if r.photoMinHeight == 0 {
+		r.photoMinHeight = defaultPhotoMinHeight
+	}
+	r.header = append(r.header, xlarge)
+	for _, size := range headerSizes[1:] {
+		face, err := opentype.NewFace(font, &opentype.FaceOptions{
+			Size: size, // points
+			DPI:  dpi,
+		})
+		if err != nil {
+			return renderer{}, fmt.Errorf("making header font face: %w", err)
+		}
+		r.header = append(r.header, face)
+	}
+	if cfg.BoldFont != "" {
+		if err := r.loadBoldFont(cfg.BoldFont, dpi); err != nil {
+			return renderer{}, err
+		}
+	}
+	r.subst, err = newGlyphSubstituter(cfg.GlyphSubstitutions)
+	if err != nil {
+		return renderer{}, fmt.Errorf("bad glyph_substitutions: %w", err)
+	}
+	missing := '?'
+	if cfg.MissingGlyph != "" {
+		if utf8.RuneCountInString(cfg.MissingGlyph) != 1 {
+			return renderer{}, fmt.Errorf("missing_glyph %q must be a single character", cfg.MissingGlyph)
+		}
+		missing, _ = utf8.DecodeRuneInString(cfg.MissingGlyph)
+	}
+	r.missing = newMissingGlyphs(missing)
+	if err := r.addFallbackFonts(cfg.FallbackFonts, dpi); err != nil {
+		return renderer{}, err
+	}
+	if r.normal.(*fallbackFace).pick(missing) == nil {
+		return renderer{}, fmt.Errorf("no font has a glyph for missing_glyph %q", missing)
+	}
+	return r, nil
+}
+
+// loadBoldFont sets up bold equivalents of each face from the given font file.
+func (r *renderer) loadBoldFont(filename string, dpi float64) error {
+	fdata, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("loading bold font file: %w", err)
+	}
+	bfont, err := opentype.Parse(fdata)
+	if err != nil {
+		return fmt.Errorf("parsing bold font data: %w", err)
+	}
+	r.boldFont = bfont
+	r.bold = make(map[font.Face]font.Face)
+	for face, size := range map[font.Face]float64{r.tiny: 10, r.small: 12, r.normal: 16, r.large: 20, r.xlarge: 36} {
+		r.bold[face], err = opentype.NewFace(bfont, &opentype.FaceOptions{
+			Size: size, // points
+			DPI:  dpi,
+		})
+		if err != nil {
+			return fmt.Errorf("making bold font face: %w", err)
+		}
+	}
+	return nil
+}
+
+type refresher struct {
+	cfg  Config
+	ts   todoistBackend
+	hass *HASS // may be nil
+
+	state         *stateStore
+	taskEvents    []taskEventer
+	chime         *taskEventer // may be nil
+	weatherHints  []weatherHint
+	titleRewrites []titleRewrite
+
+	reorderers map[string]*Reorderer
+
+	accessible atomic.Bool // accessibility mode
+
+	nudging bool // whether the last refresh nudged about cheap energy; only used by refresh
+
+	// The most recently fetched forecast, and when; only used by refresh.
+	forecast   *forecast
+	forecastAt time.Time
+
+	// When any integration last worked, and when they stopped if none do now; only used by refresh.
+	lastOnline, offlineSince time.Time
+
+	hassItems []hassItemValue // the last values of cfg.HASS.Items; only used by refresh
+	calendars []calendarFeed  // the last events of cfg.Calendars; only used by refresh
 
-type refresher struct {
-	cfg Config
-	ts  *todoist.Syncer
+	latest displayStore // most recent result of Refresh
 
-	reorderers map[string]*Reorderer
+	mu       sync.Mutex
+	amStatus []alertmanagerStatus // as of the most recent refresh
+	override imageOverride        // set by ShowImage
+	actions  []taskAction         // queued by QueueTaskAction
+	page     int                  // of tasks, set by TurnPage
+	pageAt   time.Time            // when page was last turned
 }
 
-func newRefresher(cfg Config) (*refresher, error) {
+func newRefresher(cfg Config, state *stateStore) (*refresher, error) {
+	ts, err := newTodoistBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TodoistCache != "" {
+		ts = newTodoistCache(ts, cfg.TodoistCache)
+	}
+	switch cfg.Order {
+	case "", "priority", "todoist":
+	default:
+		return nil, fmt.Errorf("unknown order %q (want priority or todoist)", cfg.Order)
+	}
 	r := &refresher{
-		cfg: cfg,
-		ts:  todoist.NewSyncer(cfg.TodoistAPIToken),
+		cfg:  cfg,
+		ts:   ts,
+		hass: NewHASS(cfg.HASS),
+
+		state: state,
 
 		reorderers: make(map[string]*Reorderer),
 	}
+	if r.hass != nil {
+		r.taskEvents, err = parseTaskEvents(cfg.HASS)
+		if err != nil {
+			return nil, fmt.Errorf("bad Home Assistant events: %w", err)
+		}
+		r.chime, err = parseChime(cfg.HASS.Chime)
+		if err != nil {
+			return nil, fmt.Errorf("bad Home Assistant chime: %w", err)
+		}
+		r.weatherHints, err = parseWeatherHints(cfg.Weather)
+		if err != nil {
+			return nil, fmt.Errorf("bad weather hints: %w", err)
+		}
+	}
+	r.titleRewrites, err = parseTitleRewrites(cfg.TitleRewrites)
+	if err != nil {
+		return nil, fmt.Errorf("bad title rewrites: %w", err)
+	}
 	for _, o := range cfg.Orderings {
 		ro, err := NewReorderer(o.Groups)
 		if err != nil {
@@ -469,24 +1959,83 @@ func newRefresher(cfg Config) (*refresher, error) {
 		r.reorderers[o.Project] = ro
 		log.Printf("Prepared reorderer for project %q with %d groups", o.Project, len(o.Groups))
 	}
+	r.accessible.Store(cfg.AccessibilityMode)
 
 	return r, nil
 }
 
+// Latest returns a copy of the most recently refreshed data.
+func (r *refresher) Latest() displayData { return r.latest.Get() }
+
+// SetAccessibilityMode changes whether subsequent refreshes ask for accessibility mode rendering.
+func (r *refresher) SetAccessibilityMode(on bool) { r.accessible.Store(on) }
+
 type displayData struct {
 	today time.Time // only day resolution
+	now   time.Time // when this was refreshed; only considered by Equal for countdowns
 
 	tasks []renderableTask
 
 	// TODO: report errors?
 
 	alerts []Alert
+
+	events []calendarEvent // today's, in order
+
+	forecast *forecast // nil if not configured or not known
+	weather  weather   // from the weather sensors; only considered by Equal through message
+
+	// message is the index of the configured message that matches, or -1 if none does.
+	// It is compared by Equal instead of the weather, so the panel isn't refreshed
+	// for every small change in the weather sensors.
+	message int
+
+	completions []int // tasks completed on each of the last week's days, oldest first; nil if not shown
+
+	hassFooter  []string // formatted Home Assistant entity states
+	hassHeader  []string // likewise, for after the subtitle
+	hassSidebar []string // likewise, for down the right of the task list
+
+	notes string // household notes, one per line
+
+	nudge string // banner text encouraging power-hungry tasks; may be empty
+
+	override *image.Paletted // shown instead of everything else, if set
+
+	health []integrationHealth // how each integration fared, in display order
+
+	offline      bool      // whether the tasks are cached from a previous run
+	cachedAt     time.Time // when the cached tasks were saved, if offline
+	offlineSince time.Time // when integrations last worked, if none do now
+
+	accessible bool // whether to render in accessibility mode
+
+	page int // which page of tasks to show, from 0
+
+	relativeTimes bool // whether times are shown relative to now
+
+	// Not displayed, so not considered by Equal,
+	// except that a lopsided fairness report shows an indicator.
+	hygiene  hygieneMetrics
+	fairness *fairnessReport // nil if not enabled
 }
 
+// lopsided reports whether to show the fairness indicator.
+func (dd displayData) lopsided() bool { return dd.fairness != nil && dd.fairness.Lopsided }
+
 func (dd displayData) Equal(o displayData) bool {
 	if !dd.today.Equal(o.today) {
 		return false
 	}
+	if dd.accessible != o.accessible {
+		return false
+	}
+	if dd.page != o.page {
+		return false
+	}
+	if dd.lopsided() != o.lopsided() {
+		return false
+	}
 	if len(dd.tasks) != len(o.tasks) {
 		return false
 	}
@@ -494,6 +2043,12 @@ func (dd displayData) Equal(o displayData) bool {
 		if dd.tasks[i].Compare(o.tasks[i]) != 0 {
 			return false
 		}
+		if countdown(dd.tasks[i].Time, dd.now) != countdown(o.tasks[i].Time, o.now) {
+			return false
+		}
+		if dd.relativeTimes && relativeChanged(dd.tasks[i].Time, dd.now, o.tasks[i].Time, o.now) {
+			return false
+		}
 	}
 	if len(dd.alerts) != len(o.alerts) {
 		return false
@@ -503,13 +2058,82 @@ func (dd displayData) Equal(o displayData) bool {
 			return false
 		}
 	}
+	if len(dd.events) != len(o.events) {
+		return false
+	}
+	for i := range dd.events {
+		if !dd.events[i].Same(o.events[i]) {
+			return false
+		}
+		if dd.relativeTimes && relativeChanged(dd.events[i].Time, dd.now, o.events[i].Time, o.now) {
+			return false
+		}
+	}
+	if len(dd.completions) != len(o.completions) {
+		return false
+	}
+	for i := range dd.completions {
+		if dd.completions[i] != o.completions[i] {
+			return false
+		}
+	}
+	if (dd.forecast == nil) != (o.forecast == nil) || (dd.forecast != nil && *dd.forecast != *o.forecast) {
+		return false
+	}
+	if dd.message != o.message {
+		return false
+	}
+	if dd.nudge != o.nudge || dd.notes != o.notes {
+		return false
+	}
+	if dd.override != o.override {
+		return false
+	}
+	if dd.offline != o.offline || !dd.cachedAt.Equal(o.cachedAt) || !dd.offlineSince.Equal(o.offlineSince) {
+		return false
+	}
+	if len(dd.health) != len(o.health) {
+		return false
+	}
+	for i := range dd.health {
+		if dd.health[i] != o.health[i] {
+			return false
+		}
+	}
+	return stringsEqual(dd.hassFooter, o.hassFooter) &&
+		stringsEqual(dd.hassHeader, o.hassHeader) &&
+		stringsEqual(dd.hassSidebar, o.hassSidebar)
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
 	return true
 }
 
 func (r *refresher) Refresh(ctx context.Context) displayData {
-	d, m, y := time.Now().Date()
+	dd := r.refresh(ctx)
+	dd.override = r.activeOverride(time.Now())
+	r.latest.Set(dd)
+	return dd
+}
+
+func (r *refresher) refresh(ctx context.Context) displayData {
+	now := time.Now()
+	d, m, y := now.Date()
 	dd := displayData{
-		today: time.Date(d, m, y, 0, 0, 0, 0, time.Local),
+		today:      time.Date(d, m, y, 0, 0, 0, 0, time.Local),
+		now:        now,
+		accessible: r.accessible.Load(),
+		page:       r.Page(now),
+
+		relativeTimes: usesRelativeTimes(r.cfg.Regions),
 	}
 	if *testTodoist {
 		t0 := time.Time{}
@@ -523,27 +2147,146 @@ func (r *refresher) Refresh(ctx context.Context) displayData {
 		return dd
 	}
 
-	if err := r.ts.Sync(ctx); err != nil {
-		// TODO: add error to screen? or some sort of simple message?
+	r.applyTaskActions(ctx)
+	err := r.ts.Sync(ctx)
+	if err != nil {
 		log.Printf("Syncing from Todoist: %v", err)
 		// Continue on and use any existing data.
 	}
-	dd.tasks = RenderableTasks(r.ts)
-	ApplyMetadata(ctx, r.ts, *actOnMetadata)
+	dd.health = append(dd.health, integrationHealth{"T", err == nil})
+	r.state.View(func(st *State) { dd.notes = st.Notes })
+	if c, ok := r.ts.(*todoistCache); ok {
+		if at, offline := c.Offline(); offline {
+			log.Printf("Showing Todoist data cached at %s", at.Format(time.Stamp))
+			dd.offline, dd.cachedAt = true, at
+		}
+	}
+	dd.tasks = RenderableTasks(r.ts.Data(), r.cfg.NextActionsLabel, r.cfg.Subtasks, r.cfg.Order, r.titleRewrites)
+	dd.hygiene = TodoistHygiene(r.ts.Data(), time.Now())
+	ApplyMetadata(ctx, r.ts, r.cfg.Metadata, *actOnMetadata)
+	if r.cfg.InProgress.StaleAfter > 0 && err == nil {
+		// Only track a successful sync, since stale data could make labels seem to come and go.
+		markStaleProgress(dd.tasks, r.trackInProgress(ctx, r.ts.Data(), now))
+	}
 	r.reorder(ctx)
 
-	if r.cfg.Alertmanager != "" {
-		as, err := FetchAlerts(ctx, r.cfg.Alertmanager)
+	hassOK := true
+	if (len(r.taskEvents) > 0 || r.cfg.Fairness.Enabled || r.cfg.Footer.Completions || r.cfg.CompletedFeed) && err == nil {
+		// Only compare against a successful sync, since stale data could hide transitions.
+		if !r.trackTasks(ctx, r.ts.Data(), now) {
+			hassOK = false
+		}
+	}
+	if r.chime != nil && err == nil {
+		if !r.chimeNewP1(ctx, r.ts.Data(), now) {
+			hassOK = false
+		}
+	}
+	if r.cfg.Footer.Completions {
+		r.state.View(func(st *State) { dd.completions = completionsByDay(st.Completions, now) })
+	}
+	if r.cfg.Fairness.Enabled {
+		var rep fairnessReport
+		r.state.View(func(st *State) { rep = newFairnessReport(r.cfg.Fairness, st.Fairness, now) })
+		dd.fairness = &rep
+	}
+	if r.hass != nil && len(r.cfg.Presence.People) > 0 {
+		away, err := pollPresence(ctx, r.hass, r.cfg.Presence)
+		if err != nil {
+			log.Printf("Polling presence from Home Assistant: %v", err)
+			// Continue on without filtering.
+			hassOK = false
+		} else {
+			dd.tasks = applyPresence(dd.tasks, len(r.cfg.Presence.People), away, r.cfg.Presence.Hide)
+		}
+	}
+
+	if len(r.weatherHints) > 0 || (r.cfg.Weather.sensors() && messagesUseWeather(r.cfg.Messages)) {
+		w, err := fetchWeather(ctx, r.hass, r.cfg.Weather)
 		if err != nil {
-			log.Printf("Fetching alerts from Alertmanager %s: %v", r.cfg.Alertmanager, err)
+			log.Printf("Fetching weather from Home Assistant: %v", err)
+			// Continue on without hints.
+			hassOK = false
 		} else {
-			dd.alerts = as
+			applyWeatherHints(dd.tasks, r.weatherHints, w)
+			dd.weather = w
+		}
+	}
+
+	if r.hass != nil && r.cfg.Energy.Entity != "" {
+		if !r.checkEnergy(ctx, &dd) {
+			hassOK = false
+		}
+	}
+
+	if r.hass != nil {
+		for _, entity := range r.cfg.HASS.Footer {
+			ent, err := r.hass.Entity(ctx, entity)
+			if err != nil {
+				log.Printf("Getting state of %s from Home Assistant: %v", entity, err)
+				hassOK = false
+				continue
+			}
+			dd.hassFooter = append(dd.hassFooter, cleanString(ent.String()))
+		}
+		if !r.fetchHASSItems(ctx, &dd, now) {
+			hassOK = false
 		}
 	}
 
+	if ams := r.cfg.alertmanagers(); len(ams) > 0 {
+		dd.health = append(dd.health, integrationHealth{"A", r.fetchAlerts(ctx, &dd, ams)})
+	}
+	if len(r.cfg.Calendars) > 0 {
+		dd.health = append(dd.health, integrationHealth{"C", r.fetchEvents(ctx, &dd, now)})
+	}
+	if r.cfg.Weather.Forecast.Provider != "" {
+		dd.health = append(dd.health, integrationHealth{"W", r.fetchForecast(ctx, &dd, now)})
+	}
+	if r.hass != nil {
+		dd.health = append(dd.health, integrationHealth{"H", hassOK})
+	}
+	r.trackConnectivity(&dd, now)
+	dd.message = matchingMessage(r.cfg.Messages, dd)
+
 	return dd
 }
 
+// checkEnergy sets a nudge if there are pending power-hungry tasks and energy is cheap,
+// and fires a Home Assistant event when a nudge starts.
+// It reports whether talking to Home Assistant worked.
+func (r *refresher) checkEnergy(ctx context.Context, dd *displayData) (ok bool) {
+	ok = true
+	n := powerHungryPending(dd.tasks)
+	cheap := false
+	if n > 0 {
+		var err error
+		cheap, err = energyIsCheap(ctx, r.hass, r.cfg.Energy)
+		if err != nil {
+			log.Printf("Checking energy price: %v", err)
+			// Keep the previous nudge state, to avoid flapping.
+			cheap = r.nudging
+			ok = false
+		}
+	}
+	if cheap {
+		dd.nudge = nudgeMessage(n)
+	}
+	if cheap && !r.nudging {
+		event := r.cfg.Energy.Event
+		if event == "" {
+			event = defaultEnergyEvent
+		}
+		err := r.hass.FireEvent(ctx, event, map[string]int{"pending": n})
+		if err != nil {
+			log.Printf("Firing %s event: %v", event, err)
+			ok = false
+		}
+	}
+	r.nudging = cheap
+	return ok
+}
+
 func (r *refresher) reorder(ctx context.Context) {
 	type oi struct { // ordered item
 		ID         string
@@ -554,8 +2297,9 @@ func (r *refresher) reorder(ctx context.Context) {
 
 	for project, ro := range r.reorderers {
 		var items []oi
-		for _, item := range r.ts.Items {
-			if r.ts.Projects[item.ProjectID].Name != project {
+		td := r.ts.Data()
+		for _, item := range td.Items {
+			if td.Projects[item.ProjectID].Name != project {
 				continue
 			}
 			if item.ParentID != "" {
@@ -624,115 +2368,559 @@ func (r *refresher) reorder(ctx context.Context) {
 	}
 }
 
-func (r renderer) Render(dst draw.Image, data displayData) {
-	// Date in top-right corner.
+// Render draws the display. It reports the tasks that didn't fit.
+func (r renderer) Render(dst draw.Image, data displayData) (hidden hiddenTasks) {
+	hidden, _ = r.RenderHits(dst, data)
+	return hidden
+}
+
+// RenderHits is like Render, but also returns the frame's hit zones.
+func (r renderer) RenderHits(dst draw.Image, data displayData) (hidden hiddenTasks, hits []hitZone) {
+	if data.override != nil {
+		draw.Draw(dst, dst.Bounds(), data.override, image.Point{}, draw.Src)
+		return hiddenTasks{}, nil
+	}
+
+	// Pick faces and colours. Accessibility mode steps everything up a size,
+	// and reserves red for overdue tasks.
+	f := &frame{
+		dst:  dst,
+		data: data,
+
+		taskFace:    r.normal,
+		projectFace: r.small,
+		alertFace:   r.tiny,
+		accentCol:   colorRed,
+	}
+	if data.accessible {
+		f.taskFace, f.projectFace, f.alertFace = r.large, r.normal, r.small
+		f.accentCol = color.Black
+	}
+
+	r.layoutRegions(f)
+	return f.hidden, f.hits
+}
+
+// frame is what the widgets share while rendering.
+type frame struct {
+	dst  draw.Image
+	data displayData
+
+	taskFace, projectFace, alertFace font.Face
+	accentCol                        color.Color
+
+	timeStyle string // of the region being planned
+	dither    string // of the region being planned
+
+	hidden hiddenTasks // set by the tasks widget
+	hits   []hitZone   // added to by widgets as they draw
+}
+
+// Each widget is planned with the room available to it, returning the height it needs
+// and a function to draw it with its top edge at the given y coordinate.
+// If there's nothing to draw, the function is nil.
+
+// planHeader plans the date in the top right corner, with a subtitle to its left.
+func (r renderer) planHeader(f *frame, room image.Rectangle) (int, func(top int)) {
+	data := f.data
+
 	// Put date number in red for December, before day 25.
 	var domCol color.Color = color.Black
 	_, mon, day := data.today.Date()
 	if mon == time.December && day <= 25 {
-		domCol = colorRed
+		domCol = f.accentCol
+	}
+	// Without a matching message, such as when a weather condition can't be checked
+	// because the sensors failed, there is no subtitle.
+	var subtitle string
+	if i := matchingMessage(r.messages, data); i >= 0 && len(r.messages[i].Options) > 0 {
+		opts := r.messages[i].Options
+		subtitle = r.substitute(opts[rand.Intn(len(opts))])
+	}
+	for _, txt := range data.hassHeader {
+		if subtitle != "" {
+			subtitle += " · "
+		}
+		subtitle += txt
 	}
-	monBL := r.writeText(dst, image.Pt(-2, 2), topRight, color.Black, r.xlarge, data.today.Format(" Jan"))
-	domBL := r.writeText(dst, image.Pt(monBL.X, 2), topRight, domCol, r.xlarge, data.today.Format(" 2"))
-	dateBL := r.writeText(dst, image.Pt(domBL.X, 2), topRight, color.Black, r.xlarge, data.today.Format("Mon"))
 
-	var subtitles []string
-	for _, msg := range r.messages {
-		if msg.Matches(len(data.tasks)) {
-			subtitles = msg.Options
-			break
-		}
+	// Any weather goes between the date and the subtitle.
+	weatherWidth, weatherHeight, drawWeather := r.planWeather(f)
+	if drawWeather != nil {
+		weatherWidth += 10
 	}
-	subtitle := subtitles[rand.Intn(len(subtitles))]
-	next := image.Pt(10, dateBL.Y)
-	r.writeText(dst, next, bottomLeft, color.Black, r.large, subtitle)
-	next = image.Pt(2, dateBL.Y)
 
-	listVPitch := r.normal.Metrics().Height.Ceil()
-	listBase := image.Pt(10, next.Y+2+listVPitch) // baseline of each list entry
-	for i, task := range data.tasks {             // TODO: adjust font size for task count?
-		baselineY := listBase.Y + i*listVPitch
-		origin := image.Pt(listBase.X, baselineY)
+	// Shrink the date if it would collide with the subtitle.
+	avail := f.dst.Bounds().Dx() - 2 - 10 - font.MeasureString(r.large, subtitle).Ceil() - 10 - weatherWidth
+	dateFace := fitFace(r.header, r.substitute(data.today.Format(r.dateFormat)), avail)
+	before, dom, after := splitDayOfMonth(r.dateFormat)
+	parts := []struct {
+		layout string
+		col    color.Color
+	}{
+		{after, color.Black},
+		{dom, domCol},
+		{before, color.Black},
+	}
 
-		var titleCol color.Color = color.Black
-		if task.Overdue {
-			titleCol = colorRed
+	// The subtitle shares the baseline of the last part drawn, which sets the height.
+	height := 0
+	for _, part := range parts {
+		if part.layout != "" {
+			b, _ := font.BoundString(dateFace, data.today.Format(part.layout))
+			height = (fixed.I(2) - b.Min.Y).Round()
+		}
+	}
+	// The weather shares it too, so the date moves down if the weather is taller.
+	drop := max(weatherHeight-height, 0)
+	return height + drop, func(top int) {
+		dateBL := image.Pt(-2, top+2+drop)
+		for _, part := range parts {
+			if part.layout != "" {
+				dateBL = r.writeText(f.dst, image.Pt(dateBL.X, top+2+drop), topRight, part.col, dateFace, data.today.Format(part.layout))
+			}
+		}
+		if drawWeather != nil {
+			drawWeather(image.Pt(dateBL.X-10, dateBL.Y))
+			dateBL.X -= weatherWidth
 		}
 
-		txt := fmt.Sprintf("[P%d] %s", 4-task.Priority, task.Title)
-		// Priority
-		next := r.writeText(dst, origin, bottomLeft, color.Black, r.normal, fmt.Sprintf("[P%d] ", 4-task.Priority))
-		origin = image.Pt(next.X, baselineY)
+		// If even the smallest date doesn't fit, shorten the subtitle instead.
+		next := image.Pt(10, dateBL.Y)
+		r.writeText(f.dst, next, bottomLeft, color.Black, r.large, truncateText(r.large, subtitle, dateBL.X-10-next.X))
+	}
+}
 
-		// Title
-		next = r.writeText(dst, origin, bottomLeft, titleCol, r.normal, task.Title)
-		origin = image.Pt(next.X, baselineY)
+// planBanner plans the nudge banner: full width, in reverse colours.
+func (r renderer) planBanner(f *frame, room image.Rectangle) (int, func(top int)) {
+	if f.data.nudge == "" {
+		return 0, nil
+	}
+	face := r.normal
+	h := face.Metrics().Height.Ceil() + 4
+	return 4 + h, func(top int) {
+		banner := image.Rect(0, top+4, f.dst.Bounds().Max.X, top+4+h)
+		draw.Draw(f.dst, banner, &image.Uniform{f.accentCol}, image.Point{}, draw.Src)
+		baseline := banner.Max.Y - 2 - face.Metrics().Descent.Ceil()
+		r.writeText(f.dst, image.Pt(10, baseline), bottomLeft, color.White, face, f.data.nudge)
+	}
+}
 
-		// Remaining info
-		txt = ""
-		if task.Total > 0 {
-			txt += fmt.Sprintf(" {%d/%d}", task.Done, task.Total)
+// planTasks plans the task list, working out which tasks fit in the room,
+// leaving space to say what's hidden if they don't all.
+func (r renderer) planTasks(f *frame, room image.Rectangle) (int, func(top int)) {
+	data := f.data
+	taskFace, projectFace := f.taskFace, f.projectFace
+	timeStyle := f.timeStyle
+
+	// Depending on the overflow policy, smaller faces are tried first,
+	// and two columns of tasks may be tried after one.
+	tasks := atLeastPriority(data.tasks, r.minPriority)
+	victims := overflowVictims(tasks, r.overflow)
+	type step struct {
+		taskFace, projectFace font.Face
+		columns               int
+	}
+	var steps []step
+	if r.columns != columnsTwo {
+		steps = append(steps, step{taskFace, projectFace, 1})
+		if r.overflow == overflowShrink {
+			if data.accessible {
+				steps = append(steps, step{r.normal, r.small, 1})
+			}
+			steps = append(steps, step{r.small, r.tiny, 1})
 		}
-		if task.HasDesc {
-			txt += " ♫"
+	}
+	if r.columns == columnsTwo || r.columns == columnsAuto {
+		// Two columns are narrower, so their text is one size smaller.
+		steps = append(steps, step{r.smallerFace(taskFace), r.smallerFace(projectFace), 2})
+	}
+	var (
+		listVPitch, subtaskPitch int
+		gutter                   int // for identicons
+		numColumns               int
+		shown, overflowed        []renderableTask
+	)
+	height := func(row listRow) int {
+		switch {
+		case row.divider:
+			return listVPitch / 2
+		case row.level > 0:
+			return subtaskPitch
 		}
-		if task.InProgress {
-			txt += " ◊"
+		return listVPitch
+	}
+	for _, step := range steps {
+		taskFace, projectFace, numColumns = step.taskFace, step.projectFace, step.columns
+		listVPitch = taskFace.Metrics().Height.Ceil()
+		if data.accessible {
+			listVPitch = listVPitch * 5 / 4
 		}
-		if !task.Time.IsZero() {
-			txt += " <" + task.Time.Format(time.Kitchen) + ">"
+		subtaskPitch = projectFace.Metrics().Height.Ceil()
+		gutter = 0
+		if r.identicons {
+			gutter = identiconSize(taskFace.Metrics().Ascent.Ceil()) + 6
 		}
-		if task.Assignee != "" {
-			txt += " (" + task.Assignee + ")"
+		listRoom := room.Dy() - 4 - taskFace.Metrics().Descent.Ceil()
+		shown, overflowed = r.fitTasks(tasks, victims, r.maxTasks, height, numColumns, listRoom, subtaskPitch)
+		if len(overflowed) == 0 {
+			break
 		}
-		next = r.writeText(dst, origin, bottomLeft, color.Black, r.normal, txt)
-		origin = image.Pt(next.X+10, baselineY)
-		r.writeText(dst, origin, bottomLeft, colorRed, r.small, task.Project)
 	}
-	bottomOfListY := listBase.Y + (len(data.tasks)-1)*listVPitch
-	topOfFooterY := dst.Bounds().Max.Y - 2
+	// Later pages show what overflowed the one before, until nothing does.
+	for page := 0; page < data.page && len(overflowed) > 0; page++ {
+		listRoom := room.Dy() - 4 - taskFace.Metrics().Descent.Ceil()
+		rest := overflowed
+		shown, overflowed = r.fitTasks(rest, overflowVictims(rest, r.overflow), r.maxTasks, height, numColumns, listRoom, subtaskPitch)
+	}
+	columns := splitColumns(r.listRows(shown), height, numColumns)
+	used := 2 + columnsHeight(columns, height)
+	if len(overflowed) > 0 {
+		f.hidden = hiddenIn(r.listRows(overflowed))
+		used += subtaskPitch
+	}
+
+	// Home Assistant states in the sidebar go down the right, narrowing the task list.
+	// The sidebar is at most a third of the width.
+	sideFace := f.projectFace
+	sidePitch := sideFace.Metrics().Height.Ceil()
+	var sidebar []string
+	sideWidth := 0
+	for _, txt := range data.hassSidebar {
+		txt = truncateText(sideFace, txt, f.dst.Bounds().Dx()/3-20)
+		sidebar = append(sidebar, txt)
+		sideWidth = max(sideWidth, font.MeasureString(sideFace, txt).Ceil()+20)
+	}
+	if len(sidebar) > 0 {
+		used = max(used, 2+len(sidebar)*sidePitch+sideFace.Metrics().Descent.Ceil())
+	}
+
+	// drawColumn draws a column of rows with its left edge at the given x coordinate,
+	// returning the baseline of the row after the last.
+	drawColumn := func(dst draw.Image, left, top int, rows []listRow) int {
+		accentCol := f.accentCol
+		// listBase is the baseline of the first list entry, and y is that of the next.
+		listBase := image.Pt(left+10+gutter, top+2+listVPitch)
+		y := listBase.Y
+		// Rows are tiled by their baselines, so their hit zones are too,
+		// shifted down to cover descenders.
+		descent := taskFace.Metrics().Descent.Ceil()
+
+		for _, row := range rows {
+			if row.divider {
+				// A dotted divider, taking half a row.
+				dy := y - listVPitch + listVPitch/2
+				for x := listBase.X; x < dst.Bounds().Max.X-10; x += 4 {
+					dst.Set(x, dy, color.Black)
+					dst.Set(x+1, dy, color.Black)
+				}
+				y += listVPitch / 2
+				continue
+			}
+			if row.level > 0 {
+				// Subtasks are smaller, and indented beneath their parent.
+				pitch := subtaskPitch
+				baselineY := y - listVPitch + pitch
+				y += pitch
+				origin := image.Pt(listBase.X+20*row.level, baselineY)
+				if row.indent {
+					origin.X += 20
+				}
+				if row.more == 0 {
+					f.hits = append(f.hits, taskHit(row.task, left, baselineY-pitch+descent, dst.Bounds().Max.X, baselineY+descent))
+				}
+				if r.identicons && row.more == 0 && row.task.Assignee != "" {
+					size := identiconSize(projectFace.Metrics().Ascent.Ceil())
+					drawIdenticon(dst, image.Pt(left+10, baselineY), size, color.Black, newIdenticon(row.task.Assignee))
+				}
+				r.writeSubtask(dst, origin, projectFace, row, timeStyle, data.now)
+				continue
+			}
+			baselineY := y
+			y += listVPitch
+			origin := image.Pt(listBase.X, baselineY)
 
-	// Render alerts from the bottom up.
-	alertFont := r.tiny
-	alertListVPitch := alertFont.Metrics().Height.Ceil()
-	for i := len(data.alerts) - 1; i >= 0; i-- {
-		// Stop before we get to the task list.
-		if topOfFooterY-alertListVPitch <= bottomOfListY {
-			break
+			if row.header != "" {
+				name := r.projectName(taskFace, row.header, dst.Bounds().Max.X-2-origin.X)
+				r.writeSpans(dst, origin, accentCol, taskFace, []textSpan{{Text: name, Bold: true}})
+				continue
+			}
+			task := row.task
+			f.hits = append(f.hits, taskHit(task, left, baselineY-listVPitch+descent, dst.Bounds().Max.X, baselineY+descent))
+			if row.indent {
+				origin.X += 20
+			}
+			if r.identicons && task.Assignee != "" {
+				size := identiconSize(taskFace.Metrics().Ascent.Ceil())
+				drawIdenticon(dst, image.Pt(left+10, baselineY), size, color.Black, newIdenticon(task.Assignee))
+			}
+
+			var titleCol color.Color = color.Black
+			if task.Overdue {
+				titleCol = colorRed
+			} else if task.Emphasis && r.labelColours {
+				titleCol = accentCol
+			}
+
+			txt := fmt.Sprintf("[P%d] %s", 4-task.Priority, task.Title)
+			// Priority
+			next := r.writeText(dst, origin, bottomLeft, color.Black, taskFace, fmt.Sprintf("[P%d] ", 4-task.Priority))
+			origin = image.Pt(next.X, baselineY)
+
+			// Title
+			next = r.writeSpans(dst, origin, titleCol, taskFace, parseInline(task.Title))
+			origin = image.Pt(next.X, baselineY)
+
+			// Remaining info
+			txt = ""
+			if task.Total > 0 {
+				txt += fmt.Sprintf(" {%d/%d}", task.Done, task.Total)
+			}
+			if task.HasDesc {
+				txt += " ♫"
+			}
+			if task.InProgress {
+				txt += " ◊"
+				if task.StaleProgress {
+					// In progress for so long that it probably isn't.
+					txt += "?"
+				}
+			}
+			for _, h := range task.Hints {
+				txt += " " + r.glyphOr(taskFace, h, weatherHintAlt)
+			}
+			if cd := r.phrases.countdown(task.Time, data.now); cd != "" && timeStyle != timeRelative {
+				txt += " <" + cd + ">"
+			} else if !task.Time.IsZero() {
+				txt += " <" + r.formatTime(task.Time, data.now, timeStyle) + ">"
+			}
+			if task.Assignee != "" {
+				txt += " (" + task.Assignee + ")"
+			}
+			next = r.writeText(dst, origin, bottomLeft, color.Black, taskFace, txt)
+			if !row.indent {
+				origin = image.Pt(next.X+10, baselineY)
+				r.writeText(dst, origin, bottomLeft, accentCol, projectFace, r.projectName(projectFace, task.Project, dst.Bounds().Max.X-2-origin.X))
+			}
+		}
+		return y
+	}
+
+	return used, func(top int) {
+		accentCol := f.accentCol
+		width := (f.dst.Bounds().Dx() - sideWidth) / len(columns)
+		// y is the baseline of the row after the longest column.
+		y := 0
+		for i, rows := range columns {
+			dst := f.dst
+			if len(columns) > 1 || sideWidth > 0 {
+				dst = clippedImage{
+					img:    f.dst,
+					bounds: image.Rect(i*width, f.dst.Bounds().Min.Y, (i+1)*width, f.dst.Bounds().Max.Y),
+				}
+			}
+			y = max(y, drawColumn(dst, i*width, top, rows))
 		}
+		if len(overflowed) > 0 {
+			baselineY := y - listVPitch + subtaskPitch
+			r.writeText(f.dst, image.Pt(10+gutter, baselineY), bottomLeft, accentCol, projectFace, f.hidden.String())
+			descent := projectFace.Metrics().Descent.Ceil()
+			f.hits = append(f.hits, hitZone{
+				Rect:   image.Rect(0, baselineY-subtaskPitch+descent, f.dst.Bounds().Dx()-sideWidth, baselineY+descent),
+				Action: hitActionNextPage,
+			})
+		}
+		for i, txt := range sidebar {
+			baselineY := top + 2 + (i+1)*sidePitch
+			r.writeText(f.dst, image.Pt(f.dst.Bounds().Max.X-10, baselineY), bottomRight, color.Black, sideFace, txt)
+		}
+	}
+}
 
-		alert := data.alerts[i]
-		origin := image.Pt(2, topOfFooterY)
-		next := r.writeText(dst, origin, bottomLeft, colorRed, alertFont, alert.Summary)
-		origin.X = next.X
-		r.writeText(dst, origin, bottomLeft, color.Black, alertFont, ": "+alert.Description)
+// planFooter plans the footer, drawn from the bottom up.
+func (r renderer) planFooter(f *frame, room image.Rectangle) (int, func(top int)) {
+	data, alertFace, accentCol := f.data, f.alertFace, f.accentCol
+	footerVPitch := alertFace.Metrics().Height.Ceil()
+	footerRoom := room.Dy() - 3
+	if pct := r.footer.MaxHeightPercent; pct > 0 {
+		footerRoom = min(footerRoom, f.dst.Bounds().Dy()*pct/100)
+	}
+	footer := layoutFooter(r.footer, noteLines(data.notes), data.hassFooter, collapseAlerts(data.alerts), footerRoom/footerVPitch)
+	// The completions chart goes at the right, above the status strip.
+	drawChart := r.planCompletions(f, footerVPitch-4)
+	if len(footer) == 0 && drawChart == nil {
+		return 2, func(int) {}
+	}
+	height := 2 + len(footer)*footerVPitch
+	if drawChart != nil {
+		height = max(height, 2+2*footerVPitch)
+	}
+	return height, func(top int) {
+		dst := f.dst
+		baselineY := top + height - 2 // of the last line
+		for i := len(footer) - 1; i >= 0; i-- {
+			line := footer[i]
+			origin := image.Pt(2, baselineY)
+			switch {
+			case line.alert != nil:
+				alert := line.alert
+				if alert.Origin != "" {
+					origin.X = r.writeText(dst, origin, bottomLeft, color.Black, alertFace, "["+alert.Origin+"] ").X
+				}
+				col := accentCol
+				if alert.Muted {
+					col = color.Black
+				}
+				next := r.writeText(dst, origin, bottomLeft, col, alertFace, alert.Summary)
+				origin.X = next.X
+				txt := ": " + alert.Description
+				if alert.Count > 1 {
+					txt += fmt.Sprintf(" ×%d", alert.Count)
+				}
+				r.writeText(dst, origin, bottomLeft, color.Black, alertFace, txt)
+			case line.more > 0:
+				r.writeText(dst, origin, bottomLeft, accentCol, alertFace, fmt.Sprintf("+%d more", line.more))
+			case line.note != "":
+				next := r.writeText(dst, origin, bottomLeft, accentCol, alertFace, r.glyphOr(alertFace, "✎", "•")+" ")
+				r.writeText(dst, image.Pt(next.X, origin.Y), bottomLeft, color.Black, alertFace, line.note)
+			default:
+				r.writeText(dst, origin, bottomLeft, color.Black, alertFace, line.text)
+			}
 
-		topOfFooterY -= alertListVPitch
+			baselineY -= footerVPitch
+		}
+		if drawChart != nil {
+			drawChart(image.Pt(dst.Bounds().Max.X-3, top+height-2-footerVPitch))
+		}
 	}
+}
 
-	if len(data.alerts) == 0 {
-		r.writeText(dst, image.Pt(-2, -2), bottomRight, color.Black, r.tiny, "π")
+// planStatus plans the integration health strip and other status badges, right aligned.
+func (r renderer) planStatus(f *frame, room image.Rectangle) (int, func(top int)) {
+	data, accentCol := f.data, f.accentCol
+	height := r.tiny.Metrics().Height.Ceil() + 3
+	return height, func(top int) {
+		dst := f.dst
+		// Positions are absolute, matching writeText's handling of (-2, -2).
+		corner := image.Pt(dst.Bounds().Max.X-3, top+height-3)
+		strip := r.writeHealth(dst, corner, accentCol, data.health)
+		if len(data.alerts) == 0 {
+			if len(data.health) > 0 {
+				strip.X -= 6
+			}
+			strip = r.writeText(dst, image.Pt(strip.X, corner.Y), bottomRight, color.Black, r.tiny, "π")
+		}
+		if data.lopsided() {
+			// The split of tasks has been lopsided lately.
+			strip = r.writeText(dst, image.Pt(strip.X-6, corner.Y), bottomRight, accentCol, r.tiny, r.glyphOr(r.tiny, "⚖", "≠"))
+		}
+		if !data.offlineSince.IsZero() {
+			r.writeText(dst, image.Pt(strip.X-6, corner.Y), bottomRight, accentCol, r.tiny, offlineBadge(data.offlineSince, data.now))
+		} else if data.offline {
+			// The tasks are from before a restart, and Todoist can't be reached.
+			r.writeText(dst, image.Pt(strip.X-6, corner.Y), bottomRight, accentCol, r.tiny, cachedBadge(data.cachedAt, data.now))
+		}
 	}
+}
 
-	sub := clippedImage{
-		img: dst,
-		bounds: image.Rectangle{
-			Min: image.Pt(10, bottomOfListY+10),
-			Max: image.Pt(dst.Bounds().Max.X-10, topOfFooterY-2),
-		},
+// planPhoto plans a photo filling the room.
+func (r renderer) planPhoto(f *frame, room image.Rectangle) (int, func(top int)) {
+	if f.data.accessible || !r.photos {
+		return 0, nil
 	}
-	if !sub.bounds.Empty() {
-		photo, err := r.photoPicker()
-		if err != nil {
+	height, dither := room.Dy(), f.dither
+	return height, func(top int) {
+		sub := clippedImage{
+			img: f.dst,
+			bounds: image.Rectangle{
+				Min: image.Pt(10, top+10),
+				Max: image.Pt(f.dst.Bounds().Max.X-10, top+height-2),
+			},
+		}
+		if sub.bounds.Empty() {
+			return
+		}
+		if h := sub.bounds.Dy(); h < r.photoMinHeight {
+			// Not worth picking, decoding and dithering a photo for a thin sliver.
+			log.Printf("Skipping photo: only %dpx of free height, under photo_min_height of %dpx", h, r.photoMinHeight)
+		} else if photo, err := r.photoPicker(); err != nil {
 			log.Printf("Picking random photo: %v", err)
 		} else if photo != "" {
-			if err := drawPhoto(sub, photo); err != nil {
+			if err := drawPhoto(sub, photo, dither); err != nil {
 				log.Printf("Drawing random photo: %v", err)
 			}
 		}
 	}
 }
 
+// atLeastPriority returns the tasks with at least the given priority.
+// Subtasks are kept with their parents.
+func atLeastPriority(tasks []renderableTask, min int) []renderableTask {
+	if min <= 1 {
+		return tasks
+	}
+	var res []renderableTask
+	for _, task := range tasks {
+		if task.Priority >= min {
+			res = append(res, task)
+		}
+	}
+	return res
+}
+
+// writeSubtask draws a subtask row, or a count of hidden subtasks.
+// Countdowns are only kept up to date for top-level tasks, so subtasks just show their time.
+func (r renderer) writeSubtask(dst draw.Image, origin image.Point, face font.Face, row listRow, timeStyle string, now time.Time) {
+	if row.more > 0 {
+		r.writeText(dst, origin, bottomLeft, color.Black, face, fmt.Sprintf("+%d more", row.more))
+		return
+	}
+	task := row.task
+	var titleCol color.Color = color.Black
+	if task.Overdue {
+		titleCol = colorRed
+	}
+	next := r.writeText(dst, origin, bottomLeft, color.Black, face, "• ")
+	next = r.writeSpans(dst, image.Pt(next.X, origin.Y), titleCol, face, parseInline(task.Title))
+	txt := ""
+	if !task.Time.IsZero() {
+		txt += " <" + r.formatTime(task.Time, now, timeStyle) + ">"
+	}
+	if task.Assignee != "" {
+		txt += " (" + task.Assignee + ")"
+	}
+	r.writeText(dst, image.Pt(next.X, origin.Y), bottomLeft, color.Black, face, txt)
+}
+
+// projectName returns the name to display for a project, shortened to fit within avail pixels.
+func (r renderer) projectName(face font.Face, project string, avail int) string {
+	if short, ok := r.projectNames[project]; ok {
+		project = short
+	}
+	if r.maxProjectWidth > 0 && r.maxProjectWidth < avail {
+		avail = r.maxProjectWidth
+	}
+	return truncateText(face, r.substitute(project), avail)
+}
+
+// truncateText shortens text, if needed, so that it is no wider than width pixels when drawn with face.
+// Truncated text ends with an ellipsis.
+func truncateText(face font.Face, text string, width int) string {
+	const ellipsis = "…"
+	fits := func(s string) bool { return font.MeasureString(face, s).Ceil() <= width }
+	if fits(text) {
+		return text
+	}
+	runes := []rune(text)
+	for n := len(runes) - 1; n > 0; n-- {
+		s := strings.TrimRight(string(runes[:n]), " ") + ellipsis
+		if fits(s) {
+			return s
+		}
+	}
+	return ""
+}
+
 type originAnchor int
 
 const (
@@ -757,10 +2945,29 @@ func (oa originAnchor) String() string {
 	}
 }
 
+// writeSpans renders styled text with its baseline starting at origin, which must be non-negative.
+// It returns the top right corner.
+func (r renderer) writeSpans(dst draw.Image, origin image.Point, col color.Color, face font.Face, spans []textSpan) image.Point {
+	next := origin
+	for _, span := range spans {
+		if !span.Bold {
+			next = r.writeText(dst, origin, bottomLeft, col, face, span.Text)
+		} else if bf, ok := r.bold[face]; ok {
+			next = r.writeText(dst, origin, bottomLeft, col, bf, span.Text)
+		} else {
+			// Fake it by drawing twice, offset by a pixel.
+			r.writeText(dst, origin, bottomLeft, col, face, span.Text)
+			next = r.writeText(dst, origin.Add(image.Pt(1, 0)), bottomLeft, col, face, span.Text)
+		}
+		origin.X = next.X
+	}
+	return image.Pt(origin.X, next.Y)
+}
+
 // writeText renders some text at the origin.
 // If either component of origin is negative, it is interpreted as being relative to the right/bottom.
 // The text is written such that the origin is at the given anchor corner of the text.
-// It returns the opposite corner.
+// It returns the opposite corner. The glyph substitutions are applied to the text.
 func (r renderer) writeText(dst draw.Image, origin image.Point, anchor originAnchor, col color.Color, face font.Face, text string) (opposite image.Point) {
 	defer func() {
 		if *debug {
@@ -770,6 +2977,7 @@ func (r renderer) writeText(dst draw.Image, origin image.Point, anchor originAnc
 	// TODO: fix this to work in case dst's bounds is not (0, 0).
 	// TODO: It'd be nice to log a message if the text busts the bounds of dst.
 
+	text = r.substitute(text)
 	d := &font.Drawer{
 		Dst:  dst,
 		Src:  &image.Uniform{col},
@@ -843,33 +3051,54 @@ func (r renderer) writeText(dst draw.Image, origin image.Point, anchor originAnc
 	return image.Pt(d.Dot.X.Round(), d.Dot.Y.Round())
 }
 
-func photoOptions(dir string) ([]string, error) {
+// expandHome expands a leading "~/" in dir to the user's home directory.
+func expandHome(dir string) (string, error) {
 	if strings.HasPrefix(dir, "~/") {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return nil, fmt.Errorf("os.UserHomeDir: %w", err)
+			return "", fmt.Errorf("os.UserHomeDir: %w", err)
 		}
 		dir = filepath.Join(home, dir[2:])
 	}
+	return dir, nil
+}
 
-	opts, err := filepath.Glob(filepath.Join(dir, "*.jpg"))
+func photoOptions(dir string) ([]string, error) {
+	dir, err := expandHome(dir)
 	if err != nil {
-		return nil, fmt.Errorf("globbing photos dir: %w", err)
+		return nil, err
 	}
-	return opts, nil
-}
 
-func drawPhoto(dst draw.Image, filename string) error {
-	f, err := os.Open(filename)
+	ents, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("opening %s: %w", filename, err)
+		return nil, fmt.Errorf("reading photos dir: %w", err)
 	}
-	src, _, err := image.Decode(f)
-	f.Close()
+	var opts []string
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") || !photoExts[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		opts = append(opts, filepath.Join(dir, name))
+	}
+	return opts, nil
+}
+
+// defaultPhotoMinHeight is the default for Config.PhotoMinHeight.
+const defaultPhotoMinHeight = 60 // pixels
+
+func drawPhoto(dst draw.Image, filename, dither string) error {
+	src, err := decodePhoto(filename)
 	if err != nil {
-		return fmt.Errorf("decoding image %s: %w", filename, err)
+		return err
 	}
+	drawImage(dst, src, dither)
+	return nil
+}
 
+// drawImage draws src scaled to fit dst, dithered to dst's colours
+// or to black and white as set by dither (see RegionConfig.Dither).
+func drawImage(dst draw.Image, src image.Image, dither string) {
 	srcWidth := src.Bounds().Max.X - src.Bounds().Min.X
 	srcHeight := src.Bounds().Max.Y - src.Bounds().Min.Y
 	dstWidth := dst.Bounds().Max.X - dst.Bounds().Min.X
@@ -900,6 +3129,11 @@ func drawPhoto(dst draw.Image, filename string) error {
 	// To make the remaining code simpler, shift dst so that its bounds always starts at (0, 0).
 	dst = shiftedImage{dst}
 
+	if dither == ditherOrdered || dither == ditherBlueNoise {
+		drawGray(dst, src, scale, dither)
+		return
+	}
+
 	// TODO: This is quite inefficient.
 	carriedErrors := make([]colorError, dst.Bounds().Max.X*dst.Bounds().Max.Y)
 	carriedError := func(x, y int) *colorError {
@@ -930,8 +3164,6 @@ func drawPhoto(dst draw.Image, filename string) error {
 			}
 		}
 	}
-
-	return nil
 }
 
 type clippedImage struct {
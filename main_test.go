@@ -1,9 +1,23 @@
 package main
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 func TestServerWriteDoesNotSpin(t *testing.T) {
@@ -21,3 +35,310 @@ func TestServerWriteDoesNotSpin(t *testing.T) {
 	// This would break:
 	io.WriteString(s, "the final straw")
 }
+
+func TestTruncateText(t *testing.T) {
+	face := basicfont.Face7x13 // 7px per glyph
+	tests := []struct {
+		text  string
+		width int
+		want  string
+	}{
+		{"House", 100, "House"},
+		{"House", 35, "House"},
+		{"Household Administration", 70, "Household…"},
+		{"Big House", 35, "Big…"}, // trailing space is dropped
+		{"House", 5, ""},
+	}
+	for _, test := range tests {
+		got := truncateText(face, test.text, test.width)
+		if got != test.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestAtLeastPriority(t *testing.T) {
+	tasks := []renderableTask{
+		{Priority: 4, Title: "a", Subtasks: []renderableTask{{Priority: 1, Title: "a1"}}},
+		{Priority: 3, Title: "b"},
+		{Priority: 2, Title: "c"},
+		{Priority: 1, Title: "d"},
+	}
+	tests := []struct {
+		min  int
+		want string
+	}{
+		{0, "abcd"},
+		{1, "abcd"},
+		{3, "ab"},
+		{4, "a"},
+	}
+	for _, test := range tests {
+		var got string
+		for _, task := range atLeastPriority(tasks, test.min) {
+			got += task.Title
+		}
+		if got != test.want {
+			t.Errorf("atLeastPriority(_, %d) gave %q, want %q", test.min, got, test.want)
+		}
+	}
+}
+
+func TestMatchingMessageCountsSubtasks(t *testing.T) {
+	zero, three := 0, 3
+	messages := []message{
+		{Eq: &zero, Options: []string{"All done!"}},
+		{Lt: &three, Options: []string{"Nearly there"}},
+		{Options: []string{"Things to do"}},
+	}
+	tasks := []renderableTask{
+		{Title: "Take out bins", Subtasks: []renderableTask{{Title: "Rinse recycling"}, {Title: "Flatten boxes"}}},
+	}
+	if i := matchingMessage(messages, displayData{tasks: tasks}); i != 2 {
+		t.Errorf("With one task and two subtasks, matched message %d, want 2", i)
+	}
+}
+
+func TestPhotoMinHeight(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	for _, test := range []struct {
+		minHeight int
+		want      bool
+	}{
+		{0, true},
+		{400, true},
+		{1000, false},
+	} {
+		picked := false
+		cfg := Config{
+			Font:           fontFile,
+			PhotosDir:      "photos",
+			PhotoMinHeight: test.minHeight,
+			Messages:       []message{{Options: []string{"Testing"}}},
+		}
+		rend, err := newRenderer(cfg, func() (string, error) { picked = true; return "", nil })
+		if err != nil {
+			t.Fatalf("newRenderer: %v", err)
+		}
+		rend.Render(image.NewRGBA(image.Rect(0, 0, 800, 480)), displayData{now: time.Now()})
+		if picked != test.want {
+			t.Errorf("With photo_min_height %d, picked a photo = %t, want %t", test.minHeight, picked, test.want)
+		}
+	}
+}
+
+func TestServeTasks(t *testing.T) {
+	s := &server{ref: &refresher{}}
+	s.ref.latest.Set(displayData{
+		today: time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local),
+		tasks: []renderableTask{
+			{Priority: 4, Title: "Take out bins", Assignee: "David", Project: "House"},
+			{Priority: 3, Title: "Clean gutters", Overdue: true, Project: "House"},
+			{Priority: 1, Title: "Write report", Assignee: "Alice", Project: "Work"},
+		},
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Take out bins", "Clean gutters", "Write report"}},
+		{"assignee=david", []string{"Take out bins"}},
+		{"project=House&overdue=false", []string{"Take out bins"}},
+		{"overdue=true", []string{"Clean gutters"}},
+		{"project=Garden", []string{}},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/tasks?"+test.query, nil))
+		if rec.Code != 200 {
+			t.Errorf("/api/tasks?%s: status %d", test.query, rec.Code)
+			continue
+		}
+		var resp struct {
+			Today string
+			Tasks []struct{ Title string }
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("/api/tasks?%s: bad JSON: %v", test.query, err)
+			continue
+		}
+		got := []string{}
+		for _, task := range resp.Tasks {
+			got = append(got, task.Title)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("/api/tasks?%s returned %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/tasks?overdue=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Bad overdue value gave status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeFramePlane(t *testing.T) {
+	p := newPaper(PanelConfig{}, PanelTuning{})
+	s := &server{framePlane: p.Plane}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	if rec := get("/api/frame/bw.png"); rec.Code != http.StatusNotFound {
+		t.Errorf("Before any refresh, bw.png gave %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	p.Clear()
+	p.Set(10, 20, color.Black)
+	p.Set(30, 40, colorRed)
+	p.recordFrame()
+	p.Set(50, 60, color.Black) // not sent, so not exported
+
+	for _, test := range []struct {
+		path     string
+		set, off image.Point
+	}{
+		{"/api/frame/bw.png", image.Pt(30, 40), image.Pt(10, 20)},
+		{"/api/frame/red.png", image.Pt(30, 40), image.Pt(10, 20)},
+	} {
+		rec := get(test.path)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: %d %s", test.path, rec.Code, rec.Body)
+			continue
+		}
+		img, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Errorf("Decoding %s: %v", test.path, err)
+			continue
+		}
+		pal, ok := img.(*image.Paletted)
+		if !ok || len(pal.Palette) != 2 {
+			t.Errorf("%s is a %T, want a 1-bit paletted image", test.path, img)
+			continue
+		}
+		if got := pal.Bounds().Size(); got != image.Pt(800, 480) {
+			t.Errorf("%s is %v, want 800x480", test.path, got)
+		}
+		if pal.ColorIndexAt(test.set.X, test.set.Y) != 1 || pal.ColorIndexAt(test.off.X, test.off.Y) != 0 {
+			t.Errorf("%s has the wrong bits", test.path)
+		}
+		if pal.ColorIndexAt(50, 60) != pal.ColorIndexAt(0, 0) {
+			t.Errorf("%s includes drawing that wasn't sent", test.path)
+		}
+
+		// Revalidating the same frame shouldn't resend it.
+		etag := rec.Header().Get("ETag")
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("GET %s with If-None-Match %s: %d with %d bytes, want 304 with none", test.path, etag, rec.Code, rec.Body.Len())
+		}
+	}
+	etag := get("/api/frame/bw.png").Header().Get("ETag")
+	p.recordFrame() // now includes (50, 60)
+	if got := get("/api/frame/bw.png").Header().Get("ETag"); got == etag {
+		t.Errorf("ETag didn't change with a new frame")
+	}
+}
+
+func TestServeFrontTabs(t *testing.T) {
+	state, _ := loadState("")
+	p := newPaper(PanelConfig{}, PanelTuning{})
+	s := &server{state: state, startTime: time.Now(), ref: &refresher{}, framePlane: p.Plane}
+	s.ref.latest.Set(displayData{
+		tasks: []renderableTask{
+			{Priority: 4, Title: "Take out bins", Assignee: "David", Project: "House"},
+			{Priority: 3, Time: time.Date(2024, time.June, 12, 17, 30, 0, 0, time.Local), Title: "Clean gutters", Overdue: true, Project: "House"},
+		},
+	})
+	s.Write([]byte("Refreshed OK\n"))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	tests := []struct {
+		path       string
+		want, omit []string
+	}{
+		{"/", []string{`href="/?tab=status" class="current"`, "Save notes"}, []string{"Refreshed OK"}},
+		{"/?tab=preview", []string{"Nothing has been sent to the panel yet.", `action="/show-image"`}, []string{"Save notes"}},
+		{"/?tab=photos", nil, []string{"Save notes", `action="/show-image"`}},
+		{"/?tab=tasks", []string{"[P0] <span>Take out bins</span> (David)", `[P1] <span class="overdue">Clean gutters</span> &lt;17:30&gt;`}, nil},
+		{"/?tab=logs", []string{"Refreshed OK"}, []string{"Save notes"}},
+	}
+	for _, test := range tests {
+		rec := get(test.path)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: %d %s", test.path, rec.Code, rec.Body)
+			continue
+		}
+		body := rec.Body.String()
+		for _, want := range test.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s does not contain %q", test.path, want)
+			}
+		}
+		for _, omit := range test.omit {
+			if strings.Contains(body, omit) {
+				t.Errorf("GET %s contains %q", test.path, omit)
+			}
+		}
+	}
+
+	p.Clear()
+	p.recordFrame()
+	if body := get("/?tab=preview").Body.String(); !strings.Contains(body, `src="/api/frame/bw.png"`) || !strings.Contains(body, `src="/api/frame/red.png"`) {
+		t.Errorf("Preview tab after a refresh does not show both planes")
+	}
+	if rec := get("/?tab=bogus"); rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown tab gave %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestWriteBody(t *testing.T) {
+	body := []byte(strings.Repeat("<p>Hello, world!</p>\n", 100))
+	tests := []struct {
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8, br", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		writeBody(rec, req, body)
+
+		var r io.Reader = rec.Body
+		if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != test.gzipped {
+			t.Errorf("With Accept-Encoding %q, gzipped = %t, want %t", test.acceptEncoding, gzipped, test.gzipped)
+			continue
+		} else if gzipped {
+			gr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Errorf("With Accept-Encoding %q, bad gzip: %v", test.acceptEncoding, err)
+				continue
+			}
+			r = gr
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != string(body) {
+			t.Errorf("With Accept-Encoding %q, body is wrong (err %v)", test.acceptEncoding, err)
+		}
+	}
+}
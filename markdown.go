@@ -0,0 +1,123 @@
+package main
+
+// Inline markdown in task titles.
+// Todoist renders a subset of markdown, and people use it in task names.
+
+import (
+	"sort"
+	"strings"
+)
+
+// textSpan is a run of text with uniform style.
+type textSpan struct {
+	Text string
+	Bold bool
+}
+
+// parseInline parses the inline markdown that is common in Todoist titles.
+// Links are reduced to their text, **bold** and __bold__ produce bold spans,
+// *emphasis* markers are dropped, and common emoji are mapped to glyphs
+// that our fonts are likely to have.
+func parseInline(s string) []textSpan {
+	var spans []textSpan
+	var cur strings.Builder
+	bold := false
+	emit := func() {
+		if cur.Len() == 0 {
+			return
+		}
+		txt := cur.String()
+		cur.Reset()
+		// Merge with the previous span if the style is the same.
+		if n := len(spans); n > 0 && spans[n-1].Bold == bold {
+			spans[n-1].Text += txt
+			return
+		}
+		spans = append(spans, textSpan{Text: txt, Bold: bold})
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			// Only treat this as bold if it is closed, or we are closing.
+			if bold || strings.Contains(rest[2:], rest[:2]) {
+				emit()
+				bold = !bold
+				i += 2
+				continue
+			}
+		case rest[0] == '*':
+			// Single asterisks for emphasis; we have no italic face.
+			if j := strings.IndexByte(rest[1:], '*'); j > 0 && rest[1] != ' ' {
+				cur.WriteString(rest[1 : 1+j])
+				i += 2 + j
+				continue
+			}
+		case rest[0] == '[':
+			// [text](url)
+			if j := strings.Index(rest, "]("); j > 0 {
+				if k := strings.IndexByte(rest[j:], ')'); k > 0 {
+					cur.WriteString(rest[1:j])
+					i += j + k + 1
+					continue
+				}
+			}
+		case rest[0] == ':':
+			// Emoji shortcode, like :shopping_cart:.
+			if j := strings.IndexByte(rest[1:], ':'); j > 0 {
+				if rep, ok := emojiGlyphs[rest[:j+2]]; ok {
+					cur.WriteString(rep)
+					i += j + 2
+					continue
+				}
+			}
+		}
+		cur.WriteByte(s[i])
+		i++
+	}
+	emit()
+
+	for i := range spans {
+		spans[i].Text = emojiReplacer.Replace(spans[i].Text)
+	}
+	return spans
+}
+
+// emojiGlyphs maps common emoji, and their shortcodes, to text that a typical font can render.
+var emojiGlyphs = map[string]string{
+	":heart:": "♥", "❤️": "♥", "❤": "♥",
+	":star:": "★", "⭐": "★",
+	":white_check_mark:": "✓", "✅": "✓", ":heavy_check_mark:": "✓", "✔️": "✓",
+	":x:": "✗", "❌": "✗",
+	":warning:": "!", "⚠️": "!", "⚠": "!",
+	":exclamation:": "!", "❗": "!",
+	":question:": "?", "❓": "?",
+	":arrow_right:": "→", "➡️": "→",
+	":arrow_left:": "←", "⬅️": "←",
+	":musical_note:": "♪", "🎵": "♪",
+	":sunny:": "☼", "☀️": "☼",
+	":phone:": "☎", "☎️": "☎",
+}
+
+var emojiReplacer = func() *strings.Replacer {
+	var emoji []string
+	for k := range emojiGlyphs {
+		if !strings.HasPrefix(k, ":") {
+			emoji = append(emoji, k)
+		}
+	}
+	// The replacer prefers earlier arguments, so put longer sequences first
+	// to consume any variation selector along with its emoji.
+	sort.Slice(emoji, func(i, j int) bool {
+		if len(emoji[i]) != len(emoji[j]) {
+			return len(emoji[i]) > len(emoji[j])
+		}
+		return emoji[i] < emoji[j]
+	})
+	var oldnew []string
+	for _, k := range emoji {
+		oldnew = append(oldnew, k, emojiGlyphs[k])
+	}
+	return strings.NewReplacer(oldnew...)
+}()
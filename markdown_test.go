@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []textSpan
+	}{
+		{"Wash up", []textSpan{{Text: "Wash up"}}},
+		{"Buy **milk** now", []textSpan{{Text: "Buy "}, {Text: "milk", Bold: true}, {Text: " now"}}},
+		{"__Urgent__", []textSpan{{Text: "Urgent", Bold: true}}},
+		{"Read [the docs](https://example.com/x_(y)", []textSpan{{Text: "Read the docs"}}},
+		{"Call [Mum](tel:123) *today*", []textSpan{{Text: "Call Mum today"}}},
+		{"Water plants :sunny:", []textSpan{{Text: "Water plants ☼"}}},
+		{"Fix ⚠️ leak", []textSpan{{Text: "Fix ! leak"}}},
+		{"3 * 4 = 12", []textSpan{{Text: "3 * 4 = 12"}}},
+		{"Unclosed **bold", []textSpan{{Text: "Unclosed **bold"}}},
+		{"Time 10:30:00", []textSpan{{Text: "Time 10:30:00"}}},
+		{"snake_case_name", []textSpan{{Text: "snake_case_name"}}},
+	}
+	for _, test := range tests {
+		got := parseInline(test.in)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseInline(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
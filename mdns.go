@@ -0,0 +1,294 @@
+package main
+
+// Advertising the web UI with multicast DNS (RFC 6762) and DNS-SD (RFC 6763),
+// so it can be found as kitchenthing.local without any DHCP or DNS setup.
+// Only the little needed to answer for our own names is implemented.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type MDNSConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Name is the service instance and host name. It defaults to "kitchenthing".
+	Name string `yaml:"name"`
+}
+
+const (
+	mdnsTTL         = 120 // seconds
+	mdnsServiceType = "_http._tcp.local."
+	mdnsServiceEnum = "_services._dns-sd._udp.local."
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+type mdnsResponder struct {
+	instance string // e.g. "kitchenthing._http._tcp.local."
+	host     string // e.g. "kitchenthing.local."
+	port     uint16
+	txt      []string
+	addrs    func() []net.IP
+}
+
+func newMDNSResponder(cfg MDNSConfig, port int) *mdnsResponder {
+	name := cfg.Name
+	if name == "" {
+		name = "kitchenthing"
+	}
+	host := name + ".local."
+	return &mdnsResponder{
+		instance: name + "." + mdnsServiceType,
+		host:     host,
+		port:     uint16(port),
+		txt: []string{
+			"path=/",
+			fmt.Sprintf("preview=http://%s:%d/api/frame/bw.png", strings.TrimSuffix(host, "."), port),
+		},
+		addrs: localAddrs,
+	}
+}
+
+// localAddrs returns the addresses of the network interfaces that support multicast.
+func localAddrs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Printf("mDNS: listing network interfaces: %v", err)
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipn, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipn.IP)
+			}
+		}
+	}
+	return ips
+}
+
+// Serve answers mDNS queries until ctx is done, announcing the service at the start
+// and withdrawing it at the end.
+func (m *mdnsResponder) Serve(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("listening for mDNS: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		if raw, err := m.announcement(0); err == nil {
+			conn.WriteTo(raw, mdnsGroup)
+		}
+		conn.Close()
+	}()
+
+	// Announce twice, a second apart (RFC 6762 section 8.3).
+	go func() {
+		for i := 0; i < 2; i++ {
+			raw, err := m.announcement(mdnsTTL)
+			if err != nil {
+				log.Printf("mDNS: building announcement: %v", err)
+				return
+			}
+			if _, err := conn.WriteTo(raw, mdnsGroup); err != nil {
+				log.Printf("mDNS: announcing: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	log.Printf("Advertising %s on port %d via mDNS", m.instance, m.port)
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("reading mDNS packet: %w", err)
+		}
+		// Queries from a port other than 5353 are from simple resolvers
+		// that expect a conventional unicast reply (RFC 6762 section 6.7).
+		legacy := src.Port != mdnsGroup.Port
+		resp, ok, err := m.respond(buf[:n], legacy)
+		if err != nil {
+			log.Printf("mDNS: handling packet from %v: %v", src, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		dst := mdnsGroup
+		if legacy {
+			dst = src
+		}
+		if _, err := conn.WriteTo(resp, dst); err != nil {
+			log.Printf("mDNS: responding to %v: %v", src, err)
+		}
+	}
+}
+
+// respond builds the response to a query packet, reporting false if there's nothing to say.
+func (m *mdnsResponder) respond(packet []byte, legacy bool) ([]byte, bool, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(packet)
+	if err != nil {
+		return nil, false, err
+	}
+	if hdr.Response {
+		return nil, false, nil
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var answers, extra []dnsmessage.Resource
+	seen := make(map[string]bool)
+	add := func(dst *[]dnsmessage.Resource, rs []dnsmessage.Resource) {
+		for _, r := range rs {
+			// Key on the data too, so a host with several addresses answers with them all.
+			key := r.Header.Name.String() + " " + r.Header.Type.String() + " " + r.Body.GoString()
+			if !seen[key] {
+				seen[key] = true
+				*dst = append(*dst, r)
+			}
+		}
+	}
+	for _, q := range qs {
+		ans, add2 := m.answer(q, mdnsTTL)
+		add(&answers, ans)
+		add(&extra, add2)
+	}
+	if len(answers) == 0 {
+		return nil, false, nil
+	}
+
+	rh := dnsmessage.Header{Response: true, Authoritative: true}
+	var questions []dnsmessage.Question
+	if legacy {
+		rh.ID = hdr.ID
+		questions = qs
+		for i := range answers {
+			answers[i].Header.TTL = 10 // RFC 6762 section 6.7
+		}
+	}
+	raw, err := buildDNS(rh, questions, answers, extra)
+	return raw, err == nil, err
+}
+
+// announcement returns an unsolicited response with all our records.
+// A TTL of zero withdraws them.
+func (m *mdnsResponder) announcement(ttl uint32) ([]byte, error) {
+	ptr, extra := m.answer(dnsmessage.Question{
+		Name: dnsmessage.MustNewName(mdnsServiceType),
+		Type: dnsmessage.TypePTR,
+	}, ttl)
+	return buildDNS(dnsmessage.Header{Response: true, Authoritative: true}, nil, append(ptr, extra...), nil)
+}
+
+// answer returns the answers to q, and any additional records that will likely be wanted next.
+func (m *mdnsResponder) answer(q dnsmessage.Question, ttl uint32) (answers, extra []dnsmessage.Resource) {
+	name := strings.ToLower(q.Name.String())
+	hdr := func(name string, typ dnsmessage.Type, flush bool) dnsmessage.ResourceHeader {
+		class := dnsmessage.ClassINET
+		if flush {
+			// The cache-flush bit, for records that are unique to us (RFC 6762 section 10.2).
+			class |= 1 << 15
+		}
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: class, TTL: ttl}
+	}
+	want := func(typ dnsmessage.Type) bool { return q.Type == typ || q.Type == dnsmessage.TypeALL }
+
+	ptr := dnsmessage.Resource{
+		Header: hdr(mdnsServiceType, dnsmessage.TypePTR, false),
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(m.instance)},
+	}
+	srv := dnsmessage.Resource{
+		Header: hdr(m.instance, dnsmessage.TypeSRV, true),
+		Body:   &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(m.host), Port: m.port},
+	}
+	txt := dnsmessage.Resource{
+		Header: hdr(m.instance, dnsmessage.TypeTXT, true),
+		Body:   &dnsmessage.TXTResource{TXT: m.txt},
+	}
+	var addrs []dnsmessage.Resource
+	for _, ip := range m.addrs() {
+		if ip4 := ip.To4(); ip4 != nil {
+			var a [4]byte
+			copy(a[:], ip4)
+			addrs = append(addrs, dnsmessage.Resource{Header: hdr(m.host, dnsmessage.TypeA, true), Body: &dnsmessage.AResource{A: a}})
+		} else if ip6 := ip.To16(); ip6 != nil {
+			var a [16]byte
+			copy(a[:], ip6)
+			addrs = append(addrs, dnsmessage.Resource{Header: hdr(m.host, dnsmessage.TypeAAAA, true), Body: &dnsmessage.AAAAResource{AAAA: a}})
+		}
+	}
+	addrsOf := func(typ dnsmessage.Type) []dnsmessage.Resource {
+		var rs []dnsmessage.Resource
+		for _, r := range addrs {
+			if q.Type == dnsmessage.TypeALL || r.Header.Type == typ {
+				rs = append(rs, r)
+			}
+		}
+		return rs
+	}
+
+	switch name {
+	case mdnsServiceEnum:
+		if want(dnsmessage.TypePTR) {
+			answers = append(answers, dnsmessage.Resource{
+				Header: hdr(mdnsServiceEnum, dnsmessage.TypePTR, false),
+				Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(mdnsServiceType)},
+			})
+		}
+	case mdnsServiceType:
+		if want(dnsmessage.TypePTR) {
+			answers = append(answers, ptr)
+			extra = append(append(extra, srv, txt), addrs...)
+		}
+	case strings.ToLower(m.instance):
+		if want(dnsmessage.TypeSRV) {
+			answers = append(answers, srv)
+			extra = append(extra, addrs...)
+		}
+		if want(dnsmessage.TypeTXT) {
+			answers = append(answers, txt)
+		}
+	case strings.ToLower(m.host):
+		if want(dnsmessage.TypeA) {
+			answers = append(answers, addrsOf(dnsmessage.TypeA)...)
+		} else if want(dnsmessage.TypeAAAA) {
+			answers = append(answers, addrsOf(dnsmessage.TypeAAAA)...)
+		}
+	}
+	return answers, extra
+}
+
+func buildDNS(hdr dnsmessage.Header, questions []dnsmessage.Question, answers, extra []dnsmessage.Resource) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header:      hdr,
+		Questions:   questions,
+		Answers:     answers,
+		Additionals: extra,
+	}
+	return msg.Pack()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMDNSRespond(t *testing.T) {
+	m := newMDNSResponder(MDNSConfig{}, 8080)
+	m.addrs = func() []net.IP {
+		return []net.IP{net.IPv4(192, 0, 2, 7), net.IPv4(192, 0, 2, 8), net.ParseIP("fe80::7")}
+	}
+
+	query := func(name string, typ dnsmessage.Type) []byte {
+		msg := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 42},
+			Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}},
+		}
+		raw, err := msg.Pack()
+		if err != nil {
+			t.Fatalf("Packing query: %v", err)
+		}
+		return raw
+	}
+	describe := func(rs []dnsmessage.Resource) []string {
+		var res []string
+		for _, r := range rs {
+			s := r.Header.Name.String() + " " + r.Header.Type.String()[len("Type"):]
+			switch b := r.Body.(type) {
+			case *dnsmessage.PTRResource:
+				s += " " + b.PTR.String()
+			case *dnsmessage.SRVResource:
+				s += " " + net.JoinHostPort(b.Target.String(), "8080")
+			case *dnsmessage.TXTResource:
+				s += " " + b.TXT[len(b.TXT)-1]
+			case *dnsmessage.AResource:
+				s += " " + net.IP(b.A[:]).String()
+			case *dnsmessage.AAAAResource:
+				s += " " + net.IP(b.AAAA[:]).String()
+			}
+			res = append(res, s)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name        string
+		typ         dnsmessage.Type
+		answers     []string
+		additionals []string
+	}{
+		{"_http._tcp.local.", dnsmessage.TypePTR,
+			[]string{"_http._tcp.local. PTR kitchenthing._http._tcp.local."},
+			[]string{
+				"kitchenthing._http._tcp.local. SRV kitchenthing.local.:8080",
+				"kitchenthing._http._tcp.local. TXT preview=http://kitchenthing.local:8080/api/frame/bw.png",
+				"kitchenthing.local. A 192.0.2.7",
+				"kitchenthing.local. A 192.0.2.8",
+				"kitchenthing.local. AAAA fe80::7",
+			}},
+		{"KitchenThing.local.", dnsmessage.TypeA, []string{"kitchenthing.local. A 192.0.2.7", "kitchenthing.local. A 192.0.2.8"}, nil},
+		{"kitchenthing.local.", dnsmessage.TypeAAAA, []string{"kitchenthing.local. AAAA fe80::7"}, nil},
+		{"_services._dns-sd._udp.local.", dnsmessage.TypePTR, []string{"_services._dns-sd._udp.local. PTR _http._tcp.local."}, nil},
+		{"printer.local.", dnsmessage.TypeA, nil, nil},
+		{"_ipp._tcp.local.", dnsmessage.TypePTR, nil, nil},
+	}
+	for _, test := range tests {
+		raw, ok, err := m.respond(query(test.name, test.typ), false)
+		if err != nil {
+			t.Errorf("respond(%s %v): %v", test.name, test.typ, err)
+			continue
+		}
+		if !ok {
+			if test.answers != nil {
+				t.Errorf("respond(%s %v) gave no response", test.name, test.typ)
+			}
+			continue
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(raw); err != nil {
+			t.Errorf("Unpacking response to %s %v: %v", test.name, test.typ, err)
+			continue
+		}
+		if !msg.Header.Response || msg.Header.ID != 0 || len(msg.Questions) != 0 {
+			t.Errorf("Response to %s %v has header %+v and %d questions, want a multicast response", test.name, test.typ, msg.Header, len(msg.Questions))
+		}
+		if got := describe(msg.Answers); !reflect.DeepEqual(got, test.answers) {
+			t.Errorf("Answers to %s %v:\n got %q\nwant %q", test.name, test.typ, got, test.answers)
+		}
+		if got := describe(msg.Additionals); !reflect.DeepEqual(got, test.additionals) {
+			t.Errorf("Additionals for %s %v:\n got %q\nwant %q", test.name, test.typ, got, test.additionals)
+		}
+	}
+
+	// Legacy unicast queries get a conventional reply.
+	raw, ok, err := m.respond(query("kitchenthing.local.", dnsmessage.TypeA), true)
+	if err != nil || !ok {
+		t.Fatalf("Legacy respond: %t, %v", ok, err)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(raw); err != nil {
+		t.Fatalf("Unpacking legacy response: %v", err)
+	}
+	if msg.Header.ID != 42 || len(msg.Questions) != 1 || msg.Answers[0].Header.TTL != 10 {
+		t.Errorf("Legacy response has ID %d, %d questions and TTL %d; want 42, 1 and 10", msg.Header.ID, len(msg.Questions), msg.Answers[0].Header.TTL)
+	}
+}
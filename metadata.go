@@ -0,0 +1,195 @@
+package main
+
+// Which metadata labels (such as m:dd) are acted on in which projects.
+// Some are handy in one project but dangerous in another, such as deleting
+// duplicates, which suits a shopping list better than a list of work to do.
+//
+// Further metadata labels can be defined in the config by rules,
+// which say what to do with tasks that have them.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/dsymonds/todoist"
+)
+
+// metadataLabels are the metadata labels that ApplyMetadata acts on.
+var metadataLabels = map[string]bool{
+	"m:uf":  true, // unassign future tasks
+	"m:dd":  true, // delete duplicates
+	"m:rem": true, // add reminders
+}
+
+type MetadataConfig struct {
+	// Disable lists metadata labels not to act on, except in projects that enable them.
+	Disable []string `yaml:"disable"`
+
+	// Projects changes which metadata labels are acted on in particular projects, by name.
+	Projects map[string]MetadataProjectConfig `yaml:"projects"`
+
+	// Rules define further metadata labels.
+	Rules []MetadataRule `yaml:"rules"`
+}
+
+type MetadataProjectConfig struct {
+	Enable  []string `yaml:"enable"`
+	Disable []string `yaml:"disable"`
+}
+
+// MetadataRule defines a metadata label by what to do with tasks that have it.
+// The label is removed once everything is done, so each task is acted on once.
+type MetadataRule struct {
+	// Label is the metadata label, or a pattern of them as for path.Match, such as "m:soon-*".
+	Label string `yaml:"label"`
+
+	Due       string   `yaml:"due"`        // due date to set, in Todoist's syntax, such as "tomorrow"
+	AddLabels []string `yaml:"add_labels"` // labels to add
+	Assign    string   `yaml:"assign"`     // who to assign to, by full or first name
+	Project   string   `yaml:"project"`    // project to move to, by name
+}
+
+func (mr MetadataRule) validate() error {
+	if !strings.HasPrefix(mr.Label, "m:") {
+		return fmt.Errorf("label %q does not start with m:", mr.Label)
+	}
+	if _, err := path.Match(mr.Label, ""); err != nil {
+		return fmt.Errorf("bad label pattern %q: %w", mr.Label, err)
+	}
+	for label := range metadataLabels {
+		if ok, _ := path.Match(mr.Label, label); ok {
+			return fmt.Errorf("label %q matches the built-in metadata label %q", mr.Label, label)
+		}
+	}
+	if mr.Due == "" && len(mr.AddLabels) == 0 && mr.Assign == "" && mr.Project == "" {
+		return fmt.Errorf("rule for %q does nothing", mr.Label)
+	}
+	for _, label := range mr.AddLabels {
+		// Otherwise rules could act on each other's tasks, or on their own, indefinitely.
+		if strings.HasPrefix(label, "m:") {
+			return fmt.Errorf("rule for %q adds metadata label %q", mr.Label, label)
+		}
+	}
+	return nil
+}
+
+// rule returns the first rule for a metadata label.
+func (mc MetadataConfig) rule(label string) (MetadataRule, bool) {
+	for _, mr := range mc.Rules {
+		if ok, _ := path.Match(mr.Label, label); ok {
+			return mr, true
+		}
+	}
+	return MetadataRule{}, false
+}
+
+func (mc MetadataConfig) validate() error {
+	for i, mr := range mc.Rules {
+		if err := mr.validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	check := func(where string, labels []string) error {
+		for _, label := range labels {
+			if _, ok := mc.rule(label); !ok && !metadataLabels[label] {
+				return fmt.Errorf("%s: unknown metadata label %q", where, label)
+			}
+		}
+		return nil
+	}
+	if err := check("disable", mc.Disable); err != nil {
+		return err
+	}
+	for proj, pc := range mc.Projects {
+		if err := check("project "+proj, pc.Enable); err != nil {
+			return err
+		}
+		if err := check("project "+proj, pc.Disable); err != nil {
+			return err
+		}
+		for _, label := range pc.Enable {
+			if hasLabel(pc.Disable, label) {
+				return fmt.Errorf("project %s: %q is both enabled and disabled", proj, label)
+			}
+		}
+	}
+	return nil
+}
+
+// enabled reports whether to act on a metadata label in the named project.
+func (mc MetadataConfig) enabled(label, project string) bool {
+	pc := mc.Projects[project]
+	if hasLabel(pc.Disable, label) {
+		return false
+	}
+	return hasLabel(pc.Enable, label) || !hasLabel(mc.Disable, label)
+}
+
+// applyRule does what a rule says to an item with the rule's metadata label.
+func applyRule(ctx context.Context, ts todoistBackend, item todoist.Item, label string, mr MetadataRule, mutate bool) error {
+	td := ts.Data()
+	var projectID, assignee string
+	if mr.Project != "" {
+		for _, p := range td.Projects {
+			if p.Name == mr.Project {
+				projectID = p.ID
+				break
+			}
+		}
+		if projectID == "" {
+			return fmt.Errorf("no project named %q", mr.Project)
+		}
+	}
+	if mr.Assign != "" {
+		for _, c := range td.Collaborators {
+			first, _, _ := strings.Cut(c.FullName, " ")
+			if strings.EqualFold(c.FullName, mr.Assign) || strings.EqualFold(first, mr.Assign) {
+				assignee = c.ID
+				break
+			}
+		}
+		if assignee == "" {
+			return fmt.Errorf("no collaborator named %q", mr.Assign)
+		}
+	}
+	if !mutate {
+		log.Printf("Would apply the rule for %q to %s (%q)...", label, item.ID, item.Content)
+		return nil
+	}
+
+	// The label is removed last, so if anything fails it is all tried again on the next refresh.
+	if projectID != "" && projectID != item.ProjectID {
+		if err := ts.Move(ctx, item.ID, projectID); err != nil {
+			return fmt.Errorf("moving to project %q: %w", mr.Project, err)
+		}
+	}
+	if mr.Due != "" {
+		if err := ts.SetDue(ctx, item.ID, mr.Due); err != nil {
+			return fmt.Errorf("setting due date: %w", err)
+		}
+	}
+	if assignee != "" && (item.Responsible == nil || *item.Responsible != assignee) {
+		if err := ts.Assign(ctx, item, assignee); err != nil {
+			return fmt.Errorf("assigning: %w", err)
+		}
+	}
+	var labels []string
+	for _, l := range item.Labels {
+		if l != label {
+			labels = append(labels, l)
+		}
+	}
+	for _, l := range mr.AddLabels {
+		if !hasLabel(labels, l) {
+			labels = append(labels, l)
+		}
+	}
+	if err := ts.UpdateItem(ctx, item.ID, todoist.ItemUpdates{Labels: &labels}); err != nil {
+		return fmt.Errorf("updating labels: %w", err)
+	}
+	log.Printf("Applied the rule for %q to %q", label, item.Content)
+	return nil
+}
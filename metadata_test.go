@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestApplyMetadataPerProject(t *testing.T) {
+	ft := newFakeTodoist()
+	ft.data.Projects = map[string]todoist.Project{
+		"p1": {ID: "p1", Name: "Groceries"},
+		"p2": {ID: "p2", Name: "Work"},
+		"p3": {ID: "p3", Name: "House"},
+	}
+	ft.data.Items = map[string]todoist.Item{
+		"1": {ID: "1", ProjectID: "p1", Content: "milk", Labels: []string{"m:dd"}},
+		"2": {ID: "2", ProjectID: "p1", Content: "milk", Labels: []string{"m:dd"}},
+		"3": {ID: "3", ProjectID: "p2", Content: "file report", Labels: []string{"m:dd"}},
+		"4": {ID: "4", ProjectID: "p2", Content: "file report", Labels: []string{"m:dd"}},
+		"5": {ID: "5", ProjectID: "p3", Content: "sweep", Labels: []string{"m:dd"}},
+		"6": {ID: "6", ProjectID: "p3", Content: "sweep", Labels: []string{"m:dd"}},
+	}
+	cfg := MetadataConfig{
+		Disable: []string{"m:dd"},
+		Projects: map[string]MetadataProjectConfig{
+			"Groceries": {Enable: []string{"m:dd"}},
+		},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	ApplyMetadata(context.Background(), ft, cfg, true)
+	for id, want := range map[string]bool{"1": true, "2": false, "3": true, "4": true, "5": true, "6": true} {
+		if _, ok := ft.data.Items[id]; ok != want {
+			t.Errorf("After applying metadata, item %s present = %t, want %t", id, ok, want)
+		}
+	}
+}
+
+func TestApplyMetadataRules(t *testing.T) {
+	ft := newFakeTodoist()
+	ft.data.Projects["p2"] = todoist.Project{ID: "p2", Name: "Garden", Shared: true}
+	ft.data.Items = map[string]todoist.Item{
+		"1": {ID: "1", ProjectID: "p1", Content: "mow lawn", Labels: []string{"m:garden", "outside"}},
+		"2": {ID: "2", ProjectID: "p1", Content: "wash car", Labels: []string{"m:soon-2024-06-13"}},
+		"3": {ID: "3", ProjectID: "p1", Content: "feed cat", Labels: []string{"m:unknown"}},
+	}
+	cfg := MetadataConfig{
+		Rules: []MetadataRule{
+			{Label: "m:garden", Project: "Garden", Assign: "david", AddLabels: []string{"outside", "power-hungry"}},
+			{Label: "m:soon-*", Due: "2024-06-13"},
+		},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	// Without mutating, nothing changes.
+	ApplyMetadata(context.Background(), ft, cfg, false)
+	if ft.mutations != 0 {
+		t.Errorf("Without mutating, applying rules made %d changes", ft.mutations)
+	}
+
+	ApplyMetadata(context.Background(), ft, cfg, true)
+	mown := ft.data.Items["1"]
+	sort.Strings(mown.Labels)
+	if mown.ProjectID != "p2" || mown.Responsible == nil || *mown.Responsible != "u1" || !reflect.DeepEqual(mown.Labels, []string{"outside", "power-hungry"}) {
+		t.Errorf("After the m:garden rule, task is %+v", mown)
+	}
+	if washed := ft.data.Items["2"]; washed.Due == nil || washed.Due.Date != "2024-06-13" || len(washed.Labels) != 0 {
+		t.Errorf("After the m:soon-* rule, task is %+v", washed)
+	}
+	if fed := ft.data.Items["3"]; len(fed.Labels) != 1 {
+		t.Errorf("Task with no matching rule has labels %q", fed.Labels)
+	}
+
+	// The labels are gone, so the rules don't act again.
+	ft.mutations = 0
+	ApplyMetadata(context.Background(), ft, cfg, true)
+	if ft.mutations != 0 {
+		t.Errorf("Applying rules again made %d changes", ft.mutations)
+	}
+}
+
+func TestMetadataConfig(t *testing.T) {
+	tests := []struct {
+		cfg MetadataConfig
+		ok  bool
+	}{
+		{MetadataConfig{}, true},
+		{MetadataConfig{Disable: []string{"m:dd", "m:uf"}}, true},
+		{MetadataConfig{Disable: []string{"m:nope"}}, false},
+		{MetadataConfig{Projects: map[string]MetadataProjectConfig{"Work": {Disable: []string{"m:dd"}}}}, true},
+		{MetadataConfig{Projects: map[string]MetadataProjectConfig{"Work": {Enable: []string{"dd"}}}}, false},
+		{MetadataConfig{Projects: map[string]MetadataProjectConfig{"Work": {Enable: []string{"m:dd"}, Disable: []string{"m:dd"}}}}, false},
+		{MetadataConfig{Rules: []MetadataRule{{Label: "m:soon-*", Due: "tomorrow"}}, Disable: []string{"m:soon-1"}}, true},
+		{MetadataConfig{Rules: []MetadataRule{{Label: "soon", Due: "tomorrow"}}}, false},
+		{MetadataConfig{Rules: []MetadataRule{{Label: "m:[", Due: "tomorrow"}}}, false},
+		{MetadataConfig{Rules: []MetadataRule{{Label: "m:d*", Due: "tomorrow"}}}, false}, // matches m:dd
+		{MetadataConfig{Rules: []MetadataRule{{Label: "m:soon"}}}, false},
+		{MetadataConfig{Rules: []MetadataRule{{Label: "m:soon", AddLabels: []string{"m:later"}}}}, false},
+	}
+	for _, test := range tests {
+		err := test.cfg.validate()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%+v.validate() = %v, want ok=%t", test.cfg, err, test.ok)
+		}
+	}
+}
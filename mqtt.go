@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
@@ -13,10 +18,70 @@ import (
 
 const (
 	mqttClientID = "kitchenthing"
+
+	// mqttQueueSize bounds how many publishes are held while the broker is unreachable.
+	mqttQueueSize = 64
 )
 
+// MQTTPublishConfig configures how messages are published.
+// Anything not set for a specific topic falls back to the defaults,
+// and then to QoS 0 with retain set.
+type MQTTPublishConfig struct {
+	MQTTPublishOptions `yaml:",inline"` // defaults
+
+	Topics map[string]MQTTPublishOptions `yaml:"topics"` // keyed by topic
+}
+
+type MQTTPublishOptions struct {
+	QoS    *int  `yaml:"qos"`
+	Retain *bool `yaml:"retain"`
+}
+
+func (opts MQTTPublishOptions) validate() error {
+	if opts.QoS != nil && (*opts.QoS < 0 || *opts.QoS > 2) {
+		return fmt.Errorf("QoS %d out of range [0,2]", *opts.QoS)
+	}
+	return nil
+}
+
+// options returns the QoS and retain flag to use for publishing to topic.
+func (pc MQTTPublishConfig) options(topic string) (qos byte, retain bool) {
+	qos, retain = 0, true
+	for _, opts := range []MQTTPublishOptions{pc.MQTTPublishOptions, pc.Topics[topic]} {
+		if opts.QoS != nil {
+			qos = byte(*opts.QoS)
+		}
+		if opts.Retain != nil {
+			retain = *opts.Retain
+		}
+	}
+	return
+}
+
 type MQTT struct {
-	cm *autopaho.ConnectionManager
+	cm       *autopaho.ConnectionManager
+	pub      MQTTPublishConfig
+	alerts   bool // whether Alertmanager is configured
+	fairness bool // whether the fairness report is enabled
+
+	// pubMu serialises publishes, so queued messages are
+	// flushed before anything newer is published.
+	pubMu sync.Mutex
+
+	mu       sync.Mutex
+	handlers map[string]func(payload []byte) // keyed by topic
+	up       bool
+	changed  time.Time       // when up last changed
+	queue    []*paho.Publish // at most one per topic
+	dropped  int             // publishes lost to a full queue
+}
+
+// MQTTStatus is a snapshot of the MQTT connection state.
+type MQTTStatus struct {
+	Connected bool      `json:"connected"`
+	Since     time.Time `json:"since,omitempty"`
+	Queued    int       `json:"queued"`
+	Dropped   int       `json:"dropped"`
 }
 
 func NewMQTT(cfg Config) (*MQTT, error) {
@@ -29,7 +94,21 @@ func NewMQTT(cfg Config) (*MQTT, error) {
 		return nil, fmt.Errorf("parsing MQTT broker addr %q: %v", cfg.MQTT, err)
 	}
 
-	mqtt := &MQTT{}
+	if err := cfg.MQTTPublish.validate(); err != nil {
+		return nil, fmt.Errorf("bad MQTT publish config: %w", err)
+	}
+	for topic, opts := range cfg.MQTTPublish.Topics {
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("bad MQTT publish config for %s: %w", topic, err)
+		}
+	}
+
+	mqtt := &MQTT{
+		pub:      cfg.MQTTPublish,
+		alerts:   len(cfg.alertmanagers()) > 0,
+		fairness: cfg.Fairness.Enabled,
+		handlers: make(map[string]func([]byte)),
+	}
 
 	// Ensure OnConnectionUp won't race us.
 	initc := make(chan int)
@@ -41,11 +120,17 @@ func NewMQTT(cfg Config) (*MQTT, error) {
 		KeepAlive:  10, // seconds
 		OnConnectionUp: func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
 			log.Printf("MQTT connection up")
-			<-initc          // wait until NewMQTT returns
-			mqtt.discovery() // TODO: only once?
+			<-initc // wait until NewMQTT returns
+			mqtt.setUp(true)
+			// The broker may have restarted without persistence,
+			// so always resend discovery and resubscribe.
+			mqtt.discovery()
+			mqtt.subscribeAll()
+			mqtt.flush()
 		},
 		OnConnectError: func(err error) {
 			//log.Printf("Connection error: %v", err)
+			mqtt.setUp(false)
 		},
 		//PahoErrors: pahoLogger{log, "ERROR"},
 
@@ -53,7 +138,17 @@ func NewMQTT(cfg Config) (*MQTT, error) {
 
 		ClientConfig: paho.ClientConfig{
 			ClientID: mqttClientID,
-			// TODO: need OnClientError/OnServerDisconnect?
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				mqtt.dispatch,
+			},
+			OnClientError: func(err error) {
+				log.Printf("MQTT connection lost: %v", err)
+				mqtt.setUp(false)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				log.Printf("MQTT server disconnected (reason %d)", d.ReasonCode)
+				mqtt.setUp(false)
+			},
 		},
 	})
 	if err != nil {
@@ -63,21 +158,196 @@ func NewMQTT(cfg Config) (*MQTT, error) {
 	return mqtt, nil
 }
 
+func (m *MQTT) setUp(up bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.up != up {
+		m.up = up
+		m.changed = time.Now()
+	}
+}
+
+// Status reports the current connection state.
+func (m *MQTT) Status() MQTTStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MQTTStatus{
+		Connected: m.up,
+		Since:     m.changed,
+		Queued:    len(m.queue),
+		Dropped:   m.dropped,
+	}
+}
+
+// publish publishes a message with the configured QoS and retain flag.
+// If the connection is down, the message is queued until it comes back up.
+func (m *MQTT) publish(topic string, payload []byte) error {
+	m.pubMu.Lock()
+	defer m.pubMu.Unlock()
+
+	qos, retain := m.pub.options(topic)
+	pub := &paho.Publish{
+		QoS:     qos,
+		Retain:  retain,
+		Topic:   topic,
+		Payload: payload,
+	}
+	_, err := m.cm.Publish(context.Background(), pub)
+	if errors.Is(err, autopaho.ConnectionDownError) {
+		m.setUp(false)
+		m.enqueue(pub)
+		return nil
+	}
+	return err
+}
+
+func (m *MQTT) enqueue(pub *paho.Publish) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Everything is retained state, so only the latest message per topic matters.
+	for i, q := range m.queue {
+		if q.Topic == pub.Topic {
+			m.queue[i] = pub
+			return
+		}
+	}
+	if len(m.queue) >= mqttQueueSize {
+		m.queue = m.queue[1:]
+		m.dropped++
+	}
+	m.queue = append(m.queue, pub)
+}
+
+// flush publishes everything queued while the connection was down.
+func (m *MQTT) flush() {
+	m.pubMu.Lock()
+	defer m.pubMu.Unlock()
+
+	m.mu.Lock()
+	queue := m.queue
+	m.queue = nil
+	m.mu.Unlock()
+
+	for i, pub := range queue {
+		_, err := m.cm.Publish(context.Background(), pub)
+		if errors.Is(err, autopaho.ConnectionDownError) {
+			// Down again already; keep the rest for next time.
+			for _, pub := range queue[i:] {
+				m.enqueue(pub)
+			}
+			return
+		}
+		if err != nil {
+			log.Printf("MQTT publishing queued message to %s: %v", pub.Topic, err)
+		}
+	}
+	if len(queue) > 0 {
+		log.Printf("MQTT published %d queued messages", len(queue))
+	}
+}
+
+// Handle arranges for fn to be called with the payload of each message published to topic.
+// The subscription is renewed whenever the connection comes up.
+func (m *MQTT) Handle(topic string, fn func(payload []byte)) {
+	m.mu.Lock()
+	m.handlers[topic] = fn
+	m.mu.Unlock()
+
+	m.subscribe(topic)
+}
+
+func (m *MQTT) subscribeAll() {
+	m.mu.Lock()
+	var topics []string
+	for topic := range m.handlers {
+		topics = append(topics, topic)
+	}
+	m.mu.Unlock()
+
+	for _, topic := range topics {
+		m.subscribe(topic)
+	}
+}
+
+func (m *MQTT) subscribe(topic string) {
+	_, err := m.cm.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: topic, QoS: 0},
+		},
+	})
+	if errors.Is(err, autopaho.ConnectionDownError) {
+		// We'll subscribe when the connection comes up.
+		return
+	}
+	if err != nil {
+		log.Printf("MQTT subscribing to %s: %v", topic, err)
+	}
+}
+
+func (m *MQTT) dispatch(pr paho.PublishReceived) (bool, error) {
+	m.mu.Lock()
+	fn, ok := m.handlers[pr.Packet.Topic]
+	m.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	fn(pr.Packet.Payload)
+	return true, nil
+}
+
 func (m *MQTT) discovery() {
 	// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
 
 	ctx := context.Background()
-	_, err := m.cm.Publish(ctx, &paho.Publish{
-		QoS:     0, // at most once
-		Retain:  true,
-		Topic:   "homeassistant/sensor/todoist/power_hungry_pending_count/config",
-		Payload: []byte(mqttDiscoveryPayload),
-	})
-	if err != nil {
-		log.Printf("Publishing discovery message: %v", err)
+	configs := []struct {
+		topic, payload string
+	}{
+		{"homeassistant/sensor/todoist/power_hungry_pending_count/config", mqttDiscoveryPayload},
+		{"homeassistant/switch/kitchenthing/accessibility_mode/config", mqttAccessibilityDiscoveryPayload},
+		{"homeassistant/text/kitchenthing/notes/config", mqttNotesDiscoveryPayload},
+		{"homeassistant/sensor/kitchenthing/panel_refreshes/config", mqttRefreshesDiscoveryPayload},
+		{"homeassistant/sensor/kitchenthing/hidden_tasks/config", mqttHiddenDiscoveryPayload},
+		{"homeassistant/binary_sensor/kitchenthing/overdue_p1/config", mqttOverdueP1DiscoveryPayload},
+	}
+	if m.alerts {
+		configs = append(configs, struct{ topic, payload string }{
+			"homeassistant/sensor/kitchenthing/alerts/config", mqttAlertsDiscoveryPayload,
+		})
+	}
+	if m.fairness {
+		configs = append(configs, struct{ topic, payload string }{
+			"homeassistant/binary_sensor/todoist/fairness_lopsided/config", mqttFairnessDiscoveryPayload,
+		})
+	}
+	for _, def := range hygieneMetricDefs {
+		configs = append(configs, struct{ topic, payload string }{
+			"homeassistant/sensor/todoist/hygiene_" + def.name + "/config",
+			fmt.Sprintf(mqttHygieneDiscoveryTemplate, def.help, def.name, mqttHygieneTopic(def.name)),
+		})
+	}
+	for _, c := range configs {
+		qos, retain := m.pub.options(c.topic)
+		_, err := m.cm.Publish(ctx, &paho.Publish{
+			QoS:     qos,
+			Retain:  retain,
+			Topic:   c.topic,
+			Payload: []byte(c.payload),
+		})
+		if err != nil {
+			log.Printf("Publishing discovery message to %s: %v", c.topic, err)
+		}
 	}
 }
 
+const mqttDiscoveryDevice = `{
+    "name": "Todoist meta-device",
+    "manufacturer": "Dave Industries",
+    "model": "kitchenthing",
+    "suggested_area": "Kitchen",
+    "identifiers": ["todoist"]
+  }`
+
 // Constructed manually, and with a lot of trial and error.
 // The HA docs are not clear.
 const mqttDiscoveryPayload = `
@@ -90,36 +360,295 @@ const mqttDiscoveryPayload = `
   "state_topic": "` + mqttUpdateTopic + `",
   "unit_of_measurement": "tasks",
   "icon": "mdi:checkbox-marked-circle-auto-outline",
-  "device": {
-    "name": "Todoist meta-device",
-    "manufacturer": "Dave Industries",
-    "model": "kitchenthing",
-    "suggested_area": "Kitchen",
-    "identifiers": ["todoist"]
-  }
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttAccessibilityDiscoveryPayload = `
+{
+  "name": "accessibility mode",
+  "object_id": "kitchenthing_accessibility_mode",
+  "unique_id": "kitchenthing_accessibility_mode",
+  "state_topic": "` + mqttAccessibilityStateTopic + `",
+  "command_topic": "` + mqttAccessibilityCommandTopic + `",
+  "icon": "mdi:human",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttNotesDiscoveryPayload = `
+{
+  "name": "notes",
+  "object_id": "kitchenthing_notes",
+  "unique_id": "kitchenthing_notes",
+  "state_topic": "` + mqttNotesStateTopic + `",
+  "command_topic": "` + mqttNotesCommandTopic + `",
+  "max": 255,
+  "icon": "mdi:note-text",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttRefreshesDiscoveryPayload = `
+{
+  "name": "panel refreshes",
+  "object_id": "kitchenthing_panel_refreshes",
+  "unique_id": "kitchenthing_panel_refreshes",
+  "state_class": "total_increasing",
+  "state_topic": "` + mqttRefreshesTopic + `",
+  "unit_of_measurement": "refreshes",
+  "icon": "mdi:refresh",
+  "entity_category": "diagnostic",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttHiddenDiscoveryPayload = `
+{
+  "name": "hidden tasks",
+  "object_id": "kitchenthing_hidden_tasks",
+  "unique_id": "kitchenthing_hidden_tasks",
+  "state_class": "measurement",
+  "state_topic": "` + mqttHiddenCountTopic + `",
+  "json_attributes_topic": "` + mqttHiddenTopic + `",
+  "unit_of_measurement": "tasks",
+  "icon": "mdi:eye-off",
+  "entity_category": "diagnostic",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttOverdueP1DiscoveryPayload = `
+{
+  "name": "overdue P1 task",
+  "object_id": "kitchenthing_overdue_p1",
+  "unique_id": "kitchenthing_overdue_p1",
+  "state_topic": "` + mqttOverdueP1Topic + `",
+  "device_class": "problem",
+  "icon": "mdi:alert-circle",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttAlertsDiscoveryPayload = `
+{
+  "name": "displayed alerts",
+  "object_id": "kitchenthing_alerts",
+  "unique_id": "kitchenthing_alerts",
+  "state_class": "measurement",
+  "state_topic": "` + mqttAlertsCountTopic + `",
+  "json_attributes_topic": "` + mqttAlertsTopic + `",
+  "unit_of_measurement": "alerts",
+  "icon": "mdi:alert",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+const mqttFairnessDiscoveryPayload = `
+{
+  "name": "task split lopsided",
+  "object_id": "todoist_fairness_lopsided",
+  "unique_id": "todoist_fairness_lopsided",
+  "state_topic": "` + mqttFairnessLopsidedTopic + `",
+  "json_attributes_topic": "` + mqttFairnessTopic + `",
+  "icon": "mdi:scale-unbalanced",
+  "device": ` + mqttDiscoveryDevice + `
+}
+`
+
+// Expanded with the description, name and state topic.
+const mqttHygieneDiscoveryTemplate = `
+{
+  "name": %q,
+  "object_id": "todoist_hygiene_%[2]s",
+  "unique_id": "todoist_hygiene_%[2]s",
+  "state_class": "measurement",
+  "retain": true,
+  "state_topic": %[3]q,
+  "unit_of_measurement": "tasks",
+  "icon": "mdi:broom",
+  "device": ` + mqttDiscoveryDevice + `
 }
 `
 
-const mqttUpdateTopic = "todoist/power_hungry_pending_count/value"
+func mqttHygieneTopic(name string) string { return "todoist/hygiene/" + name + "/value" }
+
+const (
+	mqttUpdateTopic = "todoist/power_hungry_pending_count/value"
+
+	mqttRefreshesTopic = "kitchenthing/panel/refreshes"
+	mqttFrameTopic     = "kitchenthing/panel/frame"
+
+	mqttAlertsCountTopic = "kitchenthing/alerts/count"
+	mqttAlertsTopic      = "kitchenthing/alerts/json"
+
+	mqttHiddenCountTopic = "kitchenthing/tasks/hidden/count"
+	mqttHiddenTopic      = "kitchenthing/tasks/hidden/json"
+
+	mqttOverdueP1Topic = "kitchenthing/tasks/overdue_p1"
+
+	mqttFairnessTopic         = "todoist/fairness/json"
+	mqttFairnessLopsidedTopic = "todoist/fairness/lopsided"
+
+	mqttAccessibilityStateTopic   = "kitchenthing/accessibility_mode/state"
+	mqttAccessibilityCommandTopic = "kitchenthing/accessibility_mode/set"
+
+	mqttNotesStateTopic   = "kitchenthing/notes/state"
+	mqttNotesCommandTopic = "kitchenthing/notes/set"
+)
 
 func (m *MQTT) PublishUpdate(tasks []renderableTask) error {
-	ctx := context.Background()
+	phpc := powerHungryPending(tasks)
+	//log.Printf("Publishing %d to MQTT %s", phpc, mqttUpdateTopic)
+	return m.publish(mqttUpdateTopic, []byte(strconv.Itoa(phpc)))
+}
 
-	// Count number of tasks that have the "power-hungry" label,
-	// and do *not* have the "in-progress" label.
-	phpc := 0
+// powerHungryPending counts the tasks, including subtasks, that have the "power-hungry" label,
+// and do *not* have the "in-progress" label.
+func powerHungryPending(tasks []renderableTask) int {
+	return countTasks(tasks, func(t renderableTask) bool { return t.PowerHungry && !t.InProgress })
+}
+
+// PublishRefreshes publishes the lifetime count of panel refreshes.
+func (m *MQTT) PublishRefreshes(n int) error {
+	return m.publish(mqttRefreshesTopic, []byte(strconv.Itoa(n)))
+}
+
+// PublishFrame publishes the checksum of the frame on the panel. Mirrors of the panel
+// can subscribe to it to know when to fetch /api/frame/bw.png and red.png again,
+// so it is only published once the panel has finished refreshing.
+func (m *MQTT) PublishFrame(checksum string) error {
+	return m.publish(mqttFrameTopic, []byte(checksum))
+}
+
+// PublishAlerts publishes the alerts being displayed,
+// both as a count and as a JSON object for use as sensor attributes.
+func (m *MQTT) PublishAlerts(alerts []Alert) error {
+	type alertJSON struct {
+		Fingerprint string `json:"fingerprint"`
+		Origin      string `json:"origin,omitempty"`
+		Summary     string `json:"summary"`
+		Description string `json:"description,omitempty"`
+	}
+	payload := struct {
+		Count  int         `json:"count"`
+		Alerts []alertJSON `json:"alerts"`
+	}{
+		Count:  len(alerts),
+		Alerts: []alertJSON{}, // not null
+	}
+	for _, a := range alerts {
+		payload.Alerts = append(payload.Alerts, alertJSON{a.Fingerprint, a.Origin, a.Summary, a.Description})
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding alerts: %w", err)
+	}
+	// Publish the attributes first, so they are current when the count changes.
+	if err := m.publish(mqttAlertsTopic, raw); err != nil {
+		return err
+	}
+	return m.publish(mqttAlertsCountTopic, []byte(strconv.Itoa(len(alerts))))
+}
+
+// PublishHidden publishes the tasks that didn't fit on the display,
+// both as a count and as a JSON object for use as sensor attributes.
+func (m *MQTT) PublishHidden(h hiddenTasks) error {
+	if h.ByPriority == nil {
+		h.ByPriority = map[string]int{} // not null
+	}
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("encoding hidden tasks: %w", err)
+	}
+	if err := m.publish(mqttHiddenTopic, raw); err != nil {
+		return err
+	}
+	return m.publish(mqttHiddenCountTopic, []byte(strconv.Itoa(h.Count)))
+}
+
+// PublishOverdueP1 publishes whether any P1 task is overdue.
+func (m *MQTT) PublishOverdueP1(tasks []renderableTask) error {
+	state := "OFF"
+	if anyOverdueP1(tasks) {
+		state = "ON"
+	}
+	return m.publish(mqttOverdueP1Topic, []byte(state))
+}
+
+// anyOverdueP1 reports whether any of the tasks or their subtasks is an overdue P1 task.
+func anyOverdueP1(tasks []renderableTask) bool {
 	for _, t := range tasks {
-		if t.PowerHungry && !t.InProgress {
-			phpc++
+		if t.Priority == 4 && t.Overdue {
+			return true
+		}
+		if anyOverdueP1(t.Subtasks) {
+			return true
 		}
 	}
+	return false
+}
 
-	//log.Printf("Publishing %d to MQTT %s", phpc, mqttUpdateTopic)
-	_, err := m.cm.Publish(ctx, &paho.Publish{
-		QoS:     0, // at most once
-		Retain:  true,
-		Topic:   mqttUpdateTopic,
-		Payload: []byte(strconv.Itoa(phpc)),
+// PublishFairness publishes the fairness report, both as whether it is lopsided
+// and as a JSON object for use as sensor attributes.
+func (m *MQTT) PublishFairness(rep fairnessReport) error {
+	raw, err := json.Marshal(rep)
+	if err != nil {
+		return fmt.Errorf("encoding fairness report: %w", err)
+	}
+	if err := m.publish(mqttFairnessTopic, raw); err != nil {
+		return err
+	}
+	state := "OFF"
+	if rep.Lopsided {
+		state = "ON"
+	}
+	return m.publish(mqttFairnessLopsidedTopic, []byte(state))
+}
+
+// PublishAccessibilityMode publishes the current state of the accessibility mode switch.
+func (m *MQTT) PublishAccessibilityMode(on bool) error {
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	return m.publish(mqttAccessibilityStateTopic, []byte(state))
+}
+
+// HandleAccessibilityMode arranges for set to be called when the accessibility mode
+// is switched via MQTT.
+func (m *MQTT) HandleAccessibilityMode(set func(on bool)) {
+	m.Handle(mqttAccessibilityCommandTopic, func(payload []byte) {
+		switch s := strings.TrimSpace(string(payload)); {
+		case strings.EqualFold(s, "ON"):
+			set(true)
+		case strings.EqualFold(s, "OFF"):
+			set(false)
+		default:
+			log.Printf("MQTT: ignoring unknown accessibility mode command %q", s)
+		}
 	})
-	return err
+}
+
+// PublishNotes publishes the household notes.
+func (m *MQTT) PublishNotes(notes string) error {
+	return m.publish(mqttNotesStateTopic, []byte(notes))
+}
+
+// HandleNotes arranges for set to be called when the household notes are set via MQTT.
+func (m *MQTT) HandleNotes(set func(notes string)) {
+	m.Handle(mqttNotesCommandTopic, func(payload []byte) {
+		set(string(payload))
+	})
+}
+
+// PublishHygiene publishes the Todoist hygiene metrics.
+func (m *MQTT) PublishHygiene(h hygieneMetrics) error {
+	for _, def := range hygieneMetricDefs {
+		err := m.publish(mqttHygieneTopic(def.name), []byte(strconv.Itoa(def.get(h))))
+		if err != nil {
+			return fmt.Errorf("publishing %s: %w", def.name, err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMQTTPublishOptions(t *testing.T) {
+	const raw = `
+qos: 1
+topics:
+  todoist/power_hungry_pending_count/value:
+    retain: false
+  kitchenthing/accessibility_mode/state:
+    qos: 2
+`
+	var pc MQTTPublishConfig
+	if err := yaml.UnmarshalStrict([]byte(raw), &pc); err != nil {
+		t.Fatalf("Parsing config: %v", err)
+	}
+	tests := []struct {
+		topic  string
+		qos    byte
+		retain bool
+	}{
+		{"todoist/hygiene/no_due_date/value", 1, true},
+		{mqttUpdateTopic, 1, false},
+		{mqttAccessibilityStateTopic, 2, true},
+	}
+	for _, test := range tests {
+		qos, retain := pc.options(test.topic)
+		if qos != test.qos || retain != test.retain {
+			t.Errorf("options(%q) = %d, %t, want %d, %t", test.topic, qos, retain, test.qos, test.retain)
+		}
+	}
+
+	var zero MQTTPublishConfig
+	if qos, retain := zero.options(mqttUpdateTopic); qos != 0 || !retain {
+		t.Errorf("Default options = %d, %t, want 0, true", qos, retain)
+	}
+}
+
+func TestPowerHungryPending(t *testing.T) {
+	tasks := []renderableTask{
+		{Title: "dishwasher", PowerHungry: true},
+		{Title: "washing", PowerHungry: true, InProgress: true},
+		{Title: "tidy up", Subtasks: []renderableTask{
+			{Title: "run robot vacuum", PowerHungry: true},
+			{Title: "put away toys"},
+		}},
+	}
+	if got := powerHungryPending(tasks); got != 2 {
+		t.Errorf("powerHungryPending = %d, want 2, counting the subtask", got)
+	}
+}
+
+func TestAnyOverdueP1(t *testing.T) {
+	tests := []struct {
+		desc  string
+		tasks []renderableTask
+		want  bool
+	}{
+		{"none", nil, false},
+		{"P1 not overdue", []renderableTask{{Priority: 4}}, false},
+		{"overdue P2", []renderableTask{{Priority: 3, Overdue: true}}, false},
+		{"overdue P1", []renderableTask{{Priority: 3}, {Priority: 4, Overdue: true}}, true},
+		{"overdue P1 subtask", []renderableTask{{Priority: 1, Subtasks: []renderableTask{{Priority: 4, Overdue: true}}}}, true},
+	}
+	for _, test := range tests {
+		if got := anyOverdueP1(test.tasks); got != test.want {
+			t.Errorf("%s: anyOverdueP1 = %t, want %t", test.desc, got, test.want)
+		}
+	}
+}
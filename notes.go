@@ -0,0 +1,70 @@
+package main
+
+// A shared scratchpad of household notes, such as "out of milk, plumber coming Thursday",
+// kept apart from Todoist. They are shown in the footer, and can be edited
+// in the web UI or via MQTT.
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNotesLen is the longest the notes can be, in bytes.
+// Home Assistant text entities can't be any longer.
+const maxNotesLen = 255
+
+// cleanNotes tidies notes for storing: dropping blank lines and surrounding space,
+// and truncating them to maxNotesLen.
+func cleanNotes(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, cleanString(line))
+		}
+	}
+	s = strings.Join(lines, "\n")
+	for len(s) > maxNotesLen {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
+
+// noteLines splits the notes into lines for display.
+func noteLines(notes string) []string {
+	if notes == "" {
+		return nil
+	}
+	return strings.Split(notes, "\n")
+}
+
+// setNotes replaces the notes, and wakes the main loop to show them.
+func (s *server) setNotes(notes, via string) error {
+	notes = cleanNotes(notes)
+	err := s.state.Update(func(st *State) { st.Notes = notes })
+	if err != nil {
+		return err
+	}
+	log.Printf("Notes set via %s to %q", via, notes)
+	s.wake.Wake("notes set via "+via, false)
+	return nil
+}
+
+func (s *server) serveNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// In theory we should do an XSRF check here, but the threat model isn't worth the effort.
+
+	if err := s.setNotes(r.PostFormValue("notes"), "web UI"); err != nil {
+		log.Printf("Saving notes: %v", err)
+		http.Error(w, "Internal error: "+err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanNotes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"out of milk", "out of milk"},
+		{"  out of milk \r\n\r\n plumber Thursday\n", "out of milk\nplumber Thursday"},
+		{"garden 12℃", "garden 12℃"}, // substituted when drawn
+		{strings.Repeat("é", 200), strings.Repeat("é", maxNotesLen/2)},
+	}
+	for _, test := range tests {
+		if got := cleanNotes(test.in); got != test.want {
+			t.Errorf("cleanNotes(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestServeNotes(t *testing.T) {
+	state, _ := loadState("")
+	s := &server{state: state}
+
+	form := url.Values{"notes": {"out of milk\r\nplumber Thursday"}}
+	req := httptest.NewRequest("POST", "/notes", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /notes gave %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+
+	var notes string
+	state.View(func(st *State) { notes = st.Notes })
+	if got, want := noteLines(notes), []string{"out of milk", "plumber Thursday"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("After POST /notes, note lines are %q, want %q", got, want)
+	}
+}
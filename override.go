@@ -0,0 +1,50 @@
+package main
+
+// Arbitrary images shown for a while instead of the normal layout.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+// imageOverride is an image to show instead of the normal layout until a deadline.
+type imageOverride struct {
+	img   *image.Paletted
+	until time.Time
+}
+
+// ditherImage fits src within an image of the given size,
+// dithered to the panel's colours on a white background.
+func ditherImage(src image.Image, size image.Point) *image.Paletted {
+	dst := image.NewPaletted(image.Rectangle{Max: size}, staticPalette)
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	drawImage(dst, src, ditherColour)
+	return dst
+}
+
+// ShowImage arranges for img to be displayed instead of the normal layout until the given time.
+// It takes effect from the next refresh.
+func (r *refresher) ShowImage(img *image.Paletted, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.override = imageOverride{img: img, until: until}
+}
+
+// ClearImage cancels any image set by ShowImage.
+func (r *refresher) ClearImage() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.override = imageOverride{}
+}
+
+// activeOverride returns the image to show instead of the normal layout, if any.
+func (r *refresher) activeOverride(now time.Time) *image.Paletted {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.override.img == nil || !now.Before(r.override.until) {
+		return nil
+	}
+	return r.override.img
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestImageOverride(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 160, 96))
+	draw.Draw(src, src.Bounds(), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+	img := ditherImage(src, image.Pt(80, 48))
+	if img.At(40, 24) != color.Black {
+		t.Errorf("Dithered black image has %v in the middle", img.At(40, 24))
+	}
+
+	r := &refresher{}
+	now := time.Now()
+	r.ShowImage(img, now.Add(time.Minute))
+	if r.activeOverride(now) != img {
+		t.Errorf("Override not active before deadline")
+	}
+	if r.activeOverride(now.Add(time.Minute)) != nil {
+		t.Errorf("Override still active at deadline")
+	}
+	r.ClearImage()
+	if r.activeOverride(now) != nil {
+		t.Errorf("Override still active after ClearImage")
+	}
+}
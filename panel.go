@@ -0,0 +1,100 @@
+package main
+
+// The panel's geometry, which sets the size of everything that is drawn.
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+type PanelConfig struct {
+	// Width and Height are in pixels, in the orientation the panel is used.
+	// They default to 800x480, the Waveshare 7.5" panel in landscape,
+	// or 480x800 if it is rotated to portrait.
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+
+	// Rotation is how many degrees clockwise the panel is mounted from its usual landscape
+	// orientation: 0, 90, 180 or 270.
+	Rotation int `yaml:"rotation"`
+
+	// DPI is the panel's pixel density, which sets how big text is.
+	// Alternatively, set Diagonal (the size of the active area, in inches)
+	// to have it worked out. It defaults to 125, which suits the Waveshare 7.5" panel.
+	DPI      float64 `yaml:"dpi"`
+	Diagonal float64 `yaml:"diagonal"`
+}
+
+func (pc PanelConfig) validate() error {
+	if (pc.Width == 0) != (pc.Height == 0) {
+		return fmt.Errorf("set both width and height, or neither")
+	}
+	switch pc.Rotation {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("rotation %d must be 0, 90, 180 or 270", pc.Rotation)
+	}
+	size := pc.nativeSize()
+	// The controller's resolution setting has 10 bits for each, and sources come in groups of 8.
+	if size.X <= 0 || size.X > 1016 || size.X%8 != 0 {
+		return fmt.Errorf("width %d must be a multiple of 8 up to 1016", size.X)
+	}
+	if size.Y <= 0 || size.Y > 1023 {
+		return fmt.Errorf("height %d must be between 1 and 1023", size.Y)
+	}
+	if pc.DPI < 0 || pc.Diagonal < 0 {
+		return fmt.Errorf("dpi and diagonal can't be negative")
+	}
+	if pc.DPI != 0 && pc.Diagonal != 0 {
+		return fmt.Errorf("set only one of dpi and diagonal")
+	}
+	return nil
+}
+
+// size returns the panel's size in pixels, in the orientation it is used.
+func (pc PanelConfig) size() image.Point {
+	if pc.Width == 0 && pc.Height == 0 {
+		return pc.rotateSize(image.Pt(800, 480))
+	}
+	return image.Pt(pc.Width, pc.Height)
+}
+
+// nativeSize returns the panel's size in pixels, in the controller's orientation.
+func (pc PanelConfig) nativeSize() image.Point {
+	return pc.rotateSize(pc.size())
+}
+
+// rotateSize swaps the width and height of size if the panel is in portrait.
+func (pc PanelConfig) rotateSize(size image.Point) image.Point {
+	if pc.Rotation == 90 || pc.Rotation == 270 {
+		return image.Pt(size.Y, size.X)
+	}
+	return size
+}
+
+// toNative maps a point as drawn to the same point in the controller's orientation.
+func (pc PanelConfig) toNative(x, y int) (int, int) {
+	native := pc.nativeSize()
+	switch pc.Rotation {
+	case 90:
+		return y, native.Y - 1 - x
+	case 180:
+		return native.X - 1 - x, native.Y - 1 - y
+	case 270:
+		return native.X - 1 - y, x
+	}
+	return x, y
+}
+
+// dpi returns the panel's pixel density.
+func (pc PanelConfig) dpi() float64 {
+	if pc.DPI > 0 {
+		return pc.DPI
+	}
+	if pc.Diagonal > 0 {
+		size := pc.size()
+		return math.Hypot(float64(size.X), float64(size.Y)) / pc.Diagonal
+	}
+	return 125
+}
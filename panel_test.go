@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestPanelConfig(t *testing.T) {
+	tests := []struct {
+		pc   PanelConfig
+		size image.Point
+		dpi  float64
+	}{
+		{PanelConfig{}, image.Pt(800, 480), 125},
+		{PanelConfig{Width: 640, Height: 384, DPI: 100}, image.Pt(640, 384), 100},
+		{PanelConfig{Width: 600, Height: 448, Diagonal: 5.65}, image.Pt(600, 448), 132.5},
+		{PanelConfig{Rotation: 90}, image.Pt(480, 800), 125},
+		{PanelConfig{Rotation: 180}, image.Pt(800, 480), 125},
+		{PanelConfig{Width: 384, Height: 640, Rotation: 270}, image.Pt(384, 640), 125},
+	}
+	for _, test := range tests {
+		if err := test.pc.validate(); err != nil {
+			t.Errorf("%+v.validate: %v", test.pc, err)
+			continue
+		}
+		if got := test.pc.size(); got != test.size {
+			t.Errorf("%+v.size() = %v, want %v", test.pc, got, test.size)
+		}
+		if got := test.pc.dpi(); math.Abs(got-test.dpi) > 0.1 {
+			t.Errorf("%+v.dpi() = %.1f, want %.1f", test.pc, got, test.dpi)
+		}
+	}
+
+	for _, pc := range []PanelConfig{
+		{Width: 800},
+		{Width: 801, Height: 480},
+		{Width: 1024, Height: 480},
+		{Width: 800, Height: 1024},
+		{DPI: -1},
+		{DPI: 125, Diagonal: 7.5},
+		{Rotation: 45},
+		{Rotation: -90},
+		{Width: 480, Height: 804, Rotation: 90}, // natively 804 wide
+	} {
+		if err := pc.validate(); err == nil {
+			t.Errorf("%+v.validate succeeded, want error", pc)
+		}
+	}
+}
+
+func TestPanelToNative(t *testing.T) {
+	// The corners of the panel as drawn, and where they are natively.
+	corners := []image.Point{{0, 0}, {479, 0}, {479, 799}, {0, 799}}
+	tests := []struct {
+		rotation int
+		want     []image.Point
+	}{
+		{90, []image.Point{{0, 479}, {0, 0}, {799, 0}, {799, 479}}},
+		{270, []image.Point{{799, 0}, {799, 479}, {0, 479}, {0, 0}}},
+	}
+	for _, test := range tests {
+		pc := PanelConfig{Rotation: test.rotation}
+		for i, c := range corners {
+			x, y := pc.toNative(c.X, c.Y)
+			if got := image.Pt(x, y); got != test.want[i] {
+				t.Errorf("With rotation %d, toNative(%v) = %v, want %v", test.rotation, c, got, test.want[i])
+			}
+		}
+	}
+	pc := PanelConfig{Rotation: 180}
+	if x, y := pc.toNative(0, 0); x != 799 || y != 479 {
+		t.Errorf("With rotation 180, toNative(0, 0) = (%d, %d), want (799, 479)", x, y)
+	}
+}
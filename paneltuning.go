@@ -0,0 +1,118 @@
+package main
+
+// Advanced tuning of the e-Paper controller.
+// The references to the spec in this file are as in waveshare.go.
+
+import (
+	"fmt"
+	"math"
+)
+
+// PanelTuning overrides the voltage and waveform settings sent to the panel controller.
+// Anything unset keeps the driver's defaults. Bad values can damage the panel,
+// so read the spec before changing these.
+type PanelTuning struct {
+	// Gate voltage level (VG_LVL in PWR), 0 to 7. The default of 7 is ±20V.
+	VGLevel *int `yaml:"vg_level"`
+
+	// Source voltages in volts (VDH, VDL and VDHR in PWR), in 0.2V steps.
+	// VDH is 2.4 to 15, VDL is -2.4 to -15, and VDHR (for red) is 2.4 to 15.
+	// The defaults are 15, -15, and unset (the controller's own default).
+	VDH  *float64 `yaml:"vdh"`
+	VDL  *float64 `yaml:"vdl"`
+	VDHR *float64 `yaml:"vdhr"`
+
+	// Raw register values, sent only if set.
+	Booster []int `yaml:"booster"`            // Booster Soft Start (BTST), 4 bytes
+	CDI     []int `yaml:"vcom_data_interval"` // VCOM and Data interval Setting (CDI), 2 bytes
+	TCON    *int  `yaml:"tcon"`               // TCON Setting (TCON), 1 byte
+
+	// LUT selects the waveform lookup tables; see lut.go.
+	LUT LUTConfig `yaml:"lut"`
+}
+
+func (pt PanelTuning) validate() error {
+	if pt.VGLevel != nil && (*pt.VGLevel < 0 || *pt.VGLevel > 7) {
+		return fmt.Errorf("vg_level %d out of range [0,7]", *pt.VGLevel)
+	}
+	for _, v := range []struct {
+		name     string
+		volts    *float64
+		min, max float64
+	}{
+		{"vdh", pt.VDH, 2.4, 15},
+		{"vdl", pt.VDL, -15, -2.4},
+		{"vdhr", pt.VDHR, 2.4, 15},
+	} {
+		if v.volts == nil {
+			continue
+		}
+		if *v.volts < v.min || *v.volts > v.max {
+			return fmt.Errorf("%s %.1fV out of range [%.1f,%.1f]", v.name, *v.volts, v.min, v.max)
+		}
+		if _, ok := voltLevel(*v.volts); !ok {
+			return fmt.Errorf("%s %vV is not a multiple of 0.2V", v.name, *v.volts)
+		}
+	}
+	for _, r := range []struct {
+		name string
+		data []int
+		n    int
+	}{
+		{"booster", pt.Booster, 4},
+		{"vcom_data_interval", pt.CDI, 2},
+	} {
+		if r.data != nil && len(r.data) != r.n {
+			return fmt.Errorf("%s has %d bytes, want %d", r.name, len(r.data), r.n)
+		}
+		for _, b := range r.data {
+			if b < 0 || b > 0xFF {
+				return fmt.Errorf("%s value %d is not a byte", r.name, b)
+			}
+		}
+	}
+	if pt.TCON != nil && (*pt.TCON < 0 || *pt.TCON > 0xFF) {
+		return fmt.Errorf("tcon value %d is not a byte", *pt.TCON)
+	}
+	if err := pt.LUT.validate(); err != nil {
+		return fmt.Errorf("lut: %w", err)
+	}
+	return nil
+}
+
+// voltLevel converts a source voltage to its register level, where 0 is ±2.4V
+// and each step is 0.2V. It reports whether the voltage is on a step.
+func voltLevel(volts float64) (byte, bool) {
+	steps := (math.Abs(volts) - 2.4) / 0.2
+	level := math.Round(steps)
+	return byte(level), math.Abs(steps-level) < 1e-6
+}
+
+// pwr returns the data bytes for the Power Setting (PWR) command.
+func (pt PanelTuning) pwr() []byte {
+	// VSR_E | VS_E | VG_E
+	// Internal power.
+	data := []byte{0x07, 0x07, 0x3f, 0x3f}
+	if pt.VGLevel != nil {
+		data[1] = byte(*pt.VGLevel)
+	}
+	if pt.VDH != nil {
+		data[2], _ = voltLevel(*pt.VDH)
+	}
+	if pt.VDL != nil {
+		data[3], _ = voltLevel(*pt.VDL)
+	}
+	if pt.VDHR != nil {
+		l, _ := voltLevel(*pt.VDHR)
+		data = append(data, l)
+	}
+	return data
+}
+
+func intsToBytes(x []int) []byte {
+	b := make([]byte, len(x))
+	for i, v := range x {
+		b[i] = byte(v)
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPanelTuning(t *testing.T) {
+	ip := func(x int) *int { return &x }
+	fp := func(x float64) *float64 { return &x }
+
+	// The defaults must match what the driver always sent.
+	if got, want := (PanelTuning{}).pwr(), []byte{0x07, 0x07, 0x3f, 0x3f}; !bytes.Equal(got, want) {
+		t.Errorf("Default PWR = % x, want % x", got, want)
+	}
+
+	pt := PanelTuning{VGLevel: ip(5), VDH: fp(14.0), VDL: fp(-14.0), VDHR: fp(3.0)}
+	if err := pt.validate(); err != nil {
+		t.Errorf("Valid tuning failed validation: %v", err)
+	}
+	if got, want := pt.pwr(), []byte{0x07, 0x05, 0x3a, 0x3a, 0x03}; !bytes.Equal(got, want) {
+		t.Errorf("Tuned PWR = % x, want % x", got, want)
+	}
+
+	bad := []PanelTuning{
+		{VGLevel: ip(8)},
+		{VDH: fp(16)},
+		{VDH: fp(-15)},
+		{VDL: fp(15)},
+		{VDHR: fp(3.1)},
+		{Booster: []int{0x17, 0x17, 0x28}},
+		{CDI: []int{0x11, 0x107}},
+		{TCON: ip(-1)},
+		{LUT: LUTConfig{Source: "flash"}},
+		{LUT: LUTConfig{Tables: map[string][]int{"vcom": {0, 1, 1, 1, 1, 1}}}},
+		{LUT: LUTConfig{Source: "register"}},
+		{LUT: LUTConfig{Source: "register", Tables: map[string][]int{"green": {0, 1, 1, 1, 1, 1}}}},
+		{LUT: LUTConfig{Source: "register", Tables: map[string][]int{"vcom": {0, 1, 1, 1, 1}}}},
+		{LUT: LUTConfig{Source: "register", Tables: map[string][]int{"vcom": {0, 1, 1, 1, 1, 256}}}},
+	}
+	for _, pt := range bad {
+		if err := pt.validate(); err == nil {
+			t.Errorf("Bad tuning %+v passed validation", pt)
+		}
+	}
+}
+
+func TestLUTCommands(t *testing.T) {
+	if cmds := (LUTConfig{}).commands(); cmds != nil {
+		t.Errorf("OTP LUTs sent %d commands, want none", len(cmds))
+	}
+
+	lc := LUTConfig{Source: "register", Tables: map[string][]int{
+		"border": {0x40, 1, 2, 3, 4, 1},
+		"vcom":   {0x00, 10, 10, 0, 0, 1},
+	}}
+	if err := lc.validate(); err != nil {
+		t.Errorf("Register tables failed validation: %v", err)
+	}
+	cmds := lc.commands()
+	if len(cmds) != 2 || cmds[0].cmd != 0x20 || cmds[1].cmd != 0x25 {
+		t.Fatalf("Register tables sent %d commands, want VCOM then border LUTs", len(cmds))
+	}
+	if !bytes.Equal(cmds[1].data, []byte{0x40, 1, 2, 3, 4, 1}) {
+		t.Errorf("Border LUT = % x, want the configured table", cmds[1].data)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+// Tracing of what is sent to the e-Paper, and replaying of traces.
+//
+// A trace is a text file with one line per operation:
+//
+//	<seconds since start> <op> [<hex bytes>]
+//
+// where op is R (reset), C (command), D (data) or B (wait for not busy).
+// The status polling done while waiting for not busy isn't recorded.
+// This makes it easy to diff against what the Waveshare reference implementation sends.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceReset   = 'R'
+	traceCommand = 'C'
+	traceData    = 'D'
+	traceBusy    = 'B'
+)
+
+// paperTrace records operations on the paper. A nil *paperTrace records nothing.
+type paperTrace struct {
+	start time.Time
+
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer // may be nil
+}
+
+func newPaperTrace(w io.Writer) *paperTrace {
+	return &paperTrace{
+		start: time.Now(),
+		w:     bufio.NewWriter(w),
+	}
+}
+
+// openPaperTrace starts a trace that is written to filename.
+func openPaperTrace(filename string) (*paperTrace, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating paper trace: %w", err)
+	}
+	t := newPaperTrace(f)
+	t.c = f
+	return t, nil
+}
+
+func (t *paperTrace) record(op byte, data []byte) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%.6f %c", time.Since(t.start).Seconds(), op)
+	if len(data) > 0 {
+		fmt.Fprintf(t.w, " %x", data)
+	}
+	t.w.WriteByte('\n')
+}
+
+// Close flushes the trace, reporting any error that happened while writing it.
+func (t *paperTrace) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.w.Flush()
+	if t.c != nil {
+		if cerr := t.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type traceEntry struct {
+	At   time.Duration // since the start of the trace
+	Op   byte
+	Data []byte
+}
+
+// parsePaperTrace parses a trace written by a paperTrace.
+func parsePaperTrace(r io.Reader) ([]traceEntry, error) {
+	var entries []traceEntry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20) // full frames are long lines
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 || len(fields[1]) != 1 {
+			return nil, fmt.Errorf("line %d: malformed", line)
+		}
+		secs, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad timestamp: %w", line, err)
+		}
+		e := traceEntry{
+			At: time.Duration(secs * float64(time.Second)),
+			Op: fields[1][0],
+		}
+		switch e.Op {
+		case traceReset, traceCommand, traceData, traceBusy:
+		default:
+			return nil, fmt.Errorf("line %d: unknown op %q", line, fields[1])
+		}
+		if len(fields) == 3 {
+			e.Data, err = hex.DecodeString(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad data: %w", line, err)
+			}
+		}
+		if e.Op == traceCommand && len(e.Data) != 1 {
+			return nil, fmt.Errorf("line %d: command has %d bytes, want 1", line, len(e.Data))
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// traceSink is something that a trace can be replayed to. paper is one.
+type traceSink interface {
+	Reset()
+	Command(x byte, params ...byte)
+	Data(x ...byte)
+	WaitForNotBusy() error
+}
+
+// replayTrace feeds the entries to sink. If paced is set,
+// the gaps between entries are kept, except that busy waits take as long as they take.
+// It stops if a busy wait fails.
+func replayTrace(entries []traceEntry, sink traceSink, paced bool) error {
+	start := time.Now()
+	for i, e := range entries {
+		if paced {
+			if d := time.Until(start.Add(e.At)); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		switch e.Op {
+		case traceReset:
+			sink.Reset()
+		case traceCommand:
+			sink.Command(e.Data[0])
+		case traceData:
+			sink.Data(e.Data...)
+		case traceBusy:
+			if err := sink.WaitForNotBusy(); err != nil {
+				return fmt.Errorf("replaying operation %d: %w", i+1, err)
+			}
+			start = time.Now().Add(-e.At)
+		}
+	}
+	return nil
+}
+
+// traceDecoder is a traceSink that works out what the panel would show.
+// It only understands enough commands to do that.
+type traceDecoder struct {
+	width, height int
+
+	cmd      byte   // the most recent command
+	tres     []byte // data for the most recent TRES command
+	bw, red  []byte // data for the most recent DTM1 and DTM2 commands
+	frames   int    // number of DRF commands
+	frameImg *image.Paletted
+}
+
+func newTraceDecoder() *traceDecoder {
+	return &traceDecoder{width: 800, height: 480}
+}
+
+func (td *traceDecoder) Reset()                {}
+func (td *traceDecoder) WaitForNotBusy() error { return nil }
+
+func (td *traceDecoder) Command(x byte, params ...byte) {
+	td.cmd = x
+	switch x {
+	case 0x61: // Resolution Setting (TRES)
+		td.tres = nil
+	case 0x10: // Data Start Transmission 1 (DTM1)
+		td.bw = nil
+	case 0x13: // Data Start Transmission 2 (DTM2)
+		td.red = nil
+	case 0x12: // Display Refresh (DRF)
+		td.frames++
+		td.frameImg = td.image()
+	}
+	td.Data(params...)
+}
+
+func (td *traceDecoder) Data(x ...byte) {
+	switch td.cmd {
+	case 0x61:
+		td.tres = append(td.tres, x...)
+		if len(td.tres) == 4 {
+			td.width = int(td.tres[0])<<8 | int(td.tres[1])
+			td.height = int(td.tres[2])<<8 | int(td.tres[3])
+		}
+	case 0x10:
+		td.bw = append(td.bw, x...)
+	case 0x13:
+		td.red = append(td.red, x...)
+	}
+}
+
+// image returns what the panel would show after a refresh with the current data.
+// Bits in the B/W data are white when set; bits in the red data are red when set.
+func (td *traceDecoder) image() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, td.width, td.height), staticPalette)
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	bit := func(bits []byte, off int) bool {
+		return off/8 < len(bits) && bits[off/8]&(1<<(7-off&7)) != 0
+	}
+	for y := 0; y < td.height; y++ {
+		for x := 0; x < td.width; x++ {
+			off := x + y*td.width
+			switch {
+			case bit(td.red, off):
+				img.SetColorIndex(x, y, uint8(colRed))
+			case off/8 < len(td.bw) && !bit(td.bw, off):
+				img.SetColorIndex(x, y, uint8(colBlack))
+			}
+		}
+	}
+	return img
+}
+
+// replayPaperTrace replays the trace in filename. If pngFile is set, the last frame
+// is decoded and written there; otherwise the trace is sent to the panel.
+func replayPaperTrace(filename, pngFile string) error {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading paper trace: %w", err)
+	}
+	entries, err := parsePaperTrace(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parsing paper trace %s: %w", filename, err)
+	}
+	log.Printf("Replaying %d operations from %s", len(entries), filename)
+
+	if pngFile == "" {
+		// The trace already has any tuning in it.
+		p := newPaper(PanelConfig{}, PanelTuning{})
+		if err := p.Start(); err != nil {
+			return fmt.Errorf("paper start: %w", err)
+		}
+		defer p.Stop()
+		return replayTrace(entries, p, true)
+	}
+
+	td := newTraceDecoder()
+	if err := replayTrace(entries, td, false); err != nil {
+		return err
+	}
+	if td.frameImg == nil {
+		return fmt.Errorf("paper trace %s has no display refreshes", filename)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, td.frameImg); err != nil {
+		return fmt.Errorf("encoding PNG: %w", err)
+	}
+	if err := ioutil.WriteFile(pngFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing PNG: %w", err)
+	}
+	log.Printf("Wrote the last of %d frames to %s", td.frames, pngFile)
+	return nil
+}
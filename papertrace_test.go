@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPaperTraceRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	tr := newPaperTrace(&buf)
+	tr.record(traceReset, nil)
+	tr.record(traceCommand, []byte{0x61})
+	tr.record(traceData, []byte{0x00, 0x10, 0x00, 0x02}) // 16x2
+	tr.record(traceCommand, []byte{0x10})
+	tr.record(traceData, []byte{0xFF, 0x0F, 0xFF, 0xFF})
+	tr.record(traceCommand, []byte{0x13})
+	tr.record(traceData, []byte{0x00, 0x00, 0x80, 0x00})
+	tr.record(traceCommand, []byte{0x12})
+	tr.record(traceBusy, nil)
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	entries, err := parsePaperTrace(&buf)
+	if err != nil {
+		t.Fatalf("parsePaperTrace: %v", err)
+	}
+	var ops []byte
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	if got, want := string(ops), "RCDCDCDCB"; got != want {
+		t.Errorf("Parsed ops %q, want %q", got, want)
+	}
+	if got, want := entries[4].Data, []byte{0xFF, 0x0F, 0xFF, 0xFF}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DTM1 data = %x, want %x", got, want)
+	}
+
+	td := newTraceDecoder()
+	if err := replayTrace(entries, td, false); err != nil {
+		t.Fatalf("replayTrace: %v", err)
+	}
+	if td.frames != 1 {
+		t.Fatalf("Decoded %d frames, want 1", td.frames)
+	}
+	img := td.frameImg
+	if got := img.Bounds().Size(); got.X != 16 || got.Y != 2 {
+		t.Fatalf("Decoded frame is %v, want 16x2", got)
+	}
+	var rows []string
+	for y := 0; y < 2; y++ {
+		var row strings.Builder
+		for x := 0; x < 16; x++ {
+			row.WriteByte(".KR"[img.ColorIndexAt(x, y)])
+		}
+		rows = append(rows, row.String())
+	}
+	want := []string{
+		"........KKKK....",
+		"R...............",
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Decoded frame:\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParsePaperTraceErrors(t *testing.T) {
+	tests := []string{
+		"0.1",
+		"x C 12",
+		"0.1 Q",
+		"0.1 C",
+		"0.1 C 1213",
+		"0.1 D zz",
+	}
+	for _, test := range tests {
+		if _, err := parsePaperTrace(strings.NewReader(test)); err == nil {
+			t.Errorf("parsePaperTrace(%q) succeeded, want error", test)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+// Decoding photos as taken by phones: JPEGs rotated via their EXIF orientation,
+// and HEIC photos, which are converted to JPEG once by heif-convert (from libheif)
+// since there's no decoder for them in Go.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// photoExts are the (lower case) extensions of files in the photos dir that are photos.
+var photoExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".heic": true,
+	".heif": true,
+}
+
+func isHEIC(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".heic" || ext == ".heif"
+}
+
+// heifConvert is the command that converts HEIC photos to JPEG.
+var heifConvert = "heif-convert"
+
+// heicCacheDir, if set, is where converted HEIC photos are kept,
+// rather than under the user's cache dir.
+var heicCacheDir string
+
+// decodePhoto decodes a photo file, the right way up.
+func decodePhoto(filename string) (image.Image, error) {
+	if isHEIC(filename) {
+		jpg, err := convertHEIC(filename)
+		if err != nil {
+			return nil, err
+		}
+		filename = jpg
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	src, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image %s: %w", filename, err)
+	}
+	if format == "jpeg" {
+		src = orientImage(src, exifOrientation(raw))
+	}
+	return src, nil
+}
+
+// convertHEIC returns the name of a JPEG converted from a HEIC photo,
+// converting it if it hasn't been already. Conversions are kept in heicCacheDir or the user's cache dir,
+// named for the photo's path and modification time so a replaced photo is converted again.
+func convertHEIC(filename string) (string, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	dir := heicCacheDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("finding cache dir: %w", err)
+		}
+		dir = filepath.Join(cache, "kitchenthing", "heic")
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", filename, fi.ModTime().UnixNano())))
+	jpg := filepath.Join(dir, hex.EncodeToString(sum[:8])+".jpg")
+	if _, err := os.Stat(jpg); err == nil {
+		return jpg, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("making HEIC cache dir: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	tmp := jpg + ".tmp.jpg"
+	out, err := exec.CommandContext(ctx, heifConvert, "-q", "90", filename, tmp).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("converting HEIC photo %s with %s: %w: %s", filename, heifConvert, err, bytes.TrimSpace(out))
+	}
+	if err := os.Rename(tmp, jpg); err != nil {
+		return "", err
+	}
+	return jpg, nil
+}
+
+// exifOrientation returns the EXIF orientation (1 to 8) of a JPEG,
+// or 1 (the right way up already) if it doesn't have one.
+func exifOrientation(jpg []byte) int {
+	if len(jpg) < 2 || jpg[0] != 0xFF || jpg[1] != 0xD8 {
+		return 1
+	}
+	b := jpg[2:]
+	for len(b) >= 4 && b[0] == 0xFF {
+		marker := b[1]
+		if marker == 0xDA { // start of scan; no more metadata
+			break
+		}
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		if n < 2 || len(b) < 2+n {
+			break
+		}
+		seg := b[4 : 2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		b = b[2+n:]
+	}
+	return 1
+}
+
+// tiffOrientation finds the orientation tag in the first IFD of EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	off := int(bo.Uint32(tiff[4:8]))
+	if off < 8 || off+2 > len(tiff) {
+		return 1
+	}
+	count := int(bo.Uint16(tiff[off:]))
+	for i := 0; i < count; i++ {
+		e := off + 2 + 12*i
+		if e+12 > len(tiff) {
+			break
+		}
+		if bo.Uint16(tiff[e:]) != 0x0112 {
+			continue
+		}
+		// A SHORT, which is stored in the first bytes of the value field.
+		if o := int(bo.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		break
+	}
+	return 1
+}
+
+// orientImage returns src turned the right way up for the given EXIF orientation.
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	return orientedImage{src, orientation}
+}
+
+// orientedImage is an image flipped and/or rotated as an EXIF orientation says to display it.
+type orientedImage struct {
+	src         image.Image
+	orientation int
+}
+
+func (oi orientedImage) ColorModel() color.Model { return oi.src.ColorModel() }
+
+func (oi orientedImage) Bounds() image.Rectangle {
+	b := oi.src.Bounds()
+	if oi.orientation >= 5 {
+		// Turned sideways.
+		return image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	return image.Rect(0, 0, b.Dx(), b.Dy())
+}
+
+func (oi orientedImage) At(x, y int) color.Color {
+	b := oi.src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var sx, sy int
+	switch oi.orientation {
+	case 2: // mirrored
+		sx, sy = w-1-x, y
+	case 3: // upside down
+		sx, sy = w-1-x, h-1-y
+	case 4: // mirrored upside down
+		sx, sy = x, h-1-y
+	case 5: // transposed
+		sx, sy = y, x
+	case 6: // rotated anticlockwise, so turn it clockwise
+		sx, sy = y, h-1-x
+	case 7: // transposed the other way
+		sx, sy = w-1-y, h-1-x
+	case 8: // rotated clockwise, so turn it anticlockwise
+		sx, sy = w-1-y, x
+	default:
+		sx, sy = x, y
+	}
+	return oi.src.At(b.Min.X+sx, b.Min.Y+sy)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withOrientation returns a JPEG with an EXIF segment giving its orientation.
+func withOrientation(jpg []byte, bo binary.ByteOrder, orientation int) []byte {
+	var tiff bytes.Buffer
+	if bo == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, bo, uint16(42))
+	binary.Write(&tiff, bo, uint32(8))      // offset of IFD0
+	binary.Write(&tiff, bo, uint16(2))      // entries
+	binary.Write(&tiff, bo, uint16(0x010F)) // make
+	binary.Write(&tiff, bo, uint16(2))
+	binary.Write(&tiff, bo, uint32(4))
+	tiff.WriteString("Foo\x00")
+	binary.Write(&tiff, bo, uint16(0x0112)) // orientation
+	binary.Write(&tiff, bo, uint16(3))
+	binary.Write(&tiff, bo, uint32(1))
+	binary.Write(&tiff, bo, uint16(orientation))
+	binary.Write(&tiff, bo, uint16(0))
+	binary.Write(&tiff, bo, uint32(0)) // no next IFD
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 4, 3)), nil)
+
+	if got := exifOrientation(jpg.Bytes()); got != 1 {
+		t.Errorf("exifOrientation without EXIF = %d, want 1", got)
+	}
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for o := 1; o <= 8; o++ {
+			if got := exifOrientation(withOrientation(jpg.Bytes(), bo, o)); got != o {
+				t.Errorf("exifOrientation(%v, %d) = %d", bo, o, got)
+			}
+		}
+	}
+	if got := exifOrientation([]byte("not a jpeg")); got != 1 {
+		t.Errorf("exifOrientation of junk = %d, want 1", got)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// A 3x2 image with a distinct value in each pixel:
+	//	0 1 2
+	//	3 4 5
+	src := image.NewGray(image.Rect(10, 20, 13, 22))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	tests := []struct {
+		orientation int
+		want        [][]uint8 // rows, as displayed
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, test := range tests {
+		img := orientImage(src, test.orientation)
+		b := img.Bounds()
+		var got [][]uint8
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			var row []uint8
+			for x := b.Min.X; x < b.Max.X; x++ {
+				row = append(row, img.At(x, y).(color.Gray).Y)
+			}
+			got = append(got, row)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("orientation %d gave %v, want %v", test.orientation, got, test.want)
+		}
+	}
+}
+
+func TestPhotoOptions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.JPEG", "c.png", "d.heic", "notes.txt", ".hidden.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := photoOptions(dir)
+	if err != nil {
+		t.Fatalf("photoOptions: %v", err)
+	}
+	var names []string
+	for _, opt := range got {
+		names = append(names, filepath.Base(opt))
+	}
+	if want := []string{"a.jpg", "b.JPEG", "c.png", "d.heic"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("photoOptions = %q, want %q", names, want)
+	}
+}
+
+func TestServeHEICPhoto(t *testing.T) {
+	dir := t.TempDir()
+	// A stand-in for heif-convert that "converts" by copying.
+	fake := filepath.Join(dir, "heif-convert")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\ncp \"$3\" \"$4\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old, oldDir string) { heifConvert, heicCacheDir = old, oldDir }(heifConvert, heicCacheDir)
+	heifConvert, heicCacheDir = fake, filepath.Join(dir, "cache")
+
+	photos := filepath.Join(dir, "photos")
+	if err := os.Mkdir(photos, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(photos, "a.heic"), []byte("converted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{cfg: Config{PhotosDir: photos}}
+	rec := httptest.NewRecorder()
+	s.servePhoto(rec, httptest.NewRequest("GET", "/photo/a.heic", nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET /photo/a.heic: %d %s", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "image/jpeg"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if got := rec.Body.String(); got != "converted" {
+		t.Errorf("Body = %q, want the converted photo", got)
+	}
+}
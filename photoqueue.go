@@ -0,0 +1,170 @@
+package main
+
+// Picking photos from a shuffled queue, so that every photo is shown once
+// before any is shown again. An optional photos.yaml in the photos dir
+// can weight photos to come up more (or less) often:
+//
+//	weights:
+//	  wedding.jpg: 3   # three times per cycle
+//	  receipt.jpg: 0   # never
+//
+// The queue is kept in the state file, so a restart carries on where it left off.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	photoOrderRandom  = "random"  // favour photos not shown for a while (the default)
+	photoOrderShuffle = "shuffle" // cycle through every photo before repeating any
+)
+
+// photoManifestName is the name of the optional manifest in the photos dir.
+const photoManifestName = "photos.yaml"
+
+type photoManifest struct {
+	// Weights is how many times per cycle to show each photo, keyed by base name.
+	// Photos not listed have a weight of 1; a weight of 0 never shows a photo.
+	Weights map[string]int `yaml:"weights"`
+}
+
+func (pm photoManifest) weight(name string) int {
+	if w, ok := pm.Weights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// loadPhotoManifest loads the manifest from a photos dir. It is fine for there to be none.
+func loadPhotoManifest(dir string) (photoManifest, error) {
+	var pm photoManifest
+	dir, err := expandHome(dir)
+	if err != nil {
+		return pm, err
+	}
+	filename := filepath.Join(dir, photoManifestName)
+	raw, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pm, nil
+	} else if err != nil {
+		return pm, err
+	}
+	if err := yaml.UnmarshalStrict(raw, &pm); err != nil {
+		return pm, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	for name, w := range pm.Weights {
+		if w < 0 {
+			return pm, fmt.Errorf("%s: negative weight for %s", filename, name)
+		}
+	}
+	return pm, nil
+}
+
+// photoShuffle is a cycle through the photos, by base name.
+type photoShuffle struct {
+	Order []string `json:"order"`
+	Next  int      `json:"next"` // index in Order of the next photo to show
+}
+
+// Pick returns the next photo to show of names (base names), weighted by pm,
+// or "" if there is nothing to show. Photos that have gone are dropped from the cycle,
+// and new ones are slotted into what's left of it.
+func (ps *photoShuffle) Pick(names []string, pm photoManifest, rng *rand.Rand) string {
+	avail := make(map[string]bool)
+	for _, name := range names {
+		if pm.weight(name) > 0 {
+			avail[name] = true
+		}
+	}
+	if ps.Next > len(ps.Order) || ps.Next < 0 {
+		ps.Next = len(ps.Order)
+	}
+
+	var order []string
+	inCycle := make(map[string]bool)
+	next := ps.Next
+	for i, name := range ps.Order {
+		if !avail[name] {
+			if i < ps.Next {
+				next--
+			}
+			continue
+		}
+		order = append(order, name)
+		inCycle[name] = true
+	}
+	var last string
+	if next > 0 {
+		last = order[next-1]
+	}
+	var added []string
+	for name := range avail {
+		if !inCycle[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		for j := 0; j < pm.weight(name); j++ {
+			i := next + rng.Intn(len(order)-next+1)
+			order = append(order[:i], append([]string{name}, order[i:]...)...)
+		}
+	}
+
+	if next >= len(order) {
+		// Start a new cycle.
+		if len(order) > 0 {
+			last = order[len(order)-1]
+		}
+		order = shuffleCycle(avail, pm, last, rng)
+		next = 0
+	}
+	if len(order) == 0 {
+		ps.Order, ps.Next = nil, 0
+		return ""
+	}
+	ps.Order, ps.Next = order, next+1
+	return order[next]
+}
+
+// shuffleCycle returns a new cycle through the available photos, with each repeated by its weight,
+// avoiding showing a photo twice in a row where possible, including last from the previous cycle.
+func shuffleCycle(avail map[string]bool, pm photoManifest, last string, rng *rand.Rand) []string {
+	var names []string
+	for name := range avail {
+		names = append(names, name)
+	}
+	sort.Strings(names) // so rng alone decides the order
+	var order []string
+	for _, name := range names {
+		for j := 0; j < pm.weight(name); j++ {
+			order = append(order, name)
+		}
+	}
+	rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+	for i := range order {
+		prev := last
+		if i > 0 {
+			prev = order[i-1]
+		}
+		if order[i] != prev {
+			continue
+		}
+		for j := i + 1; j < len(order); j++ {
+			if order[j] != prev {
+				order[i], order[j] = order[j], order[i]
+				break
+			}
+		}
+	}
+	return order
+}
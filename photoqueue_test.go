@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPhotoShuffle(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	names := []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}
+	var ps photoShuffle
+	var picked []string
+	for i := 0; i < 3*len(names); i++ {
+		picked = append(picked, ps.Pick(names, photoManifest{}, rng))
+	}
+	for i := 0; i < len(picked); i += len(names) {
+		cycle := append([]string(nil), picked[i:i+len(names)]...)
+		sort.Strings(cycle)
+		if !reflect.DeepEqual(cycle, names) {
+			t.Errorf("Cycle %d was %q, want each photo once", i/len(names)+1, picked[i:i+len(names)])
+		}
+	}
+	for i := 1; i < len(picked); i++ {
+		if picked[i] == picked[i-1] {
+			t.Errorf("Photo %q picked twice in a row at %d: %q", picked[i], i, picked)
+		}
+	}
+}
+
+func TestPhotoShuffleChanges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ps := photoShuffle{Order: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, Next: 2}
+
+	// c.jpg is gone, and e.jpg is new.
+	names := []string{"a.jpg", "b.jpg", "d.jpg", "e.jpg"}
+	var rest []string
+	for i := 0; i < 2; i++ {
+		rest = append(rest, ps.Pick(names, photoManifest{}, rng))
+	}
+	sort.Strings(rest)
+	if want := []string{"d.jpg", "e.jpg"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("Rest of the cycle was %q, want %q", rest, want)
+	}
+	if got := len(ps.Order); got != 4 {
+		t.Errorf("Next cycle has %d photos, want 4", got)
+	}
+
+	// Nothing to show.
+	if got := ps.Pick(names, photoManifest{Weights: map[string]int{"a.jpg": 0, "b.jpg": 0, "d.jpg": 0, "e.jpg": 0}}, rng); got != "" {
+		t.Errorf("Pick with every weight 0 = %q, want none", got)
+	}
+}
+
+func TestPhotoShuffleWeights(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	names := []string{"a.jpg", "b.jpg", "c.jpg"}
+	pm := photoManifest{Weights: map[string]int{"a.jpg": 3, "c.jpg": 0}}
+	var ps photoShuffle
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[ps.Pick(names, pm, rng)]++
+	}
+	if want := map[string]int{"a.jpg": 6, "b.jpg": 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Over two cycles, picked %v, want %v", counts, want)
+	}
+}
+
+func TestLoadPhotoManifest(t *testing.T) {
+	dir := t.TempDir()
+	pm, err := loadPhotoManifest(dir)
+	if err != nil || pm.weight("a.jpg") != 1 {
+		t.Errorf("Without a manifest, got %+v, %v, want weight 1", pm, err)
+	}
+	filename := filepath.Join(dir, photoManifestName)
+	if err := ioutil.WriteFile(filename, []byte("weights:\n  a.jpg: 3\n  b.jpg: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pm, err = loadPhotoManifest(dir)
+	if err != nil {
+		t.Fatalf("loadPhotoManifest: %v", err)
+	}
+	if pm.weight("a.jpg") != 3 || pm.weight("b.jpg") != 0 || pm.weight("c.jpg") != 1 {
+		t.Errorf("Manifest weights = %v", pm.Weights)
+	}
+	if err := ioutil.WriteFile(filename, []byte("weights:\n  a.jpg: -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPhotoManifest(dir); err == nil {
+		t.Errorf("Negative weight didn't give an error")
+	}
+}
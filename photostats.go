@@ -0,0 +1,69 @@
+package main
+
+// Tracking which photos have been displayed, and for how long,
+// so that random selection can favour photos that haven't been seen for a while.
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type photoStat struct {
+	Shows     int       `json:"shows"`
+	Seconds   int64     `json:"seconds"` // total time displayed
+	LastShown time.Time `json:"last_shown"`
+}
+
+// Displayed returns the total time the photo was displayed.
+func (ps photoStat) Displayed() time.Duration { return time.Duration(ps.Seconds) * time.Second }
+
+// recordPhotoShown notes that the photo with the given base name is now displayed.
+// The previous photo is counted as displayed until now.
+func recordPhotoShown(st *State, name string, now time.Time) {
+	if st.PhotoStats == nil {
+		st.PhotoStats = make(map[string]photoStat)
+	}
+	if prev, ok := st.PhotoStats[st.ShowingPhoto]; ok && !st.ShowingSince.IsZero() && now.After(st.ShowingSince) {
+		prev.Seconds += int64(now.Sub(st.ShowingSince) / time.Second)
+		st.PhotoStats[st.ShowingPhoto] = prev
+	}
+	ps := st.PhotoStats[name]
+	ps.Shows++
+	ps.LastShown = now
+	st.PhotoStats[name] = ps
+	st.ShowingPhoto, st.ShowingSince = name, now
+}
+
+// leastRecentlyShown returns the half of opts (full filenames) that were shown least recently,
+// including any that were never shown. Picking from these eventually covers every photo.
+func leastRecentlyShown(opts []string, stats map[string]photoStat) []string {
+	sorted := append([]string(nil), opts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return stats[filepath.Base(sorted[i])].LastShown.Before(stats[filepath.Base(sorted[j])].LastShown)
+	})
+	return sorted[:(len(sorted)+1)/2]
+}
+
+// photoCoverage summarises how well the photo library has been covered.
+type photoCoverage struct {
+	Total         int // photos in the library
+	Shown         int // ever shown
+	ShownThisWeek int // shown in the last 7 days
+}
+
+func newPhotoCoverage(names []string, stats map[string]photoStat, now time.Time) photoCoverage {
+	pc := photoCoverage{Total: len(names)}
+	weekAgo := now.AddDate(0, 0, -7)
+	for _, name := range names {
+		ps, ok := stats[name]
+		if !ok || ps.Shows == 0 {
+			continue
+		}
+		pc.Shown++
+		if ps.LastShown.After(weekAgo) {
+			pc.ShownThisWeek++
+		}
+	}
+	return pc
+}
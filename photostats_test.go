@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordPhotoShown(t *testing.T) {
+	t0 := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.UTC)
+	var st State
+	recordPhotoShown(&st, "a.jpg", t0)
+	recordPhotoShown(&st, "b.jpg", t0.Add(10*time.Minute))
+	recordPhotoShown(&st, "a.jpg", t0.Add(15*time.Minute))
+
+	if got := st.PhotoStats["a.jpg"]; got.Shows != 2 || got.Displayed() != 10*time.Minute || !got.LastShown.Equal(t0.Add(15*time.Minute)) {
+		t.Errorf("a.jpg stats = %+v, want 2 shows for 10m, last at 09:15", got)
+	}
+	if got := st.PhotoStats["b.jpg"]; got.Shows != 1 || got.Displayed() != 5*time.Minute {
+		t.Errorf("b.jpg stats = %+v, want 1 show for 5m", got)
+	}
+	if st.ShowingPhoto != "a.jpg" {
+		t.Errorf("Showing %q, want a.jpg", st.ShowingPhoto)
+	}
+}
+
+func TestLeastRecentlyShown(t *testing.T) {
+	t0 := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.UTC)
+	stats := map[string]photoStat{
+		"a.jpg": {Shows: 1, LastShown: t0},
+		"b.jpg": {Shows: 1, LastShown: t0.Add(-time.Hour)},
+		"d.jpg": {Shows: 1, LastShown: t0.Add(time.Hour)},
+	}
+	opts := []string{"/p/a.jpg", "/p/b.jpg", "/p/c.jpg", "/p/d.jpg", "/p/e.jpg"}
+	got := leastRecentlyShown(opts, stats)
+	want := []string{"/p/c.jpg", "/p/e.jpg", "/p/b.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("leastRecentlyShown = %q, want %q", got, want)
+	}
+
+	pc := newPhotoCoverage([]string{"a.jpg", "b.jpg", "c.jpg"}, stats, t0.AddDate(0, 0, 7).Add(-30*time.Minute))
+	if want := (photoCoverage{Total: 3, Shown: 2, ShownThisWeek: 1}); pc != want {
+		t.Errorf("newPhotoCoverage = %+v, want %+v", pc, want)
+	}
+}
+
+func TestPhotoRendered(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := loadState("")
+	s := &server{cfg: Config{PhotosDir: dir}, state: state}
+	shows := func() (n int) {
+		state.View(func(st *State) { n = st.PhotoStats["a.jpg"].Shows })
+		return n
+	}
+
+	// A render that doesn't refresh the panel doesn't count.
+	if _, err := s.pickPhoto(); err != nil {
+		t.Fatalf("pickPhoto: %v", err)
+	}
+	s.photoRendered(false)
+	if n := shows(); n != 0 {
+		t.Errorf("After a render that wasn't shown, a.jpg has %d shows, want 0", n)
+	}
+
+	s.pickPhoto()
+	s.photoRendered(true)
+	s.photoRendered(true) // a render with no room for a photo
+	if n := shows(); n != 1 {
+		t.Errorf("After a render that was shown, a.jpg has %d shows, want 1", n)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+// Shutting down safely when a UPS HAT reports that mains power has been lost.
+// The panel gets one last frame saying when, then goes into deep sleep and
+// isn't refreshed again, so it can't be left half-refreshed when the battery runs out.
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	rpio "github.com/stianeikeland/go-rpio/v4"
+)
+
+type PowerLossConfig struct {
+	// GPIO, if positive, is the BCM number of the pin that signals power loss.
+	// It is high while power is lost, or low if ActiveLow is set.
+	GPIO      int  `yaml:"gpio"`
+	ActiveLow bool `yaml:"active_low"`
+
+	// MQTTTopic, if set, is a topic on which MQTTPayload (default "ON") signals power loss.
+	MQTTTopic   string `yaml:"mqtt_topic"`
+	MQTTPayload string `yaml:"mqtt_payload"`
+}
+
+// powerLoss is signalled once power is lost. A nil powerLoss is never signalled.
+type powerLoss struct {
+	once sync.Once
+	c    chan struct{} // closed when power is lost
+	at   time.Time     // when power was lost; set before c is closed
+}
+
+func newPowerLoss() *powerLoss {
+	return &powerLoss{c: make(chan struct{})}
+}
+
+// Lost signals that power has been lost. Only the first call has any effect.
+func (pl *powerLoss) Lost(via string) {
+	pl.once.Do(func() {
+		pl.at = time.Now()
+		log.Printf("Power lost (signalled via %s)", via)
+		close(pl.c)
+	})
+}
+
+// C returns a channel that is closed when power is lost.
+func (pl *powerLoss) C() <-chan struct{} {
+	if pl == nil {
+		return nil
+	}
+	return pl.c
+}
+
+// At returns when power was lost. It must only be called after C is closed.
+func (pl *powerLoss) At() time.Time { return pl.at }
+
+// handleMQTT returns an MQTT handler that signals power loss for the configured payload.
+func (pl *powerLoss) handleMQTT(cfg PowerLossConfig) func(payload []byte) {
+	want := cfg.MQTTPayload
+	if want == "" {
+		want = "ON"
+	}
+	return func(payload []byte) {
+		if strings.EqualFold(strings.TrimSpace(string(payload)), want) {
+			pl.Lost("MQTT")
+		}
+	}
+}
+
+// watchGPIO polls the configured pin until power is lost or ctx is done.
+// GPIO access must already be set up, which starting the panel does.
+func (pl *powerLoss) watchGPIO(ctx context.Context, cfg PowerLossConfig) {
+	pin := rpio.Pin(cfg.GPIO)
+	pin.Input()
+	lost := rpio.High
+	if cfg.ActiveLow {
+		pin.PullUp()
+		lost = rpio.Low
+	} else {
+		pin.PullDown()
+	}
+
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		if pin.Read() == lost {
+			pl.Lost("GPIO")
+			return
+		}
+	}
+}
+
+// powerLostBanner is the banner shown on the last frame before power runs out.
+func powerLostBanner(at time.Time) string {
+	return "Power lost at " + at.Format(time.Kitchen)
+}
+
+// freezeForPowerLoss shows data for the last time with a banner saying when power was lost,
+// leaving the panel in deep sleep, then waits for ctx to be done without refreshing again.
+func freezeForPowerLoss(ctx context.Context, rend renderer, pipe *panelPipeline, data displayData, at time.Time) error {
+	if data.today.IsZero() {
+		// Nothing has been displayed yet.
+		y, m, d := at.Date()
+		data.today, data.now = time.Date(y, m, d, 0, 0, 0, 0, time.Local), at
+	}
+	data.override = nil
+	data.nudge = powerLostBanner(at)
+	rend.Render(pipe.Back(), data)
+	pipe.Show()
+	pipe.Wait()
+	log.Printf("Panel frozen after power loss; it won't be refreshed again until restarted")
+
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestPowerLoss(t *testing.T) {
+	var nilPL *powerLoss
+	if c := nilPL.C(); c != nil {
+		t.Errorf("nil powerLoss C() = %v, want nil", c)
+	}
+
+	pl := newPowerLoss()
+	handle := pl.handleMQTT(PowerLossConfig{MQTTTopic: "ups/state", MQTTPayload: "lost"})
+	handle([]byte("ok"))
+	select {
+	case <-pl.C():
+		t.Fatalf("Power loss signalled by the wrong payload")
+	default:
+	}
+
+	handle([]byte(" LOST\n"))
+	select {
+	case <-pl.C():
+	default:
+		t.Fatalf("Power loss not signalled by MQTT payload")
+	}
+	at := pl.At()
+	if at.IsZero() {
+		t.Errorf("Power loss time not set")
+	}
+	pl.Lost("GPIO") // must not panic by closing twice
+	if got := pl.At(); !got.Equal(at) {
+		t.Errorf("Second signal changed the time from %v to %v", at, got)
+	}
+}
+
+func TestFreezeForPowerLoss(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	cfg := Config{
+		Font:     fontFile,
+		Messages: []message{{Options: []string{"Testing"}}},
+	}
+	rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	fp := newFakePaper()
+	pipe := newPanelPipeline(fp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	at := time.Date(2024, time.June, 3, 15, 4, 0, 0, time.Local)
+	if err := freezeForPowerLoss(ctx, rend, pipe, displayData{}, at); err != context.Canceled {
+		t.Errorf("freezeForPowerLoss = %v, want %v", err, context.Canceled)
+	}
+	if fp.refreshes != 1 {
+		t.Errorf("Panel refreshed %d times, want 1", fp.refreshes)
+	}
+	// The banner is the only thing drawn in red.
+	red := 0
+	for _, c := range fp.Pix {
+		if c == uint8(colRed) {
+			red++
+		}
+	}
+	if red == 0 {
+		t.Errorf("No power loss banner drawn")
+	}
+	if got, want := powerLostBanner(at), "Power lost at 3:04PM"; got != want {
+		t.Errorf("powerLostBanner = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+// Presence-based task filtering.
+
+import (
+	"context"
+	"fmt"
+)
+
+type PresenceConfig struct {
+	// People maps assignee names (as displayed) to the Home Assistant entity
+	// that tracks whether they are home (e.g. "person.david").
+	People map[string]string `yaml:"people"`
+
+	// Hide says to hide tasks assigned to people who are away,
+	// instead of demoting them below a divider.
+	Hide bool `yaml:"hide"`
+}
+
+// pollPresence returns the set of configured people who are not at home.
+func pollPresence(ctx context.Context, hass *HASS, cfg PresenceConfig) (away map[string]bool, err error) {
+	away = make(map[string]bool)
+	for name, entity := range cfg.People {
+		state, err := hass.State(ctx, entity)
+		if err != nil {
+			return nil, fmt.Errorf("getting state of %s: %w", entity, err)
+		}
+		// Both person.* and device_tracker.* entities use "home" for being at home.
+		if state != "home" {
+			away[name] = true
+		}
+	}
+	return away, nil
+}
+
+// applyPresence demotes or hides tasks assigned to people who are away.
+// If nobody is home, everything is left alone.
+// The tasks should already be sorted; their relative order is preserved.
+func applyPresence(tasks []renderableTask, people int, away map[string]bool, hide bool) []renderableTask {
+	if len(away) == 0 || len(away) >= people {
+		return tasks
+	}
+	var here, gone []renderableTask
+	for _, task := range tasks {
+		if task.Assignee != "" && away[task.Assignee] {
+			task.Demoted = true
+			gone = append(gone, task)
+		} else {
+			here = append(here, task)
+		}
+	}
+	if hide {
+		return here
+	}
+	return append(here, gone...)
+}
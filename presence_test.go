@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestApplyPresence(t *testing.T) {
+	tasks := []renderableTask{
+		{Title: "a", Assignee: "David"},
+		{Title: "b", Assignee: "Kate"},
+		{Title: "c"},
+		{Title: "d", Assignee: "David"},
+	}
+	titles := func(tasks []renderableTask) (s string) {
+		for _, task := range tasks {
+			s += task.Title
+			if task.Demoted {
+				s += "-"
+			}
+		}
+		return
+	}
+	tests := []struct {
+		away map[string]bool
+		hide bool
+		want string
+	}{
+		// Everyone home.
+		{nil, false, "abcd"},
+		// Only Kate home.
+		{map[string]bool{"David": true}, false, "bca-d-"},
+		{map[string]bool{"David": true}, true, "bc"},
+		// Nobody home; leave everything alone.
+		{map[string]bool{"David": true, "Kate": true}, false, "abcd"},
+	}
+	for _, test := range tests {
+		got := titles(applyPresence(tasks, 2, test.away, test.hide))
+		if got != test.want {
+			t.Errorf("applyPresence(away=%v, hide=%t) = %q, want %q", test.away, test.hide, got, test.want)
+		}
+	}
+}
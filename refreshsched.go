@@ -0,0 +1,84 @@
+package main
+
+// Refresh periods that depend on the time of day, so the display can be responsive
+// while people are about and refresh less often overnight.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RefreshPeriodRule is the refresh period for part of the day.
+type RefreshPeriodRule struct {
+	// Between is a range of local times, as "07:00-21:00".
+	// It may wrap past midnight, as "21:00-07:00".
+	Between string        `yaml:"between"`
+	Period  time.Duration `yaml:"period"`
+
+	from, to time.Duration // since midnight; set by parse
+}
+
+// parse checks the rule and parses its times.
+func (rp *RefreshPeriodRule) parse() error {
+	if rp.Period <= 0 {
+		return fmt.Errorf("period must be positive")
+	}
+	fromStr, toStr, ok := strings.Cut(rp.Between, "-")
+	if !ok {
+		return fmt.Errorf("between %q isn't a range of times, such as 07:00-21:00", rp.Between)
+	}
+	var err error
+	if rp.from, err = timeOfDay(strings.TrimSpace(fromStr)); err != nil {
+		return err
+	}
+	if rp.to, err = timeOfDay(strings.TrimSpace(toStr)); err != nil {
+		return err
+	}
+	if rp.from == rp.to {
+		return fmt.Errorf("between %q is empty", rp.Between)
+	}
+	return nil
+}
+
+// timeOfDay parses a time of day such as "07:00" or "9pm", returning how long it is after midnight.
+func timeOfDay(s string) (time.Duration, error) {
+	rem, ok := parseClock(s)
+	if !ok {
+		return 0, fmt.Errorf("bad time %q (want one such as 07:00 or 9pm)", s)
+	}
+	return time.Duration(rem.Hour)*time.Hour + time.Duration(rem.Minute)*time.Minute, nil
+}
+
+// contains reports whether the time of day (since midnight) is within the rule's range.
+func (rp RefreshPeriodRule) contains(tod time.Duration) bool {
+	if rp.from < rp.to {
+		return rp.from <= tod && tod < rp.to
+	}
+	return tod >= rp.from || tod < rp.to // wraps past midnight
+}
+
+// refreshWait returns how long to wait before the next refresh.
+// That is the period of the first rule covering now, or the default if none does,
+// but not past the start or end of a rule, so a new period takes effect on time.
+func refreshWait(def time.Duration, rules []RefreshPeriodRule, now time.Time) time.Duration {
+	h, m, sec := now.Clock()
+	tod := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second + time.Duration(now.Nanosecond())
+	wait := def
+	for _, rp := range rules {
+		if rp.contains(tod) {
+			wait = rp.Period
+			break
+		}
+	}
+	for _, rp := range rules {
+		for _, edge := range []time.Duration{rp.from, rp.to} {
+			d := edge - tod
+			if d <= 0 {
+				d += 24 * time.Hour
+			}
+			wait = min(wait, d)
+		}
+	}
+	return wait
+}
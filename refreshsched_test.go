@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshWait(t *testing.T) {
+	rules := []RefreshPeriodRule{
+		{Between: "07:00-21:00", Period: 2 * time.Minute},
+		{Between: "9pm-7am", Period: 30 * time.Minute},
+	}
+	for i := range rules {
+		if err := rules[i].parse(); err != nil {
+			t.Fatalf("Rule %d: %v", i+1, err)
+		}
+	}
+	day := time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at   string
+		want time.Duration
+	}{
+		{"09:00", 2 * time.Minute},
+		{"23:00", 30 * time.Minute},
+		{"03:00", 30 * time.Minute},
+		{"06:50", 10 * time.Minute}, // not past the start of the daytime period
+		{"20:59", time.Minute},
+		{"21:00", 30 * time.Minute},
+	}
+	for _, test := range tests {
+		tod, err := timeOfDay(test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := refreshWait(10*time.Minute, rules, day.Add(tod)); got != test.want {
+			t.Errorf("refreshWait at %s = %v, want %v", test.at, got, test.want)
+		}
+	}
+
+	// Outside any rule, the default applies.
+	morning := []RefreshPeriodRule{{Between: "06:00-09:00", Period: time.Minute}}
+	if err := morning[0].parse(); err != nil {
+		t.Fatal(err)
+	}
+	if got := refreshWait(10*time.Minute, morning, day.Add(12*time.Hour)); got != 10*time.Minute {
+		t.Errorf("refreshWait outside any rule = %v, want the default", got)
+	}
+}
+
+func TestRefreshPeriodRuleParse(t *testing.T) {
+	for _, rp := range []RefreshPeriodRule{
+		{Between: "07:00-21:00"},
+		{Between: "07:00", Period: time.Minute},
+		{Between: "07:00-25:00", Period: time.Minute},
+		{Between: "07:00-07:00", Period: time.Minute},
+	} {
+		if err := rp.parse(); err == nil {
+			t.Errorf("%+v parsed", rp)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+// Arrangement of the display into regions, each drawn by a widget.
+//
+// Regions are horizontal bands across the whole panel, placed in the order they are
+// configured: each one anchored at the top goes below the previous ones there, and
+// each one anchored at the bottom goes above the previous ones there. A region takes as
+// much height as its widget needs, unless it has a fixed height; the photo takes all
+// that's left when it is placed, so it normally goes last.
+
+import (
+	"fmt"
+	"image"
+)
+
+type RegionConfig struct {
+	// Widget is what to draw in the region:
+	// "header" (the date and subtitle), "banner" (the nudge banner), "calendar" (today's events), "tasks",
+	// "footer" (notes, Home Assistant and alerts), "status" (integration health) or "photo".
+	Widget string `yaml:"widget"`
+
+	// Anchor is "top" (the default) or "bottom".
+	Anchor string `yaml:"anchor"`
+
+	// Overlay draws the widget at its anchor without taking any height from later regions.
+	Overlay bool `yaml:"overlay"`
+
+	// Height or HeightPercent (of the panel's height) fix the region's height.
+	Height        int `yaml:"height"`
+	HeightPercent int `yaml:"height_percent"`
+
+	// TimeStyle is how the tasks and calendar widgets show times:
+	// "clock" (the default, such as 5:30PM) or "relative" (such as "in 2h", "yesterday" or "Mon").
+	TimeStyle string `yaml:"time_style"`
+
+	// Dither is how the photo widget draws photos in the panel's colours:
+	// "colour" (the default) diffuses the error into all of them, and "ordered" or "blue-noise"
+	// simulate grayscale in black and white with a Bayer matrix or blue noise pattern.
+	// Other widgets only draw text and shapes, which are always in solid colours.
+	Dither string `yaml:"dither"`
+}
+
+// defaultRegions matches the arrangement from before regions were configurable.
+var defaultRegions = []RegionConfig{
+	{Widget: "header"},
+	{Widget: "banner"},
+	{Widget: "calendar"},
+	{Widget: "tasks"},
+	{Widget: "status", Anchor: "bottom", Overlay: true},
+	{Widget: "footer", Anchor: "bottom"},
+	{Widget: "photo"},
+}
+
+var regionWidgets = map[string]func(r renderer, f *frame, room image.Rectangle) (int, func(top int)){
+	"header":   renderer.planHeader,
+	"banner":   renderer.planBanner,
+	"calendar": renderer.planCalendar,
+	"tasks":    renderer.planTasks,
+	"footer":   renderer.planFooter,
+	"status":   renderer.planStatus,
+	"photo":    renderer.planPhoto,
+}
+
+func validateRegions(regions []RegionConfig) error {
+	seen := make(map[string]bool)
+	for i, rc := range regions {
+		if _, ok := regionWidgets[rc.Widget]; !ok {
+			return fmt.Errorf("region %d: unknown widget %q", i+1, rc.Widget)
+		}
+		if seen[rc.Widget] {
+			return fmt.Errorf("region %d: widget %q is already in another region", i+1, rc.Widget)
+		}
+		seen[rc.Widget] = true
+		switch rc.Anchor {
+		case "", "top", "bottom":
+		default:
+			return fmt.Errorf("region %d: unknown anchor %q", i+1, rc.Anchor)
+		}
+		if rc.Height < 0 || rc.HeightPercent < 0 || rc.HeightPercent > 100 {
+			return fmt.Errorf("region %d: bad height", i+1)
+		}
+		if rc.Height > 0 && rc.HeightPercent > 0 {
+			return fmt.Errorf("region %d: set only one of height and height_percent", i+1)
+		}
+		switch rc.TimeStyle {
+		case "", timeClock, timeRelative:
+		default:
+			return fmt.Errorf("region %d: unknown time_style %q", i+1, rc.TimeStyle)
+		}
+		switch rc.Dither {
+		case "", ditherColour, ditherOrdered, ditherBlueNoise:
+		default:
+			return fmt.Errorf("region %d: unknown dither %q", i+1, rc.Dither)
+		}
+		if rc.Dither != "" && rc.Widget != "photo" {
+			return fmt.Errorf("region %d: only the photo widget can be dithered", i+1)
+		}
+	}
+	return nil
+}
+
+// height returns the fixed height of the region on a panel of the given height, or 0 if it isn't fixed.
+func (rc RegionConfig) height(panel int) int {
+	if rc.HeightPercent > 0 {
+		return panel * rc.HeightPercent / 100
+	}
+	return rc.Height
+}
+
+// layoutRegions draws each region in turn, in the space left by those before it.
+// A region with a fixed height takes it even if its widget has nothing to draw.
+func (r renderer) layoutRegions(f *frame) {
+	free := f.dst.Bounds()
+	for _, rc := range r.regions {
+		room := free
+		fixed := min(rc.height(f.dst.Bounds().Dy()), room.Dy())
+		bottom := rc.Anchor == "bottom"
+		if fixed > 0 {
+			if bottom {
+				room.Min.Y = room.Max.Y - fixed
+			} else {
+				room.Max.Y = room.Min.Y + fixed
+			}
+		}
+
+		f.timeStyle, f.dither = rc.TimeStyle, rc.Dither
+		height, draw := regionWidgets[rc.Widget](r, f, room)
+		if draw != nil && bottom {
+			draw(room.Max.Y - height)
+		} else if draw != nil {
+			draw(room.Min.Y)
+		}
+
+		if rc.Overlay {
+			continue
+		}
+		if fixed > 0 {
+			height = fixed
+		}
+		if bottom {
+			free.Max.Y = max(free.Max.Y-height, free.Min.Y)
+		} else {
+			free.Min.Y = min(free.Min.Y+height, free.Max.Y)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestValidateRegions(t *testing.T) {
+	tests := []struct {
+		regions []RegionConfig
+		ok      bool
+	}{
+		{nil, true},
+		{defaultRegions, true},
+		{[]RegionConfig{{Widget: "tasks"}, {Widget: "header", Anchor: "bottom", HeightPercent: 20}}, true},
+		{[]RegionConfig{{Widget: "weather"}}, false},
+		{[]RegionConfig{{Widget: "tasks"}, {Widget: "tasks"}}, false},
+		{[]RegionConfig{{Widget: "tasks", Anchor: "middle"}}, false},
+		{[]RegionConfig{{Widget: "tasks", Height: -1}}, false},
+		{[]RegionConfig{{Widget: "tasks", HeightPercent: 101}}, false},
+		{[]RegionConfig{{Widget: "tasks", Height: 100, HeightPercent: 10}}, false},
+		{[]RegionConfig{{Widget: "tasks", TimeStyle: "relative"}, {Widget: "calendar", TimeStyle: "clock"}}, true},
+		{[]RegionConfig{{Widget: "tasks", TimeStyle: "fuzzy"}}, false},
+		{[]RegionConfig{{Widget: "photo", Dither: "blue-noise"}}, true},
+		{[]RegionConfig{{Widget: "photo", Dither: "floyd"}}, false},
+		{[]RegionConfig{{Widget: "tasks", Dither: "ordered"}}, false},
+	}
+	for _, test := range tests {
+		err := validateRegions(test.regions)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("validateRegions(%+v) = %v, want ok=%t", test.regions, err, test.ok)
+		}
+	}
+}
+
+func TestRegionPlacement(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+	data := displayData{
+		today: time.Date(2024, time.June, 3, 0, 0, 0, 0, time.Local),
+		tasks: []renderableTask{{Priority: 4, Title: "Take out the bins"}},
+	}
+	// inked reports whether anything is drawn in the band of rows.
+	inked := func(img *image.RGBA, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				if r, _, _, _ := img.At(x, y).RGBA(); r != 0xFFFF {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, test := range []struct {
+		desc             string
+		regions          []RegionConfig
+		top, mid, bottom bool // whether each third of the panel is drawn in
+	}{
+		{"default", nil, true, false, true}, // the status strip is at the bottom
+		{"header at bottom", []RegionConfig{{Widget: "header", Anchor: "bottom"}}, false, false, true},
+		{"tasks below a fixed gap", []RegionConfig{{Widget: "banner", Height: 200}, {Widget: "tasks"}}, false, true, false},
+		{"no tasks", []RegionConfig{{Widget: "header"}, {Widget: "footer", Anchor: "bottom"}}, true, false, false},
+	} {
+		cfg := Config{
+			Font:     fontFile,
+			Messages: []message{{Options: []string{"Testing"}}},
+			Regions:  test.regions,
+		}
+		rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+		if err != nil {
+			t.Fatalf("newRenderer: %v", err)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 800, 480))
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+		rend.Render(img, data)
+		top, mid, bottom := inked(img, 0, 160), inked(img, 160, 320), inked(img, 320, 480)
+		if top != test.top || mid != test.mid || bottom != test.bottom {
+			t.Errorf("%s: drawn in thirds = %t, %t, %t, want %t, %t, %t", test.desc, top, mid, bottom, test.top, test.mid, test.bottom)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+// Times of tasks and events, either as a time of day or as a phrase
+// relative to now, such as "in 2h", "yesterday" or "Mon", in a few languages.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	timeClock    = "clock"    // such as 5:30PM; the default
+	timeRelative = "relative" // such as "in 2h"
+)
+
+// timePhrases are the words for times in a language.
+type timePhrases struct {
+	now                 string
+	in, ago             string // formats for a duration, such as "in %s"
+	minutes, hours      string // formats for a number of each, such as "%dm"
+	yesterday, tomorrow string
+	weekdays            [7]string  // from Sunday
+	months              [12]string // from January
+	clock               string     // layout for a time of day, as for time.Format
+}
+
+const defaultLocale = "en"
+
+var timeLocales = map[string]timePhrases{
+	"en": {
+		now: "now", in: "in %s", ago: "%s ago", minutes: "%dm", hours: "%dh",
+		yesterday: "yesterday", tomorrow: "tomorrow",
+		weekdays: [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		months:   [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		clock:    time.Kitchen,
+	},
+	"de": {
+		now: "jetzt", in: "in %s", ago: "vor %s", minutes: "%d Min.", hours: "%d Std.",
+		yesterday: "gestern", tomorrow: "morgen",
+		weekdays: [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		months:   [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		clock:    "15:04",
+	},
+	"es": {
+		now: "ahora", in: "en %s", ago: "hace %s", minutes: "%d min", hours: "%d h",
+		yesterday: "ayer", tomorrow: "mañana",
+		weekdays: [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		months:   [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		clock:    "15:04",
+	},
+	"fr": {
+		now: "maintenant", in: "dans %s", ago: "il y a %s", minutes: "%d min", hours: "%d h",
+		yesterday: "hier", tomorrow: "demain",
+		weekdays: [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		months:   [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		clock:    "15:04",
+	},
+	"nl": {
+		now: "nu", in: "over %s", ago: "%s geleden", minutes: "%d min", hours: "%d uur",
+		yesterday: "gisteren", tomorrow: "morgen",
+		weekdays: [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		months:   [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		clock:    "15:04",
+	},
+}
+
+// lookupLocale returns the phrases for a locale such as "de" or "en-AU".
+func lookupLocale(locale string) (timePhrases, error) {
+	if locale == "" {
+		locale = defaultLocale
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	if tp, ok := timeLocales[lang]; ok {
+		return tp, nil
+	}
+	var known []string
+	for l := range timeLocales {
+		known = append(known, l)
+	}
+	sort.Strings(known)
+	return timePhrases{}, fmt.Errorf("unsupported locale %q; known languages are %s", locale, strings.Join(known, ", "))
+}
+
+// countdown is like the countdown function, in the language of tp.
+func (tp timePhrases) countdown(t, now time.Time) string {
+	if countdown(t, now) == "" {
+		return ""
+	}
+	return fmt.Sprintf(tp.in, fmt.Sprintf(tp.minutes, countdownMinutes(t.Sub(now))))
+}
+
+// relative returns a phrase for when t is, relative to now.
+// Within the hour either side, it is in minutes, as for countdowns; otherwise it's in hours
+// if t is today, then in days or weekdays if t is within the week either side, and then the date.
+func (tp timePhrases) relative(t, now time.Time) string {
+	d := t.Sub(now)
+	switch days := daysBetween(now, t); {
+	case d > 0 && d <= countdownWindow:
+		return tp.countdown(t, now)
+	case d <= 0 && d > -countdownStep:
+		return tp.now
+	case d <= 0 && d > -countdownWindow:
+		mins := int(-d / countdownStep * countdownStep / time.Minute)
+		return fmt.Sprintf(tp.ago, fmt.Sprintf(tp.minutes, mins))
+	case days == 0 && d > 0:
+		return fmt.Sprintf(tp.in, fmt.Sprintf(tp.hours, int((d+time.Hour/2)/time.Hour)))
+	case days == 0:
+		return fmt.Sprintf(tp.ago, fmt.Sprintf(tp.hours, int((-d+time.Hour/2)/time.Hour)))
+	case days == -1:
+		return tp.yesterday
+	case days == 1:
+		return tp.tomorrow
+	case days > -7 && days < 7:
+		return tp.weekdays[t.In(now.Location()).Weekday()]
+	}
+	_, m, dd := t.In(now.Location()).Date()
+	return fmt.Sprintf("%d %s", dd, tp.months[m-1])
+}
+
+// daysBetween returns the number of calendar days from a to b, in a's location.
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.In(a.Location()).Date()
+	da := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	db := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// formatTime returns how to show t, in the given time style.
+func (r renderer) formatTime(t, now time.Time, style string) string {
+	if style == timeRelative {
+		return r.phrases.relative(t, now)
+	}
+	return t.Format(r.phrases.clock)
+}
+
+// relativeChanged reports whether relative times for a and b, at their respective nows, would differ.
+func relativeChanged(a, aNow, b, bNow time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return a.IsZero() != b.IsZero()
+	}
+	en := timeLocales[defaultLocale]
+	return en.relative(a, aNow) != en.relative(b, bNow)
+}
+
+// usesRelativeTimes reports whether any of the regions shows relative times,
+// which change as time passes even when nothing else does.
+func usesRelativeTimes(regions []RegionConfig) bool {
+	for _, rc := range regions {
+		if rc.TimeStyle == timeRelative {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, time.June, 5, 14, 0, 0, 0, time.UTC) // a Wednesday
+	en, de := timeLocales["en"], timeLocales["de"]
+	for _, test := range []struct {
+		t      time.Time
+		en, de string
+	}{
+		{now.Add(2 * time.Minute), "in 5m", "in 5 Min."},
+		{now.Add(time.Hour), "in 60m", "in 60 Min."},
+		{now.Add(-2 * time.Minute), "now", "jetzt"},
+		{now.Add(-17 * time.Minute), "15m ago", "vor 15 Min."},
+		{now.Add(2*time.Hour + 20*time.Minute), "in 2h", "in 2 Std."},
+		{now.Add(-3*time.Hour - 40*time.Minute), "4h ago", "vor 4 Std."},
+		{now.Add(-15 * time.Hour), "yesterday", "gestern"},
+		{now.Add(11 * time.Hour), "tomorrow", "morgen"},
+		{now.AddDate(0, 0, -2), "Mon", "Mo"},
+		{now.AddDate(0, 0, 4), "Sun", "So"},
+		{now.AddDate(0, 0, 7), "12 Jun", "12 Juni"},
+	} {
+		if got := en.relative(test.t, now); got != test.en {
+			t.Errorf("relative(%v) in English = %q, want %q", test.t, got, test.en)
+		}
+		if got := de.relative(test.t, now); got != test.de {
+			t.Errorf("relative(%v) in German = %q, want %q", test.t, got, test.de)
+		}
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	for _, locale := range []string{"", "en", "en-AU", "FR", "nl-be"} {
+		if _, err := lookupLocale(locale); err != nil {
+			t.Errorf("lookupLocale(%q): %v", locale, err)
+		}
+	}
+	if _, err := lookupLocale("tlh"); err == nil {
+		t.Errorf("lookupLocale(%q) succeeded", "tlh")
+	}
+	if tp, _ := lookupLocale(""); tp.countdown(time.Unix(600, 0), time.Unix(0, 0)) != countdown(time.Unix(600, 0), time.Unix(0, 0)) {
+		t.Errorf("Default locale's countdown differs from countdown")
+	}
+}
+
+func TestRelativeTimesEqual(t *testing.T) {
+	now := time.Date(2024, time.June, 5, 14, 0, 0, 0, time.UTC)
+	due := now.Add(3 * time.Hour)
+	a := displayData{today: now.Truncate(24 * time.Hour), now: now, tasks: []renderableTask{{Title: "Pick up kids", Time: due}}}
+	b := a
+	b.now = now.Add(40 * time.Minute) // "in 3h" becomes "in 2h"
+	if !a.Equal(b) {
+		t.Errorf("Data with clock times isn't equal after 40 minutes")
+	}
+	a.relativeTimes, b.relativeTimes = true, true
+	if a.Equal(b) {
+		t.Errorf("Data with relative times is equal after the phrase changed")
+	}
+	b.now = now.Add(10 * time.Minute)
+	if !a.Equal(b) {
+		t.Errorf("Data with relative times isn't equal after 10 minutes")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+// Reminders set with the m:rem metadata label, such as "m:rem=30m+10m" for reminders
+// 30 and 10 minutes before a task is due, or "m:rem=7:30am" for a reminder at 7:30am
+// on the day it is due. The label is removed as the reminders are added.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+// reminder is a Todoist reminder, either some time before a task is due or at a clock time.
+type reminder struct {
+	Before time.Duration // if not At
+	At     bool
+	Hour   int // only if At
+	Minute int
+}
+
+func (rem reminder) String() string {
+	if !rem.At {
+		return rem.Before.String() + " before"
+	}
+	return time.Date(2000, 1, 1, rem.Hour, rem.Minute, 0, 0, time.UTC).Format(time.Kitchen)
+}
+
+// parseReminders parses the value of an m:rem label: durations and clock times, separated by "+".
+func parseReminders(s string) ([]reminder, error) {
+	if s == "" {
+		return nil, fmt.Errorf("no reminders given (want something like m:rem=30m)")
+	}
+	var rems []reminder
+	for _, part := range strings.Split(s, "+") {
+		if d, err := time.ParseDuration(part); err == nil {
+			if d < time.Minute {
+				return nil, fmt.Errorf("reminder %q is less than a minute before", part)
+			}
+			rems = append(rems, reminder{Before: d})
+			continue
+		}
+		rem, ok := parseClock(part)
+		if !ok {
+			return nil, fmt.Errorf("bad reminder %q (want a duration like 30m or a time like 7:30am)", part)
+		}
+		rems = append(rems, rem)
+	}
+	return rems, nil
+}
+
+func parseClock(s string) (reminder, bool) {
+	for _, layout := range []string{"3:04pm", "3pm", "15:04"} {
+		if t, err := time.Parse(layout, strings.ToLower(s)); err == nil {
+			return reminder{At: true, Hour: t.Hour(), Minute: t.Minute()}, true
+		}
+	}
+	return reminder{}, false
+}
+
+// reminderArgs returns the arguments of the reminder_add command that adds rem to an item.
+// Clock times are on the day the item is due, or the next such time if it has no due date.
+func reminderArgs(item todoist.Item, rem reminder, now time.Time) (map[string]interface{}, error) {
+	if !rem.At {
+		if _, ok := dueTime(item.Due); !ok {
+			return nil, fmt.Errorf("reminder %v needs the task to be due at a time", rem)
+		}
+		return map[string]interface{}{
+			"item_id":       item.ID,
+			"type":          "relative",
+			"minute_offset": int(rem.Before / time.Minute),
+		}, nil
+	}
+	day := now
+	if item.Due != nil {
+		t, _, err := parseDue(item.Due)
+		if err != nil {
+			return nil, err
+		}
+		day = t
+	}
+	y, m, d := day.Date()
+	at := time.Date(y, m, d, rem.Hour, rem.Minute, 0, 0, time.Local)
+	if item.Due == nil && at.Before(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return map[string]interface{}{
+		"item_id": item.ID,
+		"type":    "absolute",
+		"due":     map[string]string{"date": at.Format("2006-01-02T15:04:05")},
+	}, nil
+}
+
+// applyReminders adds the reminders in an m:rem label's value to an item, removing the label first
+// so that a failure part way through doesn't add any reminder twice when it is tried again.
+// Any reminders that couldn't be added are put back in the label, to be tried at the next refresh.
+func applyReminders(ctx context.Context, ts todoistBackend, item todoist.Item, label, value string, mutate bool) error {
+	rems, err := parseReminders(value)
+	if err != nil {
+		return err
+	}
+	var args []map[string]interface{}
+	for _, rem := range rems {
+		a, err := reminderArgs(item, rem, time.Now())
+		if err != nil {
+			return err
+		}
+		args = append(args, a)
+	}
+	if !mutate {
+		log.Printf("Would add reminders %v to %s (%q)...", rems, item.ID, item.Content)
+		return nil
+	}
+	if err := removeLabel(ctx, ts, item, label, mutate); err != nil {
+		return err
+	}
+	parts := strings.Split(value, "+") // parallel to rems
+	for i, a := range args {
+		if err := ts.AddReminder(ctx, a); err != nil {
+			err = fmt.Errorf("adding reminder %v: %w", rems[i], err)
+			var labels []string
+			for _, l := range item.Labels {
+				if l != label {
+					labels = append(labels, l)
+				}
+			}
+			labels = append(labels, "m:rem="+strings.Join(parts[i:], "+"))
+			if lerr := ts.UpdateItem(ctx, item.ID, todoist.ItemUpdates{Labels: &labels}); lerr != nil {
+				return fmt.Errorf("%w (and putting back the rest of the label: %v)", err, lerr)
+			}
+			return err
+		}
+	}
+	log.Printf("Added reminders %v to %q", rems, item.Content)
+	return nil
+}
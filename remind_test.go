@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestParseReminders(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []reminder
+	}{
+		{"30m", []reminder{{Before: 30 * time.Minute}}},
+		{"30m+10m", []reminder{{Before: 30 * time.Minute}, {Before: 10 * time.Minute}}},
+		{"1h30m", []reminder{{Before: 90 * time.Minute}}},
+		{"7:30am", []reminder{{At: true, Hour: 7, Minute: 30}}},
+		{"7:30PM", []reminder{{At: true, Hour: 19, Minute: 30}}},
+		{"9am+1h", []reminder{{At: true, Hour: 9}, {Before: time.Hour}}},
+		{"18:45", []reminder{{At: true, Hour: 18, Minute: 45}}},
+
+		{"", nil},
+		{"30s", nil},
+		{"-10m", nil},
+		{"30m+", nil},
+		{"soon", nil},
+		{"25:00", nil},
+	}
+	for _, test := range tests {
+		got, err := parseReminders(test.in)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseReminders(%q) = %v, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseReminders(%q): %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseReminders(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestApplyReminders(t *testing.T) {
+	ft := newFakeTodoist()
+	ft.data.Items = map[string]todoist.Item{
+		"1": {ID: "1", ProjectID: "p1", Content: "leave for airport", Due: &todoist.Due{Date: "2030-06-12T15:00:00"}, Labels: []string{"m:rem=30m+10m", "outside"}},
+		"2": {ID: "2", ProjectID: "p1", Content: "put bins out", Due: &todoist.Due{Date: "2030-06-12"}, Labels: []string{"m:rem=7:30pm"}},
+		"3": {ID: "3", ProjectID: "p1", Content: "water plants", Due: &todoist.Due{Date: "2030-06-12"}, Labels: []string{"m:rem=10m"}},
+	}
+	ApplyMetadata(context.Background(), ft, MetadataConfig{}, true)
+
+	want := map[string][]map[string]interface{}{
+		"1": {
+			{"item_id": "1", "type": "relative", "minute_offset": 30},
+			{"item_id": "1", "type": "relative", "minute_offset": 10},
+		},
+		"2": {
+			{"item_id": "2", "type": "absolute", "due": map[string]string{"date": "2030-06-12T19:30:00"}},
+		},
+	}
+	if !reflect.DeepEqual(ft.reminders, want) {
+		t.Errorf("Reminders added:\n got %v\nwant %v", ft.reminders, want)
+	}
+	if got := ft.data.Items["1"].Labels; !reflect.DeepEqual(got, []string{"outside"}) {
+		t.Errorf("After adding reminders, labels are %q, want only outside", got)
+	}
+	// A relative reminder needs a time, so the last task is left alone.
+	if got := ft.data.Items["3"].Labels; len(got) != 1 {
+		t.Errorf("Task without a due time has labels %q, want m:rem kept", got)
+	}
+
+	// If adding a reminder fails, only the reminders not yet added are tried again.
+	ft.data.Items["5"] = todoist.Item{ID: "5", ProjectID: "p1", Content: "pick up kids", Due: &todoist.Due{Date: "2030-06-12T15:00:00"}, Labels: []string{"m:rem=1h+30m+10m"}}
+	ft.reminderErr = func(args map[string]interface{}) error {
+		if args["minute_offset"] == 30 {
+			return errors.New("reminder limit reached")
+		}
+		return nil
+	}
+	ApplyMetadata(context.Background(), ft, MetadataConfig{}, true)
+	if got := ft.data.Items["5"].Labels; !reflect.DeepEqual(got, []string{"m:rem=30m+10m"}) {
+		t.Errorf("After failing to add a reminder, labels are %q, want m:rem=30m+10m", got)
+	}
+	ft.reminderErr = nil
+	ApplyMetadata(context.Background(), ft, MetadataConfig{}, true)
+	var offsets []interface{}
+	for _, a := range ft.reminders["5"] {
+		offsets = append(offsets, a["minute_offset"])
+	}
+	if want := []interface{}{60, 30, 10}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("After retrying, reminders at %v minutes before, want %v", offsets, want)
+	}
+	if got := ft.data.Items["5"].Labels; len(got) != 0 {
+		t.Errorf("After retrying, labels are %q, want none", got)
+	}
+
+	// m:rem can be disabled like any other metadata label, whatever its value.
+	ft.data.Items["4"] = todoist.Item{ID: "4", ProjectID: "p1", Content: "call mum", Labels: []string{"m:rem=9am"}}
+	ApplyMetadata(context.Background(), ft, MetadataConfig{Disable: []string{"m:rem"}}, true)
+	if len(ft.reminders["4"]) != 0 {
+		t.Errorf("Disabled m:rem added reminders %v", ft.reminders["4"])
+	}
+}
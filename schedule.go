@@ -0,0 +1,141 @@
+package main
+
+// Scheduled photos, which take the place of the random photo for a range of dates.
+//
+// The schedule is encoded in the filename, as
+//	YYYY-MM-DD_YYYY-MM-DD_name.png
+// covering the two dates inclusively.
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+type scheduledPhoto struct {
+	From, To time.Time // inclusive, at midnight local time
+	Name     string
+	Filename string
+}
+
+// Active reports whether the photo is scheduled for the given day.
+func (sp scheduledPhoto) Active(day time.Time) bool {
+	return !day.Before(sp.From) && !day.After(sp.To)
+}
+
+var scheduledPhotoRE = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})_(\d{4}-\d{2}-\d{2})_(.*)\.png$`)
+
+// scheduledPhotos returns the scheduled photos in dir, ordered by start date.
+func scheduledPhotos(dir string) ([]scheduledPhoto, error) {
+	dir, err := expandHome(dir)
+	if err != nil {
+		return nil, err
+	}
+	des, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil // nothing uploaded yet
+	} else if err != nil {
+		return nil, fmt.Errorf("reading scheduled photos dir: %w", err)
+	}
+	var sps []scheduledPhoto
+	for _, de := range des {
+		m := scheduledPhotoRE.FindStringSubmatch(de.Name())
+		if m == nil {
+			continue
+		}
+		from, err1 := time.ParseInLocation("2006-01-02", m[1], time.Local)
+		to, err2 := time.ParseInLocation("2006-01-02", m[2], time.Local)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		sps = append(sps, scheduledPhoto{
+			From:     from,
+			To:       to,
+			Name:     m[3],
+			Filename: filepath.Join(dir, de.Name()),
+		})
+	}
+	sort.Slice(sps, func(i, j int) bool { return sps[i].From.Before(sps[j].From) })
+	return sps, nil
+}
+
+// activeScheduledPhoto returns the filename of the photo scheduled for the given day, if any.
+// If more than one is scheduled, the one that started most recently wins.
+func activeScheduledPhoto(dir string, day time.Time) (string, error) {
+	y, m, d := day.Date()
+	day = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+
+	sps, err := scheduledPhotos(dir)
+	if err != nil {
+		return "", err
+	}
+	for i := len(sps) - 1; i >= 0; i-- {
+		if sps[i].Active(day) {
+			return sps[i].Filename, nil
+		}
+	}
+	return "", nil
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// saveScheduledPhoto decodes an image, shrinks it to fit within maxSize (the panel),
+// and saves it in dir scheduled for the given dates.
+func saveScheduledPhoto(dir string, from, to time.Time, name string, r io.Reader, maxSize image.Point) (string, error) {
+	dir, err := expandHome(dir)
+	if err != nil {
+		return "", err
+	}
+	if to.Before(from) {
+		return "", fmt.Errorf("schedule ends (%s) before it starts (%s)", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return "", fmt.Errorf("decoding image: %w", err)
+	}
+
+	// Shrink to fit, preserving the aspect ratio.
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	if w > maxSize.X {
+		w, h = maxSize.X, h*maxSize.X/w
+	}
+	if h > maxSize.Y {
+		w, h = w*maxSize.Y/h, maxSize.Y
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, sb, xdraw.Src, nil)
+
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(strings.TrimSuffix(name, filepath.Ext(name)), "-"), "-")
+	if name == "" {
+		name = "photo"
+	}
+	filename := filepath.Join(dir, from.Format("2006-01-02")+"_"+to.Format("2006-01-02")+"_"+name+".png")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	if err := png.Encode(f, dst); err != nil {
+		f.Close()
+		return "", fmt.Errorf("encoding PNG: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
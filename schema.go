@@ -0,0 +1,246 @@
+package main
+
+// A JSON Schema (https://json-schema.org) for the config file, generated from Config.
+// Editors can use it to autocomplete and check config.yaml; print it with -print_schema.
+// It is also used to explain mistakes in the config file more clearly than the YAML decoder does.
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// jsonSchema is the subset of JSON Schema needed to describe Config.
+type jsonSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"` // empty for anything
+
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false, or a *jsonSchema
+
+	Items *jsonSchema `json:"items,omitempty"`
+
+	Pattern string `json:"pattern,omitempty"`
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationPattern matches what time.ParseDuration accepts.
+const durationPattern = `^[-+]?(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// configSchema returns the schema for Config.
+func configSchema() *jsonSchema {
+	s := schemaFor(reflect.TypeOf(Config{}))
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = "kitchenthing config"
+	return s
+}
+
+func schemaFor(t reflect.Type) *jsonSchema {
+	if t == durationType {
+		return &jsonSchema{Type: "string", Pattern: durationPattern, Description: "a duration, such as 10m or 1h30m"}
+	}
+	if t.Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		// It decodes itself, so could be anything.
+		return &jsonSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Struct:
+		s := &jsonSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*jsonSchema),
+			AdditionalProperties: false, // parseConfig is strict
+		}
+		addProperties(s, t)
+		return s
+	}
+	return &jsonSchema{}
+}
+
+// addProperties adds the fields of the struct type t to s, following the yaml package's rules.
+func addProperties(s *jsonSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+flags+",", ",inline,") {
+			addProperties(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		s.Properties[name] = schemaFor(f.Type)
+	}
+}
+
+// check checks a value decoded from YAML against the schema,
+// returning a description of each problem, prefixed with where it is.
+func (s *jsonSchema) check(v interface{}, path string) []string {
+	if v == nil {
+		// YAML null leaves anything as its zero value.
+		return nil
+	}
+	at := path
+	if at == "" {
+		at = "top level"
+	}
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: got %s, want a mapping", at, yamlKind(v))}
+		}
+		var probs []string
+		for _, k := range sortedKeys(m) {
+			key, ok := k.(string)
+			if !ok {
+				probs = append(probs, fmt.Sprintf("%s: key %v isn't a string", at, k))
+				continue
+			}
+			sub := path + "." + key
+			if path == "" {
+				sub = key
+			}
+			if ps, ok := s.Properties[key]; ok {
+				probs = append(probs, ps.check(m[k], sub)...)
+			} else if as, ok := s.AdditionalProperties.(*jsonSchema); ok {
+				probs = append(probs, as.check(m[k], sub)...)
+			} else {
+				msg := fmt.Sprintf("%s: unknown field %q", at, key)
+				if guess := closestProperty(s.Properties, key); guess != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", guess)
+				}
+				probs = append(probs, msg)
+			}
+		}
+		return probs
+	case "array":
+		l, ok := v.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: got %s, want a list", at, yamlKind(v))}
+		}
+		var probs []string
+		for i, x := range l {
+			probs = append(probs, s.Items.check(x, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return probs
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			msg := fmt.Sprintf("%s: got %s, want a string", at, yamlKind(v))
+			switch v.(type) {
+			case map[interface{}]interface{}, []interface{}:
+			default:
+				msg += " (quote it if it should be one)"
+			}
+			return []string{msg}
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			return []string{fmt.Sprintf("%s: %q isn't %s", at, str, s.Description)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%s: got %s, want true or false", at, yamlKind(v))}
+		}
+	case "integer":
+		switch v.(type) {
+		case int, int64, uint64:
+		default:
+			return []string{fmt.Sprintf("%s: got %s, want a whole number", at, yamlKind(v))}
+		}
+	case "number":
+		switch v.(type) {
+		case int, int64, uint64, float64:
+		default:
+			return []string{fmt.Sprintf("%s: got %s, want a number", at, yamlKind(v))}
+		}
+	}
+	return nil
+}
+
+// yamlKind describes the kind of a value decoded from YAML.
+func yamlKind(v interface{}) string {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return "a mapping"
+	case []interface{}:
+		return "a list"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func sortedKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	return keys
+}
+
+// closestProperty returns the property name closest to key, if any is close enough to be a likely typo.
+func closestProperty(props map[string]*jsonSchema, key string) string {
+	best, bestDist := "", 3 // only suggest names within two edits
+	for name := range props {
+		if d := editDistance(name, key); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if bestDist >= 3 {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
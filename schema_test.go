@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfigSchemaCheck(t *testing.T) {
+	const raw = `
+font: "x.ttf"
+refresh_perod: 10m
+refresh_period: 10 minutes
+footer:
+  order: [notes, {a: b}]
+accessibility_mode: yes please
+panel: {width: "800"}
+mqtt_publish:
+  qos: 1
+  topics:
+    foo: {retian: true}
+todoist_api_token: 12345
+`
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+	got := configSchema().check(v, "")
+	want := []string{
+		`accessibility_mode: got the string "yes please", want true or false`,
+		`footer.order[1]: got a mapping, want a string`,
+		`mqtt_publish.topics.foo: unknown field "retian" (did you mean "retain"?)`,
+		`panel.width: got the string "800", want a whole number`,
+		`refresh_period: "10 minutes" isn't a duration, such as 10m or 1h30m`,
+		`top level: unknown field "refresh_perod" (did you mean "refresh_period"?)`,
+		`todoist_api_token: got 12345, want a string (quote it if it should be one)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Problems:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestConfigSchemaAcceptsValid(t *testing.T) {
+	const raw = `
+font: "x.ttf"
+refresh_period: 1h30m
+messages:
+  - eq: 0
+    options: ["All done!"]
+mqtt_publish:
+  qos: 1
+  topics:
+    foo: {retain: false}
+regions:
+  - widget: tasks
+    height_percent: 50
+hass:
+  url: http://hass:8123
+panel_tuning:
+some_null:
+`
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+	probs := configSchema().check(v, "")
+	// some_null is the only problem.
+	if len(probs) != 1 {
+		t.Errorf("Problems with valid config: %q", probs)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"font", "font", 0},
+		{"font", "fnot", 2},
+		{"refresh_perod", "refresh_period", 1},
+		{"", "abc", 3},
+	} {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
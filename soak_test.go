@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+	"golang.org/x/image/font/gofont/gobold"
+)
+
+var (
+	soakDuration = flag.Duration("soak", 0, "simulated `duration` to run the soak test for; the test is skipped if zero")
+	soakSpeed    = flag.Int("soak_speed", 1000, "how many times faster than real time to run the soak test")
+)
+
+// TestSoak runs the main loop against fakes for a long simulated period,
+// checking that resource usage stays bounded and that the loop doesn't
+// keep mutating Todoist when nothing is changing.
+//
+// Run it with something like
+//
+//	go test -run=Soak -soak=168h -timeout=20m
+func TestSoak(t *testing.T) {
+	if *soakDuration == 0 {
+		t.Skip("soak test not requested; use -soak")
+	}
+	speed := time.Duration(*soakSpeed)
+	realDuration := *soakDuration / speed
+	t.Logf("Soaking for %v simulated (%v real)", *soakDuration, realDuration)
+
+	// Send logs through the server's log buffer, as in production.
+	s := &server{}
+	log.SetOutput(s)
+	defer log.SetOutput(os.Stderr)
+
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, gobold.TTF, 0644); err != nil {
+		t.Fatalf("Writing font: %v", err)
+	}
+
+	am := newFakeAlertmanager()
+	amSrv := httptest.NewServer(am)
+	defer amSrv.Close()
+
+	cfg := Config{
+		Font:          fontFile,
+		RefreshPeriod: 10 * time.Minute / speed,
+		Alertmanager:  strings.TrimPrefix(amSrv.URL, "http://"),
+		Messages:      []message{{Options: []string{"Soaking"}}},
+	}
+	cfg.Orderings = append(cfg.Orderings, struct {
+		Project string          `yaml:"project"`
+		Groups  []GroupPatterns `yaml:"groups"`
+	}{"House", []GroupPatterns{
+		{Name: "wet", Patterns: []string{"wash.*", "water.*"}},
+		{Name: "dry", Patterns: []string{"sweep.*", "dust.*"}},
+	}})
+
+	rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	state, err := loadState("")
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	ref, err := newRefresher(cfg, state)
+	if err != nil {
+		t.Fatalf("newRefresher: %v", err)
+	}
+	ft := newFakeTodoist()
+	ref.ts = ft
+	fp := newFakePaper()
+
+	runtime.GC()
+	startGoroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		loop(ctx, cfg, rend, ref, fp, state, nil, nil, nil, nil, nil, nil)
+	}()
+
+	// Every simulated half hour, change something in Todoist or Alertmanager.
+	// Every simulated day, check memory usage.
+	rnd := rand.New(rand.NewSource(1))
+	tick := time.NewTicker(30 * time.Minute / speed)
+	defer tick.Stop()
+	deadline := time.After(realDuration)
+	var heap []uint64 // sampled daily
+	for n := 0; ; n++ {
+		select {
+		case <-tick.C:
+		case <-deadline:
+			goto done
+		}
+		switch rnd.Intn(4) {
+		case 0, 1:
+			ft.mutate(rnd)
+		case 2:
+			am.mutate(rnd)
+		}
+		if n%48 == 0 {
+			var ms runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&ms)
+			heap = append(heap, ms.HeapAlloc)
+		}
+	}
+done:
+	cancel()
+	wg.Wait()
+
+	t.Logf("%d syncs, %d Todoist mutations, %d panel refreshes", ft.syncs, ft.totalMutations+ft.mutations, fp.refreshes)
+	if fp.refreshes == 0 {
+		t.Errorf("Panel was never refreshed")
+	}
+	if ft.storms > 0 {
+		t.Errorf("%d refreshes mutated Todoist even though nothing had changed", ft.storms)
+	}
+
+	// Memory should be roughly flat after the first day.
+	t.Logf("Heap samples: %v", heap)
+	if len(heap) > 2 {
+		first, last := heap[1], heap[len(heap)-1]
+		if last > 2*first+(4<<20) {
+			t.Errorf("Heap grew from %d to %d bytes", first, last)
+		}
+	}
+
+	// Everything started by the loop should have stopped.
+	http.DefaultClient.CloseIdleConnections()
+	time.Sleep(100 * time.Millisecond)
+	if n := runtime.NumGoroutine(); n > startGoroutines {
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Errorf("Goroutines went from %d to %d; stacks:\n%s", startGoroutines, n, buf)
+	}
+}
+
+// fakeTodoist is a todoistBackend that holds tasks in memory.
+type fakeTodoist struct {
+	mu     sync.Mutex
+	data   todoistData
+	nextID int
+
+	reminders   map[string][]map[string]interface{}     // reminder_add arguments, by item ID
+	reminderErr func(args map[string]interface{}) error // if non-nil, may fail AddReminder
+
+	syncs, mutations int // mutations are counted since the last sync
+	totalMutations   int
+	external         int    // external changes since the last sync
+	quiet            [2]int // external changes before the previous two syncs
+	storms           int    // refreshes that mutated without any external change
+}
+
+func newFakeTodoist() *fakeTodoist {
+	ft := &fakeTodoist{
+		data: todoistData{
+			Projects: map[string]todoist.Project{
+				"p1": {ID: "p1", Name: "House", Shared: true},
+			},
+			Collaborators: map[string]todoist.Collaborator{
+				"u1": {ID: "u1", FullName: "David Symonds"},
+			},
+			Items: make(map[string]todoist.Item),
+		},
+	}
+	for i := 0; i < 8; i++ {
+		ft.add(rand.New(rand.NewSource(int64(i))))
+	}
+	ft.external = 0
+	return ft
+}
+
+var fakeTaskNames = []string{"wash up", "water plants", "sweep floor", "dust shelves", "feed cat", "take out bins"}
+
+func (ft *fakeTodoist) add(rnd *rand.Rand) {
+	ft.nextID++
+	item := todoist.Item{
+		ID:         fmt.Sprint(ft.nextID),
+		ProjectID:  "p1",
+		Content:    fakeTaskNames[rnd.Intn(len(fakeTaskNames))],
+		Priority:   1 + rnd.Intn(4),
+		Due:        &todoist.Due{Date: time.Now().Format("2006-01-02")},
+		ChildOrder: ft.nextID,
+	}
+	if rnd.Intn(2) == 0 {
+		uid := "u1"
+		item.Responsible = &uid
+	}
+	ft.data.Items[item.ID] = item
+	ft.external++
+}
+
+// mutate makes an external change, as if someone used the Todoist app.
+func (ft *fakeTodoist) mutate(rnd *rand.Rand) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	if len(ft.data.Items) < 4 || (len(ft.data.Items) < 20 && rnd.Intn(2) == 0) {
+		ft.add(rnd)
+		return
+	}
+	// Complete an arbitrary task.
+	for id := range ft.data.Items {
+		delete(ft.data.Items, id)
+		break
+	}
+	ft.external++
+}
+
+func (ft *fakeTodoist) Sync(ctx context.Context) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	// Any mutations since the last sync were made by the previous refresh.
+	// If there were no external changes before either of the last two syncs,
+	// the previous refresh should have had nothing to do.
+	if ft.syncs >= 2 && ft.quiet[0] == 0 && ft.quiet[1] == 0 && ft.mutations > 0 {
+		ft.storms++
+	}
+	ft.quiet[0], ft.quiet[1] = ft.quiet[1], ft.external
+	ft.external = 0
+	ft.syncs++
+	ft.totalMutations += ft.mutations
+	ft.mutations = 0
+	return nil
+}
+
+func (ft *fakeTodoist) Data() todoistData {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	// Return a copy, since the fake changes concurrently.
+	td := todoistData{
+		Projects:      ft.data.Projects,
+		Collaborators: ft.data.Collaborators,
+		Items:         make(map[string]todoist.Item),
+	}
+	for id, item := range ft.data.Items {
+		item.Labels = append([]string(nil), item.Labels...)
+		td.Items[id] = item
+	}
+	return td
+}
+
+func (ft *fakeTodoist) Assign(ctx context.Context, item todoist.Item, assignee string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	it := ft.data.Items[item.ID]
+	it.Responsible = nil
+	if assignee != "" {
+		it.Responsible = &assignee
+	}
+	ft.data.Items[item.ID] = it
+	return nil
+}
+
+func (ft *fakeTodoist) UpdateItem(ctx context.Context, itemID string, updates todoist.ItemUpdates) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	it := ft.data.Items[itemID]
+	if updates.Content != nil {
+		it.Content = *updates.Content
+	}
+	if updates.Labels != nil {
+		it.Labels = append([]string(nil), *updates.Labels...)
+	}
+	ft.data.Items[itemID] = it
+	return nil
+}
+
+func (ft *fakeTodoist) DeleteItem(ctx context.Context, itemID string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	delete(ft.data.Items, itemID)
+	return nil
+}
+
+func (ft *fakeTodoist) CloseItem(ctx context.Context, itemID string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	delete(ft.data.Items, itemID)
+	return nil
+}
+
+func (ft *fakeTodoist) Reorder(ctx context.Context, itemIDs []string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	for i, id := range itemIDs {
+		it := ft.data.Items[id]
+		it.ChildOrder = i + 1
+		ft.data.Items[id] = it
+	}
+	return nil
+}
+
+// SetDue sets the due date as given, so it should be a plain date or time, not something like "tomorrow".
+func (ft *fakeTodoist) SetDue(ctx context.Context, itemID, due string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	it := ft.data.Items[itemID]
+	it.Due = &todoist.Due{Date: due}
+	ft.data.Items[itemID] = it
+	return nil
+}
+
+func (ft *fakeTodoist) Move(ctx context.Context, itemID, projectID string) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	it := ft.data.Items[itemID]
+	it.ProjectID = projectID
+	ft.data.Items[itemID] = it
+	return nil
+}
+
+func (ft *fakeTodoist) AddReminder(ctx context.Context, args map[string]interface{}) error {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.mutations++
+	if ft.reminderErr != nil {
+		if err := ft.reminderErr(args); err != nil {
+			return err
+		}
+	}
+	if ft.reminders == nil {
+		ft.reminders = make(map[string][]map[string]interface{})
+	}
+	id := args["item_id"].(string)
+	ft.reminders[id] = append(ft.reminders[id], args)
+	return nil
+}
+
+// fakeAlertmanager serves a changing set of alerts.
+type fakeAlertmanager struct {
+	mu     sync.Mutex
+	alerts []*gettableAlert
+}
+
+func newFakeAlertmanager() *fakeAlertmanager { return &fakeAlertmanager{} }
+
+func (fa *fakeAlertmanager) mutate(rnd *rand.Rand) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	if len(fa.alerts) > 0 && rnd.Intn(2) == 0 {
+		fa.alerts = fa.alerts[1:]
+		return
+	}
+	fa.alerts = append(fa.alerts, &gettableAlert{
+		Fingerprint: fmt.Sprint(rnd.Int63()),
+		Annotations: map[string]string{
+			"summary":     "Something broke",
+			"description": fmt.Sprintf("Thing %d is broken", rnd.Intn(5)),
+		},
+	})
+}
+
+func (fa *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	json.NewEncoder(w).Encode(fa.alerts)
+}
+
+// fakePaper is a display that renders to memory.
+type fakePaper struct {
+	*image.Paletted
+	refreshes int
+}
+
+func newFakePaper() *fakePaper {
+	return &fakePaper{Paletted: image.NewPaletted(image.Rect(0, 0, 800, 480), staticPalette)}
+}
+
+func (fp *fakePaper) Init() error {
+	draw.Draw(fp, fp.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	return nil
+}
+
+func (fp *fakePaper) DisplayRefresh() error { fp.refreshes++; return nil }
+func (fp *fakePaper) Sleep()                {}
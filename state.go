@@ -0,0 +1,143 @@
+package main
+
+// Persistent state, kept across restarts.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is everything that is persisted in the state file.
+type State struct {
+	// HiddenPhotos are the base names of photos excluded from random selection.
+	HiddenPhotos []string `json:"hidden_photos,omitempty"`
+
+	// PhotoStats records how each photo has been displayed, keyed by base name.
+	// ShowingPhoto is the base name of the photo displayed since ShowingSince.
+	PhotoStats   map[string]photoStat `json:"photo_stats,omitempty"`
+	ShowingPhoto string               `json:"showing_photo,omitempty"`
+	ShowingSince time.Time            `json:"showing_since"`
+	// PhotoShuffle is where photo_order: shuffle is up to.
+	PhotoShuffle photoShuffle `json:"photo_shuffle"`
+
+	// Notes are the household notes, one per line.
+	Notes string `json:"notes,omitempty"`
+
+	// PanelRefreshes counts full refreshes of the panel, ever.
+	PanelRefreshes int `json:"panel_refreshes,omitempty"`
+	// RefreshesToday counts full refreshes on RefreshDay (YYYY-MM-DD).
+	RefreshDay     string `json:"refresh_day,omitempty"`
+	RefreshesToday int    `json:"refreshes_today,omitempty"`
+
+	// OpenTasks are the open tasks as of the last refresh, keyed by ID,
+	// for noticing transitions. If it is missing, the next refresh only records it.
+	OpenTasks map[string]openTask `json:"open_tasks,omitempty"`
+	// FiredTaskEvents records when task events were fired,
+	// keyed by transition, event type and task ID.
+	FiredTaskEvents map[string]time.Time `json:"fired_task_events,omitempty"`
+	// PendingTaskEvents are task events that Home Assistant couldn't be sent, oldest first.
+	PendingTaskEvents []pendingTaskEvent `json:"pending_task_events,omitempty"`
+
+	// ChimedTasks records when a chime was made for new P1 tasks, keyed by task ID and due date.
+	// If it is missing, the next refresh only records the current tasks.
+	ChimedTasks map[string]time.Time `json:"chimed_tasks"`
+
+	// Fairness tallies assignments and completions by day (YYYY-MM-DD), then by person.
+	Fairness map[string]map[string]fairnessCount `json:"fairness,omitempty"`
+
+	// InProgressSince records when each task, keyed by ID, was first seen with the in-progress label.
+	InProgressSince map[string]time.Time `json:"in_progress_since,omitempty"`
+
+	// Completions counts completed tasks by day (YYYY-MM-DD), for the completions chart.
+	Completions map[string]int `json:"completions,omitempty"`
+
+	// CompletedTasks are the tasks completed in the last week, for the completed tasks feed.
+	CompletedTasks []completedTask `json:"completed_tasks,omitempty"`
+}
+
+// stateStore guards a State, saving it to a file after each update.
+// If it has no filename, the state is only kept in memory.
+type stateStore struct {
+	filename string
+
+	mu sync.Mutex
+	st State
+}
+
+// loadState loads the state from filename, which does not need to exist yet.
+func loadState(filename string) (*stateStore, error) {
+	ss := &stateStore{filename: filename}
+	if filename == "" {
+		return ss, nil
+	}
+	raw, err := ioutil.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ss, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &ss.st); err != nil {
+		return nil, fmt.Errorf("parsing state file %s: %w", filename, err)
+	}
+	return ss, nil
+}
+
+// View calls f with the state. f must not retain or modify it.
+func (ss *stateStore) View(f func(st *State)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	f(&ss.st)
+}
+
+// Update calls f to modify the state, then saves it.
+// The modification is kept in memory even if saving fails.
+func (ss *stateStore) Update(f func(st *State)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	f(&ss.st)
+	return ss.save()
+}
+
+func (ss *stateStore) save() error {
+	if ss.filename == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(&ss.st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+	if err := writeFileAtomic(ss.filename, raw); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place,
+// so a power cut can't leave a truncated file.
+func writeFileAtomic(filename string, raw []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
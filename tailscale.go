@@ -0,0 +1,30 @@
+package main
+
+// Serving directly on a tailnet (https://tailscale.com), as its own node,
+// so the web UI is reachable away from home without port forwarding.
+//
+// This needs tailscale.com/tsnet (required in go.mod), which is large, so it is
+// only built in with the tsnet build tag:
+//
+//	go build -tags tsnet
+
+type TailscaleConfig struct {
+	// Hostname is the node's name on the tailnet. It defaults to "kitchenthing".
+	Hostname string `yaml:"hostname"`
+
+	// StateDir is where the node's identity is kept.
+	// It defaults to "tailscale" in the top-level state_dir if that is set,
+	// or else to a directory under the user's config directory.
+	StateDir string `yaml:"state_dir"`
+
+	// AuthKey authorizes the node to join the tailnet the first time.
+	// If empty, $TS_AUTHKEY is used, or else a login URL is logged.
+	AuthKey string `yaml:"auth_key"`
+}
+
+func (tc TailscaleConfig) hostname() string {
+	if tc.Hostname == "" {
+		return "kitchenthing"
+	}
+	return tc.Hostname
+}
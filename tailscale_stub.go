@@ -0,0 +1,14 @@
+//go:build !tsnet
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+const tailscaleSupported = false
+
+func listenTailscale(tc TailscaleConfig, port string) (net.Listener, error) {
+	return nil, fmt.Errorf("serving on %s:%s needs a build with the tsnet tag", tc.hostname(), port)
+}
@@ -0,0 +1,45 @@
+//go:build tsnet
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"tailscale.com/tsnet"
+)
+
+const tailscaleSupported = true
+
+var (
+	tsMu     sync.Mutex
+	tsServer *tsnet.Server // shared by all tailscale: listeners
+)
+
+func listenTailscale(tc TailscaleConfig, port string) (net.Listener, error) {
+	tsMu.Lock()
+	defer tsMu.Unlock()
+	if tsServer == nil {
+		srv := &tsnet.Server{
+			Hostname: tc.hostname(),
+			Dir:      tc.StateDir,
+			AuthKey:  tc.AuthKey,
+			Logf:     tailscaleLogf,
+		}
+		if err := srv.Start(); err != nil {
+			return nil, fmt.Errorf("starting Tailscale: %w", err)
+		}
+		tsServer = srv
+	}
+	return tsServer.Listen("tcp", ":"+port)
+}
+
+// tailscaleLogf logs only how to log the node in; the rest of tsnet's logging is far too chatty.
+func tailscaleLogf(format string, args ...any) {
+	if strings.Contains(format, "AUTHKEY") {
+		log.Printf("Tailscale: "+format, args...)
+	}
+}
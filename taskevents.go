@@ -0,0 +1,290 @@
+package main
+
+// Home Assistant events for Todoist task transitions, such as completion.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// Task transitions that can fire events.
+const (
+	taskCompleted = "completed"
+	taskOverdue   = "overdue"  // was not overdue as of the previous refresh, but now is
+	taskAssigned  = "assigned" // new, or assigned to someone else since the previous refresh
+)
+
+const (
+	completionEvent = "todoist_task_completed"
+
+	// A task that makes the same transition again within this window
+	// (e.g. completed, reopened and completed again) only fires one event.
+	taskEventDedupeWindow = 24 * time.Hour
+
+	// At most this many events are fired per refresh. Anything beyond that
+	// is more likely to be a glitch (e.g. a mass reschedule) than a burst of chores.
+	maxTaskEvents = 10
+)
+
+// HASSEventConfig is a Home Assistant event to fire when a task in a shared project makes a transition.
+type HASSEventConfig struct {
+	When string `yaml:"when"` // "completed", "overdue" or "assigned"
+	Type string `yaml:"type"` // event type, e.g. "chore_done"
+
+	// Data is a text/template for the event data, which must produce a JSON object.
+	// It is executed with a taskEvent, and the json function formats a value as JSON.
+	// It defaults to an object with the task's id, content, project and assignee.
+	Data string `yaml:"data"`
+}
+
+const defaultTaskEventData = `{"id": {{json .ID}}, "content": {{json .Content}}, "project": {{json .Project}}, "assignee": {{json .Assignee}}}`
+
+// taskEvent is what event data templates are executed with.
+type taskEvent struct {
+	When string // "completed", "overdue" or "assigned"
+	ID   string
+	openTask
+}
+
+// taskEventer fires one configured event.
+type taskEventer struct {
+	when, typ string
+	data      *template.Template
+}
+
+// parseTaskEvents prepares the configured task events.
+func parseTaskEvents(cfg HASSConfig) ([]taskEventer, error) {
+	evs := cfg.Events
+	if cfg.CompletionEvents {
+		evs = append(evs, HASSEventConfig{When: taskCompleted, Type: completionEvent})
+	}
+	var res []taskEventer
+	for _, ev := range evs {
+		if ev.When != taskCompleted && ev.When != taskOverdue && ev.When != taskAssigned {
+			return nil, fmt.Errorf("event %q has unknown when %q", ev.Type, ev.When)
+		}
+		if ev.Type == "" {
+			return nil, fmt.Errorf("%s event has no type", ev.When)
+		}
+		data := ev.Data
+		if data == "" {
+			data = defaultTaskEventData
+		}
+		tmpl, err := template.New(ev.Type).Funcs(template.FuncMap{"json": jsonString}).Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing data template for event %q: %w", ev.Type, err)
+		}
+		res = append(res, taskEventer{when: ev.When, typ: ev.Type, data: tmpl})
+	}
+	return res, nil
+}
+
+func jsonString(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	return string(raw), err
+}
+
+// eventData executes the data template, checking that it produces a JSON object.
+func (te taskEventer) eventData(ev taskEvent) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := te.data.Execute(&buf, ev); err != nil {
+		return nil, fmt.Errorf("executing data template: %w", err)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &obj); err != nil {
+		return nil, fmt.Errorf("data template did not produce a JSON object: %w", err)
+	}
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// openTask is what is remembered about an open task, so transitions can be noticed and described.
+type openTask struct {
+	Content  string `json:"content"`
+	Project  string `json:"project"`
+	Assignee string `json:"assignee,omitempty"`
+	Priority int    `json:"priority,omitempty"` // 4 is highest, as in the Todoist API
+	Due      string `json:"due,omitempty"`      // date, optionally with time, as in the Todoist API
+	Overdue  bool   `json:"overdue,omitempty"`
+}
+
+// openTasks returns the open tasks in shared projects, keyed by ID.
+func openTasks(td todoistData, now time.Time) map[string]openTask {
+	m := make(map[string]openTask)
+	for _, item := range td.Items {
+		proj := td.Projects[item.ProjectID]
+		if !proj.Shared {
+			continue
+		}
+		ot := openTask{Content: item.Content, Project: proj.Name, Priority: item.Priority}
+		if item.Responsible != nil {
+			ot.Assignee = td.Collaborators[*item.Responsible].FullName
+		}
+		if item.Due != nil {
+			ot.Due = item.Due.Date
+			ot.Overdue = dueWhen(item.Due, now) < 0
+		}
+		m[item.ID] = ot
+	}
+	return m
+}
+
+// taskTransitions returns the transitions between baseline and open, ordered by task ID.
+// Todoist doesn't distinguish completion from deletion in what we sync,
+// so a deleted task counts as completed too.
+func taskTransitions(baseline, open map[string]openTask) []taskEvent {
+	var res []taskEvent
+	for id, old := range baseline {
+		cur, ok := open[id]
+		if !ok {
+			res = append(res, taskEvent{When: taskCompleted, ID: id, openTask: old})
+			continue
+		}
+		if cur.Overdue && !old.Overdue {
+			res = append(res, taskEvent{When: taskOverdue, ID: id, openTask: cur})
+		}
+		if cur.Assignee != "" && cur.Assignee != old.Assignee {
+			res = append(res, taskEvent{When: taskAssigned, ID: id, openTask: cur})
+		}
+	}
+	for id, cur := range open {
+		if _, ok := baseline[id]; !ok && cur.Assignee != "" {
+			res = append(res, taskEvent{When: taskAssigned, ID: id, openTask: cur})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// trackTasks notices task transitions since the previous refresh, firing the configured
+// Home Assistant events and tallying assignments and completions for the fairness report,
+// the completions chart and the completed tasks feed.
+// The set of open tasks is persisted, so a restart neither loses nor repeats transitions.
+// It reports whether talking to Home Assistant worked.
+func (r *refresher) trackTasks(ctx context.Context, td todoistData, now time.Time) (ok bool) {
+	open := openTasks(td, now)
+
+	var baseline map[string]openTask
+	var pending []pendingTaskEvent
+	fired := make(map[string]time.Time)
+	r.state.View(func(st *State) {
+		baseline = st.OpenTasks
+		pending = append(pending, st.PendingTaskEvents...)
+		for key, t := range st.FiredTaskEvents {
+			if now.Sub(t) < taskEventDedupeWindow {
+				fired[key] = t
+			}
+		}
+	})
+	if baseline == nil {
+		// First run, so there's nothing to compare against.
+		log.Printf("Recorded baseline of %d open tasks for task tracking", len(open))
+		r.saveTaskEvents(open, fired, pending, nil, 0, nil, now)
+		return true
+	}
+
+	// Events that failed before go first, sharing the limit on events per refresh.
+	pending, n, ok := r.retryTaskEvents(ctx, pending, maxTaskEvents, now)
+	throttled := 0
+	var tallies []taskEvent
+	completed := 0
+	var feed []completedTask
+	for _, ev := range taskTransitions(baseline, open) {
+		if r.cfg.Footer.Completions && ev.When == taskCompleted {
+			key := "completions " + ev.ID
+			if _, ok := fired[key]; !ok {
+				completed++
+				fired[key] = now
+			}
+		}
+		if r.cfg.CompletedFeed && ev.When == taskCompleted {
+			key := "feed " + ev.ID
+			if _, ok := fired[key]; !ok {
+				feed = append(feed, completedTask{ID: ev.ID, At: now, openTask: ev.openTask})
+				fired[key] = now
+			}
+		}
+		if r.cfg.Fairness.Enabled && ev.When != taskOverdue && ev.Assignee != "" {
+			key := "fairness " + ev.When + " " + ev.ID + " " + ev.Assignee
+			if _, ok := fired[key]; !ok {
+				tallies = append(tallies, ev)
+				fired[key] = now
+			}
+		}
+		for _, te := range r.taskEvents {
+			if te.when != ev.When {
+				continue
+			}
+			key := ev.When + " " + te.typ + " " + ev.ID
+			if _, ok := fired[key]; ok {
+				continue
+			}
+			if n >= maxTaskEvents {
+				throttled++
+				continue
+			}
+			data, err := te.eventData(ev)
+			if err != nil {
+				// Retrying won't help.
+				log.Printf("Preparing %s event for task %s: %v", te.typ, ev.ID, err)
+				continue
+			}
+			n++
+			fired[key] = now
+			if err := r.hass.FireEvent(ctx, te.typ, data); err != nil {
+				log.Printf("Firing %s event for task %s: %v; queueing it to retry", te.typ, ev.ID, err)
+				pending = queueTaskEvent(pending, te.typ, data, now)
+				ok = false
+			}
+		}
+	}
+	if throttled > 0 {
+		log.Printf("Fired %d task events this refresh; dropped %d more", n, throttled)
+	}
+	r.saveTaskEvents(open, fired, pending, tallies, completed, feed, now)
+	return ok
+}
+
+func (r *refresher) saveTaskEvents(open map[string]openTask, fired map[string]time.Time, pending []pendingTaskEvent, tallies []taskEvent, completed int, feed []completedTask, now time.Time) {
+	if len(fired) == 0 {
+		fired = nil
+	}
+	// Avoid rewriting the state file when nothing has changed.
+	same := false
+	r.state.View(func(st *State) {
+		same = st.OpenTasks != nil && reflect.DeepEqual(st.OpenTasks, open) && reflect.DeepEqual(st.FiredTaskEvents, fired) &&
+			reflect.DeepEqual(st.PendingTaskEvents, pending)
+	})
+	if same && len(tallies) == 0 && completed == 0 && len(feed) == 0 {
+		return
+	}
+	err := r.state.Update(func(st *State) {
+		st.OpenTasks = open
+		st.FiredTaskEvents = fired
+		st.PendingTaskEvents = pending
+		if len(tallies) > 0 && st.Fairness == nil {
+			st.Fairness = make(map[string]map[string]fairnessCount)
+		}
+		for _, ev := range tallies {
+			tallyFairness(st.Fairness, ev, now)
+		}
+		pruneFairness(st.Fairness, now)
+		if completed > 0 {
+			if st.Completions == nil {
+				st.Completions = make(map[string]int)
+			}
+			st.Completions[now.Format("2006-01-02")] += completed
+		}
+		pruneCompletions(st.Completions, now)
+		st.CompletedTasks = pruneCompletedTasks(append(st.CompletedTasks, feed...), now)
+	})
+	if err != nil {
+		log.Printf("Saving state: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestTaskEventsCompletion(t *testing.T) {
+	var fired []string // task IDs
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/events/"+completionEvent {
+			t.Errorf("Request to unexpected path %s", r.URL.Path)
+		}
+		if failing {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		var data map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("Decoding event data: %v", err)
+		}
+		fired = append(fired, data["id"])
+	}))
+	defer srv.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	newRef := func() *refresher {
+		state, err := loadState(stateFile)
+		if err != nil {
+			t.Fatalf("loadState: %v", err)
+		}
+		hcfg := HASSConfig{URL: srv.URL, CompletionEvents: true}
+		evs, err := parseTaskEvents(hcfg)
+		if err != nil {
+			t.Fatalf("parseTaskEvents: %v", err)
+		}
+		return &refresher{hass: NewHASS(hcfg), state: state, taskEvents: evs}
+	}
+
+	td := todoistData{
+		Projects: map[string]todoist.Project{
+			"p1": {ID: "p1", Name: "House", Shared: true},
+			"p2": {ID: "p2", Name: "Mine"},
+		},
+		Items: make(map[string]todoist.Item),
+	}
+	for i := 1; i <= 20; i++ {
+		id := fmt.Sprint(i)
+		td.Items[id] = todoist.Item{ID: id, ProjectID: "p1", Content: "task " + id}
+	}
+	td.Items["mine"] = todoist.Item{ID: "mine", ProjectID: "p2"}
+	now := time.Now()
+	check := func(r *refresher, wantOK bool, want ...string) {
+		t.Helper()
+		fired = nil
+		if ok := r.trackTasks(context.Background(), td, now); ok != wantOK {
+			t.Errorf("trackTasks reported %t, want %t", ok, wantOK)
+		}
+		if !reflect.DeepEqual(fired, want) {
+			t.Errorf("Fired events for %q, want %q", fired, want)
+		}
+	}
+
+	// The first run only records a baseline, even though everything looks new.
+	r := newRef()
+	check(r, true)
+
+	// Completing a task fires an event, but completing a private one doesn't.
+	delete(td.Items, "3")
+	delete(td.Items, "mine")
+	check(r, true, "3")
+	check(r, true)
+
+	// A restart doesn't repeat anything.
+	r = newRef()
+	check(r, true)
+
+	// Failures are queued, and retried with backoff, even across a restart.
+	delete(td.Items, "4")
+	failing = true
+	check(r, false)
+	now = now.Add(minTaskEventBackoff)
+	check(r, false) // the retry fails too
+	failing = false
+	now = now.Add(minTaskEventBackoff)
+	check(r, true) // not yet
+	r = newRef()
+	now = now.Add(minTaskEventBackoff)
+	check(r, true, "4")
+	check(r, true)
+
+	// A task completed, reopened and completed again only fires once.
+	td.Items["4"] = todoist.Item{ID: "4", ProjectID: "p1"}
+	check(r, true)
+	delete(td.Items, "4")
+	check(r, true)
+	// ... unless it's been long enough.
+	td.Items["4"] = todoist.Item{ID: "4", ProjectID: "p1"}
+	check(r, true)
+	now = now.Add(taskEventDedupeWindow)
+	delete(td.Items, "4")
+	check(r, true, "4")
+
+	// A sudden mass completion is throttled.
+	for i := 5; i <= 20; i++ {
+		delete(td.Items, fmt.Sprint(i))
+	}
+	fired = nil
+	r.trackTasks(context.Background(), td, now)
+	if len(fired) != maxTaskEvents {
+		t.Errorf("Mass completion fired %d events, want %d", len(fired), maxTaskEvents)
+	}
+	check(r, true)
+}
+
+func TestTaskEventBackoff(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{10, time.Hour},
+	} {
+		if got := taskEventBackoff(test.attempts); got != test.want {
+			t.Errorf("taskEventBackoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+
+	now := time.Now()
+	var pending []pendingTaskEvent
+	for i := 0; i < maxPendingTaskEvents+5; i++ {
+		pending = queueTaskEvent(pending, fmt.Sprint(i), json.RawMessage(`{}`), now)
+	}
+	if len(pending) != maxPendingTaskEvents || pending[0].Type != "5" {
+		t.Errorf("After overfilling the queue, it has %d events starting with %q, want %d starting with %q", len(pending), pending[0].Type, maxPendingTaskEvents, "5")
+	}
+}
+
+func TestTaskEventsTemplate(t *testing.T) {
+	type event struct {
+		Type string
+		Data map[string]interface{}
+	}
+	var fired []event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := event{Type: strings.TrimPrefix(r.URL.Path, "/api/events/")}
+		if err := json.NewDecoder(r.Body).Decode(&ev.Data); err != nil {
+			t.Errorf("Decoding event data: %v", err)
+		}
+		fired = append(fired, ev)
+	}))
+	defer srv.Close()
+
+	hcfg := HASSConfig{
+		URL: srv.URL,
+		Events: []HASSEventConfig{
+			{When: "completed", Type: "chore_done", Data: `{"who": {{json .Assignee}}, "what": {{json .Content}}, "p": {{.Priority}}}`},
+			{When: "overdue", Type: "chore_late"},
+		},
+	}
+	evs, err := parseTaskEvents(hcfg)
+	if err != nil {
+		t.Fatalf("parseTaskEvents: %v", err)
+	}
+	state, _ := loadState("")
+	r := &refresher{hass: NewHASS(hcfg), state: state, taskEvents: evs}
+
+	uid := "u1"
+	td := todoistData{
+		Projects:      map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Collaborators: map[string]todoist.Collaborator{"u1": {ID: "u1", FullName: "Jo \"Quotes\" Bloggs"}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "wash up", Priority: 4, Responsible: &uid},
+			"2": {ID: "2", ProjectID: "p1", Content: "water plants", Due: &todoist.Due{Date: "2024-06-12T18:00:00"}},
+		},
+	}
+	now := time.Date(2024, time.June, 12, 17, 0, 0, 0, time.Local)
+	r.trackTasks(context.Background(), td, now)
+
+	delete(td.Items, "1")
+	now = now.Add(2 * time.Hour)
+	if !r.trackTasks(context.Background(), td, now) {
+		t.Errorf("trackTasks failed")
+	}
+	want := []event{
+		{"chore_done", map[string]interface{}{"who": `Jo "Quotes" Bloggs`, "what": "wash up", "p": 4.0}},
+		{"chore_late", map[string]interface{}{"id": "2", "content": "water plants", "project": "House", "assignee": ""}},
+	}
+	if !reflect.DeepEqual(fired, want) {
+		t.Errorf("Fired events:\n got %+v\nwant %+v", fired, want)
+	}
+}
+
+func TestParseTaskEventsErrors(t *testing.T) {
+	tests := []HASSEventConfig{
+		{When: "exploded", Type: "boom"},
+		{When: "completed"},
+		{When: "completed", Type: "chore_done", Data: "{{.Nope"},
+	}
+	for _, ev := range tests {
+		if _, err := parseTaskEvents(HASSConfig{Events: []HASSEventConfig{ev}}); err == nil {
+			t.Errorf("parseTaskEvents(%+v) succeeded, want error", ev)
+		}
+	}
+
+	// A template that doesn't produce an object is caught when it's used.
+	evs, err := parseTaskEvents(HASSConfig{Events: []HASSEventConfig{{When: "completed", Type: "x", Data: "{{.Content}}"}}})
+	if err != nil {
+		t.Fatalf("parseTaskEvents: %v", err)
+	}
+	if _, err := evs[0].eventData(taskEvent{openTask: openTask{Content: "wash up"}}); err == nil {
+		t.Errorf("eventData with non-JSON output succeeded")
+	}
+}
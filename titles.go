@@ -0,0 +1,51 @@
+package main
+
+// Rewriting task titles before they are shown, such as to strip a prefix
+// that an integration adds or to shorten wordy titles.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TitleRewriteConfig rewrites the parts of task titles that match a regexp.
+type TitleRewriteConfig struct {
+	Match string `yaml:"match"` // regexp, such as `^\[Auto\]\s*`
+	// Replace is what to replace each match with, which may refer to submatches as $1 and so on.
+	// It may be empty, to remove matches.
+	Replace string `yaml:"replace"`
+}
+
+type titleRewrite struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+func parseTitleRewrites(cfgs []TitleRewriteConfig) ([]titleRewrite, error) {
+	var rws []titleRewrite
+	for i, tc := range cfgs {
+		if tc.Match == "" {
+			return nil, fmt.Errorf("rewrite %d has no match pattern", i+1)
+		}
+		re, err := regexp.Compile(tc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %d has bad match pattern: %w", i+1, err)
+		}
+		rws = append(rws, titleRewrite{re, tc.Replace})
+	}
+	return rws, nil
+}
+
+// rewriteTitle applies the rewrites in order.
+// A title that would be rewritten to nothing is left alone.
+func rewriteTitle(title string, rws []titleRewrite) string {
+	orig := title
+	for _, rw := range rws {
+		title = rw.re.ReplaceAllString(title, rw.replace)
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		return orig
+	}
+	return title
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestRewriteTitles(t *testing.T) {
+	rws, err := parseTitleRewrites([]TitleRewriteConfig{
+		{Match: `^\[Auto\]\s*`},
+		{Match: `(?i)^take the (\w+) out tonight please$`, Replace: "$1 out"},
+		{Match: `!+$`},
+	})
+	if err != nil {
+		t.Fatalf("parseTitleRewrites: %v", err)
+	}
+	today := &todoist.Due{Date: time.Now().Format("2006-01-02")}
+	td := todoistData{
+		Projects: map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "[Auto] Water plants", Due: today},
+			"2": {ID: "2", ProjectID: "p1", Content: "Take the bins out tonight please", Due: today},
+			"3": {ID: "3", ProjectID: "p1", ParentID: "2", Content: "[Auto] Rinse recycling!!", Due: today},
+			"4": {ID: "4", ProjectID: "p1", Content: "[Auto] !!!", Due: today}, // would be empty
+			"5": {ID: "5", ProjectID: "p1", Content: "Clean gutters", Due: today},
+			"6": {ID: "6", ProjectID: "p1", Content: "Zap bugs", Due: today},
+		},
+	}
+	tasks := RenderableTasks(td, "", SubtaskConfig{Depth: 1}, "", rws)
+
+	// Tasks sort by their rewritten titles.
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Title)
+	}
+	want := []string{"Clean gutters", "Water plants", "Zap bugs", "[Auto] !!!", "bins out"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Titles = %q, want %q", got, want)
+	}
+	if subs := tasks[len(tasks)-1].Subtasks; len(subs) != 1 || subs[0].Title != "Rinse recycling" {
+		t.Errorf("Subtasks = %+v, want one titled %q", subs, "Rinse recycling")
+	}
+
+	for _, bad := range []TitleRewriteConfig{{}, {Match: "(unclosed"}} {
+		if _, err := parseTitleRewrites([]TitleRewriteConfig{bad}); err == nil {
+			t.Errorf("Rewrite %+v parsed", bad)
+		}
+	}
+}
@@ -26,6 +26,53 @@ type renderableTask struct {
 	Done, Total int
 	InProgress  bool // the in-progress label
 	PowerHungry bool // the power-hungry label
+
+	Emphasis bool // has a label with a red colour in Todoist
+
+	StaleProgress bool // in progress for too long; see InProgressConfig
+
+	Demoted bool // assigned to someone who isn't home
+
+	Hints []string // glyphs from weather hints
+
+	id    string       // the Todoist task ID
+	order todoistOrder // where Todoist puts the task, for the "todoist" order
+
+	// Subtasks that are also due, if configured; see SubtaskConfig.
+	Subtasks     []renderableTask
+	MoreSubtasks int // due subtasks that aren't shown
+}
+
+// SubtaskConfig controls showing due subtasks beneath their due parents.
+type SubtaskConfig struct {
+	// Depth is how many levels of subtasks to show beneath a parent.
+	// If zero, subtasks are shown like any other task.
+	Depth int `yaml:"depth"`
+	// Limit, if positive, is the most subtasks to show beneath each parent.
+	Limit int `yaml:"limit"`
+}
+
+// todoistOrder is where a task appears in the Todoist app.
+type todoistOrder struct {
+	day   int // day_order, the position in the Today view; -1 if unknown
+	child int // child_order, the position within its project or parent
+}
+
+// todoistOrderLess orders tasks as the Todoist app does: by their position in
+// the Today view where that's known, and otherwise by project then their position in it.
+func todoistOrderLess(a, b renderableTask) bool {
+	if ad, bd := a.order.day >= 0, b.order.day >= 0; ad != bd {
+		return ad
+	} else if ad && a.order.day != b.order.day {
+		return a.order.day < b.order.day
+	}
+	if a.Project != b.Project {
+		return a.Project < b.Project
+	}
+	if a.order.child != b.order.child {
+		return a.order.child < b.order.child
+	}
+	return a.Compare(b) < 0
 }
 
 func (rt renderableTask) Compare(o renderableTask) int {
@@ -68,7 +115,38 @@ func (rt renderableTask) Compare(o renderableTask) int {
 	if rt.PowerHungry != o.PowerHungry {
 		return boolCompare(rt.PowerHungry, o.PowerHungry)
 	}
-	return strings.Compare(rt.Assignee, o.Assignee)
+	if rt.Emphasis != o.Emphasis {
+		return boolCompare(rt.Emphasis, o.Emphasis)
+	}
+	if rt.StaleProgress != o.StaleProgress {
+		return boolCompare(rt.StaleProgress, o.StaleProgress)
+	}
+	if rt.Demoted != o.Demoted {
+		return boolCompare(o.Demoted, rt.Demoted) // inverse; demoted tasks last
+	}
+	if rt.Assignee != o.Assignee {
+		return strings.Compare(rt.Assignee, o.Assignee)
+	}
+	if len(rt.Hints) != len(o.Hints) {
+		return cmp(len(rt.Hints), len(o.Hints))
+	}
+	for i := range rt.Hints {
+		if rt.Hints[i] != o.Hints[i] {
+			return strings.Compare(rt.Hints[i], o.Hints[i])
+		}
+	}
+	if rt.MoreSubtasks != o.MoreSubtasks {
+		return cmp(rt.MoreSubtasks, o.MoreSubtasks)
+	}
+	if len(rt.Subtasks) != len(o.Subtasks) {
+		return cmp(len(rt.Subtasks), len(o.Subtasks))
+	}
+	for i := range rt.Subtasks {
+		if c := rt.Subtasks[i].Compare(o.Subtasks[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
 }
 
 func cmp(x, y int) int {
@@ -97,39 +175,77 @@ func timeCompare(a, b time.Time) int {
 	return 0
 }
 
-func RenderableTasks(ts *todoist.Syncer) []renderableTask {
+// emphasisColours are the Todoist label colours that are closest to the panel's red.
+// Any other colour is closest to black.
+var emphasisColours = map[string]bool{
+	"berry_red": true,
+	"red":       true,
+	"orange":    true,
+	"magenta":   true,
+	"salmon":    true,
+}
+
+// RenderableTasks returns the tasks to display from shared projects, sorted.
+// Normally those are the tasks due today or earlier. If nextLabel is set,
+// it is instead the tasks with that label, regardless of due date,
+// along with any overdue tasks. Subtasks are nested beneath their parents
+// according to sub. The tasks are sorted by priority and time, or if order is
+// "todoist", as they are arranged in the Todoist app.
+// Titles are rewritten by rws before sorting, so they sort as they are shown.
+func RenderableTasks(td todoistData, nextLabel string, sub SubtaskConfig, order string, rws []titleRewrite) []renderableTask {
+	less := func(a, b renderableTask) bool { return a.Compare(b) < 0 }
+	if order == "todoist" {
+		less = todoistOrderLess
+	}
+
 	var res []renderableTask
+	var ids, parents []string // parallel to res
 
-	for _, task := range ts.Items {
-		proj := ts.Projects[task.ProjectID]
+	now := time.Now()
+	for _, task := range td.Items {
+		proj := td.Projects[task.ProjectID]
 		if !proj.Shared {
 			continue
 		}
-		if task.Due == nil || task.Due.When() > 0 {
+		if nextLabel != "" {
+			overdue := task.Due != nil && dueWhen(task.Due, now) < 0
+			if !overdue && !hasLabel(task.Labels, nextLabel) {
+				continue
+			}
+		} else if task.Due == nil || dueWhen(task.Due, now) > 0 {
 			// No due date, or due after today.
 			continue
 		}
 		rt := renderableTask{
 			Priority: task.Priority,
-			Title:    task.Content,
+			Title:    rewriteTitle(task.Content, rws),
 			HasDesc:  task.Description != "",
-			Overdue:  task.Due.When() < 0,
+			Overdue:  task.Due != nil && dueWhen(task.Due, now) < 0,
 			Project:  proj.Name,
 
 			Done:  task.ChildCompleted,
 			Total: task.ChildCompleted + task.ChildRemaining,
+
+			id:    task.ID,
+			order: todoistOrder{day: -1, child: task.ChildOrder},
+		}
+		if d, ok := td.DayOrders[task.ID]; ok {
+			rt.order.day = d
 		}
 		if task.Responsible != nil {
-			name := ts.Collaborators[*task.Responsible].FullName
+			name := td.Collaborators[*task.Responsible].FullName
 			if i := strings.IndexByte(name, ' '); i >= 0 {
 				name = name[:i]
 			}
 			rt.Assignee = name
 		}
-		if t, ok := task.Due.Time(); ok {
+		if t, ok := dueTime(task.Due); ok {
 			rt.Time = t
 		}
 		for _, label := range task.Labels {
+			if emphasisColours[td.LabelColours[label]] {
+				rt.Emphasis = true
+			}
 			switch label {
 			case "in-progress":
 				rt.InProgress = true
@@ -138,18 +254,127 @@ func RenderableTasks(ts *todoist.Syncer) []renderableTask {
 			}
 		}
 		res = append(res, rt)
+		ids = append(ids, task.ID)
+		parents = append(parents, task.ParentID)
 	}
 
-	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	if sub.Depth > 0 {
+		res = nestSubtasks(res, ids, parents, sub, less)
+	}
+	sort.Slice(res, func(i, j int) bool { return less(res[i], res[j]) })
 
 	return res
 }
 
-func ApplyMetadata(ctx context.Context, ts *todoist.Syncer, mutate bool) {
-	for _, item := range ts.Items {
+// nestSubtasks moves tasks whose parent is also in tasks beneath that parent.
+// ids and parents are the task and parent IDs for each task.
+// Subtasks are sorted using less.
+func nestSubtasks(tasks []renderableTask, ids, parents []string, sub SubtaskConfig, less func(a, b renderableTask) bool) []renderableTask {
+	index := make(map[string]int) // ID => index in tasks
+	for i, id := range ids {
+		index[id] = i
+	}
+	children := make(map[int][]int)
+	var roots []int
+	for i, parent := range parents {
+		if p, ok := index[parent]; ok && parent != "" {
+			children[p] = append(children[p], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	var build func(i, depth int) renderableTask
+	build = func(i, depth int) renderableTask {
+		rt := tasks[i]
+		kids := children[i]
+		if depth == sub.Depth {
+			rt.MoreSubtasks = len(kids)
+			return rt
+		}
+		for _, k := range kids {
+			rt.Subtasks = append(rt.Subtasks, build(k, depth+1))
+		}
+		sort.Slice(rt.Subtasks, func(i, j int) bool { return less(rt.Subtasks[i], rt.Subtasks[j]) })
+		if sub.Limit > 0 && len(rt.Subtasks) > sub.Limit {
+			rt.MoreSubtasks = len(rt.Subtasks) - sub.Limit
+			rt.Subtasks = rt.Subtasks[:sub.Limit]
+		}
+		return rt
+	}
+	var res []renderableTask
+	for _, i := range roots {
+		res = append(res, build(i, 0))
+	}
+	return res
+}
+
+// countTasks counts the tasks and their nested subtasks for which f reports true,
+// or all of them if f is nil.
+func countTasks(tasks []renderableTask, f func(renderableTask) bool) int {
+	n := 0
+	for _, t := range tasks {
+		if f == nil || f(t) {
+			n++
+		}
+		n += countTasks(t.Subtasks, f)
+	}
+	return n
+}
+
+// removeLabel removes a label from the item, if it has it.
+// Unless mutate is set, it only logs what it would do.
+func removeLabel(ctx context.Context, ts todoistBackend, item todoist.Item, label string, mutate bool) error {
+	var labels []string
+	for _, l := range item.Labels {
+		if l != label {
+			labels = append(labels, l)
+		}
+	}
+	if len(labels) == len(item.Labels) {
+		return nil
+	}
+	if !mutate {
+		log.Printf("Would change label set from %v to %v", item.Labels, labels)
+		return nil
+	}
+	if err := ts.UpdateItem(ctx, item.ID, todoist.ItemUpdates{Labels: &labels}); err != nil {
+		return fmt.Errorf("removing labels: %w", err)
+	}
+	log.Printf("Changed label set from %v to %v", item.Labels, labels)
+	return nil
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func ApplyMetadata(ctx context.Context, ts todoistBackend, cfg MetadataConfig, mutate bool) {
+	td := ts.Data()
+	for _, item := range td.Items {
+		ruled := false
 		for _, label := range item.Labels {
-			if strings.HasPrefix(label, "m:") {
-				if err := applyMetadata(ctx, ts, item, label, mutate); err != nil {
+			// Some metadata labels take a value, as in "m:rem=30m".
+			name, value, _ := strings.Cut(label, "=")
+			if strings.HasPrefix(label, "m:") && cfg.enabled(name, td.Projects[item.ProjectID].Name) {
+				var err error
+				if metadataLabels[name] {
+					err = applyMetadata(ctx, ts, item, label, name, value, mutate)
+				} else if mr, ok := cfg.rule(label); ok {
+					// Each rule rewrites the item's labels, which aren't seen again until the next sync,
+					// so any other rules for the item wait until the next refresh.
+					if ruled {
+						continue
+					}
+					ruled = true
+					err = applyRule(ctx, ts, item, label, mr, mutate)
+				}
+				if err != nil {
 					log.Printf("Applying metadata label %q to item %s (%q): %v", label, item.ID, item.Content, err)
 				}
 			}
@@ -157,11 +382,11 @@ func ApplyMetadata(ctx context.Context, ts *todoist.Syncer, mutate bool) {
 	}
 }
 
-func applyMetadata(ctx context.Context, ts *todoist.Syncer, item todoist.Item, label string, mutate bool) error {
-	switch label {
+func applyMetadata(ctx context.Context, ts todoistBackend, item todoist.Item, label, name, value string, mutate bool) error {
+	switch name {
 	case "m:uf":
 		// Unassign if the item is due in the future (after today).
-		if item.Due == nil || item.Due.When() <= 0 {
+		if item.Due == nil || dueWhen(item.Due, time.Now()) <= 0 {
 			return nil
 		}
 		if item.Responsible != nil {
@@ -176,30 +401,12 @@ func applyMetadata(ctx context.Context, ts *todoist.Syncer, item todoist.Item, l
 		}
 
 		// Remove any "in-progress" label.
-		var labels []string
-		for _, label := range item.Labels {
-			if label != "in-progress" {
-				labels = append(labels, label)
-			}
-		}
-		if len(labels) != len(item.Labels) {
-			if !mutate {
-				log.Printf("Would change label set from %v to %v", item.Labels, labels)
-			} else {
-				err := ts.UpdateItem(ctx, item.ID, todoist.ItemUpdates{Labels: &labels})
-				if err != nil {
-					return fmt.Errorf("removing labels: %w", err)
-				}
-				log.Printf("Changed label set from %v to %v", item.Labels, labels)
-			}
-		}
-
-		return nil
+		return removeLabel(ctx, ts, item, "in-progress", mutate)
 	case "m:dd":
 		// If there's any other tasks with the same title in the same project, and a lower ID,
 		// complete this task automatically.
 		matched := false
-		for _, other := range ts.Items {
+		for _, other := range ts.Data().Items {
 			if other.Content == item.Content && other.ProjectID == item.ProjectID && other.ID < item.ID {
 				matched = true
 				break
@@ -216,7 +423,48 @@ func applyMetadata(ctx context.Context, ts *todoist.Syncer, item todoist.Item, l
 			return fmt.Errorf("deleting item: %w", err)
 		}
 		log.Printf("Deleted duplicate item %s (%q)...", item.ID, item.Content)
+	case "m:rem":
+		return applyReminders(ctx, ts, item, label, value, mutate)
 	}
 
 	return nil
 }
+
+// hygieneMetrics are gauges of how well-kept the shared Todoist projects are.
+type hygieneMetrics struct {
+	NoDueDate    int // top-level tasks with no due date
+	LongOverdue  int // tasks overdue by more than a week
+	UnassignedP1 int // P1 tasks with nobody responsible
+}
+
+// hygieneMetricDefs describes each hygiene metric, for exporting.
+var hygieneMetricDefs = []struct {
+	name, help string
+	get        func(hygieneMetrics) int
+}{
+	{"no_due_date", "Top-level tasks in shared projects with no due date.", func(h hygieneMetrics) int { return h.NoDueDate }},
+	{"overdue_week", "Tasks in shared projects overdue by more than 7 days.", func(h hygieneMetrics) int { return h.LongOverdue }},
+	{"unassigned_p1", "P1 tasks in shared projects with nobody responsible.", func(h hygieneMetrics) int { return h.UnassignedP1 }},
+}
+
+func TodoistHygiene(td todoistData, now time.Time) hygieneMetrics {
+	var h hygieneMetrics
+	y, m, d := now.Date()
+	weekAgo := time.Date(y, m, d-7, 0, 0, 0, 0, time.Local)
+	for _, item := range td.Items {
+		if !td.Projects[item.ProjectID].Shared {
+			continue
+		}
+		if item.Due == nil {
+			if item.ParentID == "" {
+				h.NoDueDate++
+			}
+		} else if due, _, err := parseDue(item.Due); err == nil && due.Before(weekAgo) {
+			h.LongOverdue++
+		}
+		if item.Priority == 4 && item.Responsible == nil {
+			h.UnassignedP1++
+		}
+	}
+	return h
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+func TestRenderableTasksNextActions(t *testing.T) {
+	day := func(offset int) *todoist.Due {
+		return &todoist.Due{Date: time.Now().AddDate(0, 0, offset).Format("2006-01-02")}
+	}
+	td := todoistData{
+		Projects: map[string]todoist.Project{
+			"p1": {ID: "p1", Name: "House", Shared: true},
+			"p2": {ID: "p2", Name: "Mine"},
+		},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "labelled, no date", Labels: []string{"next"}},
+			"2": {ID: "2", ProjectID: "p1", Content: "labelled, next week", Labels: []string{"next"}, Due: day(7)},
+			"3": {ID: "3", ProjectID: "p1", Content: "overdue", Due: day(-1)},
+			"4": {ID: "4", ProjectID: "p1", Content: "due today", Due: day(0)},
+			"5": {ID: "5", ProjectID: "p2", Content: "labelled, unshared", Labels: []string{"next"}},
+		},
+	}
+	titles := func(tasks []renderableTask) map[string]bool {
+		m := make(map[string]bool)
+		for _, task := range tasks {
+			m[task.Title] = true
+		}
+		return m
+	}
+
+	normal := titles(RenderableTasks(td, "", SubtaskConfig{}, "", nil))
+	if len(normal) != 2 || !normal["overdue"] || !normal["due today"] {
+		t.Errorf("Normal selection = %v, want overdue and due today", normal)
+	}
+	next := titles(RenderableTasks(td, "next", SubtaskConfig{}, "", nil))
+	if len(next) != 3 || !next["labelled, no date"] || !next["labelled, next week"] || !next["overdue"] {
+		t.Errorf("Next actions selection = %v, want the labelled and overdue tasks", next)
+	}
+}
+
+func TestRenderableTasksSubtasks(t *testing.T) {
+	today := &todoist.Due{Date: time.Now().Format("2006-01-02")}
+	td := todoistData{
+		Projects: map[string]todoist.Project{"p1": {ID: "p1", Name: "House", Shared: true}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "clean kitchen", Priority: 2, Due: today},
+			"2": {ID: "2", ProjectID: "p1", ParentID: "1", Content: "wipe benches", Priority: 1, Due: today},
+			"3": {ID: "3", ProjectID: "p1", ParentID: "1", Content: "mop floor", Priority: 3, Due: today},
+			"4": {ID: "4", ProjectID: "p1", ParentID: "3", Content: "fill bucket", Priority: 1, Due: today},
+			"5": {ID: "5", ProjectID: "p1", ParentID: "1", Content: "descale kettle", Priority: 1, Due: today},
+			// Not due, so its due subtask stands alone.
+			"6": {ID: "6", ProjectID: "p1", Content: "garden"},
+			"7": {ID: "7", ProjectID: "p1", ParentID: "6", Content: "water plants", Priority: 1, Due: today},
+		},
+	}
+	describe := func(tasks []renderableTask) []string {
+		var res []string
+		var walk func(prefix string, tasks []renderableTask)
+		walk = func(prefix string, tasks []renderableTask) {
+			for _, task := range tasks {
+				s := prefix + task.Title
+				if task.MoreSubtasks > 0 {
+					s += fmt.Sprintf(" +%d", task.MoreSubtasks)
+				}
+				res = append(res, s)
+				walk(prefix+"-", task.Subtasks)
+			}
+		}
+		walk("", tasks)
+		return res
+	}
+
+	tests := []struct {
+		sub  SubtaskConfig
+		want []string
+	}{
+		{SubtaskConfig{}, []string{"mop floor", "clean kitchen", "descale kettle", "fill bucket", "water plants", "wipe benches"}},
+		{SubtaskConfig{Depth: 1}, []string{"clean kitchen", "-mop floor +1", "-descale kettle", "-wipe benches", "water plants"}},
+		{SubtaskConfig{Depth: 2}, []string{"clean kitchen", "-mop floor", "--fill bucket", "-descale kettle", "-wipe benches", "water plants"}},
+		{SubtaskConfig{Depth: 2, Limit: 1}, []string{"clean kitchen +2", "-mop floor", "--fill bucket", "water plants"}},
+	}
+	for _, test := range tests {
+		got := describe(RenderableTasks(td, "", test.sub, "", nil))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RenderableTasks with %+v:\n got %q\nwant %q", test.sub, got, test.want)
+		}
+	}
+}
+
+func TestRenderableTasksTodoistOrder(t *testing.T) {
+	today := &todoist.Due{Date: time.Now().Format("2006-01-02")}
+	td := todoistData{
+		Projects: map[string]todoist.Project{
+			"p1": {ID: "p1", Name: "House", Shared: true},
+			"p2": {ID: "p2", Name: "Garden", Shared: true},
+		},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p1", Content: "dishes", Priority: 4, ChildOrder: 3, Due: today},
+			"2": {ID: "2", ProjectID: "p1", Content: "laundry", Priority: 1, ChildOrder: 1, Due: today},
+			"3": {ID: "3", ProjectID: "p2", Content: "weeding", Priority: 1, ChildOrder: 2, Due: today},
+			"4": {ID: "4", ProjectID: "p2", Content: "mowing", Priority: 2, ChildOrder: 1, Due: today},
+			"5": {ID: "5", ProjectID: "p1", Content: "bins", Priority: 1, ChildOrder: 2, Due: today},
+		},
+		DayOrders: map[string]int{"5": 2, "3": 1},
+	}
+	var got []string
+	for _, task := range RenderableTasks(td, "", SubtaskConfig{}, "todoist", nil) {
+		got = append(got, task.Title)
+	}
+	// Tasks in the Today view first, then by project and their order within it.
+	want := []string{"weeding", "bins", "mowing", "laundry", "dishes"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RenderableTasks in Todoist order = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+// Adapters for the different versions of the Todoist API.
+//
+// Everything else deals only with todoistBackend and todoistData,
+// so that API migrations only need handling here.
+//
+// The v9 API is handled by github.com/dsymonds/todoist.
+// The v1 API (https://developer.todoist.com/api/v1/) is handled directly,
+// producing the same types.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+// todoistData is the state of Todoist as of the last sync. Maps are keyed by the relevant ID.
+type todoistData struct {
+	Projects      map[string]todoist.Project
+	Collaborators map[string]todoist.Collaborator
+	Items         map[string]todoist.Item // only incomplete items
+
+	// DayOrders are the items' positions in the Today view, where known.
+	// Only the v1 API reports these.
+	DayOrders map[string]int
+
+	// LabelColours are the Todoist colour names (such as "berry_red") of personal labels, by name.
+	// Shared labels have no colour.
+	LabelColours map[string]string
+}
+
+// todoistBackend is the subset of the Todoist API that kitchenthing uses.
+type todoistBackend interface {
+	// Sync fetches any changes since the last sync.
+	Sync(ctx context.Context) error
+	// Data returns the synced data. It must not be modified.
+	Data() todoistData
+
+	// Assign assigns an item to a collaborator UID, or unassigns it if assignee is empty.
+	Assign(ctx context.Context, item todoist.Item, assignee string) error
+	UpdateItem(ctx context.Context, itemID string, updates todoist.ItemUpdates) error
+	DeleteItem(ctx context.Context, itemID string) error
+	// Reorder sets the order of the given items to match the order of the slice.
+	Reorder(ctx context.Context, itemIDs []string) error
+	// SetDue sets an item's due date from a date in Todoist's own syntax, such as "tomorrow".
+	SetDue(ctx context.Context, itemID, due string) error
+	// Move moves an item to another project.
+	Move(ctx context.Context, itemID, projectID string) error
+	// AddReminder adds a reminder, given the arguments of a reminder_add sync command.
+	AddReminder(ctx context.Context, args map[string]interface{}) error
+	// CloseItem completes an item. A recurring item moves on to its next occurrence instead.
+	CloseItem(ctx context.Context, itemID string) error
+}
+
+func newTodoistBackend(cfg Config) (todoistBackend, error) {
+	switch cfg.TodoistAPI {
+	case "v9":
+		return newTodoistV9(cfg.TodoistAPIToken), nil
+	case "v1":
+		return newTodoistV1(cfg.TodoistAPIToken), nil
+	case "", "auto":
+		return &todoistAuto{
+			todoistBackend: newTodoistV9(cfg.TodoistAPIToken),
+			fallback:       newTodoistV1(cfg.TodoistAPIToken),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown todoist_api %q (want v9, v1 or auto)", cfg.TodoistAPI)
+}
+
+// todoistV9 adapts the v9 Sync API, as implemented by the todoist package.
+type todoistV9 struct {
+	*todoist.Syncer
+	rest *todoistV1 // only used for requests that the todoist package doesn't support
+
+	labelColours map[string]string
+}
+
+func newTodoistV9(apiToken string) *todoistV9 {
+	return &todoistV9{Syncer: todoist.NewSyncer(apiToken), rest: newTodoistV1(apiToken)}
+}
+
+// Sync syncs with the todoist package, which doesn't fetch labels, so they are fetched separately.
+// If that fails, the previous label colours are kept.
+func (t *todoistV9) Sync(ctx context.Context) error {
+	if err := t.Syncer.Sync(ctx); err != nil {
+		return err
+	}
+	var labels []struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := t.rest.do(ctx, "GET", "/rest/v2/labels", nil, &labels); err != nil {
+		log.Printf("Fetching Todoist labels: %v", err)
+		return nil
+	}
+	t.labelColours = make(map[string]string)
+	for _, l := range labels {
+		t.labelColours[l.Name] = l.Color
+	}
+	return nil
+}
+
+func (t *todoistV9) Data() todoistData {
+	return todoistData{
+		Projects:      t.Projects,
+		Collaborators: t.Collaborators,
+		Items:         t.Items,
+		LabelColours:  t.labelColours,
+	}
+}
+
+func (t *todoistV9) SetDue(ctx context.Context, itemID, due string) error {
+	req := map[string]string{"due_string": due}
+	return t.rest.do(ctx, "POST", "/rest/v2/tasks/"+url.PathEscape(itemID), req, nil)
+}
+
+func (t *todoistV9) Move(ctx context.Context, itemID, projectID string) error {
+	return t.rest.command(ctx, "/sync/v9/sync", "item_move", map[string]string{"id": itemID, "project_id": projectID})
+}
+
+func (t *todoistV9) AddReminder(ctx context.Context, args map[string]interface{}) error {
+	return t.rest.command(ctx, "/sync/v9/sync", "reminder_add", args)
+}
+
+func (t *todoistV9) CloseItem(ctx context.Context, itemID string) error {
+	return t.rest.command(ctx, "/sync/v9/sync", "item_close", map[string]string{"id": itemID})
+}
+
+// todoistAuto uses one backend until the API it speaks appears to have been retired,
+// at which point it switches permanently to the fallback.
+type todoistAuto struct {
+	todoistBackend
+	fallback todoistBackend // nil once switched
+}
+
+func (t *todoistAuto) Sync(ctx context.Context) error {
+	err := t.todoistBackend.Sync(ctx)
+	if err != nil && t.fallback != nil && todoistAPIGone(err) {
+		log.Printf("Todoist API appears to have been retired (%v); switching to the newer API", err)
+		t.todoistBackend, t.fallback = t.fallback, nil
+		return t.todoistBackend.Sync(ctx)
+	}
+	return err
+}
+
+// todoistAPIGone reports whether err indicates that the API version is no longer served.
+func todoistAPIGone(err error) bool {
+	// The todoist package only reports the HTTP status in the error text.
+	msg := err.Error()
+	return strings.Contains(msg, "returned 410 ") || strings.Contains(msg, "returned 404 ")
+}
+
+// todoistV1 speaks the unified v1 API.
+type todoistV1 struct {
+	apiToken string
+	base     string // scheme and host of the API server
+
+	syncToken    string
+	labels       map[string]string // label ID => name
+	labelColours map[string]string // label ID => colour
+	data         todoistData
+}
+
+func newTodoistV1(apiToken string) *todoistV1 {
+	return &todoistV1{
+		apiToken:  apiToken,
+		base:      "https://api.todoist.com",
+		syncToken: "*", // this means next sync should get all data
+	}
+}
+
+func (t *todoistV1) Data() todoistData { return t.data }
+
+// v1Project is a project as sent by the v1 API.
+// Whether a project is shared has been reported under different names.
+type v1Project struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Shared    *bool  `json:"shared"`
+	IsShared  *bool  `json:"is_shared"`
+	IsDeleted bool   `json:"is_deleted"`
+}
+
+// v1Item is an item as sent by the v1 API.
+// Labels may be either label names or (in older formats) label IDs.
+type v1Item struct {
+	todoist.Item
+	Labels    []json.RawMessage `json:"labels"`
+	IsDeleted bool              `json:"is_deleted"`
+	DayOrder  *int              `json:"day_order"` // -1 if not in the Today view
+}
+
+func (t *todoistV1) Sync(ctx context.Context) error {
+	var data struct {
+		SyncToken     string                 `json:"sync_token"`
+		FullSync      bool                   `json:"full_sync"`
+		Projects      []v1Project            `json:"projects"`
+		Collaborators []todoist.Collaborator `json:"collaborators"`
+		Items         []v1Item               `json:"items"`
+		Labels        []struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			Color     string `json:"color"`
+			IsDeleted bool   `json:"is_deleted"`
+		} `json:"labels"`
+		Completed []struct {
+			ItemID   string `json:"item_id"`
+			NumItems int    `json:"completed_items"`
+		} `json:"completed_info"`
+	}
+	err := t.do(ctx, "POST", "/api/v1/sync", url.Values{
+		"sync_token":     []string{t.syncToken},
+		"resource_types": []string{`["projects","items","collaborators","labels","completed_info"]`},
+	}, &data)
+	if err != nil {
+		return err
+	}
+
+	if data.FullSync || t.data.Projects == nil {
+		t.labels = make(map[string]string)
+		t.labelColours = make(map[string]string)
+		t.data = todoistData{
+			Projects:      make(map[string]todoist.Project),
+			Collaborators: make(map[string]todoist.Collaborator),
+			Items:         make(map[string]todoist.Item),
+			DayOrders:     make(map[string]int),
+		}
+	}
+	for _, l := range data.Labels {
+		if l.IsDeleted {
+			delete(t.labels, l.ID)
+			delete(t.labelColours, l.ID)
+		} else {
+			t.labels[l.ID] = l.Name
+			t.labelColours[l.ID] = l.Color
+		}
+	}
+	t.data.LabelColours = make(map[string]string)
+	for id, name := range t.labels {
+		t.data.LabelColours[name] = t.labelColours[id]
+	}
+	for _, p := range data.Projects {
+		if p.IsDeleted {
+			delete(t.data.Projects, p.ID)
+			continue
+		}
+		proj := todoist.Project{ID: p.ID, Name: p.Name}
+		if p.Shared != nil {
+			proj.Shared = *p.Shared
+		} else if p.IsShared != nil {
+			proj.Shared = *p.IsShared
+		}
+		t.data.Projects[p.ID] = proj
+	}
+	for _, c := range data.Collaborators {
+		t.data.Collaborators[c.ID] = c
+	}
+	for _, vi := range data.Items {
+		if vi.Checked || vi.IsDeleted {
+			delete(t.data.Items, vi.ID)
+			delete(t.data.DayOrders, vi.ID)
+			continue
+		}
+		item := vi.Item
+		item.Labels = t.labelNames(vi.Labels)
+		t.data.Items[item.ID] = item
+		if vi.DayOrder != nil && *vi.DayOrder >= 0 {
+			t.data.DayOrders[item.ID] = *vi.DayOrder
+		} else {
+			delete(t.data.DayOrders, item.ID)
+		}
+	}
+	for _, comp := range data.Completed {
+		if item, ok := t.data.Items[comp.ItemID]; ok {
+			item.ChildCompleted = comp.NumItems
+			t.data.Items[comp.ItemID] = item
+		}
+	}
+	t.syncToken = data.SyncToken
+
+	// Recompute pending children.
+	for id, item := range t.data.Items {
+		item.ChildRemaining = 0
+		t.data.Items[id] = item
+	}
+	for _, item := range t.data.Items {
+		if p, ok := t.data.Items[item.ParentID]; ok {
+			p.ChildRemaining++
+			t.data.Items[item.ParentID] = p
+		}
+	}
+
+	return nil
+}
+
+// labelNames converts labels as sent by the API into label names.
+func (t *todoistV1) labelNames(raw []json.RawMessage) []string {
+	var names []string
+	for _, r := range raw {
+		var name string
+		if err := json.Unmarshal(r, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+		// Not a string, so it must be a numeric label ID.
+		var id json.Number
+		if err := json.Unmarshal(r, &id); err != nil {
+			log.Printf("WARNING: Todoist sent an unrecognised label %s", r)
+			continue
+		}
+		if name, ok := t.labels[id.String()]; ok {
+			names = append(names, name)
+		} else {
+			log.Printf("WARNING: Todoist item has unknown label ID %s", id)
+		}
+	}
+	return names
+}
+
+func (t *todoistV1) Assign(ctx context.Context, item todoist.Item, assignee string) error {
+	var req struct {
+		AssigneeID *string `json:"assignee_id"`
+	}
+	if assignee != "" {
+		req.AssigneeID = &assignee
+	}
+	return t.do(ctx, "POST", "/api/v1/tasks/"+url.PathEscape(item.ID), req, nil)
+}
+
+func (t *todoistV1) UpdateItem(ctx context.Context, itemID string, updates todoist.ItemUpdates) error {
+	return t.do(ctx, "POST", "/api/v1/tasks/"+url.PathEscape(itemID), updates, nil)
+}
+
+func (t *todoistV1) DeleteItem(ctx context.Context, itemID string) error {
+	return t.do(ctx, "DELETE", "/api/v1/tasks/"+url.PathEscape(itemID), nil, nil)
+}
+
+func (t *todoistV1) Reorder(ctx context.Context, itemIDs []string) error {
+	type item struct {
+		ID string `json:"id"`
+		CO int    `json:"child_order"`
+	}
+	var items []item
+	for i, id := range itemIDs {
+		// child_order numbers from 1.
+		items = append(items, item{ID: id, CO: i + 1})
+	}
+	return t.command(ctx, "/api/v1/sync", "item_reorder", map[string]interface{}{"items": items})
+}
+
+func (t *todoistV1) SetDue(ctx context.Context, itemID, due string) error {
+	req := map[string]string{"due_string": due}
+	return t.do(ctx, "POST", "/api/v1/tasks/"+url.PathEscape(itemID), req, nil)
+}
+
+func (t *todoistV1) Move(ctx context.Context, itemID, projectID string) error {
+	return t.command(ctx, "/api/v1/sync", "item_move", map[string]string{"id": itemID, "project_id": projectID})
+}
+
+func (t *todoistV1) AddReminder(ctx context.Context, args map[string]interface{}) error {
+	return t.command(ctx, "/api/v1/sync", "reminder_add", args)
+}
+
+func (t *todoistV1) CloseItem(ctx context.Context, itemID string) error {
+	return t.do(ctx, "POST", "/api/v1/tasks/"+url.PathEscape(itemID)+"/close", nil, nil)
+}
+
+// command runs a single write command via the sync endpoint at path.
+// The v9 adapter uses this too, since the v9 sync endpoint takes commands in the same form.
+func (t *todoistV1) command(ctx context.Context, path, typ string, args interface{}) error {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return fmt.Errorf("generating command UUID: %w", err)
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // variant 10
+	uuid := fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+
+	cmds, err := json.Marshal([]map[string]interface{}{{
+		"type": typ,
+		"args": args,
+		"uuid": uuid,
+	}})
+	if err != nil {
+		return fmt.Errorf("marshaling JSON body: %w", err)
+	}
+	var resp struct {
+		SyncStatus map[string]json.RawMessage `json:"sync_status"`
+	}
+	if err := t.do(ctx, "POST", path, url.Values{"commands": []string{string(cmds)}}, &resp); err != nil {
+		return err
+	}
+	if st, ok := resp.SyncStatus[uuid]; ok && string(st) != `"ok"` {
+		return fmt.Errorf("%s command failed: %s", typ, st)
+	}
+	return nil
+}
+
+// do makes an API request. The body may be nil, url.Values for a form, or anything else to send as JSON.
+// If dst is non-nil, the response is decoded into it.
+func (t *todoistV1) do(ctx context.Context, method, path string, body, dst interface{}) error {
+	var rb io.Reader
+	var ct string
+	switch body := body.(type) {
+	case nil:
+	case url.Values:
+		rb, ct = strings.NewReader(body.Encode()), "application/x-www-form-urlencoded"
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling JSON body: %w", err)
+		}
+		rb, ct = bytes.NewReader(b), "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.base+path, rb)
+	if err != nil {
+		return fmt.Errorf("constructing HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.apiToken)
+	if ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading API response body: %w", err)
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		return fmt.Errorf("API request returned %s", resp.Status)
+	}
+	if dst == nil || len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("parsing API response: %w", err)
+	}
+	return nil
+}
+
+// parseDue parses a due date. It returns the due time, and whether the due date has a time.
+// Full-day due dates are treated as being due at the end of the day, in local time.
+func parseDue(due *todoist.Due) (t time.Time, hasTime bool, err error) {
+	if !strings.Contains(due.Date, "T") {
+		// YYYY-MM-DD (full-day date)
+		t, err := time.ParseInLocation("2006-01-02", due.Date, time.Local)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("parsing full-day date %q: %w", due.Date, err)
+		}
+		return t.Add(24*time.Hour - time.Second), false, nil
+	}
+	// YYYY-MM-DDTHH:MM:SS or YYYY-MM-DDTHH:MM:SSZ
+	str, loc := due.Date, time.Local
+	if strings.HasSuffix(str, "Z") {
+		str, loc = str[:len(str)-1], time.UTC
+	}
+	t, err = time.ParseInLocation("2006-01-02T15:04:05", str, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("parsing due date with time %q: %w", due.Date, err)
+	}
+	return t.Local(), true, nil
+}
+
+// dueWhen reports when a due date is relative to now.
+// This is -1, 0 or 1 for overdue, today and future due dates.
+// Unparseable due dates are treated as due today.
+func dueWhen(due *todoist.Due, now time.Time) int {
+	t, _, err := parseDue(due)
+	if err != nil {
+		return 0
+	}
+	ty, tm, td := t.Date()
+	ny, nm, nd := now.Date()
+	if c := timeCompare(time.Date(ty, tm, td, 0, 0, 0, 0, time.Local), time.Date(ny, nm, nd, 0, 0, 0, 0, time.Local)); c != 0 {
+		return c
+	}
+	// Remaining check is for things due today.
+	if t.Before(now) {
+		return -1
+	}
+	return 0
+}
+
+// dueTime reports a due date's exact time, if a time is associated with it.
+func dueTime(due *todoist.Due) (time.Time, bool) {
+	if due == nil {
+		return time.Time{}, false
+	}
+	t, hasTime, err := parseDue(due)
+	if err != nil || !hasTime {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,136 @@
+package main
+
+// Persisting the last successful Todoist sync, so that after a power cut with no network
+// the display can start up showing the last known tasks instead of nothing.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+// todoistSnapshot is the form of todoistData in the cache file.
+type todoistSnapshot struct {
+	Projects      map[string]todoist.Project      `json:"projects"`
+	Collaborators map[string]todoist.Collaborator `json:"collaborators"`
+	Items         map[string]todoist.Item         `json:"items"`
+	DayOrders     map[string]int                  `json:"day_orders,omitempty"`
+	LabelColours  map[string]string               `json:"label_colours,omitempty"`
+
+	// Children holds each item's completed and remaining subtask counts,
+	// which the todoist package doesn't encode.
+	Children map[string][2]int `json:"children,omitempty"`
+}
+
+// todoistCache saves the data after each successful sync, and until the first one
+// serves the data saved by a previous run.
+type todoistCache struct {
+	todoistBackend
+	filename string
+
+	cached   *todoistData // nil once a sync has succeeded
+	cachedAt time.Time    // when cached was saved
+	saved    []byte       // what was last written, to avoid rewriting the same thing
+}
+
+func newTodoistCache(b todoistBackend, filename string) *todoistCache {
+	t := &todoistCache{todoistBackend: b, filename: filename}
+	if err := t.load(); err != nil {
+		log.Printf("Loading cached Todoist data: %v", err)
+	}
+	return t
+}
+
+func (t *todoistCache) load() error {
+	raw, err := ioutil.ReadFile(t.filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fi, err := os.Stat(t.filename)
+	if err != nil {
+		return err
+	}
+	var snap todoistSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return fmt.Errorf("parsing %s: %w", t.filename, err)
+	}
+	td := todoistData{
+		Projects:      snap.Projects,
+		Collaborators: snap.Collaborators,
+		Items:         snap.Items,
+		DayOrders:     snap.DayOrders,
+		LabelColours:  snap.LabelColours,
+	}
+	for id, c := range snap.Children {
+		if item, ok := td.Items[id]; ok {
+			item.ChildCompleted, item.ChildRemaining = c[0], c[1]
+			td.Items[id] = item
+		}
+	}
+	t.cached, t.cachedAt, t.saved = &td, fi.ModTime(), raw
+	log.Printf("Loaded %d Todoist items cached at %s", len(td.Items), t.cachedAt.Format(time.Stamp))
+	return nil
+}
+
+func (t *todoistCache) Sync(ctx context.Context) error {
+	err := t.todoistBackend.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	t.cached = nil
+	if err := t.save(t.todoistBackend.Data()); err != nil {
+		log.Printf("Caching Todoist data: %v", err)
+	}
+	return nil
+}
+
+func (t *todoistCache) save(td todoistData) error {
+	snap := todoistSnapshot{
+		Projects:      td.Projects,
+		Collaborators: td.Collaborators,
+		Items:         td.Items,
+		DayOrders:     td.DayOrders,
+		LabelColours:  td.LabelColours,
+		Children:      make(map[string][2]int),
+	}
+	for id, item := range td.Items {
+		if item.ChildCompleted > 0 || item.ChildRemaining > 0 {
+			snap.Children[id] = [2]int{item.ChildCompleted, item.ChildRemaining}
+		}
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+	if bytes.Equal(raw, t.saved) {
+		return nil
+	}
+	if err := writeFileAtomic(t.filename, raw); err != nil {
+		return err
+	}
+	t.saved = raw
+	return nil
+}
+
+func (t *todoistCache) Data() todoistData {
+	if t.cached != nil {
+		return *t.cached
+	}
+	return t.todoistBackend.Data()
+}
+
+// Offline reports whether the data is from a previous run, and when it was saved.
+func (t *todoistCache) Offline() (time.Time, bool) {
+	return t.cachedAt, t.cached != nil
+}
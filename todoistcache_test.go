@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsymonds/todoist"
+)
+
+// flakyTodoist is a todoistBackend whose syncs can fail.
+type flakyTodoist struct {
+	todoistBackend // nil; only Sync and Data are used
+	data           todoistData
+	err            error
+}
+
+func (ft *flakyTodoist) Sync(ctx context.Context) error { return ft.err }
+func (ft *flakyTodoist) Data() todoistData              { return ft.data }
+
+func TestTodoistCache(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "todoist.json")
+	ctx := context.Background()
+
+	// Nothing is cached to start with.
+	ft := &flakyTodoist{data: todoistData{
+		Projects: map[string]todoist.Project{"p": {ID: "p", Name: "House"}},
+		Items: map[string]todoist.Item{
+			"1": {ID: "1", ProjectID: "p", Content: "parent", ChildCompleted: 1, ChildRemaining: 2},
+		},
+		LabelColours: map[string]string{"urgent": "red"},
+	}}
+	tc := newTodoistCache(ft, filename)
+	if _, offline := tc.Offline(); offline {
+		t.Errorf("Offline with no cache file")
+	}
+	if err := tc.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// After a restart with no network, the cached data is used until a sync works.
+	ft = &flakyTodoist{err: errors.New("no network")}
+	tc = newTodoistCache(ft, filename)
+	if err := tc.Sync(ctx); err == nil {
+		t.Errorf("Sync with no network succeeded")
+	}
+	if _, offline := tc.Offline(); !offline {
+		t.Errorf("Not offline when using cached data")
+	}
+	item := tc.Data().Items["1"]
+	if item.Content != "parent" || item.ChildCompleted != 1 || item.ChildRemaining != 2 {
+		t.Errorf("Cached item = %+v, want parent with 1 of 3 subtasks done", item)
+	}
+	if got := tc.Data().LabelColours["urgent"]; got != "red" {
+		t.Errorf("Cached colour of label urgent = %q, want red", got)
+	}
+
+	ft.err = nil
+	if err := tc.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if _, offline := tc.Offline(); offline {
+		t.Errorf("Still offline after a successful sync")
+	}
+	if n := len(tc.Data().Items); n != 0 {
+		t.Errorf("After a successful sync, got %d items, want the synced 0", n)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+// Input from a touch overlay on the panel, read as Linux evdev events and mapped
+// through the hit map to actions: tapping a task toggles whether it is in progress,
+// holding it completes it, and swiping left or right turns the page of tasks.
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/dsymonds/todoist"
+)
+
+// TouchConfig configures a USB or I2C touch overlay.
+type TouchConfig struct {
+	// Device is its evdev device, such as /dev/input/event0. Touch input is off if it is empty.
+	Device string `yaml:"device"`
+
+	// MaxX and MaxY are the largest raw coordinates it reports (see evtest).
+	// They default to the panel's size in pixels, less one.
+	MaxX int `yaml:"max_x"`
+	MaxY int `yaml:"max_y"`
+
+	// SwapXY, InvertX and InvertY correct for how it is mounted.
+	// The axes are swapped before either is inverted.
+	SwapXY  bool `yaml:"swap_xy"`
+	InvertX bool `yaml:"invert_x"`
+	InvertY bool `yaml:"invert_y"`
+
+	// LongPress is how long to hold a task to complete it. It defaults to 800ms.
+	LongPress time.Duration `yaml:"long_press"`
+}
+
+func (tc TouchConfig) validate() error {
+	if tc.MaxX < 0 || tc.MaxY < 0 {
+		return fmt.Errorf("negative max_x or max_y")
+	}
+	if tc.LongPress < 0 {
+		return fmt.Errorf("negative long_press")
+	}
+	return nil
+}
+
+func (tc TouchConfig) longPress() time.Duration {
+	if tc.LongPress > 0 {
+		return tc.LongPress
+	}
+	return 800 * time.Millisecond
+}
+
+const (
+	touchSlop        = 20              // pixels a tap may move
+	touchPageTimeout = 2 * time.Minute // after which the first page of tasks is shown again
+)
+
+// Gestures made by a touch.
+const (
+	gestureTap        = "tap"
+	gestureLongPress  = "long press"
+	gestureSwipeLeft  = "swipe left"
+	gestureSwipeRight = "swipe right"
+)
+
+type gesture struct {
+	kind string
+	at   image.Point // where the touch started, in panel pixels
+}
+
+// classifyTouch works out the gesture made by a touch from start to end that lasted held.
+// A touch that stays within touchSlop pixels is a tap, or a long press if held long enough.
+// One that moves mostly sideways by at least a fifth of the panel's width is a swipe.
+// Anything else, such as a drag up or down, is no gesture.
+func classifyTouch(start, end image.Point, held, longPress time.Duration, panel image.Point) (gesture, bool) {
+	d := end.Sub(start)
+	if abs(d.X) <= touchSlop && abs(d.Y) <= touchSlop {
+		if held >= longPress {
+			return gesture{gestureLongPress, start}, true
+		}
+		return gesture{gestureTap, start}, true
+	}
+	if abs(d.X) >= panel.X/5 && abs(d.X) > 2*abs(d.Y) {
+		if d.X < 0 {
+			return gesture{gestureSwipeLeft, start}, true
+		}
+		return gesture{gestureSwipeRight, start}, true
+	}
+	return gesture{}, false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// inputEvent is a struct input_event from <linux/input.h>.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// Event types and codes from <linux/input-event-codes.h>.
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evAbs = 0x03
+
+	synReport = 0x00
+
+	btnTouch = 0x14a
+
+	absX            = 0x00
+	absY            = 0x01
+	absMTSlot       = 0x2f
+	absMTPositionX  = 0x35
+	absMTPositionY  = 0x36
+	absMTTrackingID = 0x39
+)
+
+// touchTracker follows a single touch through evdev events.
+// Only the first contact of a multi-touch device is followed.
+type touchTracker struct {
+	cfg   TouchConfig
+	panel image.Point // size in pixels
+
+	// A multi-touch device reports each contact in its own slot, and its
+	// single-touch events follow any contact, so then only slot 0 is followed.
+	multi bool  // whether the device has reported multi-touch events
+	slot  int32 // that following multi-touch events are for
+
+	x, y     int32 // latest raw position
+	touching bool  // as of the latest event
+
+	down        bool // as of the latest SYN_REPORT
+	start, last image.Point
+	startAt     time.Duration
+}
+
+// event handles an event, returning the gesture made when a touch ends.
+func (tt *touchTracker) event(ev inputEvent) (gesture, bool) {
+	switch ev.Type {
+	case evAbs:
+		switch ev.Code {
+		case absX, absY:
+			if tt.multi {
+				break
+			}
+			if ev.Code == absX {
+				tt.x = ev.Value
+			} else {
+				tt.y = ev.Value
+			}
+		case absMTSlot:
+			tt.multi, tt.slot = true, ev.Value
+		case absMTPositionX, absMTPositionY, absMTTrackingID:
+			tt.multi = true
+			if tt.slot != 0 {
+				break
+			}
+			switch ev.Code {
+			case absMTPositionX:
+				tt.x = ev.Value
+			case absMTPositionY:
+				tt.y = ev.Value
+			case absMTTrackingID:
+				tt.touching = ev.Value >= 0
+			}
+		}
+	case evKey:
+		if ev.Code == btnTouch && !tt.multi {
+			tt.touching = ev.Value != 0
+		}
+	case evSyn:
+		if ev.Code != synReport {
+			break
+		}
+		at := time.Duration(ev.Time.Nano())
+		switch {
+		case tt.touching && !tt.down:
+			tt.down, tt.start, tt.startAt = true, tt.point(), at
+			tt.last = tt.start
+		case tt.touching:
+			tt.last = tt.point()
+		case tt.down:
+			tt.down = false
+			return classifyTouch(tt.start, tt.last, at-tt.startAt, tt.cfg.longPress(), tt.panel)
+		}
+	}
+	return gesture{}, false
+}
+
+// point maps the raw position to panel pixels.
+func (tt *touchTracker) point() image.Point {
+	maxX, maxY := tt.cfg.MaxX, tt.cfg.MaxY
+	if maxX == 0 || maxY == 0 {
+		maxX, maxY = tt.panel.X-1, tt.panel.Y-1
+		if tt.cfg.SwapXY {
+			maxX, maxY = maxY, maxX
+		}
+	}
+	fx, fy := float64(tt.x)/float64(maxX), float64(tt.y)/float64(maxY)
+	if tt.cfg.SwapXY {
+		fx, fy = fy, fx
+	}
+	if tt.cfg.InvertX {
+		fx = 1 - fx
+	}
+	if tt.cfg.InvertY {
+		fy = 1 - fy
+	}
+	scale := func(f float64, size int) int {
+		f = math.Max(0, math.Min(1, f))
+		return int(math.Round(f * float64(size-1)))
+	}
+	return image.Pt(scale(fx, tt.panel.X), scale(fy, tt.panel.Y))
+}
+
+// touchController turns touches into actions.
+type touchController struct {
+	cfg   TouchConfig
+	panel image.Point
+	hits  *hitMap
+	ref   *refresher
+	wake  *waker
+}
+
+// Run reads touches from the device until ctx is done.
+func (tc *touchController) Run(ctx context.Context) error {
+	f, err := os.Open(tc.cfg.Device)
+	if err != nil {
+		return fmt.Errorf("opening touch device: %w", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		f.Close() // unblocks a read
+	}()
+	err = tc.read(f)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// read handles the events read from r until it ends.
+func (tc *touchController) read(r io.Reader) error {
+	tt := touchTracker{cfg: tc.cfg, panel: tc.panel}
+	for {
+		var ev inputEvent
+		if err := binary.Read(r, binary.NativeEndian, &ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("reading touch event: %w", err)
+		}
+		if g, ok := tt.event(ev); ok {
+			tc.handle(g, time.Now())
+		}
+	}
+}
+
+func (tc *touchController) handle(g gesture, now time.Time) {
+	switch g.kind {
+	case gestureSwipeLeft:
+		// Only turn to a page that has tasks on it.
+		if tc.hits.Has(hitActionNextPage) && tc.ref.TurnPage(1, now) {
+			tc.wake.Wake("swiped to the next page", false)
+		}
+		return
+	case gestureSwipeRight:
+		if tc.ref.TurnPage(-1, now) {
+			tc.wake.Wake("swiped to the previous page", false)
+		}
+		return
+	}
+	hz, ok := tc.hits.Lookup(g.at)
+	if !ok {
+		return
+	}
+	switch hz.Action {
+	case hitActionNextPage:
+		if tc.ref.TurnPage(1, now) {
+			tc.wake.Wake("tapped for the next page", false)
+		}
+	case hitActionComplete:
+		act := taskAction{kind: taskActionToggleInProgress, itemID: hz.TaskID, title: hz.Title}
+		if g.kind == gestureLongPress {
+			act.kind = taskActionClose
+		}
+		tc.ref.QueueTaskAction(act)
+		tc.wake.Wake(fmt.Sprintf("%s on %q", g.kind, hz.Title), false)
+	}
+}
+
+// taskAction is a change to a task asked for by touch, waiting to be made by the next refresh.
+type taskAction struct {
+	kind   string
+	itemID string
+	title  string // for logging
+}
+
+const (
+	taskActionToggleInProgress = "toggle in-progress"
+	taskActionClose            = "complete"
+)
+
+// QueueTaskAction asks for a change to a task to be made at the next refresh.
+func (r *refresher) QueueTaskAction(act taskAction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = append(r.actions, act)
+}
+
+// TurnPage turns the page of tasks forward or back by delta, reporting whether it changed.
+func (r *refresher) TurnPage(delta int, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.pageLocked(now)
+	r.page, r.pageAt = max(0, old+delta), now
+	return r.page != old
+}
+
+// Page returns which page of tasks to show.
+func (r *refresher) Page(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pageLocked(now)
+}
+
+func (r *refresher) pageLocked(now time.Time) int {
+	if now.Sub(r.pageAt) >= touchPageTimeout {
+		r.page = 0
+	}
+	return r.page
+}
+
+// applyTaskActions makes the changes queued by QueueTaskAction.
+// Tasks are found in the last synced data, which is what was on the panel when touched.
+func (r *refresher) applyTaskActions(ctx context.Context) {
+	r.mu.Lock()
+	actions := r.actions
+	r.actions = nil
+	r.mu.Unlock()
+
+	items := r.ts.Data().Items
+	for _, act := range actions {
+		item, ok := items[act.itemID]
+		if !ok {
+			log.Printf("Task %q is gone; not doing %s", act.title, act.kind)
+			continue
+		}
+		var err error
+		switch act.kind {
+		case taskActionToggleInProgress:
+			if hasLabel(item.Labels, "in-progress") {
+				err = removeLabel(ctx, r.ts, item, "in-progress", true)
+			} else {
+				labels := append(append([]string(nil), item.Labels...), "in-progress")
+				err = r.ts.UpdateItem(ctx, item.ID, todoist.ItemUpdates{Labels: &labels})
+			}
+		case taskActionClose:
+			err = r.ts.CloseItem(ctx, item.ID)
+		}
+		if err != nil {
+			log.Printf("Touch action %s on %q: %v", act.kind, item.Content, err)
+			continue
+		}
+		log.Printf("Touch action %s on %q done", act.kind, item.Content)
+	}
+}
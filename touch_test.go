@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/todoist"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestClassifyTouch(t *testing.T) {
+	panel := image.Pt(800, 480)
+	long := 800 * time.Millisecond
+	tests := []struct {
+		start, end image.Point
+		held       time.Duration
+		want       string // empty for no gesture
+	}{
+		{image.Pt(100, 100), image.Pt(105, 98), 100 * time.Millisecond, gestureTap},
+		{image.Pt(100, 100), image.Pt(105, 98), time.Second, gestureLongPress},
+		{image.Pt(600, 200), image.Pt(300, 220), 300 * time.Millisecond, gestureSwipeLeft},
+		{image.Pt(300, 200), image.Pt(600, 180), 300 * time.Millisecond, gestureSwipeRight},
+		{image.Pt(300, 100), image.Pt(320, 400), 300 * time.Millisecond, ""}, // a drag down
+		{image.Pt(300, 200), image.Pt(360, 200), 300 * time.Millisecond, ""}, // too short for a swipe
+	}
+	for _, test := range tests {
+		g, ok := classifyTouch(test.start, test.end, test.held, long, panel)
+		if !ok {
+			g.kind = ""
+		}
+		if g.kind != test.want {
+			t.Errorf("classifyTouch(%v, %v, %v) = %q, want %q", test.start, test.end, test.held, g.kind, test.want)
+		}
+		if ok && g.at != test.start {
+			t.Errorf("classifyTouch(%v, %v, %v) is at %v, want the start", test.start, test.end, test.held, g.at)
+		}
+	}
+}
+
+// touchEvents encodes a touch from one raw position to another,
+// as a single-touch device reports it.
+func touchEvents(t *testing.T, buf *bytes.Buffer, start time.Time, held time.Duration, x0, y0, x1, y1 int32) {
+	t.Helper()
+	write := func(at time.Time, typ, code uint16, value int32) {
+		ev := inputEvent{Time: syscall.NsecToTimeval(at.UnixNano()), Type: typ, Code: code, Value: value}
+		if err := binary.Write(buf, binary.NativeEndian, &ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(start, evKey, btnTouch, 1)
+	write(start, evAbs, absX, x0)
+	write(start, evAbs, absY, y0)
+	write(start, evSyn, synReport, 0)
+	mid := start.Add(held / 2)
+	write(mid, evAbs, absX, (x0+x1)/2)
+	write(mid, evAbs, absY, (y0+y1)/2)
+	write(mid, evSyn, synReport, 0)
+	end := start.Add(held)
+	write(end, evAbs, absX, x1)
+	write(end, evAbs, absY, y1)
+	write(end, evSyn, synReport, 0)
+	write(end, evKey, btnTouch, 0)
+	write(end, evSyn, synReport, 0)
+}
+
+func TestTouchTrackerMapping(t *testing.T) {
+	// A 4096×4096 overlay mounted rotated: raw X runs down the panel, and raw Y runs right to left.
+	tt := touchTracker{
+		cfg:   TouchConfig{MaxX: 4095, MaxY: 4095, SwapXY: true, InvertX: true},
+		panel: image.Pt(800, 480),
+	}
+	tt.x, tt.y = 0, 4095
+	if got, want := tt.point(), image.Pt(0, 0); got != want {
+		t.Errorf("Raw (0, 4095) maps to %v, want %v", got, want)
+	}
+	tt.x, tt.y = 4095, 0
+	if got, want := tt.point(), image.Pt(799, 479); got != want {
+		t.Errorf("Raw (4095, 0) maps to %v, want %v", got, want)
+	}
+}
+
+func TestTouchTrackerTwoFingers(t *testing.T) {
+	tt := touchTracker{panel: image.Pt(800, 480)}
+	var gestures []gesture
+	at := time.Duration(0)
+	frame := func(d time.Duration, evs ...[2]int32) {
+		at += d
+		tv := syscall.NsecToTimeval(int64(at))
+		for _, e := range evs {
+			typ := uint16(evAbs)
+			if e[0] == btnTouch {
+				typ = evKey
+			}
+			tt.event(inputEvent{Time: tv, Type: typ, Code: uint16(e[0]), Value: e[1]})
+		}
+		if g, ok := tt.event(inputEvent{Time: tv, Type: evSyn, Code: synReport}); ok {
+			gestures = append(gestures, g)
+		}
+	}
+	// A tap with one finger while another touches somewhere else and lifts first.
+	frame(0, [2]int32{absMTSlot, 0}, [2]int32{absMTTrackingID, 10}, [2]int32{absMTPositionX, 200}, [2]int32{absMTPositionY, 20},
+		[2]int32{btnTouch, 1}, [2]int32{absX, 200}, [2]int32{absY, 20})
+	frame(30*time.Millisecond, [2]int32{absMTSlot, 1}, [2]int32{absMTTrackingID, 11}, [2]int32{absMTPositionX, 600}, [2]int32{absMTPositionY, 400})
+	frame(30*time.Millisecond, [2]int32{absMTTrackingID, -1})
+	frame(30*time.Millisecond, [2]int32{absMTSlot, 0}, [2]int32{absMTPositionX, 203}, [2]int32{absX, 203})
+	frame(30*time.Millisecond, [2]int32{absMTTrackingID, -1}, [2]int32{btnTouch, 0})
+
+	if want := []gesture{{gestureTap, image.Pt(200, 20)}}; !reflect.DeepEqual(gestures, want) {
+		t.Errorf("Two-finger touch made gestures %v, want %v", gestures, want)
+	}
+}
+
+func TestTouchActions(t *testing.T) {
+	ft := newFakeTodoist()
+	ft.data.Items = map[string]todoist.Item{
+		"1": {ID: "1", ProjectID: "p1", Content: "paint fence"},
+		"2": {ID: "2", ProjectID: "p1", Content: "wash up", Labels: []string{"in-progress"}},
+		"3": {ID: "3", ProjectID: "p1", Content: "take out bins"},
+	}
+	r := &refresher{ts: ft}
+	hits := new(hitMap)
+	hits.Set(image.Pt(800, 480), []hitZone{
+		{Rect: image.Rect(0, 0, 800, 40), Action: hitActionComplete, TaskID: "1", Title: "paint fence"},
+		{Rect: image.Rect(0, 40, 800, 80), Action: hitActionComplete, TaskID: "2", Title: "wash up"},
+		{Rect: image.Rect(0, 80, 800, 120), Action: hitActionComplete, TaskID: "3", Title: "take out bins"},
+		{Rect: image.Rect(0, 120, 800, 140), Action: hitActionNextPage},
+	})
+	wake := newWaker()
+	tc := &touchController{panel: image.Pt(800, 480), hits: hits, ref: r, wake: wake}
+
+	// By default, raw coordinates are panel pixels.
+	var buf bytes.Buffer
+	start := time.Now()
+	touchEvents(t, &buf, start, 100*time.Millisecond, 200, 20, 203, 22)                      // tap on 1
+	touchEvents(t, &buf, start.Add(time.Second), 100*time.Millisecond, 200, 60, 200, 60)     // tap on 2
+	touchEvents(t, &buf, start.Add(2*time.Second), time.Second, 300, 100, 300, 100)          // long press on 3
+	touchEvents(t, &buf, start.Add(4*time.Second), 100*time.Millisecond, 300, 300, 300, 300) // tap on nothing
+	if err := tc.read(&buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	select {
+	case <-wake.C():
+	default:
+		t.Errorf("Touching tasks didn't wake the loop")
+	}
+	if ft.mutations != 0 {
+		t.Errorf("Touching tasks changed Todoist before the refresh")
+	}
+
+	r.applyTaskActions(context.Background())
+	if got := ft.data.Items["1"].Labels; !reflect.DeepEqual(got, []string{"in-progress"}) {
+		t.Errorf("After a tap, task 1 has labels %q, want in-progress", got)
+	}
+	if got := ft.data.Items["2"].Labels; len(got) != 0 {
+		t.Errorf("After a tap, task 2 has labels %q, want none", got)
+	}
+	if _, ok := ft.data.Items["3"]; ok {
+		t.Errorf("After a long press, task 3 is still incomplete")
+	}
+
+	// Swiping turns the page, but not back before the first.
+	buf.Reset()
+	touchEvents(t, &buf, start, 200*time.Millisecond, 600, 200, 200, 210)
+	if err := tc.read(&buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	now := time.Now()
+	if got := r.Page(now); got != 1 {
+		t.Errorf("After swiping left, page = %d, want 1", got)
+	}
+	tc.handle(gesture{gestureSwipeRight, image.Pt(200, 200)}, now)
+	tc.handle(gesture{gestureSwipeRight, image.Pt(200, 200)}, now)
+	if got := r.Page(now); got != 0 {
+		t.Errorf("After swiping right twice, page = %d, want 0", got)
+	}
+	tc.handle(gesture{gestureTap, image.Pt(200, 130)}, now)
+	if got := r.Page(now.Add(time.Minute)); got != 1 {
+		t.Errorf("After tapping for the next page, page = %d, want 1", got)
+	}
+	if got := r.Page(now.Add(touchPageTimeout)); got != 0 {
+		t.Errorf("After %v, page = %d, want 0", touchPageTimeout, got)
+	}
+}
+
+func TestRenderPages(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rend, err := newRenderer(Config{Font: fontFile, Messages: []message{{Options: []string{"Testing"}}}}, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	data := displayData{
+		today: time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local),
+		now:   time.Date(2024, time.June, 12, 9, 30, 0, 0, time.Local),
+	}
+	for i := 0; i < 40; i++ {
+		data.tasks = append(data.tasks, renderableTask{Priority: 1, Title: fmt.Sprintf("Task %d", i), Project: "House", id: fmt.Sprint(i)})
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 480))
+	pageOf := func(page int) (ids []string, more bool) {
+		data.page = page
+		_, hits := rend.RenderHits(dst, data)
+		for _, hz := range hits {
+			switch hz.Action {
+			case hitActionComplete:
+				ids = append(ids, hz.TaskID)
+			case hitActionNextPage:
+				more = true
+			}
+		}
+		return ids, more
+	}
+
+	seen := make(map[string]bool)
+	for page := 0; ; page++ {
+		ids, more := pageOf(page)
+		if len(ids) == 0 {
+			t.Fatalf("Page %d has no tasks", page)
+		}
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("Task %s is on page %d and an earlier one", id, page)
+			}
+			seen[id] = true
+		}
+		if !more {
+			// Pages beyond the last show the last.
+			if again, _ := pageOf(page + 1); !reflect.DeepEqual(again, ids) {
+				t.Errorf("Page %d shows %q, want the last page's %q", page+1, again, ids)
+			}
+			break
+		}
+		if page > 10 {
+			t.Fatalf("Too many pages")
+		}
+	}
+	if len(seen) != len(data.tasks) {
+		t.Errorf("Pages showed %d tasks, want all %d", len(seen), len(data.tasks))
+	}
+}
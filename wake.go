@@ -0,0 +1,85 @@
+package main
+
+// Waking the main loop early, so changes made through the web UI, MQTT or signals
+// show up straight away instead of at the next refresh period.
+
+import (
+	"strings"
+	"sync"
+)
+
+// wakeRequest asks the main loop to refresh or redraw now.
+type wakeRequest struct {
+	reasons []string // for logging
+	refresh bool     // fetch new data; otherwise the last data is drawn again
+	redraw  bool     // render even if the data hasn't changed, such as for a new photo
+	repaint bool     // refresh the whole panel even if the frame looks the same
+}
+
+// waker wakes the main loop. Requests made while one is pending are merged into it.
+// A nil waker ignores requests.
+type waker struct {
+	c chan struct{} // has a value while a request is pending
+
+	mu      sync.Mutex
+	pending wakeRequest
+}
+
+func newWaker() *waker {
+	return &waker{c: make(chan struct{}, 1)}
+}
+
+// Wake asks for a refresh, and a render if redraw is set. It never blocks.
+func (w *waker) Wake(reason string, redraw bool) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.pending.reasons = append(w.pending.reasons, reason)
+	w.pending.refresh = true
+	w.pending.redraw = w.pending.redraw || redraw
+	w.mu.Unlock()
+	w.poke()
+}
+
+// Repaint asks for the last data to be drawn again without fetching anything new,
+// updating the whole panel even if the frame looks the same, such as to clear ghosting.
+// It never blocks.
+func (w *waker) Repaint(reason string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.pending.reasons = append(w.pending.reasons, reason)
+	w.pending.redraw, w.pending.repaint = true, true
+	w.mu.Unlock()
+	w.poke()
+}
+
+func (w *waker) poke() {
+	select {
+	case w.c <- struct{}{}:
+	default:
+		// Already pending.
+	}
+}
+
+// C returns a channel that receives when a request is pending.
+// It is nil for a nil waker, so it never receives.
+func (w *waker) C() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.c
+}
+
+// Take returns the pending request, clearing it.
+func (w *waker) Take() wakeRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	req := w.pending
+	w.pending = wakeRequest{}
+	return req
+}
+
+func (req wakeRequest) String() string { return strings.Join(req.reasons, ", ") }
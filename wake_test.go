@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWaker(t *testing.T) {
+	w := newWaker()
+	select {
+	case <-w.C():
+		t.Fatalf("new waker is already pending")
+	default:
+	}
+
+	w.Wake("notes", false)
+	w.Wake("photo", true)
+	w.Wake("SIGHUP", false)
+	select {
+	case <-w.C():
+	default:
+		t.Fatalf("waker is not pending after Wake")
+	}
+	got := w.Take()
+	want := wakeRequest{reasons: []string{"notes", "photo", "SIGHUP"}, refresh: true, redraw: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take = %+v, want %+v", got, want)
+	}
+	if got := w.Take(); !reflect.DeepEqual(got, wakeRequest{}) {
+		t.Errorf("second Take = %+v, want nothing", got)
+	}
+	select {
+	case <-w.C():
+		t.Errorf("waker is still pending after Take")
+	default:
+	}
+}
+
+func TestNilWaker(t *testing.T) {
+	var w *waker
+	w.Wake("ignored", true) // must not panic
+	if c := w.C(); c != nil {
+		t.Errorf("nil waker C() = %v, want nil", c)
+	}
+}
+
+func TestWakerRepaint(t *testing.T) {
+	w := newWaker()
+	w.Repaint("ghosting")
+	if got, want := w.Take(), (wakeRequest{reasons: []string{"ghosting"}, redraw: true, repaint: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Take after Repaint = %+v, want %+v", got, want)
+	}
+
+	// A refresh asked for at the same time still happens.
+	w.Repaint("ghosting")
+	w.Wake("notes", false)
+	if got := w.Take(); !got.refresh || !got.repaint {
+		t.Errorf("Take after Repaint and Wake = %+v, want a refresh and repaint", got)
+	}
+}
+
+func TestServeWake(t *testing.T) {
+	s := &server{wake: newWaker()}
+	for _, test := range []struct {
+		path string
+		want wakeRequest
+	}{
+		{"/refresh", wakeRequest{reasons: []string{"refresh requested over HTTP"}, refresh: true, redraw: true}},
+		{"/redraw", wakeRequest{reasons: []string{"redraw requested over HTTP"}, redraw: true, repaint: true}},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s gave %d, want %d", test.path, rec.Code, http.StatusMethodNotAllowed)
+		}
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("POST", test.path, nil))
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("POST %s gave %d, want %d", test.path, rec.Code, http.StatusAccepted)
+		}
+		if got := s.wake.Take(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("POST %s woke with %+v, want %+v", test.path, got, test.want)
+		}
+	}
+}
@@ -10,20 +10,23 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	rpio "github.com/stianeikeland/go-rpio/v4"
 )
 
-func newPaper() paper {
-	// I'm running in landscape, so 800 is the width.
+func newPaper(panel PanelConfig, tuning PanelTuning) paper {
+	// The panel is natively landscape, so 800 is the width.
 	// The spec identifies this as the height.
-	const width = 800
-	const height = 480
+	size := panel.nativeSize()
+	width, height := size.X, size.Y
 
 	return paper{
 		width:  width,
 		height: height,
+		panel:  panel,
 
 		// Pinout using BCM numbering.
 		reset: rpio.Pin(17), // spec says 10?!
@@ -33,15 +36,55 @@ func newPaper() paper {
 
 		bw:  newBitmap(width, height),
 		red: newBitmap(width, height),
+
+		stats: new(paperStats),
+		bus:   new(paperBus),
+
+		tuning: tuning,
 	}
 }
 
 type paper struct {
-	width, height int
+	width, height int         // in the controller's orientation
+	panel         PanelConfig // for mapping points as drawn to the controller's orientation
 
 	reset, dc, cs, busy rpio.Pin
 
 	bw, red bitmap
+
+	stats *paperStats
+	bus   *paperBus
+
+	tuning PanelTuning
+
+	// powerSave says to shut down SPI and release the pins whenever the panel is asleep,
+	// and set them up again for each refresh.
+	powerSave bool
+
+	trace *paperTrace // may be nil
+}
+
+// paperStats records information about how the panel has been used.
+// It is shared between copies of a paper.
+type paperStats struct {
+	mu        sync.Mutex
+	lastWhite time.Time // when the panel was last refreshed to entirely white
+	bw, red   []byte    // the planes most recently sent for a full refresh
+}
+
+// paperBus records whether SPI and the panel's pins are set up.
+// It is shared between copies of a paper.
+type paperBus struct {
+	mu     sync.Mutex
+	active bool
+}
+
+// LastWhiteFlush reports when the panel was last refreshed to entirely white.
+// It returns the zero time if that hasn't happened since startup.
+func (p paper) LastWhiteFlush() time.Time {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	return p.stats.lastWhite
 }
 
 func (p paper) debugf(format string, args ...interface{}) {
@@ -54,8 +97,30 @@ func (p paper) Start() error {
 	if err := rpio.Open(); err != nil {
 		return fmt.Errorf("opening memory range for GPIO access: %v", err)
 	}
+	return p.attach()
+}
 
-	p.debugf("paper.Init pin config")
+func (p paper) Stop() {
+	p.debugf("paper.Stop start")
+	defer p.debugf("paper.Stop finish")
+
+	// TODO: Turn display all white? I think that might be better for the hardware.
+
+	p.Sleep()
+	p.detach()
+	rpio.Close()
+}
+
+// attach sets up SPI and the panel's pins, if they aren't already.
+func (p paper) attach() error {
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	if p.bus.active {
+		return nil
+	}
+
+	p.debugf("paper.attach pin config")
+	start := time.Now()
 	if err := rpio.SpiBegin(rpio.Spi0); err != nil {
 		return fmt.Errorf("setting pin modes to SPI: %v", err)
 	}
@@ -63,100 +128,156 @@ func (p paper) Start() error {
 	p.dc.Mode(rpio.Output)
 	p.cs.Mode(rpio.Output)
 	p.busy.Mode(rpio.Input)
+	p.bus.active = true
+	p.debugf("paper.attach finish (took %v)", time.Since(start).Truncate(time.Microsecond))
 	return nil
 }
 
-func (p paper) Stop() {
-	p.debugf("paper.Stop start")
-	defer p.debugf("paper.Stop finish")
-
-	// TODO: Turn display all white? I think that might be better for the hardware.
-
-	p.Sleep()
+// detach shuts down SPI and drives the panel's pins low, as Waveshare's own code does,
+// so no current flows into the HAT. The panel should be asleep.
+func (p paper) detach() {
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	if !p.bus.active {
+		return
+	}
 
-	p.debugf("paper.Stop pin unconfig")
+	p.debugf("paper.detach pin unconfig")
+	p.cs.Write(rpio.Low)
+	p.dc.Write(rpio.Low)
+	p.reset.Write(rpio.Low)
 	rpio.SpiEnd(rpio.Spi0)
-	rpio.Close()
+	p.bus.active = false
+}
+
+// attached reports whether SPI and the panel's pins are set up.
+func (p paper) attached() bool {
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	return p.bus.active
 }
 
 func (p paper) Init() error {
+	// LUT from OTP (or registers, if tuned), Pixel with Black/White/Red (KWR mode), Scan up, Shift right, Booster ON, No reset.
+	return p.init(0x0F, nil, nil)
+}
+
+// init initialises the panel, setting the Panel Setting (PSR) register to psr,
+// and the Booster Soft Start (BTST) and VCOM and Data interval Setting (CDI)
+// registers to the given defaults unless they are tuned. Nil defaults aren't sent,
+// leaving the controller's own.
+func (p paper) init(psr byte, booster, cdi []byte) error {
 	p.debugf("paper.Init start")
 	defer p.debugf("paper.Init finish")
 
+	if p.powerSave {
+		if err := p.attach(); err != nil {
+			return err
+		}
+	}
+
 	p.debugf("paper.Init reset")
 	p.Reset()
 
-	// The next sequence follows one of
+	// The next sequence follows
 	//	4.2-1) BWRmode&LUTfromregister
-	// or
+	// if register LUTs are configured, or otherwise
 	//	4.2-2) BWR mode & LUT from OTP
 	// from the spec.
 
 	// Configure power setting.
 	p.debugf("paper.Init Power Setting (PWR)")
 	p.Command(0x01)
-	// VSR_E | VS_E | VG_E
-	// Internal power.
-	p.Data(0x07)
-	// VG_LVL[2:0]==b111
-	// VGH=20V, VGL=-20V
-	p.Data(0x07) // TODO: fast slew rate?
-	// VDH_LVL[5:0]==b111111
-	// Internal VDH power selection for K/W pixel=15.0V
-	p.Data(0x3f)
-	// VDL_LVL[5:0]==b111111
-	// Internal VDL power selection for K/W pixel=-15.0V
-	p.Data(0x3f)
-	// TODO: set VDHR_LVL?
+	// By default:
+	// VSR_E | VS_E | VG_E: Internal power.
+	// VG_LVL[2:0]==b111: VGH=20V, VGL=-20V
+	// VDH_LVL[5:0]==b111111: Internal VDH power selection for K/W pixel=15.0V
+	// VDL_LVL[5:0]==b111111: Internal VDL power selection for K/W pixel=-15.0V
+	// VDHR_LVL is only set if tuned.
+	p.Data(p.tuning.pwr()...) // TODO: fast slew rate?
+
+	if p.tuning.Booster != nil {
+		booster = intsToBytes(p.tuning.Booster)
+	}
+	if booster != nil {
+		p.debugf("paper.Init Booster Soft Start (BTST)")
+		p.Command(0x06, booster...)
+	}
 
 	// Power on.
 	p.debugf("paper.Init Power ON (PON)")
 	p.Command(0x04)
 	time.Sleep(100 * time.Millisecond)
 	p.debugf("paper.Init wait for not busy")
-	p.WaitForNotBusy()
+	if err := p.WaitForNotBusy(); err != nil {
+		return fmt.Errorf("powering on: %w", err)
+	}
 
 	// Panel settings.
 	p.debugf("paper.Init Panel Setting (PSR)")
 	p.Command(0x00)
-	// UD | SHL | SHD_N | RST_N
-	// LUT from OTP, Pixel with Black/White/Red (KWR mode), Scan up, Shift right, Booster ON, No reset.
-	p.Data(0x0F)
+	// UD | SHL | SHD_N | RST_N, and perhaps KWR
+	if p.tuning.LUT.fromRegister() {
+		psr |= 0x20 // REG: LUT from register
+	}
+	p.Data(psr)
 
 	// Resolution.
 	p.debugf("paper.Init Resolution Setting (TRES)")
 	p.Command(0x61)
-	// HRES[9:8]==b11
-	p.Data(0x03)
-	// HRES[7:3]==b00100
-	// HRES=0x64=100; horizontal resolution is 100*8 = 800 (active sources 0..799)
-	p.Data(0x20)
-	// VRES[9:8]==b01
-	p.Data(0x01)
-	// VRES[7:0]==b11100000
-	// VRES=0x1E0=480; vertical resolution is 480 (active gates 0..479)
-	p.Data(0xE0)
+	// HRES[9:3]: horizontal resolution, in units of 8 sources
+	// (for 800, 0x03 0x20; active sources 0..799).
+	p.Data(byte(p.width>>8), byte(p.width&0xF8))
+	// VRES[9:0]: vertical resolution (for 480, 0x01 0xE0; active gates 0..479).
+	p.Data(byte(p.height>>8), byte(p.height))
 
 	// TODO: 0x15 Dual SPI Mode (DUSPI)
-	// TODO: 0x60 TCON Setting (TCON)
-	// TODO: 0x50 VCOM and Data interval Setting (CDI)
+	if p.tuning.TCON != nil {
+		p.debugf("paper.Init TCON Setting (TCON)")
+		p.Command(0x60, byte(*p.tuning.TCON))
+	}
+	if p.tuning.CDI != nil {
+		cdi = intsToBytes(p.tuning.CDI)
+	}
+	if cdi != nil {
+		p.debugf("paper.Init VCOM and Data interval Setting (CDI)")
+		p.Command(0x50, cdi...)
+	}
 	// TODO: 0x65 Gate/Source Start Setting (GSST)
 
+	for _, lc := range p.tuning.LUT.commands() {
+		p.debugf("paper.Init LUT 0x%02X", lc.cmd)
+		p.Command(lc.cmd, lc.data...)
+	}
+
 	p.Clear()
 
 	return nil
 }
 
 func (p paper) Sleep() {
+	if !p.attached() {
+		// Already asleep, and talking to the panel now would hang.
+		return
+	}
 	p.debugf("paper.Sleep Power OFF (POF)")
 	p.Command(0x02)
 	p.debugf("paper.Sleep idle wait")
-	p.WaitForNotBusy()
+	if err := p.WaitForNotBusy(); err != nil {
+		// Go into deep sleep anyway; it's the safest state to leave the panel in.
+		log.Printf("Powering off panel: %v", err)
+	}
 	p.debugf("paper.Sleep Deep Sleep (DSLP)")
 	p.Command(0x07, 0xA5)
+
+	if p.powerSave {
+		// Waking from deep sleep needs a reset anyway, which Init does.
+		p.detach()
+	}
 }
 
 func (p paper) Reset() {
+	p.trace.record(traceReset, nil)
 	p.reset.Write(rpio.High)
 	time.Sleep(20 * time.Millisecond)
 	p.reset.Write(rpio.Low)
@@ -171,7 +292,7 @@ func (p paper) Clear() {
 	p.red.clearAll()
 }
 
-func (p paper) DisplayRefresh() {
+func (p paper) DisplayRefresh() error {
 	p.debugf("paper.DisplayRefresh start")
 	start := time.Now()
 	defer func() {
@@ -189,10 +310,58 @@ func (p paper) DisplayRefresh() {
 	p.debugf("paper.DisplayRefresh Display Refresh (DRF)")
 	p.Command(0x12)
 	time.Sleep(100 * time.Millisecond) // TODO: really needed?
-	p.WaitForNotBusy()
+	if err := p.WaitForNotBusy(); err != nil {
+		return fmt.Errorf("refreshing display: %w", err)
+	}
+
+	p.recordFrame()
+	return nil
+}
+
+// recordFrame keeps a copy of the current planes, as what's being shown.
+func (p paper) recordFrame() {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	if p.bw.isAll(0xFF) && p.red.isAll(0) {
+		p.stats.lastWhite = time.Now()
+	}
+	p.stats.bw = append(p.stats.bw[:0], p.bw.bits...)
+	p.stats.red = append(p.stats.red[:0], p.red.bits...)
+}
+
+// Plane returns the named plane ("bw" or "red") as most recently sent to the panel,
+// as a 1-bit image with set bits in white or red respectively.
+// Like Bounds, it is in the orientation the panel is used.
+// It returns nil if there's no such plane or nothing has been sent yet.
+func (p paper) Plane(name string) *image.Paletted {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	switch name {
+	case "bw":
+		return p.planeImage(bitmap{p.stats.bw, p.width, p.height}, color.Black, color.White)
+	case "red":
+		return p.planeImage(bitmap{p.stats.red, p.width, p.height}, color.White, colorRed)
+	}
+	return nil
 }
 
-func (p paper) DisplayPartialRefresh(x, y, w, h int) {
+func (p paper) planeImage(b bitmap, off, on color.Color) *image.Paletted {
+	if b.bits == nil {
+		return nil
+	}
+	size := p.panel.size()
+	img := image.NewPaletted(image.Rectangle{Max: size}, color.Palette{off, on})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			if b.get(p.panel.toNative(x, y)) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+func (p paper) DisplayPartialRefresh(x, y, w, h int) error {
 	// TODO: This doesn't work. My hardware doesn't actually support partial refreshing.
 	// The subset of data is transferred just fine, but the entire display is refreshed
 	// as slowly as usual, instead of just the window.
@@ -246,36 +415,98 @@ func (p paper) DisplayPartialRefresh(x, y, w, h int) {
 	p.debugf("paper.DisplayPartialRefresh Display Refresh (DRF)")
 	p.Command(0x12)
 	time.Sleep(100 * time.Millisecond) // TODO: really needed?
-	p.WaitForNotBusy()
+	err := p.WaitForNotBusy()
 
 	p.debugf("paper.DisplayPartialRefresh Partial Out (PTOUT)")
 	p.Command(0x92)
+	if err != nil {
+		return fmt.Errorf("refreshing display: %w", err)
+	}
+	return nil
 }
 
+// busyTimeout is how long to wait for the e-Paper to stop being busy.
+// A full refresh normally takes about 20s.
+const busyTimeout = 60 * time.Second
+
 // WaitForNotBusy waits until the busy pin goes high, signaling the e-Paper is not busy.
-func (p paper) WaitForNotBusy() {
+// If that takes too long, the error includes what the panel reports about itself.
+func (p paper) WaitForNotBusy() error {
+	p.trace.record(traceBusy, nil)
+	deadline := time.Now().Add(busyTimeout)
 	for {
-		p.Command(0x71) // Get Status (FLG)
+		p.command(0x71) // Get Status (FLG); not traced, since it's polled
 		if p.busy.Read() == rpio.High {
 			break
 		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still busy after %v (%s)", busyTimeout, p.diagnostics())
+		}
 		time.Sleep(1 * time.Millisecond)
 	}
 	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+// diagnostics reads back the panel's status, revision and temperature.
+// This needs the panel's data line to be readable over SPI;
+// if it isn't, expect all zeros or all ones.
+func (p paper) diagnostics() string {
+	p.command(0x71) // Get Status (FLG)
+	flg := p.read(1)[0]
+	p.command(0x70) // Revision (REV)
+	rev := p.read(3)
+	p.command(0x40) // Temperature Sensor Calibration (TSC)
+	tsc := p.read(2)
+	return fmt.Sprintf("FLG=0x%02X [%s], REV=%X, temperature %.1f°C", flg, paperFlags(flg), rev, tscCelsius(tsc))
+}
+
+// paperFlags describes the bits that are set in the FLG status byte.
+func paperFlags(flg byte) string {
+	names := []string{"BUSY_N", "POF", "PON", "data_flag", "I2C_BUSYN", "I2C_ERR", "PTL_flag"}
+	var set []string
+	for i, name := range names {
+		if flg&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	return strings.Join(set, " ")
+}
+
+// tscCelsius converts the TSC response to °C.
+// It is an 11-bit two's complement value in 1/8°C units, left-aligned in two bytes.
+func tscCelsius(tsc []byte) float64 {
+	v := int16(uint16(tsc[0])<<8|uint16(tsc[1])) >> 5
+	return float64(v) / 8
 }
 
 func (p paper) Command(x byte, params ...byte) {
+	p.trace.record(traceCommand, []byte{x})
+	p.command(x)
+
+	for _, param := range params {
+		p.Data(param)
+	}
+}
+
+func (p paper) command(x byte) {
 	p.dc.Write(rpio.Low)
 	p.cs.Write(rpio.Low)
 	rpio.SpiTransmit(x)
 	p.cs.Write(rpio.High)
+}
 
-	for _, param := range params {
-		p.Data(param)
-	}
+// read reads n bytes of data, following a command that returns some.
+func (p paper) read(n int) []byte {
+	p.dc.Write(rpio.High)
+	p.cs.Write(rpio.Low)
+	b := rpio.SpiReceive(n)
+	p.cs.Write(rpio.High)
+	return b
 }
 
 func (p paper) Data(x ...byte) {
+	p.trace.record(traceData, x)
 	p.dc.Write(rpio.High)
 	p.cs.Write(rpio.Low)
 	rpio.SpiTransmit(x...)
@@ -314,15 +545,14 @@ func (p paper) ColorModel() color.Model {
 	return staticPalette
 }
 
-// Bounds implements image.Image.
+// Bounds implements image.Image. It is in the orientation the panel is used.
 func (p paper) Bounds() image.Rectangle {
-	return image.Rectangle{
-		Max: image.Point{X: p.width, Y: p.height},
-	}
+	return image.Rectangle{Max: p.panel.size()}
 }
 
 // At implements image.Image.
 func (p paper) At(x, y int) color.Color {
+	x, y = p.panel.toNative(x, y)
 	if p.red.get(x, y) {
 		return colRed.RGBA()
 	}
@@ -334,6 +564,7 @@ func (p paper) At(x, y int) color.Color {
 
 // Set implements draw.Image.
 func (p paper) Set(x, y int, c color.Color) {
+	x, y = p.panel.toNative(x, y)
 	switch pickColor(c) {
 	case colBlack:
 		p.bw.clear(x, y)
@@ -376,6 +607,16 @@ func (b bitmap) setAll() {
 	}
 }
 
+// isAll reports whether every byte of the bitmap is x.
+func (b bitmap) isAll(x byte) bool {
+	for _, y := range b.bits {
+		if y != x {
+			return false
+		}
+	}
+	return true
+}
+
 func (b bitmap) clear(x, y int) {
 	off := x + y*b.width
 	i := off / 8             // byte index
@@ -387,7 +628,7 @@ func (b bitmap) get(x, y int) bool {
 	off := x + y*b.width
 	i := off / 8             // byte index
 	j := 1 << (7 - off&0x07) // bit mask
-	return b.bits[i]|byte(j) != 0
+	return b.bits[i]&byte(j) != 0
 }
 
 func (b bitmap) set(x, y int) {
@@ -0,0 +1,104 @@
+package main
+
+// Code specific to the black and white Waveshare e-Paper.
+//
+// This is the "7.5inch e-Paper V2", https://www.waveshare.com/wiki/7.5inch_e-Paper_HAT_Manual.
+// It has the same controller as the (B) panel, so it shares most of paper's code,
+// but it has no red plane and needs a few different settings.
+// The settings follow Waveshare's own code for the panel.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+)
+
+// bwPaper is a black and white panel. Anything drawn in red is shown in black.
+type bwPaper struct {
+	paper
+}
+
+var bwPalette = color.Palette{color.White, color.Black}
+
+func (p bwPaper) Init() error {
+	// LUT from OTP, Pixel with Black/White (KW mode), Scan up, Shift right, Booster ON, No reset.
+	return p.init(0x1F, []byte{0x17, 0x17, 0x28, 0x17}, []byte{0x10, 0x07})
+}
+
+func (p bwPaper) DisplayRefresh() error {
+	p.debugf("bwPaper.DisplayRefresh start")
+	start := time.Now()
+	defer func() {
+		p.debugf("bwPaper.DisplayRefresh finish (took %v)", time.Since(start).Truncate(time.Millisecond))
+	}()
+
+	// In KW mode, set bits are black, and DTM1 holds the frame being replaced.
+	p.stats.mu.Lock()
+	old := invertBits(p.stats.bw)
+	p.stats.mu.Unlock()
+	if old == nil {
+		old = make([]byte, len(p.bw.bits)) // white
+	}
+	p.debugf("bwPaper.DisplayRefresh Data Start Transmission 1 (DTM1)")
+	p.Command(0x10)
+	p.Data(old...)
+
+	p.debugf("bwPaper.DisplayRefresh Data Start Transmission 2 (DTM2)")
+	p.Command(0x13)
+	p.Data(invertBits(p.bw.bits)...)
+
+	p.debugf("bwPaper.DisplayRefresh Display Refresh (DRF)")
+	p.Command(0x12)
+	time.Sleep(100 * time.Millisecond)
+	if err := p.WaitForNotBusy(); err != nil {
+		return fmt.Errorf("refreshing display: %w", err)
+	}
+
+	p.recordFrame()
+	return nil
+}
+
+// Plane returns the "bw" plane as most recently sent to the panel. There is no "red" plane.
+func (p bwPaper) Plane(name string) *image.Paletted {
+	if name != "bw" {
+		return nil
+	}
+	return p.paper.Plane(name)
+}
+
+// ColorModel implements image.Image.
+func (p bwPaper) ColorModel() color.Model {
+	return bwPalette
+}
+
+// At implements image.Image.
+func (p bwPaper) At(x, y int) color.Color {
+	x, y = p.panel.toNative(x, y)
+	if !p.bw.get(x, y) {
+		return colBlack.RGBA()
+	}
+	return colWhite.RGBA()
+}
+
+// Set implements draw.Image.
+func (p bwPaper) Set(x, y int, c color.Color) {
+	x, y = p.panel.toNative(x, y)
+	if pickColor(c) == colWhite {
+		p.bw.set(x, y)
+	} else {
+		p.bw.clear(x, y)
+	}
+}
+
+// invertBits returns a copy of b with every bit flipped, or nil if b is nil.
+func invertBits(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	inv := make([]byte, len(b))
+	for i, x := range b {
+		inv[i] = ^x
+	}
+	return inv
+}
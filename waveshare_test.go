@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"testing/quick"
+)
+
+func TestPaperDiagnostics(t *testing.T) {
+	if got, want := paperFlags(0x05), "BUSY_N PON"; got != want {
+		t.Errorf("paperFlags(0x05) = %q, want %q", got, want)
+	}
+	if got := paperFlags(0); got != "" {
+		t.Errorf("paperFlags(0) = %q, want empty", got)
+	}
+
+	tests := []struct {
+		tsc  []byte
+		want float64
+	}{
+		{[]byte{0x19, 0x00}, 25},
+		{[]byte{0x19, 0x80}, 25.5},
+		{[]byte{0xFF, 0x00}, -1},
+		{[]byte{0xFB, 0xE0}, -4.125},
+	}
+	for _, test := range tests {
+		if got := tscCelsius(test.tsc); got != test.want {
+			t.Errorf("tscCelsius(% x) = %v, want %v", test.tsc, got, test.want)
+		}
+	}
+}
+
+func TestBitmap(t *testing.T) {
+	b := newBitmap(16, 3)
+	if len(b.bits) != 6 {
+		t.Fatalf("16x3 bitmap has %d bytes, want 6", len(b.bits))
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 16; x++ {
+			if b.get(x, y) {
+				t.Fatalf("New bitmap has (%d,%d) set", x, y)
+			}
+		}
+	}
+
+	b.set(0, 0)
+	b.set(9, 1)
+	b.set(15, 2)
+	if want := []byte{0x80, 0x00, 0x00, 0x40, 0x00, 0x01}; !bytes.Equal(b.bits, want) {
+		t.Errorf("After sets, bits = % x, want % x", b.bits, want)
+	}
+	for _, p := range [][2]int{{0, 0}, {9, 1}, {15, 2}} {
+		if !b.get(p[0], p[1]) {
+			t.Errorf("get(%d,%d) = false after set", p[0], p[1])
+		}
+	}
+	if b.get(1, 0) || b.get(8, 1) || b.get(14, 2) {
+		t.Errorf("Neighbouring bits were set")
+	}
+
+	b.clear(9, 1)
+	if b.get(9, 1) {
+		t.Errorf("get(9,1) = true after clear")
+	}
+	if !b.get(0, 0) || !b.get(15, 2) {
+		t.Errorf("clear(9,1) cleared other bits")
+	}
+
+	if got := b.subrow(8, 2, 8); !bytes.Equal(got, []byte{0x01}) {
+		t.Errorf("subrow(8, 2, 8) = % x, want 01", got)
+	}
+	if got := b.subrow(0, 1, 16); !bytes.Equal(got, []byte{0x00, 0x00}) {
+		t.Errorf("subrow(0, 1, 16) = % x, want 00 00", got)
+	}
+
+	b.setAll()
+	if !b.isAll(0xFF) || b.isAll(0) {
+		t.Errorf("setAll didn't set everything")
+	}
+	b.clearAll()
+	if !b.isAll(0) || b.isAll(0xFF) {
+		t.Errorf("clearAll didn't clear everything")
+	}
+}
+
+func TestBitmapBounds(t *testing.T) {
+	mustPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s didn't panic", name)
+			}
+		}()
+		f()
+	}
+	mustPanic("newBitmap(12, 2)", func() { newBitmap(12, 2) })
+
+	b := newBitmap(8, 2)
+	mustPanic("set past the end", func() { b.set(0, 2) })
+	mustPanic("get past the end", func() { b.get(7, 2) })
+	mustPanic("subrow past the end", func() { b.subrow(0, 2, 8) })
+}
+
+// TestBitmapQuick checks that a bitmap behaves like a set of points.
+func TestBitmapQuick(t *testing.T) {
+	const w, h = 24, 5
+	type op struct {
+		Set  bool
+		X, Y uint8
+	}
+	f := func(ops []op) bool {
+		b := newBitmap(w, h)
+		model := make(map[[2]int]bool)
+		for _, o := range ops {
+			x, y := int(o.X)%w, int(o.Y)%h
+			if o.Set {
+				b.set(x, y)
+			} else {
+				b.clear(x, y)
+			}
+			model[[2]int{x, y}] = o.Set
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if b.get(x, y) != model[[2]int{x, y}] {
+					return false
+				}
+			}
+			// subrow must agree with get.
+			row := b.subrow(0, y, w)
+			for x := 0; x < w; x++ {
+				if (row[x/8]&(0x80>>(x%8)) != 0) != b.get(x, y) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPaperColors(t *testing.T) {
+	p := newPaper(PanelConfig{}, PanelTuning{})
+	p.Clear()
+	p.Set(1, 1, color.Black)
+	p.Set(2, 1, colorRed)
+	p.Set(3, 1, color.White)
+	for _, test := range []struct {
+		x    int
+		want paperColor
+	}{
+		{0, colWhite},
+		{1, colBlack},
+		{2, colRed},
+		{3, colWhite},
+	} {
+		if got := pickColor(p.At(test.x, 1)); got != test.want {
+			t.Errorf("At(%d, 1) = %v, want %v", test.x, got, test.want)
+		}
+	}
+}
+
+func TestBWPaperColors(t *testing.T) {
+	p := bwPaper{newPaper(PanelConfig{}, PanelTuning{})}
+	p.Clear()
+	p.Set(1, 1, color.Black)
+	p.Set(2, 1, colorRed)
+	p.Set(3, 1, color.White)
+	for _, test := range []struct {
+		x    int
+		want paperColor
+	}{
+		{0, colWhite},
+		{1, colBlack},
+		{2, colBlack}, // no red
+		{3, colWhite},
+	} {
+		if got := pickColor(p.At(test.x, 1)); got != test.want {
+			t.Errorf("At(%d, 1) = %v, want %v", test.x, got, test.want)
+		}
+	}
+	if !p.red.isAll(0) {
+		t.Errorf("Red plane was drawn in")
+	}
+}
+
+func TestPaperSleepWhenDetached(t *testing.T) {
+	// With SPI shut down, as between refreshes in power save mode,
+	// sleeping must not try to talk to the panel; here that would crash.
+	p := newPaper(PanelConfig{}, PanelTuning{})
+	p.powerSave = true
+	if p.attached() {
+		t.Fatalf("New paper is attached before starting")
+	}
+	p.Sleep()
+	p.detach()
+}
+
+func TestPaperRotation(t *testing.T) {
+	p := newPaper(PanelConfig{Rotation: 90}, PanelTuning{})
+	if got, want := p.Bounds(), image.Rect(0, 0, 480, 800); got != want {
+		t.Fatalf("Bounds = %v, want %v", got, want)
+	}
+	p.Clear()
+	p.Set(479, 0, color.Black) // top right as drawn is the controller's first pixel
+	if p.bw.get(0, 0) {
+		t.Errorf("Top right pixel as drawn isn't the first pixel natively")
+	}
+	if got := pickColor(p.At(479, 0)); got != colBlack {
+		t.Errorf("At(479, 0) = %v, want black", got)
+	}
+
+	// The recorded planes, as served and mirrored, are as drawn too.
+	p.recordFrame()
+	for _, img := range []*image.Paletted{p.Plane("bw"), bwPaper{p}.Plane("bw")} {
+		if got, want := img.Bounds(), p.Bounds(); got != want {
+			t.Errorf("Plane bounds = %v, want %v", got, want)
+			continue
+		}
+		if img.ColorIndexAt(479, 0) != 0 || img.ColorIndexAt(0, 0) != 1 {
+			t.Errorf("Plane isn't in the drawn orientation")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// Tracking of panel refreshes, since e-paper panels have a limited lifetime.
+
+import (
+	"log"
+	"time"
+)
+
+// panelWear is a summary of panel refreshes.
+type panelWear struct {
+	Refreshes      int `json:"refreshes"`       // lifetime full refreshes
+	RefreshesToday int `json:"refreshes_today"` // full refreshes so far today
+	DailyBudget    int `json:"daily_budget,omitempty"`
+}
+
+// recordRefresh counts a full panel refresh in the persistent state,
+// and warns when the day's refreshes exceed budget (if positive).
+func recordRefresh(state *stateStore, budget int, now time.Time) panelWear {
+	day := now.Format("2006-01-02")
+	var pw panelWear
+	err := state.Update(func(st *State) {
+		st.PanelRefreshes++
+		if st.RefreshDay != day {
+			st.RefreshDay = day
+			st.RefreshesToday = 0
+		}
+		st.RefreshesToday++
+		pw = panelWear{
+			Refreshes:      st.PanelRefreshes,
+			RefreshesToday: st.RefreshesToday,
+			DailyBudget:    budget,
+		}
+	})
+	if err != nil {
+		log.Printf("Saving refresh count: %v", err)
+	}
+	if budget > 0 && pw.RefreshesToday == budget+1 {
+		// Only warn once a day.
+		log.Printf("WARNING: Panel has refreshed %d times today, over the budget of %d; consider a longer refresh_period", pw.RefreshesToday, budget)
+	}
+	return pw
+}
+
+// currentWear reports the refresh counts as of now.
+func currentWear(state *stateStore, budget int, now time.Time) panelWear {
+	pw := panelWear{DailyBudget: budget}
+	state.View(func(st *State) {
+		pw.Refreshes = st.PanelRefreshes
+		if st.RefreshDay == now.Format("2006-01-02") {
+			pw.RefreshesToday = st.RefreshesToday
+		}
+	})
+	return pw
+}
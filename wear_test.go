@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordRefresh(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadState(filename)
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+
+	day1 := time.Date(2024, time.June, 12, 9, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		recordRefresh(state, 2, day1.Add(time.Duration(i)*time.Hour))
+	}
+	if got, want := currentWear(state, 2, day1), (panelWear{3, 3, 2}); got != want {
+		t.Errorf("After day 1: %+v, want %+v", got, want)
+	}
+
+	// Counts should survive a restart, and the daily count should reset.
+	state, err = loadState(filename)
+	if err != nil {
+		t.Fatalf("Reloading state: %v", err)
+	}
+	day2 := day1.AddDate(0, 0, 1)
+	if got, want := currentWear(state, 2, day2), (panelWear{3, 0, 2}); got != want {
+		t.Errorf("Start of day 2: %+v, want %+v", got, want)
+	}
+	if got, want := recordRefresh(state, 2, day2), (panelWear{4, 1, 2}); got != want {
+		t.Errorf("After refresh on day 2: %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+// Hints on tasks that depend on the weather, such as an umbrella on the laundry
+// when it's likely to rain. The weather comes from Home Assistant sensors.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+type WeatherConfig struct {
+	// RainProbability is a Home Assistant sensor whose state is
+	// the chance of rain as a percentage, such as today's forecast.
+	RainProbability string `yaml:"rain_probability"`
+	// Temperature is a Home Assistant sensor whose state is
+	// a temperature, such as today's forecast maximum.
+	Temperature string `yaml:"temperature"`
+
+	Hints []WeatherHintConfig `yaml:"hints"`
+
+	// Forecast shows the current conditions and today's forecast beside the date; see forecast.go.
+	Forecast ForecastConfig `yaml:"forecast"`
+}
+
+// WeatherHintConfig annotates matching tasks with a glyph when the weather conditions hold.
+// All the conditions that are set must hold, and at least one must be set.
+type WeatherHintConfig struct {
+	Match string `yaml:"match"` // regexp matched against task titles; case insensitive
+	Glyph string `yaml:"glyph"` // e.g. "☂"; "*" is shown instead if the font can't draw it
+
+	RainAbove *float64 `yaml:"rain_above"` // percent
+	TempAbove *float64 `yaml:"temp_above"`
+	TempBelow *float64 `yaml:"temp_below"`
+}
+
+// sensors reports whether any weather sensors are configured.
+func (wc WeatherConfig) sensors() bool {
+	return wc.RainProbability != "" || wc.Temperature != ""
+}
+
+// messagesUseWeather reports whether any of messages have weather conditions.
+func messagesUseWeather(messages []message) bool {
+	for _, m := range messages {
+		if m.usesWeather() {
+			return true
+		}
+	}
+	return false
+}
+
+// weatherHintAlt is shown for a hint glyph that the font can't draw.
+const weatherHintAlt = "*"
+
+type weatherHint struct {
+	WeatherHintConfig
+	re *regexp.Regexp
+}
+
+func parseWeatherHints(cfg WeatherConfig) ([]weatherHint, error) {
+	var hints []weatherHint
+	for i, hc := range cfg.Hints {
+		if hc.Glyph == "" {
+			return nil, fmt.Errorf("hint %d has no glyph", i+1)
+		}
+		if hc.RainAbove == nil && hc.TempAbove == nil && hc.TempBelow == nil {
+			return nil, fmt.Errorf("hint %d has no conditions", i+1)
+		}
+		if hc.RainAbove != nil && cfg.RainProbability == "" {
+			return nil, fmt.Errorf("hint %d uses rain_above without a rain_probability sensor", i+1)
+		}
+		if (hc.TempAbove != nil || hc.TempBelow != nil) && cfg.Temperature == "" {
+			return nil, fmt.Errorf("hint %d uses a temperature without a temperature sensor", i+1)
+		}
+		re, err := regexp.Compile("(?i)" + hc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("hint %d has bad match pattern: %w", i+1, err)
+		}
+		hints = append(hints, weatherHint{hc, re})
+	}
+	return hints, nil
+}
+
+// weather is the current weather. Fields are nil if their sensor isn't configured.
+type weather struct {
+	Rain *float64 // percent
+	Temp *float64
+}
+
+// holds reports whether the weather satisfies the hint's conditions.
+func (wh weatherHint) holds(w weather) bool {
+	return weatherHolds(w, wh.RainAbove, wh.TempAbove, wh.TempBelow)
+}
+
+// weatherHolds reports whether the weather satisfies the conditions that are set.
+// Conditions on weather that isn't known don't hold.
+func weatherHolds(w weather, rainAbove, tempAbove, tempBelow *float64) bool {
+	if rainAbove != nil && (w.Rain == nil || *w.Rain <= *rainAbove) {
+		return false
+	}
+	if tempAbove != nil && (w.Temp == nil || *w.Temp <= *tempAbove) {
+		return false
+	}
+	if tempBelow != nil && (w.Temp == nil || *w.Temp >= *tempBelow) {
+		return false
+	}
+	return true
+}
+
+// messageWeather is the weather to match messages against: from the weather sensors,
+// with anything they don't give filled in from today's forecast.
+func (dd displayData) messageWeather() weather {
+	w := dd.weather
+	fc := dd.forecast
+	if fc == nil {
+		return w
+	}
+	if w.Rain == nil && fc.HasDaily {
+		rain := float64(fc.Rain)
+		w.Rain = &rain
+	}
+	if w.Temp == nil {
+		temp := float64(fc.Temp)
+		if fc.HasDaily {
+			temp = float64(fc.High)
+		}
+		w.Temp = &temp
+	}
+	return w
+}
+
+// fetchWeather gets the current weather from the configured sensors.
+func fetchWeather(ctx context.Context, hass *HASS, cfg WeatherConfig) (weather, error) {
+	var w weather
+	for _, s := range []struct {
+		entity string
+		dst    **float64
+	}{
+		{cfg.RainProbability, &w.Rain},
+		{cfg.Temperature, &w.Temp},
+	} {
+		if s.entity == "" {
+			continue
+		}
+		v, err := hass.NumericState(ctx, s.entity)
+		if err != nil {
+			return weather{}, err
+		}
+		*s.dst = &v
+	}
+	return w, nil
+}
+
+// applyWeatherHints annotates the tasks with the glyphs of the hints that match them.
+// Only top-level tasks are annotated.
+func applyWeatherHints(tasks []renderableTask, hints []weatherHint, w weather) {
+	for _, wh := range hints {
+		if !wh.holds(w) {
+			continue
+		}
+		for i := range tasks {
+			if wh.re.MatchString(tasks[i].Title) && !hasHint(tasks[i].Hints, wh.Glyph) {
+				tasks[i].Hints = append(tasks[i].Hints, wh.Glyph)
+			}
+		}
+	}
+}
+
+func hasHint(hints []string, glyph string) bool {
+	for _, h := range hints {
+		if h == glyph {
+			return true
+		}
+	}
+	return false
+}
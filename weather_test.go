@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestWeatherHints(t *testing.T) {
+	states := map[string]string{
+		"sensor.rain": "75",
+		"sensor.temp": "31.5",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"state": %q}`, states[strings.TrimPrefix(r.URL.Path, "/api/states/")])
+	}))
+	defer srv.Close()
+	hass := NewHASS(HASSConfig{URL: srv.URL})
+
+	sixty, thirty, five := 60.0, 30.0, 5.0
+	cfg := WeatherConfig{
+		RainProbability: "sensor.rain",
+		Temperature:     "sensor.temp",
+		Hints: []WeatherHintConfig{
+			{Match: "washing|laundry", Glyph: "☂", RainAbove: &sixty},
+			{Match: "plants", Glyph: "☀", TempAbove: &thirty},
+			{Match: "plants|laundry", Glyph: "❄", TempBelow: &five},
+		},
+	}
+	hints, err := parseWeatherHints(cfg)
+	if err != nil {
+		t.Fatalf("parseWeatherHints: %v", err)
+	}
+	w, err := fetchWeather(context.Background(), hass, cfg)
+	if err != nil {
+		t.Fatalf("fetchWeather: %v", err)
+	}
+	tasks := []renderableTask{
+		{Title: "Hang out the Washing"},
+		{Title: "Water the plants"},
+		{Title: "Vacuum"},
+	}
+	applyWeatherHints(tasks, hints, w)
+	applyWeatherHints(tasks, hints, w) // shouldn't duplicate
+	var got [][]string
+	for _, task := range tasks {
+		got = append(got, task.Hints)
+	}
+	want := [][]string{{"☂"}, {"☀"}, nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Hints = %q, want %q", got, want)
+	}
+
+	states["sensor.temp"] = "unavailable"
+	if _, err := fetchWeather(context.Background(), hass, cfg); err == nil {
+		t.Errorf("fetchWeather with unavailable temperature didn't fail")
+	}
+}
+
+func TestParseWeatherHintsErrors(t *testing.T) {
+	sixty := 60.0
+	tests := []WeatherConfig{
+		{RainProbability: "sensor.rain", Hints: []WeatherHintConfig{{Match: "x", RainAbove: &sixty}}},
+		{RainProbability: "sensor.rain", Hints: []WeatherHintConfig{{Match: "x", Glyph: "☂"}}},
+		{Hints: []WeatherHintConfig{{Match: "x", Glyph: "☂", RainAbove: &sixty}}},
+		{Temperature: "sensor.temp", Hints: []WeatherHintConfig{{Match: "x", Glyph: "☂", RainAbove: &sixty}}},
+		{RainProbability: "sensor.rain", Hints: []WeatherHintConfig{{Match: "(", Glyph: "☂", RainAbove: &sixty}}},
+	}
+	for _, test := range tests {
+		if _, err := parseWeatherHints(test); err == nil {
+			t.Errorf("parseWeatherHints(%+v) succeeded, want error", test)
+		}
+	}
+}
+
+func TestWeatherMessages(t *testing.T) {
+	zero, sixty, thirty := 0, 60.0, 30.0
+	messages := []message{
+		{Eq: &zero, Options: []string{"All done!"}},
+		{RainAbove: &sixty, Options: []string{"Take the washing in!"}},
+		{TempAbove: &thirty, Options: []string{"Hot one today"}},
+		{Options: []string{"Things to do"}},
+	}
+	pick := func(dd displayData) string {
+		if i := matchingMessage(messages, dd); i >= 0 {
+			return messages[i].Options[0]
+		}
+		return ""
+	}
+	rain, cool := 80.0, 20.0
+	tasks := []renderableTask{{Title: "x"}}
+	tests := []struct {
+		dd   displayData
+		want string
+	}{
+		{displayData{tasks: tasks}, "Things to do"},
+		{displayData{}, "All done!"},
+		{displayData{tasks: tasks, weather: weather{Rain: &rain}}, "Take the washing in!"},
+		// The forecast fills in for missing sensors.
+		{displayData{tasks: tasks, forecast: &forecast{Temp: 25, HasDaily: true, High: 33, Rain: 10}}, "Hot one today"},
+		{displayData{tasks: tasks, forecast: &forecast{Temp: 33}}, "Hot one today"},
+		{displayData{tasks: tasks, weather: weather{Temp: &cool}, forecast: &forecast{Temp: 33, HasDaily: true, High: 33, Rain: 70}}, "Take the washing in!"},
+		{displayData{tasks: tasks, weather: weather{Temp: &cool}, forecast: &forecast{Temp: 33, HasDaily: true, High: 33}}, "Things to do"},
+	}
+	for i, test := range tests {
+		if got := pick(test.dd); got != test.want {
+			t.Errorf("Test %d: picked %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestWeatherEqual(t *testing.T) {
+	thirty := 30.0
+	messages := []message{
+		{TempAbove: &thirty, Options: []string{"Hot one today"}},
+		{Options: []string{"Things to do"}},
+	}
+	at := func(temp float64) displayData {
+		dd := displayData{weather: weather{Temp: &temp}}
+		dd.message = matchingMessage(messages, dd)
+		return dd
+	}
+	if !at(20.1).Equal(at(20.2)) {
+		t.Errorf("A small change in temperature that doesn't change the message isn't Equal")
+	}
+	if at(29.9).Equal(at(30.1)) {
+		t.Errorf("A change in temperature that changes the message is Equal")
+	}
+}
+
+func TestNoMatchingMessage(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	if err := ioutil.WriteFile(fontFile, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Without any weather, as when the sensors fail, no message matches.
+	thirty := 30.0
+	cfg := Config{
+		Font:     fontFile,
+		Messages: []message{{TempAbove: &thirty, Options: []string{"Hot one today"}}},
+	}
+	rend, err := newRenderer(cfg, func() (string, error) { return "", nil })
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+	data := displayData{
+		today: time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local),
+		now:   time.Date(2024, time.June, 12, 9, 30, 0, 0, time.Local),
+		tasks: []renderableTask{{Priority: 4, Title: "Take out bins", Project: "House"}},
+	}
+	rend.Render(image.NewRGBA(image.Rect(0, 0, 800, 480)), data) // must not panic
+}
@@ -0,0 +1,181 @@
+package main
+
+// A small set of weather icons, as bitmaps, so they look the same whatever font is configured.
+// Each row is a string, with '#' for a set pixel.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+type glyphBitmap []string
+
+// weatherIcons has an icon for each condition that a forecast may have.
+var weatherIcons = map[string]glyphBitmap{
+	"clear": {
+		".......##.......",
+		".......##.......",
+		"..##........##..",
+		"..###......###..",
+		"......####......",
+		".....######.....",
+		"....########....",
+		"##..########..##",
+		"##..########..##",
+		"....########....",
+		".....######.....",
+		"......####......",
+		"..###......###..",
+		"..##........##..",
+		".......##.......",
+		".......##.......",
+	},
+	"partlycloudy": {
+		"..........#.....",
+		".......#.....#..",
+		".........###....",
+		"........#####.##",
+		".....##.#####...",
+		"....#####.###...",
+		"..#########..#..",
+		".###########....",
+		".############...",
+		"##############..",
+		"###############.",
+		"################",
+		".##############.",
+		"................",
+		"................",
+		"................",
+	},
+	"cloudy": {
+		"................",
+		"................",
+		"................",
+		"......####......",
+		"....########....",
+		"...##########...",
+		"..############..",
+		".##############.",
+		"################",
+		"################",
+		".##############.",
+		"................",
+		"................",
+		"................",
+		"................",
+		"................",
+	},
+	"fog": {
+		"................",
+		"................",
+		"..############..",
+		"................",
+		"................",
+		".##############.",
+		"................",
+		"................",
+		"..############..",
+		"................",
+		"................",
+		".##############.",
+		"................",
+		"................",
+		"..############..",
+		"................",
+	},
+	"rain": {
+		"......####......",
+		"....########....",
+		"...##########...",
+		"..############..",
+		".##############.",
+		"################",
+		"################",
+		".##############.",
+		"................",
+		"...#....#....#..",
+		"..#....#....#...",
+		"................",
+		"....#....#....#.",
+		"...#....#....#..",
+		"................",
+		"................",
+	},
+	"snow": {
+		"......####......",
+		"....########....",
+		"...##########...",
+		"..############..",
+		".##############.",
+		"################",
+		"################",
+		".##############.",
+		"................",
+		"...#.....#......",
+		"..###...###.....",
+		"...#.....#...#..",
+		".......#....###.",
+		"......###....#..",
+		".......#........",
+		"................",
+	},
+	"storm": {
+		"......####......",
+		"....########....",
+		"...##########...",
+		"..############..",
+		".##############.",
+		"#######..#######",
+		"######..########",
+		".####..########.",
+		"......######....",
+		".........##.....",
+		"........##......",
+		".......##.......",
+		"......#.........",
+		"................",
+		"................",
+		"................",
+	},
+}
+
+// rainDropIcon marks the chance of precipitation.
+var rainDropIcon = glyphBitmap{
+	"...#....",
+	"...#....",
+	"..###...",
+	"..###...",
+	".#####..",
+	".#####..",
+	".#####..",
+	"..###...",
+}
+
+// drawGlyph draws a bitmap in a colour, scaled to fit in box and centred there.
+func drawGlyph(dst draw.Image, box image.Rectangle, col color.Color, g glyphBitmap) {
+	if len(g) == 0 {
+		return
+	}
+	gw, gh := len(g[0]), len(g)
+	// Scale by whole pixels if it fits, so that lines stay even.
+	scale := min(box.Dx()/gw, box.Dy()/gh)
+	w, h := gw*scale, gh*scale
+	if scale == 0 {
+		side := min(box.Dx(), box.Dy())
+		w, h = side*gw/max(gw, gh), side*gh/max(gw, gh)
+	}
+	if w <= 0 || h <= 0 {
+		return
+	}
+	origin := box.Min.Add(image.Pt((box.Dx()-w)/2, (box.Dy()-h)/2))
+	for y := 0; y < h; y++ {
+		row := g[y*gh/h]
+		for x := 0; x < w; x++ {
+			if row[x*gw/w] == '#' {
+				dst.Set(origin.X+x, origin.Y+y, col)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+// Outgoing webhook, for simple consumers that don't speak MQTT.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// webhookPayload is the JSON body POSTed to the webhook.
+type webhookPayload struct {
+	Today      string         `json:"today"`
+	Tasks      []apiTask      `json:"tasks"`
+	Alerts     []webhookAlert `json:"alerts"`
+	Accessible bool           `json:"accessibility_mode"`
+}
+
+type webhookAlert struct {
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+}
+
+// webhookPoster POSTs to the webhook in the background,
+// so a slow or unreachable endpoint doesn't hold up the display.
+// Only the newest payload waits to be sent; older unsent ones are dropped.
+type webhookPoster struct {
+	url  string
+	next chan []byte // capacity 1
+}
+
+func startWebhookPoster(ctx context.Context, url string) *webhookPoster {
+	wp := &webhookPoster{
+		url:  url,
+		next: make(chan []byte, 1),
+	}
+	go wp.run(ctx)
+	return wp
+}
+
+// Post queues the display data to be sent, replacing any payload not yet sent.
+// It is safe to call on a nil *webhookPoster.
+func (wp *webhookPoster) Post(data displayData) {
+	if wp == nil {
+		return
+	}
+	body, err := webhookBody(data)
+	if err != nil {
+		log.Printf("Webhook: %v", err)
+		return
+	}
+	for {
+		select {
+		case wp.next <- body:
+			return
+		default:
+		}
+		// Full; drop the stale payload and try again.
+		select {
+		case <-wp.next:
+		default:
+		}
+	}
+}
+
+func (wp *webhookPoster) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-wp.next:
+			if err := postWebhookBody(ctx, wp.url, body); err != nil {
+				log.Printf("Webhook: %v", err)
+			}
+		}
+	}
+}
+
+// postWebhook POSTs the display data as JSON to url.
+func postWebhook(ctx context.Context, url string, data displayData) error {
+	body, err := webhookBody(data)
+	if err != nil {
+		return err
+	}
+	return postWebhookBody(ctx, url, body)
+}
+
+func webhookBody(data displayData) ([]byte, error) {
+	payload := webhookPayload{
+		Today:      data.today.Format("2006-01-02"),
+		Tasks:      []apiTask{}, // not null
+		Alerts:     []webhookAlert{},
+		Accessible: data.accessible,
+	}
+	for _, task := range data.tasks {
+		payload.Tasks = append(payload.Tasks, newAPITask(task))
+	}
+	for _, a := range data.alerts {
+		payload.Alerts = append(payload.Alerts, webhookAlert{a.Summary, a.Description})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding payload: %w", err)
+	}
+	return body, nil
+}
+
+func postWebhookBody(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("internal error: constructing http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP POST: %w", err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("non-2xx response: %s", resp.Status)
+	}
+	return nil
+}
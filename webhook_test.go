@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostWebhook(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Webhook method = %s, want POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Decoding webhook body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	data := displayData{
+		today: time.Date(2024, time.June, 12, 0, 0, 0, 0, time.Local),
+		tasks: []renderableTask{{Priority: 4, Title: "Take out bins", Project: "House", Subtasks: []renderableTask{
+			{Priority: 4, Title: "Rinse recycling", Project: "House", PowerHungry: true},
+		}}},
+		alerts: []Alert{{Fingerprint: "abc", Summary: "Fridge", Description: "Door open"}},
+	}
+	if err := postWebhook(context.Background(), srv.URL, data); err != nil {
+		t.Fatalf("postWebhook: %v", err)
+	}
+	if got.Today != "2024-06-12" || len(got.Tasks) != 1 || got.Tasks[0].Title != "Take out bins" || len(got.Alerts) != 1 {
+		t.Errorf("Webhook got %+v", got)
+	}
+	if len(got.Tasks) == 1 && (len(got.Tasks[0].Subtasks) != 1 || !got.Tasks[0].Subtasks[0].PowerHungry) {
+		t.Errorf("Webhook got subtasks %+v, want the power-hungry subtask", got.Tasks[0].Subtasks)
+	}
+
+	srv.Config.Handler = http.NotFoundHandler()
+	if err := postWebhook(context.Background(), srv.URL, data); err == nil {
+		t.Errorf("postWebhook succeeded with a 404 response")
+	}
+}
+
+func TestWebhookPosterDropsStale(t *testing.T) {
+	release := make(chan struct{})
+	got := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("Decoding webhook body: %v", err)
+		}
+		got <- p.Today
+		<-release // a slow endpoint
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wp := startWebhookPoster(ctx, srv.URL)
+
+	day := func(d int) displayData {
+		return displayData{today: time.Date(2024, time.June, d, 0, 0, 0, 0, time.Local)}
+	}
+	wp.Post(day(1))
+	if first := <-got; first != "2024-06-01" {
+		t.Fatalf("First webhook was for %s, want 2024-06-01", first)
+	}
+	// The endpoint is stuck on the first; these must not block, and only the last should be sent.
+	done := make(chan struct{})
+	go func() {
+		for d := 2; d <= 5; d++ {
+			wp.Post(day(d))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Post blocked on a slow webhook endpoint")
+	}
+	release <- struct{}{}
+	if next := <-got; next != "2024-06-05" {
+		t.Errorf("Second webhook was for %s, want 2024-06-05", next)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+// Translations of the web UI, since not everyone in a household reads English.
+// Each page is in the browser's preferred language, if there are translations for it,
+// or otherwise in the language of the configured locale.
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webMessages are the translations of the web UI's messages, by language and then by
+// the English message. Messages may be formats, as for fmt.Sprintf.
+var webMessages = map[string]map[string]string{
+	"de": {
+		"Hi. I've been running for %v.":           "Hallo. Ich laufe seit %v.",
+		"The panel was last flushed to white %v.": "Das Display wurde zuletzt %v ganz weiß aufgefrischt.",
+		"not since startup":                       "nicht seit dem Start",
+		"%v ago":                                  "vor %v",
+		"MQTT is disconnected":                    "MQTT ist getrennt",
+		"(%d updates queued, %d dropped).":        "(%d Aktualisierungen in der Warteschlange, %d verworfen).",
+		"Notes to show on the display:":           "Notizen für das Display:",
+		"Save notes":                              "Notizen speichern",
+		"Next photo to use:":                      "Nächstes Foto:",
+		"Set":                                     "Festlegen",
+		"Manage photos":                           "Fotos verwalten",
+		"Show this photo":                         "Dieses Foto zeigen",
+		"from":                                    "vom",
+		"to":                                      "bis",
+		"Schedule":                                "Einplanen",
+		"Show this image instead of everything else": "Dieses Bild statt allem anderen zeigen",
+		"for":          "für",
+		"minutes":      "Minuten",
+		"Show":         "Zeigen",
+		"Stop showing": "Nicht mehr zeigen",
+		"Uploaded images appear from the next refresh.": "Hochgeladene Bilder erscheinen ab der nächsten Aktualisierung.",
+		"Alerts":       "Warnungen",
+		"Alertmanager": "Alertmanager",
+		"Status":       "Status",
+		"Last worked":  "Zuletzt funktioniert",
+		"OK":           "OK",
+		"never":        "nie",
+		"Preview":      "Vorschau",
+		"Photos":       "Fotos",
+		"Tasks":        "Aufgaben",
+		"Logs":         "Protokoll",
+		"Nothing has been sent to the panel yet.": "Es wurde noch nichts an das Display gesendet.",
+		"Nothing to do.": "Nichts zu tun.",
+	},
+	"es": {
+		"Hi. I've been running for %v.":           "Hola. Llevo funcionando %v.",
+		"The panel was last flushed to white %v.": "La pantalla se limpió en blanco por última vez %v.",
+		"not since startup":                       "no desde el arranque",
+		"%v ago":                                  "hace %v",
+		"MQTT is disconnected":                    "MQTT está desconectado",
+		"(%d updates queued, %d dropped).":        "(%d actualizaciones en cola, %d descartadas).",
+		"Notes to show on the display:":           "Notas para mostrar en la pantalla:",
+		"Save notes":                              "Guardar notas",
+		"Next photo to use:":                      "Próxima foto:",
+		"Set":                                     "Elegir",
+		"Manage photos":                           "Gestionar fotos",
+		"Show this photo":                         "Mostrar esta foto",
+		"from":                                    "desde",
+		"to":                                      "hasta",
+		"Schedule":                                "Programar",
+		"Show this image instead of everything else": "Mostrar esta imagen en lugar de todo lo demás",
+		"for":          "durante",
+		"minutes":      "minutos",
+		"Show":         "Mostrar",
+		"Stop showing": "Dejar de mostrar",
+		"Uploaded images appear from the next refresh.": "Las imágenes subidas aparecen a partir de la próxima actualización.",
+		"Alerts":       "Alertas",
+		"Alertmanager": "Alertmanager",
+		"Status":       "Estado",
+		"Last worked":  "Último funcionamiento",
+		"OK":           "OK",
+		"never":        "nunca",
+		"Preview":      "Vista previa",
+		"Photos":       "Fotos",
+		"Tasks":        "Tareas",
+		"Logs":         "Registro",
+		"Nothing has been sent to the panel yet.": "Todavía no se ha enviado nada a la pantalla.",
+		"Nothing to do.": "Nada que hacer.",
+	},
+	"fr": {
+		"Hi. I've been running for %v.":           "Bonjour. Je tourne depuis %v.",
+		"The panel was last flushed to white %v.": "L'écran a été rafraîchi en blanc pour la dernière fois %v.",
+		"not since startup":                       "pas depuis le démarrage",
+		"%v ago":                                  "il y a %v",
+		"MQTT is disconnected":                    "MQTT est déconnecté",
+		"(%d updates queued, %d dropped).":        "(%d mises à jour en attente, %d abandonnées).",
+		"Notes to show on the display:":           "Notes à afficher sur l'écran :",
+		"Save notes":                              "Enregistrer les notes",
+		"Next photo to use:":                      "Prochaine photo :",
+		"Set":                                     "Choisir",
+		"Manage photos":                           "Gérer les photos",
+		"Show this photo":                         "Afficher cette photo",
+		"from":                                    "du",
+		"to":                                      "au",
+		"Schedule":                                "Programmer",
+		"Show this image instead of everything else": "Afficher cette image à la place de tout le reste",
+		"for":          "pendant",
+		"minutes":      "minutes",
+		"Show":         "Afficher",
+		"Stop showing": "Arrêter l'affichage",
+		"Uploaded images appear from the next refresh.": "Les images envoyées apparaissent à partir du prochain rafraîchissement.",
+		"Alerts":       "Alertes",
+		"Alertmanager": "Alertmanager",
+		"Status":       "État",
+		"Last worked":  "Dernier succès",
+		"OK":           "OK",
+		"never":        "jamais",
+		"Preview":      "Aperçu",
+		"Photos":       "Photos",
+		"Tasks":        "Tâches",
+		"Logs":         "Journal",
+		"Nothing has been sent to the panel yet.": "Rien n'a encore été envoyé à l'écran.",
+		"Nothing to do.": "Rien à faire.",
+	},
+	"nl": {
+		"Hi. I've been running for %v.":           "Hallo. Ik draai al %v.",
+		"The panel was last flushed to white %v.": "Het scherm is voor het laatst %v wit gemaakt.",
+		"not since startup":                       "niet sinds het opstarten",
+		"%v ago":                                  "%v geleden",
+		"MQTT is disconnected":                    "MQTT is niet verbonden",
+		"(%d updates queued, %d dropped).":        "(%d updates in de wachtrij, %d weggegooid).",
+		"Notes to show on the display:":           "Notities op het scherm:",
+		"Save notes":                              "Notities opslaan",
+		"Next photo to use:":                      "Volgende foto:",
+		"Set":                                     "Instellen",
+		"Manage photos":                           "Foto's beheren",
+		"Show this photo":                         "Toon deze foto",
+		"from":                                    "van",
+		"to":                                      "tot",
+		"Schedule":                                "Inplannen",
+		"Show this image instead of everything else": "Toon deze afbeelding in plaats van al het andere",
+		"for":          "gedurende",
+		"minutes":      "minuten",
+		"Show":         "Tonen",
+		"Stop showing": "Stoppen met tonen",
+		"Uploaded images appear from the next refresh.": "Geüploade afbeeldingen verschijnen vanaf de volgende verversing.",
+		"Alerts":       "Meldingen",
+		"Alertmanager": "Alertmanager",
+		"Status":       "Status",
+		"Last worked":  "Laatst gewerkt",
+		"OK":           "OK",
+		"never":        "nooit",
+		"Preview":      "Voorbeeld",
+		"Photos":       "Foto's",
+		"Tasks":        "Taken",
+		"Logs":         "Logboek",
+		"Nothing has been sent to the panel yet.": "Er is nog niets naar het scherm gestuurd.",
+		"Nothing to do.": "Niets te doen.",
+	},
+}
+
+// webTranslator translates the web UI into a language.
+type webTranslator struct {
+	lang     string
+	messages map[string]string // nil for English
+	phrases  timePhrases
+}
+
+func newWebTranslator(lang string) webTranslator {
+	wt := webTranslator{lang: lang, messages: webMessages[lang]}
+	wt.phrases, _ = lookupLocale(lang)
+	if wt.phrases.clock == "" {
+		// No relative time phrases in this language.
+		wt.phrases = timeLocales[defaultLocale]
+	}
+	return wt
+}
+
+// T translates a message, and formats it with args as for fmt.Sprintf.
+// Messages without translations are left in English.
+func (wt webTranslator) T(msg string, args ...interface{}) string {
+	if tr, ok := wt.messages[msg]; ok {
+		msg = tr
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Date formats a date like "Mon 2 Jan", in the translator's language.
+func (wt webTranslator) Date(t time.Time) string {
+	return fmt.Sprintf("%s %d %s", wt.phrases.weekdays[t.Weekday()], t.Day(), wt.phrases.months[t.Month()-1])
+}
+
+func (wt webTranslator) funcs() template.FuncMap {
+	return template.FuncMap{
+		"T":    wt.T,
+		"date": wt.Date,
+		"lang": func() string { return wt.lang },
+	}
+}
+
+// webLanguage picks the language of the web UI: the first in an Accept-Language header
+// that it can be shown in, or else that of the configured locale, or else English.
+func webLanguage(acceptLanguage, locale string) string {
+	type pref struct {
+		lang string
+		q    float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if lang != "" && q > 0 {
+			prefs = append(prefs, pref{lang, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, p := range prefs {
+		if _, ok := webMessages[p.lang]; ok || p.lang == defaultLocale {
+			return p.lang
+		}
+	}
+	if lang, _, _ := strings.Cut(strings.ToLower(locale), "-"); webMessages[lang] != nil {
+		return lang
+	}
+	return defaultLocale
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebLanguage(t *testing.T) {
+	tests := []struct {
+		accept, locale string
+		want           string
+	}{
+		{"", "", "en"},
+		{"", "de", "de"},
+		{"", "fr-CA", "fr"},
+		{"", "ja", "en"},
+		{"nl-NL,nl;q=0.9,en;q=0.8", "", "nl"},
+		{"ja,fr;q=0.5", "de", "fr"},        // no Japanese, so the next preference
+		{"en;q=0.5,es;q=0.9", "de", "es"},  // by quality, not order
+		{"en-AU,en;q=0.9", "de", "en"},     // English is always available
+		{"ja", "de", "de"},                 // nothing acceptable, so the configured locale
+		{"de;q=0,fr", "", "fr"},            // q=0 means not acceptable
+		{" es-419 ; q=0.7 , ja", "", "es"}, // spacing
+		{"*", "nl", "nl"},                  // a wildcard says nothing useful
+		{"de;q=bogus", "", "de"},           // bad quality values count as 1
+		{"x-klingon,en-GB", "fr", "en"},    // unknown languages are skipped
+		{"", "DE-at", "de"},                // locale case doesn't matter
+		{"FR-fr", "", "fr"},                // nor does Accept-Language case
+		{"zh-Hant-TW;q=0.8,nl;q=0.1", "", "nl"},
+	}
+	for _, test := range tests {
+		if got := webLanguage(test.accept, test.locale); got != test.want {
+			t.Errorf("webLanguage(%q, %q) = %q, want %q", test.accept, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestWebMessagesComplete(t *testing.T) {
+	// Every message in the front page, and those made in Go, should be translated, and nothing else.
+	used := map[string]bool{"not since startup": true, "%v ago": true}
+	for _, m := range regexp.MustCompile(`\{\{T "([^"]*)"`).FindAllStringSubmatch(frontHTML, -1) {
+		used[m[1]] = true
+	}
+	for lang, msgs := range webMessages {
+		for msg := range used {
+			if _, ok := msgs[msg]; !ok {
+				t.Errorf("%s has no translation of %q", lang, msg)
+			}
+		}
+		for msg, tr := range msgs {
+			if !used[msg] {
+				t.Errorf("%s translates unused message %q", lang, msg)
+			}
+			if strings.Count(msg, "%") != strings.Count(tr, "%") {
+				t.Errorf("%s translation of %q has different arguments: %q", lang, msg, tr)
+			}
+		}
+	}
+}
+
+func TestServeFrontTranslated(t *testing.T) {
+	state, _ := loadState("")
+	s := &server{state: state, startTime: time.Now()}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{`<html lang="de">`, "Notizen speichern", "Hallo. Ich laufe seit 0s."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("German front page does not contain %q", want)
+		}
+	}
+	if got := rec.Header().Values("Vary"); !strings.Contains(strings.Join(got, ","), "Accept-Language") {
+		t.Errorf("Front page varies by %q, want Accept-Language included", got)
+	}
+
+	if got := newWebTranslator("fr").Date(time.Date(2024, time.June, 12, 0, 0, 0, 0, time.UTC)); got != "mer. 12 juin" {
+		t.Errorf("French date = %q, want %q", got, "mer. 12 juin")
+	}
+}